@@ -20,7 +20,7 @@ package commonflags
 
 import (
 	"fmt"
-	"path"
+	"runtime"
 	"strings"
 )
 
@@ -28,8 +28,8 @@ const (
 	CcompilersDefault = "clang-5.0,gcc"
 	CcompilersUsage   = `comma-separated list of C compilers`
 
-	CformatterDefault = "clang-format-5.0"
-	CformatterUsage   = `C formatter`
+	CformatterDefault = ""
+	CformatterUsage   = `C formatter, such as "clang-format-5.0"; empty means the built-in formatter`
 
 	FocusDefault = ""
 	FocusUsage   = `comma-separated list of tests or benchmarks (name prefixes) to focus on, e.g. "wuffs_gif_decode"`
@@ -39,6 +39,15 @@ const (
 	IterscaleMax     = 1000000
 	IterscaleUsage   = `a scaling factor for the number of iterations per benchmark`
 
+	JDefault      = 0
+	JBenchDefault = 1
+	JMin          = 0
+	JMax          = 1024
+	JUsage        = `the number of jobs to run concurrently; 0 means the number of CPUs`
+
+	JSONDefault = false
+	JSONUsage   = `whether to print errors as JSON records, one per line`
+
 	MimicDefault = false
 	MimicUsage   = `whether to compare Wuffs' output with other libraries' output`
 
@@ -51,8 +60,17 @@ const (
 	VersionUsage   = `version string, e.g. "1.2.3-beta.4"`
 )
 
-// TODO: do IsAlphaNumericIsh and IsValidUsePath belong in a separate package,
-// such as lang/validate? Perhaps together with token.Unescape?
+// NumJobs returns the number of jobs to run concurrently for the -j flag value
+// j, which is presumed to be in the range [JMin..JMax].
+func NumJobs(j int) int {
+	if j == 0 {
+		return runtime.NumCPU()
+	}
+	return j
+}
+
+// TODO: does IsAlphaNumericIsh belong in lang/validate, alongside
+// IsValidUsePath? Perhaps together with token.Unescape?
 
 // IsAlphaNumericIsh returns whether s contains only ASCII alpha-numerics and a
 // limited set of punctuation such as commas and slashes, but not containing
@@ -72,10 +90,6 @@ func IsAlphaNumericIsh(s string) bool {
 	return true
 }
 
-func IsValidUsePath(s string) bool {
-	return s == path.Clean(s) && s != "" && s[0] != '.' && s[0] != '/'
-}
-
 type Version struct {
 	Major     uint32
 	Minor     uint16
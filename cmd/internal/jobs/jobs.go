@@ -0,0 +1,87 @@
+// Copyright 2018 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// jobs runs the Wuffs command line tools' concurrent jobs, such as
+// generating packages or running C compilers, as limited by their -j flags.
+package jobs
+
+import (
+	"bytes"
+	"os"
+	"sync"
+)
+
+// Semaphore limits the number of jobs that run concurrently. Its capacity is
+// that limit.
+type Semaphore chan struct{}
+
+func (s Semaphore) Acquire() { s <- struct{}{} }
+func (s Semaphore) Release() { <-s }
+
+// Run calls f(i) for every i in [0, n), running at most j of those calls
+// concurrently, and waits for them all to return.
+func Run(n int, j int, f func(i int)) {
+	sem := make(Semaphore, j)
+	wg := sync.WaitGroup{}
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		sem.Acquire()
+		go func(i int) {
+			defer wg.Done()
+			defer sem.Release()
+			f(i)
+		}(i)
+	}
+	wg.Wait()
+}
+
+// Split divides a budget of j jobs between n concurrent jobs, each of which
+// runs its own concurrent sub-jobs, such as a child process passed a -j flag.
+// It returns the number of those jobs to run at a time, and the number of
+// sub-jobs that each of them may run at a time, so that no more than j (or,
+// if j is less than 1, 1) sub-jobs run in total.
+func Split(n int, j int) (outer int, inner int) {
+	if j < 1 {
+		j = 1
+	}
+	outer = j
+	if outer > n {
+		outer = n
+	}
+	if outer < 1 {
+		outer = 1
+	}
+	return outer, j / outer
+}
+
+// Output buffers a job's standard output and standard error, so that the
+// output of concurrent jobs is printed a whole job at a time instead of being
+// interleaved.
+type Output struct {
+	Stdout bytes.Buffer
+	Stderr bytes.Buffer
+}
+
+// printMutex serializes the printing of jobs' output.
+var printMutex sync.Mutex
+
+// Flush prints and then discards the buffered output.
+func (o *Output) Flush() {
+	printMutex.Lock()
+	defer printMutex.Unlock()
+	os.Stdout.Write(o.Stdout.Bytes())
+	os.Stderr.Write(o.Stderr.Bytes())
+	o.Stdout.Reset()
+	o.Stderr.Reset()
+}
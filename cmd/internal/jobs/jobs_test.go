@@ -0,0 +1,71 @@
+// Copyright 2018 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobs
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestSplit(tt *testing.T) {
+	testCases := []struct {
+		n, j         int
+		outer, inner int
+	}{
+		{n: 10, j: 8, outer: 8, inner: 1},
+		{n: 3, j: 8, outer: 3, inner: 2},
+		{n: 1, j: 8, outer: 1, inner: 8},
+		{n: 0, j: 4, outer: 1, inner: 4},
+		{n: 5, j: 0, outer: 1, inner: 1},
+	}
+	for _, tc := range testCases {
+		outer, inner := Split(tc.n, tc.j)
+		if outer != tc.outer || inner != tc.inner {
+			tt.Errorf("Split(%d, %d): got (%d, %d), want (%d, %d)",
+				tc.n, tc.j, outer, inner, tc.outer, tc.inner)
+		}
+		if j := tc.j; j > 0 && outer*inner > j {
+			tt.Errorf("Split(%d, %d): %d * %d jobs exceeds the budget", tc.n, tc.j, outer, inner)
+		}
+	}
+}
+
+func TestRun(tt *testing.T) {
+	const n, j = 20, 3
+	mu, running, maxRunning := sync.Mutex{}, 0, 0
+	done := make([]bool, n)
+	Run(n, j, func(i int) {
+		mu.Lock()
+		running++
+		if maxRunning < running {
+			maxRunning = running
+		}
+		mu.Unlock()
+
+		done[i] = true
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+	})
+	if maxRunning > j {
+		tt.Errorf("got %d concurrent jobs, want at most %d", maxRunning, j)
+	}
+	for i, d := range done {
+		if !d {
+			tt.Errorf("job %d did not run", i)
+		}
+	}
+}
@@ -0,0 +1,958 @@
+// Copyright 2018 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cformat formats C code, such as that generated by wuffs-c, in a
+// style close to clang-format's Chromium style.
+//
+// It is not a general purpose C formatter. It re-indents code based on its
+// braces, puts each statement on its own line and wraps long lines, but
+// otherwise keeps the source's line breaks and spacing. In particular, code
+// that clang-format has already formatted should be unchanged.
+package cformat
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+const (
+	maxWidth      = 80
+	indentWidth   = 2
+	continuation  = 4
+	commentIndent = "  "
+)
+
+type kind uint8
+
+const (
+	kPunct = kind(iota)
+	kIdent
+	kNumber
+	kString
+	kLineComment
+	kBlockComment
+	kPreprocessor
+)
+
+type token struct {
+	kind kind
+	s    string
+	// newlines is the number of line breaks before this token.
+	newlines int
+	// space is the whitespace before this token, after any line break.
+	space string
+	// col is the token's 0-based column in the source.
+	col int
+}
+
+// Format formats C code.
+func Format(src []byte) ([]byte, error) {
+	toks, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	f := &formatter{toks: toks}
+	f.format()
+	return alignComments(f.out.Bytes(), f.comments), nil
+}
+
+var puncts3 = [...]string{"<<=", ">>=", "..."}
+
+var puncts2 = [...]string{
+	"!=", "##", "%=", "&&", "&=", "*=", "++", "+=", "--", "-=", "->", "/=",
+	"::", "<<", "<=", "==", ">=", ">>", "^=", "|=", "||",
+}
+
+func tokenize(src []byte) ([]token, error) {
+	toks := []token(nil)
+	newlines, space, lineStart := 0, "", 0
+	for i := 0; i < len(src); {
+		c := src[i]
+		if c == '\n' {
+			newlines++
+			space = ""
+			i++
+			lineStart = i
+			continue
+		}
+		if c == ' ' || c == '\t' || c == '\r' || c == '\f' || c == '\v' {
+			j := i + 1
+			for j < len(src) && (src[j] == ' ' || src[j] == '\t' || src[j] == '\r' ||
+				src[j] == '\f' || src[j] == '\v') {
+				j++
+			}
+			space = string(src[i:j])
+			i = j
+			continue
+		}
+
+		j, k := i+1, kPunct
+		switch {
+		case c == '#' && strings.TrimSpace(string(src[lineStart:i])) == "":
+			// A preprocessor directive runs to the end of the line, including
+			// any backslash-newline continuations.
+			k = kPreprocessor
+			for j < len(src) {
+				if src[j] == '\n' {
+					if src[j-1] != '\\' {
+						break
+					}
+				}
+				j++
+			}
+
+		case c == '/' && i+1 < len(src) && src[i+1] == '/':
+			k = kLineComment
+			for j < len(src) && src[j] != '\n' {
+				j++
+			}
+
+		case c == '/' && i+1 < len(src) && src[i+1] == '*':
+			k = kBlockComment
+			end := bytes.Index(src[i+2:], []byte("*/"))
+			if end < 0 {
+				return nil, fmt.Errorf("cformat: unterminated block comment")
+			}
+			j = i + 2 + end + 2
+
+		case c == '"' || c == '\'':
+			k = kString
+			for ; ; j++ {
+				if j >= len(src) || src[j] == '\n' {
+					return nil, fmt.Errorf("cformat: unterminated string or character literal")
+				}
+				if src[j] == '\\' {
+					j++
+				} else if src[j] == c {
+					j++
+					break
+				}
+			}
+
+		case isDigit(c) || (c == '.' && i+1 < len(src) && isDigit(src[i+1])):
+			k = kNumber
+			for j < len(src) {
+				if d := src[j]; isIdentByte(d) || d == '.' {
+					j++
+				} else if (d == '+' || d == '-') && strings.IndexByte("eEpP", src[j-1]) >= 0 {
+					j++
+				} else {
+					break
+				}
+			}
+
+		case isIdentByte(c):
+			k = kIdent
+			for j < len(src) && isIdentByte(src[j]) {
+				j++
+			}
+
+		default:
+			s := string(src[i:])
+			for _, p := range puncts3 {
+				if strings.HasPrefix(s, p) {
+					j = i + 3
+					break
+				}
+			}
+			if j == i+1 {
+				for _, p := range puncts2 {
+					if strings.HasPrefix(s, p) {
+						j = i + 2
+						break
+					}
+				}
+			}
+		}
+
+		toks = append(toks, token{
+			kind:     k,
+			s:        strings.TrimRight(string(src[i:j]), " \t\r"),
+			newlines: newlines,
+			space:    space,
+			col:      i - lineStart,
+		})
+		newlines, space = 0, ""
+		if k == kBlockComment {
+			if n := bytes.LastIndexByte(src[i:j], '\n'); n >= 0 {
+				lineStart = i + n + 1
+			}
+		}
+		i = j
+	}
+	return toks, nil
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || isDigit(c) || ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z')
+}
+
+type braceKind uint8
+
+const (
+	// bBlock is a compound statement or function body.
+	bBlock = braceKind(iota)
+	// bDo is the body of a do-while loop.
+	bDo
+	// bSwitch is the body of a switch statement. Statements after a case
+	// label are indented by one more level than the label.
+	bSwitch
+	// bAggregate is a struct, union or enum body.
+	bAggregate
+	// bUnindented is an `extern "C"` or namespace body.
+	bUnindented
+	// bInitializer is an initializer list or compound literal, formatted
+	// inline.
+	bInitializer
+)
+
+type brace struct {
+	kind braceKind
+	// caseLabels is whether a switch body has had a case label.
+	caseLabels bool
+	// ownLines is whether an initializer, having a trailing comma, starts
+	// its elements and its '}' on their own lines. parens is the number of
+	// unclosed parens at its '{'.
+	ownLines bool
+	parens   int
+	// nested is whether an initializer is inside another initializer or
+	// inside parens.
+	nested bool
+}
+
+// levels returns by how many levels the brace indents the lines after it.
+func (b brace) levels() int {
+	switch b.kind {
+	case bSwitch:
+		if b.caseLabels {
+			return 2
+		}
+	case bUnindented, bInitializer:
+		return 0
+	}
+	return 1
+}
+
+// piece is part of an output line: a token and the whitespace before it.
+type piece struct {
+	space string
+	s     string
+	// col is the token's 0-based column in the source.
+	col int
+	// breakAfter is the cost of wrapping a long line after this piece, or 0
+	// if it cannot be wrapped there.
+	breakAfter int
+	// params is whether this piece is the '(' of a function declaration's
+	// parameters, which are either all on one line or one per line.
+	params bool
+}
+
+type formatter struct {
+	toks []token
+	out  bytes.Buffer
+	// trailingComma holds the indexes of the '{' tokens whose matching '}'
+	// follows a ','.
+	trailingComma map[int]bool
+	// pointers holds the indexes of the '*' tokens that are part of a
+	// pointer type, written "T *x" in the source.
+	pointers map[int]bool
+	// binaries holds the indexes of the '&', '*', '+' and '-' tokens that are
+	// binary operators.
+	binaries map[int]bool
+	// pos is the index of the current token.
+	pos int
+
+	braces []brace
+	// parens holds, for each unclosed '(' or '[', the token before it.
+	parens []string
+	// lastParen is the token before the most recently closed '(' or '['.
+	lastParen string
+
+	initializer int
+
+	// line is the current output line, with indent spaces of indentation.
+	// listLine is whether it holds the elements of an initializer whose
+	// elements are on their own lines, so that if wrapped, its continuation
+	// lines line up with it.
+	line     []piece
+	indent   int
+	listLine bool
+	// listNested is whether that initializer is nested, which affects
+	// whether its elements are laid out in columns.
+	listNested bool
+	// closedOwnLines is whether the last initializer closed had its elements
+	// on their own lines.
+	closedOwnLines bool
+	// blankLine is whether to write a blank line before the next line.
+	blankLine bool
+	// wroteOpenBrace is whether the last line written ended with a block's
+	// '{', so that a following blank line is dropped.
+	wroteOpenBrace bool
+	// trailingCol and trailingSrcCol are the output and source columns of
+	// the last line written's trailing comment, or -1 if it had none. A
+	// comment on the next line in the same source column continues it.
+	trailingCol    int
+	trailingSrcCol int
+	// comments holds the trailing comments written so far, which are
+	// aligned once all lines are written.
+	comments []trailingComment
+
+	// stmtStart is whether the next token starts a statement (or a
+	// declaration, label, etc.). stmtIndent and stmtCol are the output
+	// indentation and source column of the current statement's first token.
+	stmtStart  bool
+	stmtIndent int
+	stmtCol    int
+	// forceBreak is whether the next token must start a new line.
+	forceBreak bool
+	// labelColon is whether the next ':' ends a case or goto label.
+	labelColon bool
+}
+
+func (f *formatter) format() {
+	f.findTrailingCommas()
+	f.findPointers()
+	f.stmtStart = true
+	prev := token{}
+	for i, tok := range f.toks {
+		next := token{}
+		if i+1 < len(f.toks) {
+			next = f.toks[i+1]
+		}
+		f.pos = i
+		f.token(prev, tok, next)
+		prev = tok
+	}
+	f.flush()
+}
+
+// findPointers finds the '*' tokens that are part of a pointer type, so that
+// they can be formatted in Chromium's "T* x" style, and the '&', '*', '+' and
+// '-' tokens that are binary operators. Without a parser, it relies on the
+// source spacing: a '*' after a type name, preceded but not followed by a
+// space, as in "T *x" or "(T *)", is a pointer.
+func (f *formatter) findPointers() {
+	f.pointers = map[int]bool{}
+	f.binaries = map[int]bool{}
+	for i := 1; i+1 < len(f.toks); i++ {
+		tok, prev, next := f.toks[i], f.toks[i-1], f.toks[i+1]
+		switch tok.s {
+		case "*":
+			if tok.space != "" && next.space == "" && next.newlines == 0 &&
+				prev.kind == kIdent && !isKeyword(prev.s) &&
+				(next.kind == kIdent || next.s == ")") {
+				f.pointers[i] = true
+				continue
+			}
+			if tok.space == "" {
+				continue
+			}
+		case "&", "+", "-":
+		default:
+			continue
+		}
+		if (prev.kind == kIdent && !isKeyword(prev.s)) || prev.kind == kNumber ||
+			prev.s == ")" || prev.s == "]" {
+			f.binaries[i] = true
+		}
+	}
+}
+
+// isIdent returns whether s is an identifier other than a keyword that can
+// precede a '('.
+func isIdent(s string) bool {
+	return s != "" && isIdentByte(s[0]) && !isDigit(s[0]) && !isKeyword(s)
+}
+
+// isControl returns whether s is a keyword that is followed by a space
+// before a '('.
+func isControl(s string) bool {
+	switch s {
+	case "case", "for", "if", "return", "switch", "while":
+		return true
+	}
+	return false
+}
+
+func isKeyword(s string) bool {
+	switch s {
+	case "case", "do", "else", "for", "goto", "if", "return", "sizeof", "switch", "while":
+		return true
+	}
+	return false
+}
+
+func (f *formatter) findTrailingCommas() {
+	f.trailingComma = map[int]bool{}
+	opens, prev := []int(nil), token{}
+	for i, tok := range f.toks {
+		switch tok.s {
+		case "{":
+			opens = append(opens, i)
+		case "}":
+			if n := len(opens); n > 0 {
+				if prev.s == "," {
+					f.trailingComma[opens[n-1]] = true
+				}
+				opens = opens[:n-1]
+			}
+		}
+		if tok.kind != kLineComment && tok.kind != kBlockComment && tok.kind != kPreprocessor {
+			prev = tok
+		}
+	}
+}
+
+func (f *formatter) token(prev token, tok token, next token) {
+	if tok.kind == kPreprocessor {
+		f.flush()
+		f.blankLineIfAny(prev, tok)
+		f.directive(tok)
+		f.forceBreak = true
+		return
+	}
+
+	// A trailing comment stays on its line, even after a forced break.
+	trailingComment := tok.kind == kLineComment && tok.newlines == 0 && f.line != nil
+	// The elements of an initializer whose elements are on their own lines
+	// are laid out afresh, ignoring the source's line breaks.
+	listElement := f.listLine && tok.kind != kLineComment && tok.kind != kBlockComment &&
+		prev.kind != kLineComment && tok.s != "}"
+	if trailingComment || ((tok.newlines == 0 || listElement) && !f.forceBreak && f.line != nil) {
+		f.line = append(f.line, piece{space: f.inlineSpace(prev, tok), s: tok.s, col: tok.col})
+	} else {
+		f.flush()
+		f.blankLineIfAny(prev, tok)
+		f.indent = f.lineIndent(prev, tok, next)
+		f.line = []piece{{s: tok.s, col: tok.col}}
+		n := len(f.braces)
+		f.listLine = n > 0 && f.braces[n-1].ownLines && f.braces[n-1].parens == len(f.parens) && tok.s != "}"
+		f.listNested = f.listLine && f.braces[n-1].nested
+	}
+	f.forceBreak = false
+
+	wasStmtStart := f.stmtStart
+	if tok.kind != kLineComment && tok.kind != kBlockComment {
+		if f.stmtStart {
+			f.stmtStart = false
+			// Continuation lines are relative to the start of the line, which
+			// may differ from tok, as in "} else if (".
+			f.stmtIndent = f.indent
+			f.stmtCol = f.line[0].col
+			f.labelColon = (tok.s == "case" || tok.s == "default" ||
+				(tok.kind == kIdent && next.s == ":")) && f.initializer == 0
+			if n := len(f.braces); n > 0 && f.braces[n-1].kind == bSwitch &&
+				(tok.s == "case" || tok.s == "default") {
+				f.braces[n-1].caseLabels = true
+			}
+		}
+	}
+
+	switch tok.kind {
+	case kLineComment:
+		f.forceBreak = true
+		f.stmtStart = wasStmtStart
+		return
+	case kBlockComment:
+		f.stmtStart = wasStmtStart
+		return
+	}
+
+	switch tok.s {
+	case "(", "[":
+		if tok.s == "(" && prev.kind == kIdent && f.atFileScope() {
+			f.line[len(f.line)-1].params = true
+		}
+		f.parens = append(f.parens, prev.s)
+		f.setBreakAfter(tok, next)
+		return
+	case ")", "]":
+		if n := len(f.parens); n > 0 {
+			f.lastParen = f.parens[n-1]
+			f.parens = f.parens[:n-1]
+		}
+		if f.isMacroCall(tok, next) {
+			f.endStatement()
+		}
+		return
+	case "{":
+		f.openBrace(prev)
+		return
+	case "}":
+		f.closeBrace(next)
+		return
+	case ",":
+		if n := len(f.braces); n > 0 && f.braces[n-1].ownLines &&
+			(next.s == "}" || (prev.s == "}" && f.closedOwnLines)) {
+			// The '}' and any element after a multi-line element start new
+			// lines.
+			f.forceBreak = true
+		}
+	case ";":
+		if len(f.parens) == 0 && f.initializer == 0 {
+			f.endStatement()
+		} else {
+			f.setBreakAfter(tok, next)
+		}
+		return
+	case ":":
+		if f.labelColon && len(f.parens) == 0 {
+			f.labelColon = false
+			if next.s != ";" || next.newlines > 0 {
+				f.endStatement()
+			}
+		}
+		return
+	}
+	f.setBreakAfter(tok, next)
+}
+
+// setBreakAfter marks where a long line can be wrapped: after commas, after
+// opening brackets and after binary operators.
+func (f *formatter) setBreakAfter(tok token, next token) {
+	if next.s == ")" || next.s == "]" || next.s == "}" || next.s == ";" {
+		return
+	}
+	cost := 1
+	switch tok.s {
+	case "=":
+		if next.s == "{" {
+			// Prefer to break after the '{'.
+			return
+		}
+	case "(", "[", "{":
+		// Prefer to break after a function call's '(' than after a cast's,
+		// a sub-expression's, an index's or an initializer's.
+		if n := len(f.line); tok.s != "(" || n < 2 || !isIdent(f.line[n-2].s) {
+			cost = 3
+		}
+	case ",", "?", "<", ">", "<<", ">>", "/", "%", "|", "^":
+	case "+", "-", "*", "&":
+		if !f.binaries[f.pos] {
+			return
+		}
+	default:
+		if !isBinaryOp(tok.s) {
+			return
+		}
+	}
+	if n := len(f.line); n > 0 {
+		f.line[n-1].breakAfter = cost
+	}
+}
+
+func (f *formatter) openBrace(prev token) {
+	k := bBlock
+	switch {
+	case f.initializer > 0 || len(f.parens) > 0 || prev.s == "=" || prev.s == "return":
+		k = bInitializer
+	case prev.s == ")":
+		switch f.lastParen {
+		case "switch":
+			k = bSwitch
+		case "=", "return", ",", "?", ":":
+			k = bInitializer
+		}
+	case prev.s == "do":
+		k = bDo
+	case prev.kind == kString:
+		// extern "C" {
+		k = bUnindented
+	case prev.s == "else" || prev.s == "{" || prev.s == "}" || prev.s == ";" || prev.s == ":" || prev.s == "":
+		// No-op.
+	case f.isNamespace():
+		k = bUnindented
+	default:
+		k = bAggregate
+	}
+
+	f.braces = append(f.braces, brace{
+		kind:   k,
+		nested: f.initializer > 0 || len(f.parens) > 0,
+	})
+	if k == bInitializer {
+		f.setBreakAfter(token{s: "{"}, token{})
+		f.initializer++
+		if f.trailingComma[f.pos] {
+			f.braces[len(f.braces)-1].ownLines = true
+			f.braces[len(f.braces)-1].parens = len(f.parens)
+			f.forceBreak = true
+		}
+		return
+	}
+	if n := len(f.line); n > 1 && f.line[n-1].space == "" {
+		f.line[n-1].space = " "
+	}
+	f.stmtStart = true
+	f.forceBreak = true
+}
+
+// atFileScope returns whether the current line is a file scope declaration,
+// outside of any brackets or initializers.
+func (f *formatter) atFileScope() bool {
+	if len(f.parens) > 0 || f.initializer > 0 {
+		return false
+	}
+	for _, b := range f.braces {
+		if b.kind != bUnindented {
+			return false
+		}
+	}
+	for _, p := range f.line {
+		if p.s == "=" {
+			return false
+		}
+	}
+	return true
+}
+
+// isNamespace returns whether a '{' at the end of the current line opens a
+// C++ namespace.
+func (f *formatter) isNamespace() bool {
+	return len(f.line) > 0 && f.line[0].s == "namespace"
+}
+
+func (f *formatter) closeBrace(next token) {
+	b := brace{kind: bBlock}
+	if n := len(f.braces); n > 0 {
+		b = f.braces[n-1]
+		f.braces = f.braces[:n-1]
+	}
+	k := b.kind
+	if k == bInitializer {
+		f.initializer--
+		f.closedOwnLines = b.ownLines
+		return
+	}
+
+	switch {
+	case next.newlines > 0:
+		// No-op.
+	case next.s == "else" || next.s == ";" || next.s == "," || next.s == ")":
+		f.stmtStart = true
+		return
+	case next.s == "while" && k == bDo:
+		return
+	case next.kind == kIdent && k == bAggregate:
+		// E.g. "} foo;" ending "typedef struct { etc } foo;".
+		return
+	}
+	f.endStatement()
+}
+
+// isMacroCall returns whether tok, a ')', ends a line like "FOO(bar)" with
+// no trailing semicolon, which clang-format treats as a complete statement: a
+// call to an all upper case macro, followed by a line break.
+func (f *formatter) isMacroCall(tok token, next token) bool {
+	if tok.s != ")" || next.newlines == 0 || len(f.parens) > 0 || f.initializer > 0 ||
+		len(f.line) < 3 || f.line[0].col != f.stmtCol || f.line[1].s != "(" {
+		return false
+	}
+	name := f.line[0].s
+	for i := 0; i < len(name); i++ {
+		if c := name[i]; !('A' <= c && c <= 'Z') && !isDigit(c) && c != '_' {
+			return false
+		}
+	}
+	return isIdent(name)
+}
+
+func (f *formatter) endStatement() {
+	f.stmtStart = true
+	f.forceBreak = true
+}
+
+// lineIndent returns the indentation of a line that starts with tok.
+func (f *formatter) lineIndent(prev token, tok token, next token) int {
+	indent, top := 0, brace{}
+	for _, b := range f.braces {
+		indent += b.levels() * indentWidth
+	}
+	if n := len(f.braces); n > 0 {
+		top = f.braces[n-1]
+	}
+	if tok.s == "}" {
+		indent -= top.levels() * indentWidth
+	}
+	if tok.kind == kLineComment && tok.newlines == 1 && tok.col == f.trailingSrcCol {
+		return f.trailingCol
+	}
+	if lists := f.ownLinesDepth(); lists > 0 && !f.stmtStart && tok.newlines == 0 {
+		// Unless the source says otherwise, the elements of initializers
+		// whose elements are on their own lines are indented by one
+		// continuation per level of such initializers.
+		if tok.s == "}" && top.ownLines {
+			lists--
+		}
+		return f.stmtIndent + lists*continuation
+	}
+	if !f.stmtStart && (tok.s != "}" || f.initializer > 0) {
+		// A continuation line keeps its source indentation relative to the
+		// start of the statement, but it must be indented unless it closes an
+		// initializer or the previous line ended with an empty "//" comment,
+		// the idiom for breaking a function declaration after its return type.
+		delta := tok.col - f.stmtCol
+		if tok.newlines == 0 {
+			// The break was forced, so the source column is meaningless.
+			delta = 0
+		}
+		if delta <= 0 {
+			if tok.s == "}" {
+				delta = 0
+			} else if !(prev.kind == kLineComment && prev.s == "//") {
+				delta = continuation
+			}
+		}
+		return f.stmtIndent + delta
+	}
+	if tok.kind == kIdent && next.s == ":" && f.initializer == 0 {
+		switch tok.s {
+		case "public", "private", "protected":
+			return indent - 1
+		}
+		return max(0, indent-indentWidth)
+	}
+	if tok.s == "case" || tok.s == "default" ||
+		(tok.kind == kLineComment && next.newlines <= 1 && (next.s == "case" || next.s == "default")) {
+		// Case labels are indented by one level within a switch body.
+		if top.kind == bSwitch && top.caseLabels {
+			indent -= indentWidth
+		}
+		return indent
+	}
+	return indent
+}
+
+// ownLinesDepth returns the number of unclosed initializers whose elements
+// are on their own lines.
+func (f *formatter) ownLinesDepth() int {
+	n := 0
+	for _, b := range f.braces {
+		if b.ownLines {
+			n++
+		}
+	}
+	return n
+}
+
+func max(x int, y int) int {
+	if x > y {
+		return x
+	}
+	return y
+}
+
+// blankLineIfAny keeps a blank line before tok, unless it directly follows a
+// block's '{' or precedes a statement block's '}'.
+func (f *formatter) blankLineIfAny(prev token, tok token) {
+	if tok.newlines <= 1 || f.wroteOpenBrace || f.out.Len() == 0 {
+		return
+	}
+	if n := len(f.braces); tok.s == "}" && prev.kind != kPreprocessor && n > 0 {
+		switch f.braces[n-1].kind {
+		case bBlock, bDo, bSwitch:
+			return
+		}
+	}
+	f.blankLine = true
+}
+
+// inlineSpace returns the whitespace between two tokens on the same line.
+func (f *formatter) inlineSpace(prev token, tok token) string {
+	if tok.kind == kLineComment {
+		// Any alignment with neighboring comments is redone afterwards.
+		return commentIndent
+	}
+	if tok.newlines > 0 {
+		// The token was on a line of its own, e.g. "else" after "}".
+		return " "
+	}
+	switch f.spacing(prev, tok) {
+	case noSpace:
+		return ""
+	case space:
+		if len(tok.space) > 1 {
+			// Keep any alignment, e.g. of table columns.
+			return tok.space
+		}
+		return " "
+	}
+	return tok.space
+}
+
+type spacing uint8
+
+const (
+	sourceSpace = spacing(iota)
+	noSpace
+	space
+)
+
+// spacing returns whether there should be a space between two tokens on the
+// same line. Where the C grammar makes that ambiguous without a parser, such
+// as whether "*" is a multiplication or part of a pointer type, it defers to
+// the source.
+func (f *formatter) spacing(prev token, tok token) spacing {
+	if f.pointers[f.pos] {
+		return noSpace
+	} else if f.pointers[f.pos-1] && tok.s != ")" {
+		return space
+	} else if f.binaries[f.pos] || f.binaries[f.pos-1] {
+		return space
+	}
+	if tok.s == "(" && prev.kind == kIdent && !isControl(prev.s) {
+		// A function call or sizeof.
+		return noSpace
+	}
+	if (prev.s == "," || prev.s == ";") && tok.s != ";" && tok.s != ")" {
+		return space
+	}
+	switch tok.s {
+	case ",", ";", ")", "]", ".", "->":
+		return noSpace
+	case "}":
+		if n := len(f.braces); n > 0 && f.braces[n-1].kind == bInitializer {
+			return noSpace
+		}
+	}
+	switch prev.s {
+	case "(", "[", ".", "->", "!", "~":
+		return noSpace
+	case "{":
+		if f.initializer > 0 {
+			return noSpace
+		}
+	case "}":
+		if tok.s == "else" || tok.s == "while" || tok.kind == kIdent {
+			return space
+		}
+	case "else":
+		return space
+	}
+	if prev.kind == kIdent || prev.kind == kNumber || prev.s == ")" || prev.s == "]" {
+		switch tok.s {
+		case "++", "--", "[":
+			return noSpace
+		}
+	}
+	if isBinaryOp(prev.s) || isBinaryOp(tok.s) {
+		return space
+	}
+	switch tok.s {
+	case "<", ">", "<<", ">>", "/", "%", "|", "^":
+		return space
+	}
+	switch prev.s {
+	case "<", ">", "<<", ">>", "/", "%", "|", "^":
+		return space
+	}
+	return sourceSpace
+}
+
+// isBinaryOp returns whether s is an operator that is always binary and is
+// surrounded by spaces.
+func isBinaryOp(s string) bool {
+	switch s {
+	case "=", "==", "!=", "<=", ">=", "&&", "||", "?",
+		"+=", "-=", "*=", "/=", "%=", "&=", "|=", "^=", "<<=", ">>=":
+		return true
+	}
+	return false
+}
+
+// flush writes the current line, wrapping it if it is too long.
+func (f *formatter) flush() {
+	if f.line == nil {
+		return
+	}
+	line := f.line
+	f.line = nil
+	f.write(f.indent, line, f.listLine)
+}
+
+func (f *formatter) write(indent int, line []piece, listLine bool) {
+	if f.blankLine {
+		f.out.WriteByte('\n')
+		f.blankLine = false
+	}
+
+	breaks := map[int]int(nil)
+	if listLine {
+		breaks = listBreaks(indent, line, f.listNested)
+	} else {
+		breaks = wrap(indent, indent+continuation, line)
+	}
+	for i, j := 0, 0; i < len(line); i = j {
+		for j = i + 1; j < len(line); j++ {
+			if _, ok := breaks[j]; ok {
+				break
+			}
+		}
+		if i > 0 {
+			indent = breaks[i]
+			line[i].space = ""
+		}
+		continued := j == i+1 && isLineComment(line[i].s) && indent == f.trailingCol
+		lineStart := f.out.Len()
+		f.trailingCol, f.trailingSrcCol = writeLine(&f.out, indent, line[i:j]), -1
+		if f.trailingCol >= 0 {
+			f.trailingSrcCol = line[j-1].col
+			f.comments = append(f.comments, trailingComment{
+				lineStart: lineStart,
+				lineEnd:   f.out.Len(),
+				codeEnd:   lineStart + f.trailingCol - len(line[j-1].space),
+				comment:   lineStart + f.trailingCol,
+			})
+		} else if continued {
+			f.trailingCol, f.trailingSrcCol = indent, line[i].col
+			f.comments = append(f.comments, trailingComment{
+				lineStart: lineStart,
+				lineEnd:   f.out.Len(),
+				codeEnd:   lineStart,
+				comment:   lineStart + indent,
+				continued: true,
+			})
+		}
+	}
+
+	last := line[len(line)-1].s
+	f.wroteOpenBrace = last == "{" && f.initializer == 0
+}
+
+// writeLine writes a line and returns the column of its trailing comment, or
+// -1 if it has none.
+func writeLine(out *bytes.Buffer, indent int, line []piece) (trailingCol int) {
+	trailingCol, col := -1, indent
+	for i := 0; i < indent; i++ {
+		out.WriteByte(' ')
+	}
+	for i, p := range line {
+		if i > 0 {
+			out.WriteString(p.space)
+			col += len(p.space)
+		}
+		if i > 0 && i == len(line)-1 && isLineComment(p.s) {
+			trailingCol = col
+		}
+		out.WriteString(p.s)
+		col += len(p.s)
+	}
+	out.WriteByte('\n')
+	return trailingCol
+}
@@ -0,0 +1,139 @@
+// Copyright 2018 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cformat
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestFormat(tt *testing.T) {
+	testCases := []struct {
+		src  string
+		want string
+	}{{
+		src: "" +
+			"#define FOO_BAR_BAZ_QUUX_ONE 1 // 0x01\n" +
+			"#define FOO_BAR_BAZ_QUUX_THREE_HUNDRED 300 // 0x12C\n",
+		want: "" +
+			"#define FOO_BAR_BAZ_QUUX_ONE 1              // 0x01\n" +
+			"#define FOO_BAR_BAZ_QUUX_THREE_HUNDRED 300  // 0x12C\n",
+	}, {
+		src: "" +
+			"static const uint8_t table[] = {1,2,3,100,200,50,6,7,8,9,10,11,12,13,14,15,16,17,18,19," +
+			"20,21,22,23,24,25,26,27,28,29,30,31,32,33,34,35,36,37,38,};\n",
+		want: "" +
+			"static const uint8_t table[] = {\n" +
+			"    1,  2,  3,  100, 200, 50, 6,  7,  8,  9,  10, 11, 12,\n" +
+			"    13, 14, 15, 16,  17,  18, 19, 20, 21, 22, 23, 24, 25,\n" +
+			"    26, 27, 28, 29,  30,  31, 32, 33, 34, 35, 36, 37, 38,\n" +
+			"};\n",
+	}, {
+		src: "" +
+			"static wuffs_base__status wuffs_foo__decoder__decode(wuffs_foo__decoder* self, " +
+			"wuffs_base__io_writer a_dst, wuffs_base__io_reader a_src) {\n" +
+			"switch (self->private_impl.c_decode[0].coro_susp_point) {\n" +
+			"case 0:\n" +
+			"if (a_dst.private_impl.buf&&(self->private_impl.f_some_rather_long_field_name>" +
+			"a_src.private_impl.limit)) {\n" +
+			"status = wuffs_foo__decoder__helper(self,a_dst,a_src,self->private_impl.f_n_bits);\n" +
+			"}\n" +
+			"return ((wuffs_base__slice_u8){.ptr = self->private_impl.f_data,.len = 3,});\n" +
+			"}\n" +
+			"}\n",
+		want: "" +
+			"static wuffs_base__status wuffs_foo__decoder__decode(\n" +
+			"    wuffs_foo__decoder* self,\n" +
+			"    wuffs_base__io_writer a_dst,\n" +
+			"    wuffs_base__io_reader a_src) {\n" +
+			"  switch (self->private_impl.c_decode[0].coro_susp_point) {\n" +
+			"    case 0:\n" +
+			"      if (a_dst.private_impl.buf &&\n" +
+			"          (self->private_impl.f_some_rather_long_field_name >\n" +
+			"           a_src.private_impl.limit)) {\n" +
+			"        status = wuffs_foo__decoder__helper(self, a_dst, a_src,\n" +
+			"                                            self->private_impl.f_n_bits);\n" +
+			"      }\n" +
+			"      return ((wuffs_base__slice_u8){\n" +
+			"          .ptr = self->private_impl.f_data,\n" +
+			"          .len = 3,\n" +
+			"      });\n" +
+			"  }\n" +
+			"}\n",
+	}}
+
+	for i, tc := range testCases {
+		got, err := Format([]byte(tc.src))
+		if err != nil {
+			tt.Errorf("test case #%d: %v", i, err)
+			continue
+		}
+		if string(got) != tc.want {
+			tt.Errorf("test case #%d:\ngot:\n%s\nwant:\n%s", i, got, tc.want)
+			continue
+		}
+		again, err := Format(got)
+		if err != nil {
+			tt.Errorf("test case #%d: formatting again: %v", i, err)
+			continue
+		}
+		if string(again) != tc.want {
+			tt.Errorf("test case #%d: formatting again:\ngot:\n%s\nwant:\n%s", i, again, tc.want)
+		}
+	}
+}
+
+// TestFormatSnapshot checks that C code formatted by clang-format, in the
+// Chromium style, is unchanged.
+func TestFormatSnapshot(tt *testing.T) {
+	const filename = "../../../../release/c/wuffs-unsupported-snapshot.h"
+	src, err := ioutil.ReadFile(filename)
+	if err != nil {
+		tt.Fatalf("ReadFile: %v", err)
+	}
+	got, err := Format(src)
+	if err != nil {
+		tt.Fatalf("Format: %v", err)
+	}
+	if bytes.Equal(got, src) {
+		return
+	}
+	gotLines, srcLines := strings.Split(string(got), "\n"), strings.Split(string(src), "\n")
+	for i := 0; ; i++ {
+		if i == len(gotLines) || i == len(srcLines) || gotLines[i] != srcLines[i] {
+			g, s := "EOF", "EOF"
+			if i < len(gotLines) {
+				g = gotLines[i]
+			}
+			if i < len(srcLines) {
+				s = srcLines[i]
+			}
+			tt.Fatalf("%s:%d:\ngot  %q\nwant %q", filename, i+1, g, s)
+		}
+	}
+}
+
+func TestFormatErrors(tt *testing.T) {
+	for _, src := range []string{
+		"/* unterminated",
+		"char* s = \"unterminated;\n",
+	} {
+		if _, err := Format([]byte(src)); err == nil {
+			tt.Errorf("%q: got nil error, want non-nil", src)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright 2018 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cformat
+
+import (
+	"strings"
+)
+
+func isLineComment(s string) bool {
+	return strings.HasPrefix(s, "//")
+}
+
+// directive writes a preprocessor directive. Like clang-format, it separates
+// a trailing comment from the code by two spaces and wraps a long line, either
+// by breaking a #define after the macro's name or by reflowing the comment.
+// Directives that already span several lines are written as is.
+func (f *formatter) directive(tok token) {
+	if strings.Contains(tok.s, "\\\n") {
+		f.write(0, []piece{{s: tok.s, col: tok.col}}, false)
+		return
+	}
+	code, comment, commentCol := splitComment(tok.s)
+	width := len(code)
+	if comment != "" {
+		width += len(commentIndent) + len(comment)
+	}
+
+	indent := 0
+	if width > maxWidth && strings.HasPrefix(code, "#define ") {
+		if name, body := splitDefine(code); body != "" {
+			f.write(0, []piece{{s: name + " \\", col: tok.col}}, false)
+			indent, code = indentWidth, body
+		}
+	}
+	if comment == "" {
+		f.write(indent, []piece{{s: code, col: tok.col}}, false)
+		return
+	}
+
+	col := indent + len(code) + len(commentIndent)
+	lines := reflow(comment, maxWidth-col)
+	f.write(indent, []piece{
+		{s: code, col: tok.col},
+		{space: commentIndent, s: lines[0], col: tok.col + commentCol},
+	}, false)
+	for _, line := range lines[1:] {
+		f.write(col, []piece{{s: line, col: tok.col + commentCol}}, false)
+	}
+}
+
+// splitComment splits a single line directive into its code and its trailing
+// "//" comment, if any, returning the comment's offset within s.
+func splitComment(s string) (code string, comment string, offset int) {
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"', '\'':
+			for i++; i < len(s) && s[i] != c; i++ {
+				if s[i] == '\\' {
+					i++
+				}
+			}
+		case '/':
+			if strings.HasPrefix(s[i:], "//") {
+				return strings.TrimRight(s[:i], " \t"), s[i:], i
+			} else if strings.HasPrefix(s[i:], "/*") {
+				if j := strings.Index(s[i+2:], "*/"); j >= 0 {
+					i += 2 + j + 1
+				}
+			}
+		}
+	}
+	return strings.TrimRight(s, " \t"), "", 0
+}
+
+// splitDefine splits a #define directive into the part up to and including
+// the macro's name and parameters, and the macro's body.
+func splitDefine(s string) (name string, body string) {
+	i := len("#define ")
+	for i < len(s) && s[i] == ' ' {
+		i++
+	}
+	for i < len(s) && s[i] != ' ' && s[i] != '(' {
+		i++
+	}
+	if i < len(s) && s[i] == '(' {
+		j := strings.IndexByte(s[i:], ')')
+		if j < 0 {
+			return s, ""
+		}
+		i += j + 1
+	}
+	return s[:i], strings.TrimSpace(s[i:])
+}
+
+// reflow splits a "//" comment into lines of at most width bytes, breaking at
+// spaces. A line is longer than width if it has no space to break at.
+func reflow(comment string, width int) []string {
+	lines := []string(nil)
+	for len(comment) > width && width > len("// ") {
+		i := strings.LastIndexByte(comment[:width+1], ' ')
+		if i <= len("//") {
+			break
+		}
+		lines = append(lines, strings.TrimRight(comment[:i], " "))
+		comment = "// " + strings.TrimLeft(comment[i:], " ")
+	}
+	return append(lines, comment)
+}
+
+// trailingComment is a "//" comment at the end of a written line, or on a line
+// of its own that continues the previous line's trailing comment. Its fields
+// are offsets into the output.
+type trailingComment struct {
+	// lineStart and lineEnd are the offsets of the start of the comment's
+	// line and of the next line.
+	lineStart int
+	lineEnd   int
+	// codeEnd and comment are the offsets of the end of the code before the
+	// comment and of the comment itself.
+	codeEnd int
+	comment int
+	// continued is whether the comment is on a line of its own.
+	continued bool
+}
+
+// minCol and maxCol return the range of columns that the comment can be
+// aligned to: at least two spaces after the code and, if possible, without
+// exceeding the maximum line width.
+func (c trailingComment) minCol() int {
+	if c.continued {
+		return 0
+	}
+	return c.codeEnd - c.lineStart + len(commentIndent)
+}
+
+func (c trailingComment) maxCol() int {
+	if c.continued {
+		return maxWidth * maxWidth
+	}
+	return max(c.minCol(), maxWidth-(c.lineEnd-1-c.comment))
+}
+
+// alignComments aligns the trailing comments on consecutive lines of src with
+// each other, as clang-format does. A run of consecutive comments is split
+// wherever aligning the next comment would push it, or an earlier comment,
+// past the maximum line width.
+func alignComments(src []byte, comments []trailingComment) []byte {
+	if len(comments) == 0 {
+		return src
+	}
+	cols := make([]int, len(comments))
+	for i := 0; i < len(comments); {
+		lo, hi, j := 0, maxWidth*maxWidth, i
+		for ; j < len(comments); j++ {
+			c := comments[j]
+			if j > i && (comments[j-1].lineEnd != c.lineStart || c.minCol() > hi || c.maxCol() < lo) {
+				break
+			}
+			lo, hi = max(lo, c.minCol()), min(hi, c.maxCol())
+		}
+		for ; i < j; i++ {
+			cols[i] = lo
+		}
+	}
+
+	dst := make([]byte, 0, len(src))
+	last := 0
+	for i, c := range comments {
+		dst = append(dst, src[last:c.codeEnd]...)
+		for n := c.codeEnd - c.lineStart; n < cols[i]; n++ {
+			dst = append(dst, ' ')
+		}
+		last = c.comment
+	}
+	return append(dst, src[last:]...)
+}
@@ -0,0 +1,451 @@
+// Copyright 2018 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cformat
+
+import (
+	"strings"
+)
+
+// overflowCost is the cost of each column past maxWidth, relative to a cost
+// of 1 for each line break.
+const overflowCost = 100
+
+// wrapper splits a line that is wider than maxWidth into several lines.
+//
+// Like clang-format, it prefers to keep a bracketed group's elements together
+// and to align continuation lines with the column after the group's opening
+// bracket, but it uses simple rules instead of a search over all possible
+// line breaks. Before each element, such as a function argument, it breaks
+// the line only if the element does not fit on the current line. At each
+// opening bracket, it chooses between aligning after the bracket and breaking
+// straight after it by laying out the group both ways.
+type wrapper struct {
+	line []piece
+	// depth is the bracket nesting depth after each piece.
+	depth []int
+	// match is the index of each opening bracket's closing bracket, or -1.
+	match []int
+	// width is the width of each piece, excluding the space before it.
+	width []int
+
+	// continuationIndent is the indentation of continuation lines outside of
+	// any brackets.
+	continuationIndent int
+
+	// breaks maps the index of each piece that starts a new line to that
+	// line's indentation.
+	breaks map[int]int
+
+	memo map[groupKey]groupResult
+}
+
+type groupKey struct {
+	lo, hi, col, lineStart, align int
+}
+
+type groupResult struct {
+	col, lineStart, cost int
+	broken               bool
+}
+
+// wrap returns the indentation of each piece of the line that starts a new
+// line, other than the first. continuationIndent is the indentation of
+// continuation lines outside of any brackets.
+func wrap(indent int, continuationIndent int, line []piece) map[int]int {
+	w := &wrapper{
+		line:  line,
+		depth: make([]int, len(line)),
+		match: make([]int, len(line)),
+		width: make([]int, len(line)),
+		memo:  map[groupKey]groupResult{},
+
+		continuationIndent: continuationIndent,
+	}
+	width, opens, depth := indent, []int(nil), 0
+	for i, p := range line {
+		w.match[i] = -1
+		if isComment(p.s) {
+			// Comments don't count towards the line width.
+		} else {
+			w.width[i] = len(p.s)
+		}
+		if i > 0 {
+			width += len(p.space)
+		}
+		width += w.width[i]
+
+		switch p.s {
+		case "(", "[", "{":
+			opens = append(opens, i)
+			depth++
+		case ")", "]", "}":
+			if n := len(opens); n > 0 {
+				w.match[opens[n-1]] = i
+				opens = opens[:n-1]
+				depth--
+			}
+		}
+		w.depth[i] = depth
+	}
+	if width <= maxWidth {
+		return nil
+	}
+
+	w.breaks = map[int]int{}
+	w.group(0, len(line), indent, indent, continuationIndent, true)
+	return w.breaks
+}
+
+func isComment(s string) bool {
+	return strings.HasPrefix(s, "//") || strings.HasPrefix(s, "/*") ||
+		strings.HasPrefix(s, "#") || strings.IndexByte(s, '\n') >= 0
+}
+
+// canBreakAfter returns whether the line can be broken after the i'th piece.
+func (w *wrapper) canBreakAfter(i int) bool {
+	if w.line[i].breakAfter == 0 || i+1 >= len(w.line) {
+		return false
+	}
+	switch w.line[i+1].s {
+	case ")", "]", "}":
+		return false
+	}
+	return !isComment(w.line[i+1].s)
+}
+
+// elementEnd returns the index of the last piece of the element that starts
+// with the i'th piece: the next piece after which the line can be broken
+// without being inside a deeper bracketed group or a tighter binding binary
+// operator's operand.
+func (w *wrapper) elementEnd(i int) int {
+	d, r := w.depth[i], 0
+	if i > 0 {
+		d, r = w.depth[i-1], precedence(w.line[i-1].s)
+	}
+	for j := i; j < len(w.line); j++ {
+		if w.depth[j] < d {
+			// Having left a bracketed group, the element ends at the next
+			// break at the shallower depth.
+			d, r = w.depth[j], 100
+		}
+		if w.depth[j] == d && w.canBreakAfter(j) && precedence(w.line[j].s) <= r {
+			return j
+		}
+	}
+	return len(w.line) - 1
+}
+
+// precedence returns how tightly a binary operator binds, or 0 for a comma
+// and 100 for anything else.
+func precedence(s string) int {
+	switch s {
+	case ",":
+		return 0
+	case "=", "+=", "-=", "*=", "/=", "%=", "&=", "|=", "^=", "<<=", ">>=":
+		return 1
+	case "?", ":":
+		return 2
+	case "||":
+		return 3
+	case "&&":
+		return 4
+	case "|":
+		return 5
+	case "^":
+		return 6
+	case "&":
+		return 7
+	case "==", "!=":
+		return 8
+	case "<", ">", "<=", ">=":
+		return 9
+	case "<<", ">>":
+		return 10
+	case "+", "-":
+		return 11
+	case "*", "/", "%":
+		return 12
+	}
+	return 100
+}
+
+// widthOf returns the width of the pieces from i to j inclusive, excluding
+// the space before the i'th piece.
+func (w *wrapper) widthOf(i int, j int) int {
+	n := w.width[i]
+	for k := i + 1; k <= j; k++ {
+		n += len(w.line[k].space) + w.width[k]
+	}
+	return n
+}
+
+// breakCost returns the cost of breaking the line after the i'th piece.
+// Breaking inside deeper brackets costs more.
+func (w *wrapper) breakCost(i int) int {
+	return w.line[i].breakAfter + w.depth[i]
+}
+
+// group lays out the pieces from lo up to hi (exclusive), given the current
+// column col. lineStart is the indentation of the current output line, so
+// that col == lineStart means that the lo'th piece starts a new line, and
+// align is the indentation of any continuation line. It returns the column
+// and line indentation after the pieces, the cost of the layout (the cost of
+// its line breaks plus a penalty for overly long lines) and whether it has
+// any line breaks. If record is true, it also records the line breaks.
+func (w *wrapper) group(lo int, hi int, col int, lineStart int, align int, record bool) groupResult {
+	key := groupKey{lo, hi, col, lineStart, align}
+	if !record {
+		if r, ok := w.memo[key]; ok {
+			return r
+		}
+	}
+
+	depth := 0
+	if lo > 0 {
+		depth = w.depth[lo-1]
+	}
+	r := groupResult{col: col, lineStart: lineStart}
+	// elementBroken is whether the current comma-separated element spans
+	// more than one line, in which case the next element starts a new line.
+	elementBroken := false
+	for i := lo; i < hi; i++ {
+		p := w.line[i]
+		newElement := i > lo && w.line[i-1].s == "," && w.depth[i-1] == depth
+		if i > lo && w.canBreakAfter(i-1) &&
+			((newElement && elementBroken) || w.shouldBreak(i, r.col, r.lineStart, align)) {
+			r.col, r.lineStart = align, align
+			r.cost += w.breakCost(i - 1)
+			r.broken, elementBroken = true, true
+			if record {
+				w.breaks[i] = align
+			}
+		} else if r.col > r.lineStart {
+			r.col += len(p.space)
+		}
+		if newElement {
+			elementBroken = false
+		}
+		r.col += w.width[i]
+		if r.col > maxWidth && w.width[i] > 0 {
+			r.cost += overflowCost * min(r.col-maxWidth, w.width[i])
+		}
+
+		m := w.match[i]
+		if m < 0 || m >= hi || m == i+1 {
+			continue
+		}
+
+		// Lay out the bracketed group, either aligned after the opening
+		// bracket or starting on a new line.
+		layout := w.group
+		if p.params && r.col+w.widthOf(i+1, len(w.line)-1) > maxWidth {
+			layout = w.onePerLine
+		}
+		aligned := layout(i+1, m, r.col, r.lineStart, r.col, false)
+		// Starting on a new line indents relative to the enclosing group's
+		// alignment, if any.
+		brokenAlign := r.lineStart + continuation
+		if align != w.continuationIndent {
+			brokenAlign = max(r.lineStart, align) + continuation
+		}
+		broken := layout(i+1, m, brokenAlign, brokenAlign, brokenAlign, false)
+		broken.cost += w.breakCost(i)
+		broken.broken = true
+		// Account for what follows the group up to the next possible line
+		// break, such as closing brackets.
+		tail := m
+		for tail+1 < len(w.line) && !w.canBreakAfter(tail) {
+			tail++
+		}
+		tailWidth := w.widthOf(m, tail)
+		aligned.cost += overflowCost * max(0, aligned.col+tailWidth-maxWidth)
+		broken.cost += overflowCost * max(0, broken.col+tailWidth-maxWidth)
+		best := aligned
+		if w.canBreakAfter(i) && broken.cost < aligned.cost {
+			best = broken
+			if record {
+				w.breaks[i+1] = brokenAlign
+				layout(i+1, m, brokenAlign, brokenAlign, brokenAlign, true)
+			}
+		} else if record {
+			layout(i+1, m, r.col, r.lineStart, r.col, true)
+		}
+		r.col, r.lineStart = best.col, best.lineStart
+		r.cost += best.cost - overflowCost*max(0, best.col+tailWidth-maxWidth)
+		if best.broken {
+			r.broken, elementBroken = true, true
+		}
+		i = m - 1
+	}
+
+	if !record {
+		w.memo[key] = r
+	}
+	return r
+}
+
+// onePerLine is like group, but it puts each comma-separated element on its
+// own line.
+func (w *wrapper) onePerLine(lo int, hi int, col int, lineStart int, align int, record bool) groupResult {
+	r := groupResult{col: col, lineStart: lineStart}
+	for i := lo; i < hi; {
+		end := i
+		for ; end < hi-1; end++ {
+			if w.line[end].s == "," && w.depth[end] == w.depth[lo] {
+				break
+			}
+		}
+		if i > lo {
+			r.col, r.lineStart = align, align
+			r.cost += w.breakCost(i - 1)
+			r.broken = true
+			if record {
+				w.breaks[i] = align
+			}
+		}
+		e := w.group(i, end+1, r.col, r.lineStart, align, record)
+		r.col, r.lineStart = e.col, e.lineStart
+		r.cost += e.cost
+		r.broken = r.broken || e.broken
+		i = end + 1
+	}
+	return r
+}
+
+// shouldBreak returns whether to break the line before the i'th piece, the
+// start of an element, given the current column col, the current line's
+// indentation lineStart and the indentation align of a continuation line.
+func (w *wrapper) shouldBreak(i int, col int, lineStart int, align int) bool {
+	if col <= align {
+		return false
+	}
+	end := w.elementEnd(i)
+	if col+len(w.line[i].space)+w.widthOf(i, end) <= maxWidth {
+		// The element fits on the current line.
+		return false
+	}
+	if align+w.widthOf(i, end) <= maxWidth {
+		// The element fits on a new line.
+		return true
+	}
+	// The element will be broken anyway, so pick whichever is cheaper.
+	breakCost := w.group(i, end+1, align, align, align, false).cost + w.breakCost(i-1)
+	noBreakCost := w.group(i, end+1, col, lineStart, align, false).cost
+	return breakCost <= noBreakCost
+}
+
+func min(x int, y int) int {
+	if x < y {
+		return x
+	}
+	return y
+}
+
+// listBreaks is like wrap, but for the elements of an initializer whose
+// elements are on their own lines. Like clang-format, it lays them out in
+// columns if there are enough of them, and otherwise one per line. nested is
+// whether the initializer is inside another initializer or inside parens, in
+// which case it needs more elements to be laid out in columns.
+func listBreaks(indent int, line []piece, nested bool) map[int]int {
+	starts, lengths, commas, depth := []int{0}, []int(nil), 0, 0
+	for i, p := range line {
+		if isComment(p.s) {
+			return wrap(indent, indent, line)
+		}
+		switch p.s {
+		case "(", "[", "{":
+			depth++
+		case ")", "]", "}":
+			depth--
+		case ",":
+			if depth == 0 {
+				commas++
+				if i+1 < len(line) {
+					starts = append(starts, i+1)
+				}
+			}
+		}
+	}
+	for k, start := range starts {
+		end := len(line)
+		if k+1 < len(starts) {
+			end = starts[k+1]
+		}
+		n := len(line[start].s)
+		for _, p := range line[start+1 : end] {
+			n += len(p.space) + len(p.s)
+		}
+		lengths = append(lengths, n)
+	}
+
+	sizes := []int{0}
+	if commas >= 5 && (!nested || commas >= 19) {
+		sizes = columnSizes(lengths, maxWidth-indent)
+	}
+	breaks := map[int]int{}
+	for k, start := range starts {
+		if c := k % len(sizes); c > 0 {
+			line[start].space = " " + strings.Repeat(" ", sizes[c-1]-lengths[k-1])
+			continue
+		}
+		if k > 0 {
+			breaks[start] = indent
+		}
+		if len(sizes) == 1 && lengths[k] > maxWidth-indent {
+			end := len(line)
+			if k+1 < len(starts) {
+				end = starts[k+1]
+			}
+			for i, j := range wrap(indent, indent+continuation, line[start:end]) {
+				breaks[start+i] = j
+			}
+		}
+	}
+	if len(breaks) == 0 {
+		return nil
+	}
+	return breaks
+}
+
+// columnSizes returns the widths of the columns to lay out elements of the
+// given lengths in, within the given width. It prefers the fewest columns
+// that need the fewest lines, and it avoids columns whose elements' lengths
+// vary by more than 10.
+func columnSizes(lengths []int, width int) []int {
+	best, bestLines := []int{0}, len(lengths)
+	for columns := 2; columns <= maxWidth/3 && columns <= len(lengths); columns++ {
+		sizes, minSizes := make([]int, columns), make([]int, columns)
+		for i := range minSizes {
+			minSizes[i] = maxWidth
+		}
+		for k, n := range lengths {
+			c := k % columns
+			sizes[c] = max(sizes[c], n)
+			minSizes[c] = min(minSizes[c], n)
+		}
+		total, ok := columns-1, true
+		for c, size := range sizes {
+			total += size
+			if c < columns-1 && size-minSizes[c] > 10 {
+				ok = false
+			}
+		}
+		lines := (len(lengths) + columns - 1) / columns
+		if ok && total <= width && lines < bestLines {
+			best, bestLines = sizes, lines
+		}
+	}
+	return best
+}
@@ -189,6 +189,34 @@ wuffs_base__load_u64le(uint8_t* p) {
 
 // --------
 
+// wuffs_base__u8__as_i8, etc. convert an unsigned integer to the signed
+// integer with the same two's complement bit pattern. A plain C cast does the
+// same on every compiler that we care about, but converting an out-of-range
+// value to a signed integer type is implementation-defined behavior.
+
+static inline int8_t  //
+wuffs_base__u8__as_i8(uint8_t x) {
+  return x < 0x80 ? (int8_t)(x) : (int8_t)(-(int8_t)(0xFF - x) - 1);
+}
+
+static inline int16_t  //
+wuffs_base__u16__as_i16(uint16_t x) {
+  return x < 0x8000 ? (int16_t)(x) : (int16_t)(-(int16_t)(0xFFFF - x) - 1);
+}
+
+static inline int32_t  //
+wuffs_base__u32__as_i32(uint32_t x) {
+  return x < 0x80000000 ? (int32_t)(x) : -(int32_t)(0xFFFFFFFF - x) - 1;
+}
+
+static inline int64_t  //
+wuffs_base__u64__as_i64(uint64_t x) {
+  return x < 0x8000000000000000 ? (int64_t)(x)
+                                : -(int64_t)(0xFFFFFFFFFFFFFFFF - x) - 1;
+}
+
+// --------
+
 static inline void  //
 wuffs_base__store_u8be(uint8_t* p, uint8_t x) {
   p[0] = x;
@@ -364,84 +392,103 @@ wuffs_base__u64__sat_sub_indirect(uint64_t* x, uint64_t y) {
 
 // ---------------- Slices and Tables
 
-static inline wuffs_base__slice_u8  //
-wuffs_base__slice_u8__subslice_i(wuffs_base__slice_u8 s, uint64_t i) {
-  if ((i <= SIZE_MAX) && (i <= s.len)) {
-    return ((wuffs_base__slice_u8){
-        .ptr = s.ptr + i,
-        .len = s.len - i,
-    });
-  }
-  return ((wuffs_base__slice_u8){});
-}
-
-static inline wuffs_base__slice_u8  //
-wuffs_base__slice_u8__subslice_j(wuffs_base__slice_u8 s, uint64_t j) {
-  if ((j <= SIZE_MAX) && (j <= s.len)) {
-    return ((wuffs_base__slice_u8){.ptr = s.ptr, .len = j});
-  }
-  return ((wuffs_base__slice_u8){});
-}
-
-static inline wuffs_base__slice_u8  //
-wuffs_base__slice_u8__subslice_ij(wuffs_base__slice_u8 s,
-                                  uint64_t i,
-                                  uint64_t j) {
-  if ((i <= j) && (j <= SIZE_MAX) && (j <= s.len)) {
-    return ((wuffs_base__slice_u8){
-        .ptr = s.ptr + i,
-        .len = j - i,
-    });
-  }
-  return ((wuffs_base__slice_u8){});
-}
-
-// wuffs_base__slice_u8__prefix returns up to the first up_to bytes of s.
-static inline wuffs_base__slice_u8  //
-wuffs_base__slice_u8__prefix(wuffs_base__slice_u8 s, uint64_t up_to) {
-  if ((uint64_t)(s.len) > up_to) {
-    s.len = up_to;
-  }
-  return s;
-}
-
-// wuffs_base__slice_u8__suffix returns up to the last up_to bytes of s.
-static inline wuffs_base__slice_u8  //
-wuffs_base__slice_u8__suffix(wuffs_base__slice_u8 s, uint64_t up_to) {
-  if ((uint64_t)(s.len) > up_to) {
-    s.ptr += (uint64_t)(s.len) - up_to;
-    s.len = up_to;
-  }
-  return s;
-}
-
-// wuffs_base__slice_u8__copy_from_slice calls memmove(dst.ptr, src.ptr,
-// length) where length is the minimum of dst.len and src.len.
+// WUFFS_BASE__DEFINE_SLICE_AND_TABLE_FUNCS defines these functions for the
+// slice and table types whose element type is T, named N (such as uint16_t
+// and u16):
+//  - wuffs_base__slice_N__subslice_i returns s[i:].
+//  - wuffs_base__slice_N__subslice_j returns s[:j].
+//  - wuffs_base__slice_N__subslice_ij returns s[i:j].
+//  - wuffs_base__slice_N__prefix returns up to the first up_to elements of s.
+//  - wuffs_base__slice_N__suffix returns up to the last up_to elements of s.
+//  - wuffs_base__slice_N__copy_from_slice calls memmove(dst.ptr, src.ptr,
+//    length * sizeof(T)) where length is the minimum of dst.len and src.len,
+//    and returns that length.
+//  - wuffs_base__table_N__row returns the y'th row of t.
 //
-// Passing a wuffs_base__slice_u8 with all fields NULL or zero (a valid, empty
-// slice) is valid and results in a no-op.
-static inline uint64_t  //
-wuffs_base__slice_u8__copy_from_slice(wuffs_base__slice_u8 dst,
-                                      wuffs_base__slice_u8 src) {
-  size_t length = dst.len < src.len ? dst.len : src.len;
-  if (length > 0) {
-    memmove(dst.ptr, src.ptr, length);
+// The subslice and row functions return an empty slice if the indexes are
+// out of bounds. Passing a slice with all fields NULL or zero (a valid, empty
+// slice) to copy_from_slice is valid and results in a no-op.
+#define WUFFS_BASE__DEFINE_SLICE_AND_TABLE_FUNCS(N, T)                     \
+  static inline wuffs_base__slice_##N                                      \
+      wuffs_base__slice_##N##__subslice_i(wuffs_base__slice_##N s,         \
+                                          uint64_t i) {                    \
+    if ((i <= SIZE_MAX) && (i <= s.len)) {                                 \
+      return ((wuffs_base__slice_##N){                                     \
+          .ptr = s.ptr + i,                                                \
+          .len = s.len - i,                                                \
+      });                                                                  \
+    }                                                                      \
+    return ((wuffs_base__slice_##N){});                                    \
+  }                                                                        \
+                                                                           \
+  static inline wuffs_base__slice_##N                                      \
+      wuffs_base__slice_##N##__subslice_j(wuffs_base__slice_##N s,         \
+                                          uint64_t j) {                    \
+    if ((j <= SIZE_MAX) && (j <= s.len)) {                                 \
+      return ((wuffs_base__slice_##N){.ptr = s.ptr, .len = j});            \
+    }                                                                      \
+    return ((wuffs_base__slice_##N){});                                    \
+  }                                                                        \
+                                                                           \
+  static inline wuffs_base__slice_##N                                      \
+      wuffs_base__slice_##N##__subslice_ij(wuffs_base__slice_##N s,        \
+                                           uint64_t i, uint64_t j) {       \
+    if ((i <= j) && (j <= SIZE_MAX) && (j <= s.len)) {                     \
+      return ((wuffs_base__slice_##N){                                     \
+          .ptr = s.ptr + i,                                                \
+          .len = j - i,                                                    \
+      });                                                                  \
+    }                                                                      \
+    return ((wuffs_base__slice_##N){});                                    \
+  }                                                                        \
+                                                                           \
+  static inline wuffs_base__slice_##N                                      \
+      wuffs_base__slice_##N##__prefix(wuffs_base__slice_##N s,             \
+                                      uint64_t up_to) {                    \
+    if ((uint64_t)(s.len) > up_to) {                                       \
+      s.len = up_to;                                                       \
+    }                                                                      \
+    return s;                                                              \
+  }                                                                        \
+                                                                           \
+  static inline wuffs_base__slice_##N                                      \
+      wuffs_base__slice_##N##__suffix(wuffs_base__slice_##N s,             \
+                                      uint64_t up_to) {                    \
+    if ((uint64_t)(s.len) > up_to) {                                       \
+      s.ptr += (uint64_t)(s.len) - up_to;                                  \
+      s.len = up_to;                                                       \
+    }                                                                      \
+    return s;                                                              \
+  }                                                                        \
+                                                                           \
+  static inline uint64_t wuffs_base__slice_##N##__copy_from_slice(         \
+      wuffs_base__slice_##N dst, wuffs_base__slice_##N src) {              \
+    size_t length = dst.len < src.len ? dst.len : src.len;                 \
+    if (length > 0) {                                                      \
+      memmove(dst.ptr, src.ptr, length * sizeof(T));                       \
+    }                                                                      \
+    return length;                                                         \
+  }                                                                        \
+                                                                           \
+  static inline wuffs_base__slice_##N                                      \
+      wuffs_base__table_##N##__row(wuffs_base__table_##N t, uint32_t y) {  \
+    if (y < t.height) {                                                    \
+      return ((wuffs_base__slice_##N){                                     \
+          .ptr = t.ptr + (t.stride * y),                                   \
+          .len = t.width,                                                  \
+      });                                                                  \
+    }                                                                      \
+    return ((wuffs_base__slice_##N){});                                    \
   }
-  return length;
-}
 
-// --------
-
-static inline wuffs_base__slice_u8  //
-wuffs_base__table_u8__row(wuffs_base__table_u8 t, uint32_t y) {
-  if (y < t.height) {
-    return ((wuffs_base__slice_u8){
-        .ptr = t.ptr + (t.stride * y),
-        .len = t.width,
-    });
-  }
-  return ((wuffs_base__slice_u8){});
-}
+WUFFS_BASE__DEFINE_SLICE_AND_TABLE_FUNCS(i8, int8_t)
+WUFFS_BASE__DEFINE_SLICE_AND_TABLE_FUNCS(i16, int16_t)
+WUFFS_BASE__DEFINE_SLICE_AND_TABLE_FUNCS(i32, int32_t)
+WUFFS_BASE__DEFINE_SLICE_AND_TABLE_FUNCS(i64, int64_t)
+WUFFS_BASE__DEFINE_SLICE_AND_TABLE_FUNCS(u8, uint8_t)
+WUFFS_BASE__DEFINE_SLICE_AND_TABLE_FUNCS(u16, uint16_t)
+WUFFS_BASE__DEFINE_SLICE_AND_TABLE_FUNCS(u32, uint32_t)
+WUFFS_BASE__DEFINE_SLICE_AND_TABLE_FUNCS(u64, uint64_t)
 
 // ---------------- Utility
 
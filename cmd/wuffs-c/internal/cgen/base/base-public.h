@@ -174,6 +174,46 @@ wuffs_base__u64__max(uint64_t x, uint64_t y) {
   return x > y ? x : y;
 }
 
+static inline int8_t  //
+wuffs_base__i8__min(int8_t x, int8_t y) {
+  return x < y ? x : y;
+}
+
+static inline int8_t  //
+wuffs_base__i8__max(int8_t x, int8_t y) {
+  return x > y ? x : y;
+}
+
+static inline int16_t  //
+wuffs_base__i16__min(int16_t x, int16_t y) {
+  return x < y ? x : y;
+}
+
+static inline int16_t  //
+wuffs_base__i16__max(int16_t x, int16_t y) {
+  return x > y ? x : y;
+}
+
+static inline int32_t  //
+wuffs_base__i32__min(int32_t x, int32_t y) {
+  return x < y ? x : y;
+}
+
+static inline int32_t  //
+wuffs_base__i32__max(int32_t x, int32_t y) {
+  return x > y ? x : y;
+}
+
+static inline int64_t  //
+wuffs_base__i64__min(int64_t x, int64_t y) {
+  return x < y ? x : y;
+}
+
+static inline int64_t  //
+wuffs_base__i64__max(int64_t x, int64_t y) {
+  return x > y ? x : y;
+}
+
 // --------
 
 // Saturating arithmetic (sat_add, sat_sub) branchless bit-twiddling algorithms
@@ -297,11 +337,19 @@ wuffs_base__u64__byte_swapped(uint64_t x) {
     size_t stride;           \
   }
 
+typedef WUFFS_BASE__SLICE(int8_t) wuffs_base__slice_i8;
+typedef WUFFS_BASE__SLICE(int16_t) wuffs_base__slice_i16;
+typedef WUFFS_BASE__SLICE(int32_t) wuffs_base__slice_i32;
+typedef WUFFS_BASE__SLICE(int64_t) wuffs_base__slice_i64;
 typedef WUFFS_BASE__SLICE(uint8_t) wuffs_base__slice_u8;
 typedef WUFFS_BASE__SLICE(uint16_t) wuffs_base__slice_u16;
 typedef WUFFS_BASE__SLICE(uint32_t) wuffs_base__slice_u32;
 typedef WUFFS_BASE__SLICE(uint64_t) wuffs_base__slice_u64;
 
+typedef WUFFS_BASE__TABLE(int8_t) wuffs_base__table_i8;
+typedef WUFFS_BASE__TABLE(int16_t) wuffs_base__table_i16;
+typedef WUFFS_BASE__TABLE(int32_t) wuffs_base__table_i32;
+typedef WUFFS_BASE__TABLE(int64_t) wuffs_base__table_i64;
 typedef WUFFS_BASE__TABLE(uint8_t) wuffs_base__table_u8;
 typedef WUFFS_BASE__TABLE(uint16_t) wuffs_base__table_u16;
 typedef WUFFS_BASE__TABLE(uint32_t) wuffs_base__table_u32;
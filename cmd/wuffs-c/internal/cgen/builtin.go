@@ -274,11 +274,8 @@ func (g *gen) writeBuiltinNumType(b *buffer, recv *a.Expr, method t.ID, args []*
 		return nil
 
 	case t.IDMax:
-		b.writes("wuffs_base__u")
-		if sz, err := g.sizeof(recv.MType()); err != nil {
+		if err := g.writeNumTypePrefix(b, recv.MType()); err != nil {
 			return err
-		} else {
-			b.printf("%d", 8*sz)
 		}
 		b.writes("__max(")
 		if err := g.writeExpr(b, recv, rp, depth); err != nil {
@@ -292,11 +289,8 @@ func (g *gen) writeBuiltinNumType(b *buffer, recv *a.Expr, method t.ID, args []*
 		return nil
 
 	case t.IDMin:
-		b.writes("wuffs_base__u")
-		if sz, err := g.sizeof(recv.MType()); err != nil {
+		if err := g.writeNumTypePrefix(b, recv.MType()); err != nil {
 			return err
-		} else {
-			b.printf("%d", 8*sz)
 		}
 		b.writes("__min(")
 		if err := g.writeExpr(b, recv, rp, depth); err != nil {
@@ -312,11 +306,29 @@ func (g *gen) writeBuiltinNumType(b *buffer, recv *a.Expr, method t.ID, args []*
 	return errNoSuchBuiltin
 }
 
+// writeNumTypePrefix writes the C function name prefix, such as
+// "wuffs_base__u32" or "wuffs_base__i64", for a numeric type.
+func (g *gen) writeNumTypePrefix(b *buffer, typ *a.TypeExpr) error {
+	sz, err := g.sizeof(typ)
+	if err != nil {
+		return err
+	}
+	if typ.IsSignedInteger() {
+		b.printf("wuffs_base__i%d", 8*sz)
+	} else {
+		b.printf("wuffs_base__u%d", 8*sz)
+	}
+	return nil
+}
+
 func (g *gen) writeBuiltinSlice(b *buffer, recv *a.Expr, method t.ID, args []*a.Node, rp replacementPolicy, depth uint32) error {
 	switch method {
-	case t.IDCopyFromSlice:
-		// TODO: don't assume that the slice is a slice of base.u8.
-		b.writes("wuffs_base__slice_u8__copy_from_slice(")
+	case t.IDCopyFromSlice, t.IDPrefix, t.IDSuffix:
+		elem, err := g.sliceElemName(recv.MType())
+		if err != nil {
+			return err
+		}
+		b.printf("wuffs_base__slice_%s__%s(", elem, method.Str(g.tm))
 		if err := g.writeExpr(b, recv, rp, depth); err != nil {
 			return err
 		}
@@ -330,15 +342,6 @@ func (g *gen) writeBuiltinSlice(b *buffer, recv *a.Expr, method t.ID, args []*a.
 		}
 		b.writes(".len))")
 		return nil
-
-	case t.IDSuffix:
-		// TODO: don't assume that the slice is a slice of base.u8.
-		b.writes("wuffs_base__slice_u8__suffix(")
-		if err := g.writeExpr(b, recv, rp, depth); err != nil {
-			return err
-		}
-		b.writeb(',')
-		return g.writeArgs(b, args, rp, depth)
 	}
 	return errNoSuchBuiltin
 }
@@ -374,8 +377,11 @@ func (g *gen) writeBuiltinTable(b *buffer, recv *a.Expr, method t.ID, args []*a.
 		field = "width"
 
 	case t.IDRow:
-		// TODO: don't assume that the table is a table of base.u8.
-		b.writes("wuffs_base__table_u8__row(")
+		elem, err := g.sliceElemName(recv.MType())
+		if err != nil {
+			return err
+		}
+		b.printf("wuffs_base__table_%s__row(", elem)
 		if err := g.writeExpr(b, recv, rp, depth); err != nil {
 			return err
 		}
@@ -440,6 +446,22 @@ func (g *gen) writeBuiltinCallSuspendibles(b *buffer, n *a.Expr, depth uint32) e
 			b.printf(" = *ioptr_src++;\n")
 			return nil
 
+		case t.IDReadI8:
+			if g.currFunk.tempW > maxTemp {
+				return fmt.Errorf("too many temporary variables required")
+			}
+			temp := g.currFunk.tempW
+			g.currFunk.tempW++
+
+			b.printf("if (WUFFS_BASE__UNLIKELY(ioptr_src == iobounds1_src)) { goto short_read_src; }")
+			g.currFunk.shortReads = append(g.currFunk.shortReads, "src")
+
+			if err := g.writeCTypeName(b, n.MType(), tPrefix, fmt.Sprint(temp)); err != nil {
+				return err
+			}
+			b.printf(" = wuffs_base__u8__as_i8(*ioptr_src++);\n")
+			return nil
+
 		case t.IDReadU16BE:
 			return g.writeReadUXX(b, n, "src", 16, "be")
 		case t.IDReadU16LE:
@@ -468,12 +490,22 @@ func (g *gen) writeBuiltinCallSuspendibles(b *buffer, n *a.Expr, depth uint32) e
 			return g.writeReadUXX(b, n, "src", 64, "be")
 		case t.IDReadU64LE:
 			return g.writeReadUXX(b, n, "src", 64, "le")
+		case t.IDReadI16BE:
+			return g.writeReadUXX(b, n, "src", 16, "be")
+		case t.IDReadI16LE:
+			return g.writeReadUXX(b, n, "src", 16, "le")
+		case t.IDReadI32BE:
+			return g.writeReadUXX(b, n, "src", 32, "be")
+		case t.IDReadI32LE:
+			return g.writeReadUXX(b, n, "src", 32, "le")
+		case t.IDReadI64BE:
+			return g.writeReadUXX(b, n, "src", 64, "be")
+		case t.IDReadI64LE:
+			return g.writeReadUXX(b, n, "src", 64, "le")
 
 		case t.IDSkip:
 			g.currFunk.usesScratch = true
-			// TODO: don't hard-code [0], and allow recursive coroutines.
-			scratchName := fmt.Sprintf("self->private_impl.%s%s[0].scratch",
-				cPrefix, g.currFunk.astFunc.FuncName().Str(g.tm))
+			scratchName := g.currFrame() + ".scratch"
 
 			b.printf("%s = ", scratchName)
 			x := n.Args()[0].AsArg().Value()
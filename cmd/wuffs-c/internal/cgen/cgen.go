@@ -30,9 +30,11 @@ import (
 	"sort"
 	"strings"
 
+	"github.com/google/wuffs/cmd/wuffs-c/internal/cformat"
 	"github.com/google/wuffs/lang/base38"
 	"github.com/google/wuffs/lang/builtin"
 	"github.com/google/wuffs/lang/check"
+	"github.com/google/wuffs/lang/diagnostic"
 	"github.com/google/wuffs/lang/generate"
 
 	cf "github.com/google/wuffs/cmd/commonflags"
@@ -68,8 +70,9 @@ const (
 func Do(args []string) error {
 	flags := flag.FlagSet{}
 	cformatterFlag := flags.String("cformatter", cf.CformatterDefault, cf.CformatterUsage)
+	jsonFlag := flags.Bool("json", cf.JSONDefault, cf.JSONUsage)
 
-	return generate.Do(&flags, args, func(pkgName string, tm *t.Map, c *check.Checker, files []*a.File) ([]byte, error) {
+	err := generate.Do(&flags, args, func(pkgName string, tm *t.Map, c *check.Checker, files []*a.File) ([]byte, error) {
 		if !cf.IsAlphaNumericIsh(*cformatterFlag) {
 			return nil, fmt.Errorf("bad -cformatter flag value %q", *cformatterFlag)
 		}
@@ -110,6 +113,9 @@ func Do(args []string) error {
 			}
 		}
 
+		if *cformatterFlag == "" {
+			return cformat.Format(unformatted)
+		}
 		stdout := &bytes.Buffer{}
 		cmd := exec.Command(*cformatterFlag, "-style=Chromium")
 		cmd.Stdin = bytes.NewReader(unformatted)
@@ -120,6 +126,10 @@ func Do(args []string) error {
 		}
 		return stdout.Bytes(), nil
 	})
+	if *jsonFlag {
+		return diagnostic.JSON("gen", err)
+	}
+	return err
 }
 
 type replacementPolicy bool
@@ -211,7 +221,7 @@ func insertBasePublicH(buf *buffer) error {
 			for _, z := range builtin.StatusList {
 				code := int32(z.Value) << 24
 				b.printf("#define %s %d // 0x%08X\n",
-					strings.ToUpper(cName(z.String(), "WUFFS_BASE__")), code, uint32(code))
+					strings.ToUpper(builtin.CName(z.String(), "WUFFS_BASE__")), code, uint32(code))
 			}
 			b.writes("\n")
 			return nil
@@ -272,9 +282,8 @@ type gen struct {
 	usesList   []string
 	usesMap    map[string]struct{}
 
-	currFunk  funk
-	funks     map[t.QQID]funk
-	wuffsRoot string
+	currFunk funk
+	funks    map[t.QQID]funk
 }
 
 func (g *gen) generate() ([]byte, error) {
@@ -356,10 +365,25 @@ func (g *gen) genHeader(b *buffer) error {
 	}
 
 	b.writes("// ---------------- Structs\n\n")
+	declared := map[t.QID]bool{}
 	for _, n := range g.structList {
+		// A suspended coroutine's out struct is part of its receiver struct.
+		qid := n.QID()
+		if err := g.writeOutStructs(b, bothPubPri, "", func(o *a.Func) bool {
+			return o.Receiver() == qid && g.isEmbeddedOutStruct(o)
+		}, declared); err != nil {
+			return err
+		}
 		if err := g.writeStruct(b, n); err != nil {
 			return err
 		}
+		declared[qid] = true
+	}
+
+	if err := g.writeOutStructs(b, pubOnly, "// ---------------- Public Out Structs\n\n", func(o *a.Func) bool {
+		return !g.isEmbeddedOutStruct(o)
+	}, declared); err != nil {
+		return err
 	}
 
 	b.writes("// ---------------- Public Initializer Prototypes\n\n")
@@ -437,6 +461,12 @@ func (g *gen) genImpl(b *buffer) error {
 		}
 	}
 
+	if err := g.writeOutStructs(b, priOnly, "// ---------------- Private Out Structs\n\n", func(o *a.Func) bool {
+		return !g.isEmbeddedOutStruct(o)
+	}, nil); err != nil {
+		return err
+	}
+
 	b.writes("// ---------------- Private Function Prototypes\n\n")
 	if err := g.forEachFunc(b, priOnly, (*gen).writeFuncPrototype); err != nil {
 		return err
@@ -521,28 +551,7 @@ func (g *gen) forEachUse(b *buffer, f func(*gen, *buffer, *a.Use) error) error {
 }
 
 func (g *gen) cName(name string) string {
-	return cName(name, g.pkgPrefix)
-}
-
-func cName(name string, pkgPrefix string) string {
-	s := []byte(pkgPrefix)
-	underscore := true
-	for _, r := range name {
-		if 'A' <= r && r <= 'Z' {
-			s = append(s, byte(r+'a'-'A'))
-			underscore = false
-		} else if ('a' <= r && r <= 'z') || ('0' <= r && r <= '9') {
-			s = append(s, byte(r))
-			underscore = false
-		} else if !underscore {
-			s = append(s, '_')
-			underscore = true
-		}
-	}
-	if underscore {
-		s = s[:len(s)-1]
-	}
-	return string(s)
+	return builtin.CName(name, g.pkgPrefix)
 }
 
 func uintBits(qid t.QID) uint32 {
@@ -561,11 +570,30 @@ func uintBits(qid t.QID) uint32 {
 	return 0
 }
 
+func intBits(qid t.QID) uint32 {
+	if qid[0] == t.IDBase {
+		switch qid[1] {
+		case t.IDI8:
+			return 8
+		case t.IDI16:
+			return 16
+		case t.IDI32:
+			return 32
+		case t.IDI64:
+			return 64
+		}
+	}
+	return 0
+}
+
 func (g *gen) sizeof(typ *a.TypeExpr) (uint32, error) {
 	if typ.Decorator() == 0 {
 		if n := uintBits(typ.QID()); n != 0 {
 			return n / 8, nil
 		}
+		if n := intBits(typ.QID()); n != 0 {
+			return n / 8, nil
+		}
 	}
 	return 0, fmt.Errorf("unknown sizeof for %q", typ.Str(g.tm))
 }
@@ -672,23 +700,30 @@ func (g *gen) writeStruct(b *buffer, n *a.Struct) error {
 				if o.Receiver() != n.QID() || !o.Suspendible() {
 					continue
 				}
+				if o.Depth() != nil {
+					b.printf("uint32_t %s%s__depth;\n", cPrefix, o.FuncName().Str(g.tm))
+				}
 				k := g.funks[o.QQID()]
 				if k.coroSuspPoint == 0 && !k.usesScratch {
 					continue
 				}
-				// TODO: allow max depth > 1 for recursive coroutines.
-				const maxDepth = 1
 				b.writes("struct {\n")
 				if k.coroSuspPoint != 0 {
 					b.writes("uint32_t coro_susp_point;\n")
 					if err := g.writeVars(b, o.Body(), true, true); err != nil {
 						return err
 					}
+					if k.hasOutVar {
+						if err := g.writeOutTypeName(b, o, "", "out"); err != nil {
+							return err
+						}
+						b.writes(";\n")
+					}
 				}
 				if k.usesScratch {
 					b.writes("uint64_t scratch;\n")
 				}
-				b.printf("} %s%s[%d];\n", cPrefix, o.FuncName().Str(g.tm), maxDepth)
+				b.printf("} %s%s[%d];\n", cPrefix, o.FuncName().Str(g.tm), funcDepth(o))
 			}
 		}
 	}
@@ -779,6 +814,9 @@ func (g *gen) writeCppImpls(b *buffer) error {
 				b.writes(aPrefix)
 				b.writes(o.AsField().Name().Str(g.tm))
 			}
+			if n.Suspendible() && len(n.Out().Fields()) > 0 {
+				b.writes(",out_ptr")
+			}
 			b.writes(");}\n\n")
 		}
 	}
@@ -799,8 +837,6 @@ func (g *gen) writeUse(b *buffer, n *a.Use) error {
 	useDirname := g.tm.ByID(n.Path())
 	useDirname, _ = t.Unescape(useDirname)
 
-	// TODO: sanity check useDirname via commonflags.IsValidUsePath?
-
 	if g.usesMap == nil {
 		g.usesMap = map[string]struct{}{}
 	} else if _, ok := g.usesMap[useDirname]; ok {
@@ -809,15 +845,12 @@ func (g *gen) writeUse(b *buffer, n *a.Use) error {
 	g.usesList = append(g.usesList, useDirname)
 	g.usesMap[useDirname] = struct{}{}
 
-	if g.wuffsRoot == "" {
-		var err error
-		g.wuffsRoot, err = generate.WuffsRoot()
-		if err != nil {
-			return err
-		}
+	// PackageRoot also checks that useDirname is a valid use path.
+	root, err := generate.PackageRoot(useDirname)
+	if err != nil {
+		return err
 	}
-
-	useeFilename := filepath.Join(g.wuffsRoot, "gen", "c", filepath.FromSlash(useDirname)+".h")
+	useeFilename := filepath.Join(root, "gen", "c", filepath.FromSlash(useDirname)+".h")
 	usee, err := ioutil.ReadFile(useeFilename)
 	if err != nil {
 		return err
@@ -911,8 +944,11 @@ func (g *gen) writeInitializerImpl(b *buffer, n *a.Struct) error {
 	for _, f := range n.Fields() {
 		f := f.AsField()
 		x := f.XType()
-		if x != x.Innermost() {
-			// TODO: arrays of sub-structs.
+		arrayLengths := []*big.Int(nil)
+		for ; x.IsArrayType(); x = x.Inner() {
+			arrayLengths = append(arrayLengths, x.ArrayLength().ConstValue())
+		}
+		if x.Decorator() != 0 {
 			continue
 		}
 
@@ -925,12 +961,23 @@ func (g *gen) writeInitializerImpl(b *buffer, n *a.Struct) error {
 			// See gen.packagePrefix for a related TODO with otherPkg.
 			otherPkg := g.tm.ByID(qid[0])
 			prefix = "wuffs_" + otherPkg + "__"
-		} else if g.structMap[qid] == nil {
+		} else if o := g.structMap[qid]; o == nil || !o.Suspendible() {
+			// Only suspendible structs have initializers.
 			continue
 		}
 
-		b.printf("%s%s__check_wuffs_version(&self->private_impl.%s%s, sizeof(self->private_impl.%s%s), WUFFS_VERSION);\n",
-			prefix, qid[1].Str(g.tm), fPrefix, f.Name().Str(g.tm), fPrefix, f.Name().Str(g.tm))
+		// For an array of sub-structs, loop over each (possibly nested) array
+		// element.
+		indexes := ""
+		for i, n := range arrayLengths {
+			b.printf("for (size_t i%d = 0; i%d < %v; i%d++) {\n", i, i, n, i)
+			indexes += fmt.Sprintf("[i%d]", i)
+		}
+		b.printf("%s%s__check_wuffs_version(&self->private_impl.%s%s%s, sizeof(self->private_impl.%s%s%s), WUFFS_VERSION);\n",
+			prefix, qid[1].Str(g.tm), fPrefix, f.Name().Str(g.tm), indexes, fPrefix, f.Name().Str(g.tm), indexes)
+		for range arrayLengths {
+			b.writes("}\n")
+		}
 	}
 
 	b.writes("}\n\n")
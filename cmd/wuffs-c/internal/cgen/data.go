@@ -26,15 +26,16 @@ const baseBasePublicH = "" +
 	"" +
 	"// --------\n\n// Flicks are a unit of time. One flick (frame-tick) is 1 / 705_600_000 of a\n// second. See https://github.com/OculusVR/Flicks\ntypedef int64_t wuffs_base__flicks;\n\n#define WUFFS_BASE__FLICKS_PER_SECOND ((uint64_t)705600000)\n#define WUFFS_BASE__FLICKS_PER_MILLISECOND ((uint64_t)705600)\n\n" +
 	"" +
-	"// ---------------- Numeric Types\n\nstatic inline uint8_t  //\nwuffs_base__u8__min(uint8_t x, uint8_t y) {\n  return x < y ? x : y;\n}\n\nstatic inline uint8_t  //\nwuffs_base__u8__max(uint8_t x, uint8_t y) {\n  return x > y ? x : y;\n}\n\nstatic inline uint16_t  //\nwuffs_base__u16__min(uint16_t x, uint16_t y) {\n  return x < y ? x : y;\n}\n\nstatic inline uint16_t  //\nwuffs_base__u16__max(uint16_t x, uint16_t y) {\n  return x > y ? x : y;\n}\n\nstatic inline uint32_t  //\nwuffs_base__u32__min(uint32_t x, uint32_t y) {\n  return x < y ? x : y;\n}\n\nstatic inline uint32_t  //\nwuffs_base__u32__max(uint32_t x, uint32_t y) {\n  return x > y ? x : y;\n}\n\nstatic inline uint64_t  //\nwuffs_base__u64__min(uint64_t x, uint64_t y) {\n  return x < y ? x : y;\n}\n\nstatic inline uint64_t  //\nwuffs_base__u64__max(uint64_t x, uint64_t y) {\n  return x > y ? x : y;\n}\n\n" +
+	"// ---------------- Numeric Types\n\nstatic inline uint8_t  //\nwuffs_base__u8__min(uint8_t x, uint8_t y) {\n  return x < y ? x : y;\n}\n\nstatic inline uint8_t  //\nwuffs_base__u8__max(uint8_t x, uint8_t y) {\n  return x > y ? x : y;\n}\n\nstatic inline uint16_t  //\nwuffs_base__u16__min(uint16_t x, uint16_t y) {\n  return x < y ? x : y;\n}\n\nstatic inline uint16_t  //\nwuffs_base__u16__max(uint16_t x, uint16_t y) {\n  return x > y ? x : y;\n}\n\nstatic inline uint32_t  //\nwuffs_base__u32__min(uint32_t x, uint32_t y) {\n  return x < y ? x : y;\n}\n\nstatic inline uint32_t  //\nwuffs_base__u32__max(uint32_t x, uint32_t y) {\n  return x > y ? x : y;\n}\n\nstatic inline uint64_t  //\nwuffs_base__u64__min(uint64_t x, uint64_t y) {\n  return x < y ? x : y;\n}\n\nstatic inline uint64_t  //\nwuffs_base__u64__max(uint64_t x, uint64_t y) {\n  return x > y ? x : y;\n}\n\nstatic inline int8_t  //\nwuffs_base__i8__min(int8_t x, int8_t y) {\n  return x < y ? x : y;\n}\n\nstatic inline int8_t  //\nwuffs_base__i8__max(int8_t x, int8_t y) {\n  return x > y ? x : y;\n}\n\ns" +
+	"tatic inline int16_t  //\nwuffs_base__i16__min(int16_t x, int16_t y) {\n  return x < y ? x : y;\n}\n\nstatic inline int16_t  //\nwuffs_base__i16__max(int16_t x, int16_t y) {\n  return x > y ? x : y;\n}\n\nstatic inline int32_t  //\nwuffs_base__i32__min(int32_t x, int32_t y) {\n  return x < y ? x : y;\n}\n\nstatic inline int32_t  //\nwuffs_base__i32__max(int32_t x, int32_t y) {\n  return x > y ? x : y;\n}\n\nstatic inline int64_t  //\nwuffs_base__i64__min(int64_t x, int64_t y) {\n  return x < y ? x : y;\n}\n\nstatic inline int64_t  //\nwuffs_base__i64__max(int64_t x, int64_t y) {\n  return x > y ? x : y;\n}\n\n" +
 	"" +
 	"// --------\n\n// Saturating arithmetic (sat_add, sat_sub) branchless bit-twiddling algorithms\n// are per https://locklessinc.com/articles/sat_arithmetic/\n//\n// It is important that the underlying types are unsigned integers, as signed\n// integer arithmetic overflow is undefined behavior in C.\n\nstatic inline uint8_t  //\nwuffs_base__u8__sat_add(uint8_t x, uint8_t y) {\n  uint8_t res = x + y;\n  res |= -(res < x);\n  return res;\n}\n\nstatic inline uint8_t  //\nwuffs_base__u8__sat_sub(uint8_t x, uint8_t y) {\n  uint8_t res = x - y;\n  res &= -(res <= x);\n  return res;\n}\n\nstatic inline uint16_t  //\nwuffs_base__u16__sat_add(uint16_t x, uint16_t y) {\n  uint16_t res = x + y;\n  res |= -(res < x);\n  return res;\n}\n\nstatic inline uint16_t  //\nwuffs_base__u16__sat_sub(uint16_t x, uint16_t y) {\n  uint16_t res = x - y;\n  res &= -(res <= x);\n  return res;\n}\n\nstatic inline uint32_t  //\nwuffs_base__u32__sat_add(uint32_t x, uint32_t y) {\n  uint32_t res = x + y;\n  res |= -(res < x);\n  return res;\n}\n\nstatic inline uint32_t  //\nwuffs_base_" +
 	"_u32__sat_sub(uint32_t x, uint32_t y) {\n  uint32_t res = x - y;\n  res &= -(res <= x);\n  return res;\n}\n\nstatic inline uint64_t  //\nwuffs_base__u64__sat_add(uint64_t x, uint64_t y) {\n  uint64_t res = x + y;\n  res |= -(res < x);\n  return res;\n}\n\nstatic inline uint64_t  //\nwuffs_base__u64__sat_sub(uint64_t x, uint64_t y) {\n  uint64_t res = x - y;\n  res &= -(res <= x);\n  return res;\n}\n\n" +
 	"" +
 	"// --------\n\n// Clang also defines \"__GNUC__\".\n\nstatic inline uint16_t  //\nwuffs_base__u16__byte_swapped(uint16_t x) {\n#if defined(__GNUC__)\n  return __builtin_bswap16(x);\n#else\n  return (x >> 8) | (x << 8);\n#endif\n}\n\nstatic inline uint32_t  //\nwuffs_base__u32__byte_swapped(uint32_t x) {\n#if defined(__GNUC__)\n  return __builtin_bswap32(x);\n#else\n  static const uint32_t mask8 = 0x00FF00FF;\n  x = ((x >> 8) & mask8) | ((x & mask8) << 8);\n  return (x >> 16) | (x << 16);\n#endif\n}\n\nstatic inline uint64_t  //\nwuffs_base__u64__byte_swapped(uint64_t x) {\n#if defined(__GNUC__)\n  return __builtin_bswap64(x);\n#else\n  static const uint64_t mask8 = 0x00FF00FF00FF00FF;\n  static const uint64_t mask16 = 0x0000FFFF0000FFFF;\n  x = ((x >> 8) & mask8) | ((x & mask8) << 8);\n  x = ((x >> 16) & mask16) | ((x & mask16) << 16);\n  return (x >> 32) | (x << 32);\n#endif\n}\n\n" +
 	"" +
-	"// ---------------- Slices and Tables\n\n// WUFFS_BASE__SLICE is a 1-dimensional buffer.\n//\n// A value with all fields NULL or zero is a valid, empty slice.\n#define WUFFS_BASE__SLICE(T) \\\n  struct {                   \\\n    T* ptr;                  \\\n    size_t len;              \\\n  }\n\n// WUFFS_BASE__TABLE is a 2-dimensional buffer.\n//\n// A value with all fields NULL or zero is a valid, empty table.\n#define WUFFS_BASE__TABLE(T) \\\n  struct {                   \\\n    T* ptr;                  \\\n    size_t width;            \\\n    size_t height;           \\\n    size_t stride;           \\\n  }\n\ntypedef WUFFS_BASE__SLICE(uint8_t) wuffs_base__slice_u8;\ntypedef WUFFS_BASE__SLICE(uint16_t) wuffs_base__slice_u16;\ntypedef WUFFS_BASE__SLICE(uint32_t) wuffs_base__slice_u32;\ntypedef WUFFS_BASE__SLICE(uint64_t) wuffs_base__slice_u64;\n\ntypedef WUFFS_BASE__TABLE(uint8_t) wuffs_base__table_u8;\ntypedef WUFFS_BASE__TABLE(uint16_t) wuffs_base__table_u16;\ntypedef WUFFS_BASE__TABLE(uint32_t) wuffs_base__table_u32;\ntypedef WUFFS_BASE__TAB" +
-	"LE(uint64_t) wuffs_base__table_u64;\n\n" +
+	"// ---------------- Slices and Tables\n\n// WUFFS_BASE__SLICE is a 1-dimensional buffer.\n//\n// A value with all fields NULL or zero is a valid, empty slice.\n#define WUFFS_BASE__SLICE(T) \\\n  struct {                   \\\n    T* ptr;                  \\\n    size_t len;              \\\n  }\n\n// WUFFS_BASE__TABLE is a 2-dimensional buffer.\n//\n// A value with all fields NULL or zero is a valid, empty table.\n#define WUFFS_BASE__TABLE(T) \\\n  struct {                   \\\n    T* ptr;                  \\\n    size_t width;            \\\n    size_t height;           \\\n    size_t stride;           \\\n  }\n\ntypedef WUFFS_BASE__SLICE(int8_t) wuffs_base__slice_i8;\ntypedef WUFFS_BASE__SLICE(int16_t) wuffs_base__slice_i16;\ntypedef WUFFS_BASE__SLICE(int32_t) wuffs_base__slice_i32;\ntypedef WUFFS_BASE__SLICE(int64_t) wuffs_base__slice_i64;\ntypedef WUFFS_BASE__SLICE(uint8_t) wuffs_base__slice_u8;\ntypedef WUFFS_BASE__SLICE(uint16_t) wuffs_base__slice_u16;\ntypedef WUFFS_BASE__SLICE(uint32_t) wuffs_base__slice_u32;\ntypedef WUFFS_BASE__SLICE(ui" +
+	"nt64_t) wuffs_base__slice_u64;\n\ntypedef WUFFS_BASE__TABLE(int8_t) wuffs_base__table_i8;\ntypedef WUFFS_BASE__TABLE(int16_t) wuffs_base__table_i16;\ntypedef WUFFS_BASE__TABLE(int32_t) wuffs_base__table_i32;\ntypedef WUFFS_BASE__TABLE(int64_t) wuffs_base__table_i64;\ntypedef WUFFS_BASE__TABLE(uint8_t) wuffs_base__table_u8;\ntypedef WUFFS_BASE__TABLE(uint16_t) wuffs_base__table_u16;\ntypedef WUFFS_BASE__TABLE(uint32_t) wuffs_base__table_u32;\ntypedef WUFFS_BASE__TABLE(uint64_t) wuffs_base__table_u64;\n\n" +
 	"" +
 	"// ---------------- Ranges and Rects\n\n// Ranges are either inclusive (\"range_ii\") or exclusive (\"range_ie\") on the\n// high end. Both the \"ii\" and \"ie\" flavors are useful in practice.\n//\n// The \"ei\" and \"ee\" flavors also exist in theory, but aren't widely used. In\n// Wuffs, the low end is always inclusive.\n//\n// The \"ii\" (closed interval) flavor is useful when refining e.g. \"the set of\n// all uint32_t values\" to a contiguous subset: \"uint32_t values in the closed\n// interval [M, N]\", for uint32_t values M and N. An unrefined type (in other\n// words, the set of all uint32_t values) is not representable in the \"ie\"\n// flavor because if N equals ((1<<32) - 1) then (N + 1) will overflow.\n//\n// On the other hand, the \"ie\" (half-open interval) flavor is recommended by\n// Dijkstra's \"Why numbering should start at zero\" at\n// http://www.cs.utexas.edu/users/EWD/ewd08xx/EWD831.PDF and a further\n// discussion of motivating rationale is at\n// https://www.quora.com/Why-are-Python-ranges-half-open-exclusive-instead-of-close" +
 	"d-inclusive\n//\n// For example, with \"ie\", the number of elements in \"uint32_t values in the\n// half-open interval [M, N)\" is equal to max(0, N-M). Furthermore, that number\n// of elements (in one dimension, a length, in two dimensions, a width or\n// height) is itself representable as a uint32_t without overflow, again for\n// uint32_t values M and N. In the contrasting \"ii\" flavor, the length of the\n// closed interval [0, (1<<32) - 1] is 1<<32, which cannot be represented as a\n// uint32_t. In Wuffs, because of this potential overflow, the \"ie\" flavor has\n// length / width / height methods, but the \"ii\" flavor does not.\n//\n// It is valid for min > max (for range_ii) or for min >= max (for range_ie),\n// in which case the range is empty. There are multiple representations of an\n// empty range.\n\ntypedef struct wuffs_base__range_ii_u32__struct {\n  uint32_t min_incl;\n  uint32_t max_incl;\n\n#ifdef __cplusplus\n  inline bool is_empty();\n  inline bool equals(wuffs_base__range_ii_u32__struct s);\n  inline bool contains(uint" +
@@ -81,17 +82,21 @@ const baseBasePrivateH = "" +
 	"int64_t  //\nwuffs_base__load_u56be(uint8_t* p) {\n  return ((uint64_t)(p[0]) << 48) | ((uint64_t)(p[1]) << 40) |\n         ((uint64_t)(p[2]) << 32) | ((uint64_t)(p[3]) << 24) |\n         ((uint64_t)(p[4]) << 16) | ((uint64_t)(p[5]) << 8) |\n         ((uint64_t)(p[6]) << 0);\n}\n\nstatic inline uint64_t  //\nwuffs_base__load_u56le(uint8_t* p) {\n  return ((uint64_t)(p[0]) << 0) | ((uint64_t)(p[1]) << 8) |\n         ((uint64_t)(p[2]) << 16) | ((uint64_t)(p[3]) << 24) |\n         ((uint64_t)(p[4]) << 32) | ((uint64_t)(p[5]) << 40) |\n         ((uint64_t)(p[6]) << 48);\n}\n\nstatic inline uint64_t  //\nwuffs_base__load_u64be(uint8_t* p) {\n  return ((uint64_t)(p[0]) << 56) | ((uint64_t)(p[1]) << 48) |\n         ((uint64_t)(p[2]) << 40) | ((uint64_t)(p[3]) << 32) |\n         ((uint64_t)(p[4]) << 24) | ((uint64_t)(p[5]) << 16) |\n         ((uint64_t)(p[6]) << 8) | ((uint64_t)(p[7]) << 0);\n}\n\nstatic inline uint64_t  //\nwuffs_base__load_u64le(uint8_t* p) {\n  return ((uint64_t)(p[0]) << 0) | ((uint64_t)(p[1]) << 8) |\n         ((uint64_t)" +
 	"(p[2]) << 16) | ((uint64_t)(p[3]) << 24) |\n         ((uint64_t)(p[4]) << 32) | ((uint64_t)(p[5]) << 40) |\n         ((uint64_t)(p[6]) << 48) | ((uint64_t)(p[7]) << 56);\n}\n\n" +
 	"" +
+	"// --------\n\n// wuffs_base__u8__as_i8, etc. convert an unsigned integer to the signed\n// integer with the same two's complement bit pattern. A plain C cast does the\n// same on every compiler that we care about, but converting an out-of-range\n// value to a signed integer type is implementation-defined behavior.\n\nstatic inline int8_t  //\nwuffs_base__u8__as_i8(uint8_t x) {\n  return x < 0x80 ? (int8_t)(x) : (int8_t)(-(int8_t)(0xFF - x) - 1);\n}\n\nstatic inline int16_t  //\nwuffs_base__u16__as_i16(uint16_t x) {\n  return x < 0x8000 ? (int16_t)(x) : (int16_t)(-(int16_t)(0xFFFF - x) - 1);\n}\n\nstatic inline int32_t  //\nwuffs_base__u32__as_i32(uint32_t x) {\n  return x < 0x80000000 ? (int32_t)(x) : -(int32_t)(0xFFFFFFFF - x) - 1;\n}\n\nstatic inline int64_t  //\nwuffs_base__u64__as_i64(uint64_t x) {\n  return x < 0x8000000000000000 ? (int64_t)(x)\n                                : -(int64_t)(0xFFFFFFFFFFFFFFFF - x) - 1;\n}\n\n" +
+	"" +
 	"// --------\n\nstatic inline void  //\nwuffs_base__store_u8be(uint8_t* p, uint8_t x) {\n  p[0] = x;\n}\n\nstatic inline void  //\nwuffs_base__store_u16be(uint8_t* p, uint16_t x) {\n  p[0] = x >> 8;\n  p[1] = x >> 0;\n}\n\nstatic inline void  //\nwuffs_base__store_u16le(uint8_t* p, uint16_t x) {\n  p[0] = x >> 0;\n  p[1] = x >> 8;\n}\n\nstatic inline void  //\nwuffs_base__store_u24be(uint8_t* p, uint32_t x) {\n  p[0] = x >> 16;\n  p[1] = x >> 8;\n  p[2] = x >> 0;\n}\n\nstatic inline void  //\nwuffs_base__store_u24le(uint8_t* p, uint32_t x) {\n  p[0] = x >> 0;\n  p[1] = x >> 8;\n  p[2] = x >> 16;\n}\n\nstatic inline void  //\nwuffs_base__store_u32be(uint8_t* p, uint32_t x) {\n  p[0] = x >> 24;\n  p[1] = x >> 16;\n  p[2] = x >> 8;\n  p[3] = x >> 0;\n}\n\nstatic inline void  //\nwuffs_base__store_u32le(uint8_t* p, uint32_t x) {\n  p[0] = x >> 0;\n  p[1] = x >> 8;\n  p[2] = x >> 16;\n  p[3] = x >> 24;\n}\n\nstatic inline void  //\nwuffs_base__store_u40be(uint8_t* p, uint64_t x) {\n  p[0] = x >> 32;\n  p[1] = x >> 24;\n  p[2] = x >> 16;\n  p[3] = x >> 8;\n  p[4] = x >>" +
 	" 0;\n}\n\nstatic inline void  //\nwuffs_base__store_u40le(uint8_t* p, uint64_t x) {\n  p[0] = x >> 0;\n  p[1] = x >> 8;\n  p[2] = x >> 16;\n  p[3] = x >> 24;\n  p[4] = x >> 32;\n}\n\nstatic inline void  //\nwuffs_base__store_u48be(uint8_t* p, uint64_t x) {\n  p[0] = x >> 40;\n  p[1] = x >> 32;\n  p[2] = x >> 24;\n  p[3] = x >> 16;\n  p[4] = x >> 8;\n  p[5] = x >> 0;\n}\n\nstatic inline void  //\nwuffs_base__store_u48le(uint8_t* p, uint64_t x) {\n  p[0] = x >> 0;\n  p[1] = x >> 8;\n  p[2] = x >> 16;\n  p[3] = x >> 24;\n  p[4] = x >> 32;\n  p[5] = x >> 40;\n}\n\nstatic inline void  //\nwuffs_base__store_u56be(uint8_t* p, uint64_t x) {\n  p[0] = x >> 48;\n  p[1] = x >> 40;\n  p[2] = x >> 32;\n  p[3] = x >> 24;\n  p[4] = x >> 16;\n  p[5] = x >> 8;\n  p[6] = x >> 0;\n}\n\nstatic inline void  //\nwuffs_base__store_u56le(uint8_t* p, uint64_t x) {\n  p[0] = x >> 0;\n  p[1] = x >> 8;\n  p[2] = x >> 16;\n  p[3] = x >> 24;\n  p[4] = x >> 32;\n  p[5] = x >> 40;\n  p[6] = x >> 48;\n}\n\nstatic inline void  //\nwuffs_base__store_u64be(uint8_t* p, uint64_t x) {\n  p[0] = x >> 56" +
 	";\n  p[1] = x >> 48;\n  p[2] = x >> 40;\n  p[3] = x >> 32;\n  p[4] = x >> 24;\n  p[5] = x >> 16;\n  p[6] = x >> 8;\n  p[7] = x >> 0;\n}\n\nstatic inline void  //\nwuffs_base__store_u64le(uint8_t* p, uint64_t x) {\n  p[0] = x >> 0;\n  p[1] = x >> 8;\n  p[2] = x >> 16;\n  p[3] = x >> 24;\n  p[4] = x >> 32;\n  p[5] = x >> 40;\n  p[6] = x >> 48;\n  p[7] = x >> 56;\n}\n\n" +
 	"" +
 	"// --------\n\nstatic inline void  //\nwuffs_base__u8__sat_add_indirect(uint8_t* x, uint8_t y) {\n  *x = wuffs_base__u8__sat_add(*x, y);\n}\n\nstatic inline void  //\nwuffs_base__u8__sat_sub_indirect(uint8_t* x, uint8_t y) {\n  *x = wuffs_base__u8__sat_sub(*x, y);\n}\n\nstatic inline void  //\nwuffs_base__u16__sat_add_indirect(uint16_t* x, uint16_t y) {\n  *x = wuffs_base__u16__sat_add(*x, y);\n}\n\nstatic inline void  //\nwuffs_base__u16__sat_sub_indirect(uint16_t* x, uint16_t y) {\n  *x = wuffs_base__u16__sat_sub(*x, y);\n}\n\nstatic inline void  //\nwuffs_base__u32__sat_add_indirect(uint32_t* x, uint32_t y) {\n  *x = wuffs_base__u32__sat_add(*x, y);\n}\n\nstatic inline void  //\nwuffs_base__u32__sat_sub_indirect(uint32_t* x, uint32_t y) {\n  *x = wuffs_base__u32__sat_sub(*x, y);\n}\n\nstatic inline void  //\nwuffs_base__u64__sat_add_indirect(uint64_t* x, uint64_t y) {\n  *x = wuffs_base__u64__sat_add(*x, y);\n}\n\nstatic inline void  //\nwuffs_base__u64__sat_sub_indirect(uint64_t* x, uint64_t y) {\n  *x = wuffs_base__u64__sat_sub(*x, y);\n}\n\n" +
 	"" +
-	"// ---------------- Slices and Tables\n\nstatic inline wuffs_base__slice_u8  //\nwuffs_base__slice_u8__subslice_i(wuffs_base__slice_u8 s, uint64_t i) {\n  if ((i <= SIZE_MAX) && (i <= s.len)) {\n    return ((wuffs_base__slice_u8){\n        .ptr = s.ptr + i,\n        .len = s.len - i,\n    });\n  }\n  return ((wuffs_base__slice_u8){});\n}\n\nstatic inline wuffs_base__slice_u8  //\nwuffs_base__slice_u8__subslice_j(wuffs_base__slice_u8 s, uint64_t j) {\n  if ((j <= SIZE_MAX) && (j <= s.len)) {\n    return ((wuffs_base__slice_u8){.ptr = s.ptr, .len = j});\n  }\n  return ((wuffs_base__slice_u8){});\n}\n\nstatic inline wuffs_base__slice_u8  //\nwuffs_base__slice_u8__subslice_ij(wuffs_base__slice_u8 s,\n                                  uint64_t i,\n                                  uint64_t j) {\n  if ((i <= j) && (j <= SIZE_MAX) && (j <= s.len)) {\n    return ((wuffs_base__slice_u8){\n        .ptr = s.ptr + i,\n        .len = j - i,\n    });\n  }\n  return ((wuffs_base__slice_u8){});\n}\n\n// wuffs_base__slice_u8__prefix returns up to the first up" +
-	"_to bytes of s.\nstatic inline wuffs_base__slice_u8  //\nwuffs_base__slice_u8__prefix(wuffs_base__slice_u8 s, uint64_t up_to) {\n  if ((uint64_t)(s.len) > up_to) {\n    s.len = up_to;\n  }\n  return s;\n}\n\n// wuffs_base__slice_u8__suffix returns up to the last up_to bytes of s.\nstatic inline wuffs_base__slice_u8  //\nwuffs_base__slice_u8__suffix(wuffs_base__slice_u8 s, uint64_t up_to) {\n  if ((uint64_t)(s.len) > up_to) {\n    s.ptr += (uint64_t)(s.len) - up_to;\n    s.len = up_to;\n  }\n  return s;\n}\n\n// wuffs_base__slice_u8__copy_from_slice calls memmove(dst.ptr, src.ptr,\n// length) where length is the minimum of dst.len and src.len.\n//\n// Passing a wuffs_base__slice_u8 with all fields NULL or zero (a valid, empty\n// slice) is valid and results in a no-op.\nstatic inline uint64_t  //\nwuffs_base__slice_u8__copy_from_slice(wuffs_base__slice_u8 dst,\n                                      wuffs_base__slice_u8 src) {\n  size_t length = dst.len < src.len ? dst.len : src.len;\n  if (length > 0) {\n    memmove(dst.ptr, src.ptr, leng" +
-	"th);\n  }\n  return length;\n}\n\n" +
-	"" +
-	"// --------\n\nstatic inline wuffs_base__slice_u8  //\nwuffs_base__table_u8__row(wuffs_base__table_u8 t, uint32_t y) {\n  if (y < t.height) {\n    return ((wuffs_base__slice_u8){\n        .ptr = t.ptr + (t.stride * y),\n        .len = t.width,\n    });\n  }\n  return ((wuffs_base__slice_u8){});\n}\n\n" +
+	"// ---------------- Slices and Tables\n\n// WUFFS_BASE__DEFINE_SLICE_AND_TABLE_FUNCS defines these functions for the\n// slice and table types whose element type is T, named N (such as uint16_t\n// and u16):\n//  - wuffs_base__slice_N__subslice_i returns s[i:].\n//  - wuffs_base__slice_N__subslice_j returns s[:j].\n//  - wuffs_base__slice_N__subslice_ij returns s[i:j].\n//  - wuffs_base__slice_N__prefix returns up to the first up_to elements of s.\n//  - wuffs_base__slice_N__suffix returns up to the last up_to elements of s.\n//  - wuffs_base__slice_N__copy_from_slice calls memmove(dst.ptr, src.ptr,\n//    length * sizeof(T)) where length is the minimum of dst.len and src.len,\n//    and returns that length.\n//  - wuffs_base__table_N__row returns the y'th row of t.\n//\n// The subslice and row functions return an empty slice if the indexes are\n// out of bounds. Passing a slice with all fields NULL or zero (a valid, empty\n// slice) to copy_from_slice is valid and results in a no-op.\n#define WUFFS_BASE__DEFINE_SLICE_AND_TABL" +
+	"E_FUNCS(N, T)                     \\\n  static inline wuffs_base__slice_##N                                      \\\n      wuffs_base__slice_##N##__subslice_i(wuffs_base__slice_##N s,         \\\n                                          uint64_t i) {                    \\\n    if ((i <= SIZE_MAX) && (i <= s.len)) {                                 \\\n      return ((wuffs_base__slice_##N){                                     \\\n          .ptr = s.ptr + i,                                                \\\n          .len = s.len - i,                                                \\\n      });                                                                  \\\n    }                                                                      \\\n    return ((wuffs_base__slice_##N){});                                    \\\n  }                                                                        \\\n                                                                           \\\n  static inline wuffs_base__slice_##N                           " +
+	"           \\\n      wuffs_base__slice_##N##__subslice_j(wuffs_base__slice_##N s,         \\\n                                          uint64_t j) {                    \\\n    if ((j <= SIZE_MAX) && (j <= s.len)) {                                 \\\n      return ((wuffs_base__slice_##N){.ptr = s.ptr, .len = j});            \\\n    }                                                                      \\\n    return ((wuffs_base__slice_##N){});                                    \\\n  }                                                                        \\\n                                                                           \\\n  static inline wuffs_base__slice_##N                                      \\\n      wuffs_base__slice_##N##__subslice_ij(wuffs_base__slice_##N s,        \\\n                                           uint64_t i, uint64_t j) {       \\\n    if ((i <= j) && (j <= SIZE_MAX) && (j <= s.len)) {                     \\\n      return ((wuffs_base__slice_##N){                                     \\\n          " +
+	".ptr = s.ptr + i,                                                \\\n          .len = j - i,                                                    \\\n      });                                                                  \\\n    }                                                                      \\\n    return ((wuffs_base__slice_##N){});                                    \\\n  }                                                                        \\\n                                                                           \\\n  static inline wuffs_base__slice_##N                                      \\\n      wuffs_base__slice_##N##__prefix(wuffs_base__slice_##N s,             \\\n                                      uint64_t up_to) {                    \\\n    if ((uint64_t)(s.len) > up_to) {                                       \\\n      s.len = up_to;                                                       \\\n    }                                                                      \\\n    return s;                    " +
+	"                                          \\\n  }                                                                        \\\n                                                                           \\\n  static inline wuffs_base__slice_##N                                      \\\n      wuffs_base__slice_##N##__suffix(wuffs_base__slice_##N s,             \\\n                                      uint64_t up_to) {                    \\\n    if ((uint64_t)(s.len) > up_to) {                                       \\\n      s.ptr += (uint64_t)(s.len) - up_to;                                  \\\n      s.len = up_to;                                                       \\\n    }                                                                      \\\n    return s;                                                              \\\n  }                                                                        \\\n                                                                           \\\n  static inline uint64_t wuffs_base__slice_##N##__copy_f" +
+	"rom_slice(         \\\n      wuffs_base__slice_##N dst, wuffs_base__slice_##N src) {              \\\n    size_t length = dst.len < src.len ? dst.len : src.len;                 \\\n    if (length > 0) {                                                      \\\n      memmove(dst.ptr, src.ptr, length * sizeof(T));                       \\\n    }                                                                      \\\n    return length;                                                         \\\n  }                                                                        \\\n                                                                           \\\n  static inline wuffs_base__slice_##N                                      \\\n      wuffs_base__table_##N##__row(wuffs_base__table_##N t, uint32_t y) {  \\\n    if (y < t.height) {                                                    \\\n      return ((wuffs_base__slice_##N){                                     \\\n          .ptr = t.ptr + (t.stride * y),                                   \\\n  " +
+	"        .len = t.width,                                                  \\\n      });                                                                  \\\n    }                                                                      \\\n    return ((wuffs_base__slice_##N){});                                    \\\n  }\n\nWUFFS_BASE__DEFINE_SLICE_AND_TABLE_FUNCS(i8, int8_t)\nWUFFS_BASE__DEFINE_SLICE_AND_TABLE_FUNCS(i16, int16_t)\nWUFFS_BASE__DEFINE_SLICE_AND_TABLE_FUNCS(i32, int32_t)\nWUFFS_BASE__DEFINE_SLICE_AND_TABLE_FUNCS(i64, int64_t)\nWUFFS_BASE__DEFINE_SLICE_AND_TABLE_FUNCS(u8, uint8_t)\nWUFFS_BASE__DEFINE_SLICE_AND_TABLE_FUNCS(u16, uint16_t)\nWUFFS_BASE__DEFINE_SLICE_AND_TABLE_FUNCS(u32, uint32_t)\nWUFFS_BASE__DEFINE_SLICE_AND_TABLE_FUNCS(u64, uint64_t)\n\n" +
 	"" +
 	"// ---------------- Utility\n\nstatic inline wuffs_base__range_ii_u32  //\nwuffs_base__utility__make_range_ii_u32(wuffs_base__utility* ignored,\n                                       uint32_t min_incl,\n                                       uint32_t max_incl) {\n  return ((wuffs_base__range_ii_u32){\n      .min_incl = min_incl,\n      .max_incl = max_incl,\n  });\n}\n\nstatic inline wuffs_base__range_ie_u32  //\nwuffs_base__utility__make_range_ie_u32(wuffs_base__utility* ignored,\n                                       uint32_t min_incl,\n                                       uint32_t max_excl) {\n  return ((wuffs_base__range_ie_u32){\n      .min_incl = min_incl,\n      .max_excl = max_excl,\n  });\n}\n\nstatic inline wuffs_base__range_ii_u64  //\nwuffs_base__utility__make_range_ii_u64(wuffs_base__utility* ignored,\n                                       uint64_t min_incl,\n                                       uint64_t max_incl) {\n  return ((wuffs_base__range_ii_u64){\n      .min_incl = min_incl,\n      .max_incl = max_incl,\n  });" +
 	"\n}\n\nstatic inline wuffs_base__range_ie_u64  //\nwuffs_base__utility__make_range_ie_u64(wuffs_base__utility* ignored,\n                                       uint64_t min_incl,\n                                       uint64_t max_excl) {\n  return ((wuffs_base__range_ie_u64){\n      .min_incl = min_incl,\n      .max_excl = max_excl,\n  });\n}\n\nstatic inline wuffs_base__rect_ii_u32  //\nwuffs_base__utility__make_rect_ii_u32(wuffs_base__utility* ignored,\n                                      uint32_t min_incl_x,\n                                      uint32_t min_incl_y,\n                                      uint32_t max_incl_x,\n                                      uint32_t max_incl_y) {\n  return ((wuffs_base__rect_ii_u32){\n      .min_incl_x = min_incl_x,\n      .min_incl_y = min_incl_y,\n      .max_incl_x = max_incl_x,\n      .max_incl_y = max_incl_y,\n  });\n}\n\nstatic inline wuffs_base__rect_ie_u32  //\nwuffs_base__utility__make_rect_ie_u32(wuffs_base__utility* ignored,\n                                      uint32_t min_incl" +
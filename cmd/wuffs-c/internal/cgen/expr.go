@@ -46,7 +46,13 @@ func (g *gen) writeExpr(b *buffer, n *a.Expr, rp replacementPolicy, depth uint32
 
 	if cv := n.ConstValue(); cv != nil {
 		if typ := n.MType(); typ.IsNumTypeOrIdeal() {
-			b.writes(cv.String())
+			if cv.Cmp(numTypeBounds[t.IDI64][0]) == 0 {
+				// In C, "-9223372036854775808" is the negation of a literal
+				// that is too large for an int64_t.
+				b.writes("INT64_MIN")
+			} else {
+				b.writes(cv.String())
+			}
 		} else if typ.IsNullptr() {
 			b.writes("NULL")
 		} else if cv.Cmp(zero) == 0 {
@@ -75,6 +81,8 @@ func (g *gen) writeExprOther(b *buffer, n *a.Expr, rp replacementPolicy, depth u
 	case 0:
 		if id1 := n.Ident(); id1 == t.IDThis {
 			b.writes("self")
+		} else if id1 == t.IDOut {
+			b.writes("out")
 		} else {
 			if n.GlobalIdent() {
 				b.writes(g.pkgPrefix)
@@ -127,7 +135,7 @@ func (g *gen) writeExprOther(b *buffer, n *a.Expr, rp replacementPolicy, depth u
 			return nil
 		}
 
-		return g.writeExprUserDefinedCall(b, n, rp, depth)
+		return g.writeExprUserDefinedCall(b, n, rp, depth, "")
 
 	case t.IDOpenBracket:
 		// n is an index.
@@ -135,7 +143,6 @@ func (g *gen) writeExprOther(b *buffer, n *a.Expr, rp replacementPolicy, depth u
 			return err
 		}
 		if lTyp := n.LHS().AsExpr().MType(); lTyp.IsSliceType() {
-			// TODO: don't assume that the slice is a slice of base.u8.
 			b.writes(".ptr")
 		}
 		b.writeb('[')
@@ -150,19 +157,22 @@ func (g *gen) writeExprOther(b *buffer, n *a.Expr, rp replacementPolicy, depth u
 		lhs := n.LHS().AsExpr()
 		mhs := n.MHS().AsExpr()
 		rhs := n.RHS().AsExpr()
+		elem, err := g.sliceElemName(n.MType())
+		if err != nil {
+			return err
+		}
 		switch {
 		case mhs != nil && rhs == nil:
-			b.writes("wuffs_base__slice_u8__subslice_i(")
+			b.printf("wuffs_base__slice_%s__subslice_i(", elem)
 		case mhs == nil && rhs != nil:
-			b.writes("wuffs_base__slice_u8__subslice_j(")
+			b.printf("wuffs_base__slice_%s__subslice_j(", elem)
 		case mhs != nil && rhs != nil:
-			b.writes("wuffs_base__slice_u8__subslice_ij(")
+			b.printf("wuffs_base__slice_%s__subslice_ij(", elem)
 		}
 
 		lhsIsArray := lhs.MType().IsArrayType()
 		if lhsIsArray {
-			// TODO: don't assume that the slice is a slice of base.u8.
-			b.writes("((wuffs_base__slice_u8){.ptr=")
+			b.printf("((wuffs_base__slice_%s){.ptr=", elem)
 		}
 		if err := g.writeExpr(b, lhs, rp, depth); err != nil {
 			return err
@@ -195,6 +205,15 @@ func (g *gen) writeExprOther(b *buffer, n *a.Expr, rp replacementPolicy, depth u
 			b.writes(n.Ident().Str(g.tm))
 			return nil
 		}
+		if lhs.Ident() == t.IDOut {
+			// A single out field is held in the "out" variable itself.
+			b.writes("out")
+			if len(g.currFunk.astFunc.Out().Fields()) > 1 {
+				b.writes("." + fPrefix)
+				b.writes(n.Ident().Str(g.tm))
+			}
+			return nil
+		}
 
 		if err := g.writeExpr(b, lhs, rp, depth); err != nil {
 			return err
@@ -216,7 +235,7 @@ func (g *gen) writeExprOther(b *buffer, n *a.Expr, rp replacementPolicy, depth u
 			if z.Message == "" {
 				return fmt.Errorf("no status code for %q", msg)
 			}
-			status.name = strings.ToUpper(cName(z.String(), "WUFFS_BASE__"))
+			status.name = strings.ToUpper(builtin.CName(z.String(), "WUFFS_BASE__"))
 		}
 		b.writes(status.name)
 		return nil
@@ -252,6 +271,27 @@ func (g *gen) writeExprBinaryOp(b *buffer, n *a.Expr, rp replacementPolicy, dept
 		b.printf("wuffs_base__u%d__sat_%s", uBits, uOp)
 		opName = ","
 
+	case t.IDXBinaryTildeModShiftL, t.IDXBinaryTildeModPlus,
+		t.IDXBinaryTildeModMinus, t.IDXBinaryTildeModStar:
+		opName = cOpName(op)
+		if uBits := uintBits(n.MType().QID()); uBits == 8 || uBits == 16 {
+			// C promotes narrower unsigned types to (signed) int, so that
+			// e.g. (x ~mod* y) for u16 values could overflow, and (x ~mod+
+			// y) for u8 values might not wrap. Instead, do the arithmetic as
+			// uint32_t and truncate the result.
+			b.printf("((uint%d_t)(((uint32_t)(", uBits)
+			if err := g.writeExpr(b, n.LHS().AsExpr(), rp, depth); err != nil {
+				return err
+			}
+			b.writes("))")
+			b.writes(opName)
+			if err := g.writeExpr(b, n.RHS().AsExpr(), rp, depth); err != nil {
+				return err
+			}
+			b.writes("))")
+			return nil
+		}
+
 	case t.IDXBinaryAs:
 		return g.writeExprAs(b, n.LHS().AsExpr(), n.RHS().AsTypeExpr(), rp, depth)
 
@@ -309,7 +349,9 @@ func (g *gen) writeExprAssociativeOp(b *buffer, n *a.Expr, rp replacementPolicy,
 	return nil
 }
 
-func (g *gen) writeExprUserDefinedCall(b *buffer, n *a.Expr, rp replacementPolicy, depth uint32) error {
+// writeExprUserDefinedCall writes the call n. For a suspendible callee that
+// has out fields, outPtr is the C expression for its out_ptr argument.
+func (g *gen) writeExprUserDefinedCall(b *buffer, n *a.Expr, rp replacementPolicy, depth uint32, outPtr string) error {
 	method := n.LHS().AsExpr()
 	recv := method.LHS().AsExpr()
 	recvTyp, addr := recv.MType(), "&"
@@ -328,35 +370,49 @@ func (g *gen) writeExprUserDefinedCall(b *buffer, n *a.Expr, rp replacementPolic
 	if len(n.Args()) > 0 {
 		b.writeb(',')
 	}
-	return g.writeArgs(b, n.Args(), rp, depth)
+	if outPtr == "" {
+		return g.writeArgs(b, n.Args(), rp, depth)
+	}
+	for _, o := range n.Args() {
+		if err := g.writeExpr(b, o.AsArg().Value(), rp, depth); err != nil {
+			return err
+		}
+		b.writeb(',')
+	}
+	b.printf("%s)", outPtr)
+	return nil
+}
+
+// userDefinedCallee returns the function or method called by n, a call to a
+// user-defined (not built-in) function.
+func (g *gen) userDefinedCallee(n *a.Expr) (*a.Func, error) {
+	method := n.LHS().AsExpr()
+	recvTyp := method.LHS().AsExpr().MType().Pointee()
+	qid := recvTyp.QID()
+	if f := g.checker.Func(t.QQID{qid[0], qid[1], method.Ident()}); f != nil {
+		return f, nil
+	}
+	return nil, fmt.Errorf("cannot resolve user-defined method call %q", n.Str(g.tm))
 }
 
 func (g *gen) writeCTypeName(b *buffer, n *a.TypeExpr, varNamePrefix string, varName string) error {
 	// It may help to refer to http://unixwiz.net/techtips/reading-cdecl.html
 
-	// TODO: fix this, allow slices of all types, not just of base.u8's. Also
-	// allow arrays of slices, slices of pointers, etc.
-	if n.IsSliceType() {
-		o := n.Inner()
-		if o.Decorator() == 0 && o.QID() == (t.QID{t.IDBase, t.IDU8}) && !o.IsRefined() {
-			b.writes("wuffs_base__slice_u8")
-			b.writeb(' ')
-			b.writes(varNamePrefix)
-			b.writes(varName)
-			return nil
-		}
-		return fmt.Errorf("cannot convert Wuffs type %q to C", n.Str(g.tm))
+	if n.Decorator() == t.IDOut {
+		qid := n.Receiver().QID()
+		b.printf("%s%s__%s__out %s%s", g.packagePrefix(qid), qid[1].Str(g.tm),
+			n.FuncName().Str(g.tm), varNamePrefix, varName)
+		return nil
 	}
-	if n.IsTableType() {
-		o := n.Inner()
-		if o.Decorator() == 0 && o.QID() == (t.QID{t.IDBase, t.IDU8}) && !o.IsRefined() {
-			b.writes("wuffs_base__table_u8")
-			b.writeb(' ')
-			b.writes(varNamePrefix)
-			b.writes(varName)
-			return nil
+
+	// TODO: allow arrays of slices, slices of pointers, etc.
+	if n.IsSliceType() || n.IsTableType() {
+		elem, err := g.sliceElemName(n)
+		if err != nil {
+			return err
 		}
-		return fmt.Errorf("cannot convert Wuffs type %q to C", n.Str(g.tm))
+		b.printf("wuffs_base__%s_%s %s%s", n.Decorator().Str(g.tm), elem, varNamePrefix, varName)
+		return nil
 	}
 
 	// maxNumPointers is an arbitrary implementation restriction.
@@ -411,6 +467,18 @@ func (g *gen) writeCTypeName(b *buffer, n *a.TypeExpr, varNamePrefix string, var
 	return nil
 }
 
+// sliceElemName returns the "u16" in "wuffs_base__slice_u16" or in
+// "wuffs_base__table_u16", for the slice or table type n. The element type
+// must be a numeric type. Its refinement, if any, does not matter.
+func (g *gen) sliceElemName(n *a.TypeExpr) (string, error) {
+	if o := n.Inner(); o != nil && o.Decorator() == 0 {
+		if qid := o.QID(); qid[0] == t.IDBase && qid[1].IsNumType() {
+			return qid[1].Str(g.tm), nil
+		}
+	}
+	return "", fmt.Errorf("cannot convert Wuffs type %q to C", n.Str(g.tm))
+}
+
 func (g *gen) packagePrefix(qid t.QID) string {
 	if qid[0] != 0 {
 		otherPkg := g.tm.ByID(qid[0])
@@ -470,6 +538,7 @@ var cOpNames = [...]string{
 	t.IDTildeModShiftLEq: " <<= ",
 	t.IDTildeModPlusEq:   " += ",
 	t.IDTildeModMinusEq:  " -= ",
+	t.IDTildeModStarEq:   " *= ",
 	t.IDTildeSatPlusEq:   noSuchCOperator,
 	t.IDTildeSatMinusEq:  noSuchCOperator,
 
@@ -492,6 +561,7 @@ var cOpNames = [...]string{
 	t.IDXBinaryTildeModShiftL: " << ",
 	t.IDXBinaryTildeModPlus:   " + ",
 	t.IDXBinaryTildeModMinus:  " - ",
+	t.IDXBinaryTildeModStar:   " * ",
 	t.IDXBinaryTildeSatPlus:   noSuchCOperator,
 	t.IDXBinaryTildeSatMinus:  noSuchCOperator,
 	t.IDXBinaryNotEq:          " != ",
@@ -15,6 +15,7 @@
 package cgen
 
 import (
+	"errors"
 	"fmt"
 	"math/big"
 
@@ -41,6 +42,7 @@ type funk struct {
 	suspendible   bool
 	usesScratch   bool
 	hasGotoOK     bool
+	hasOutVar     bool
 	shortReads    []string
 }
 
@@ -85,18 +87,17 @@ func (g *gen) writeFuncSignature(b *buffer, n *a.Func, cpp uint32) error {
 		b.writes("static ")
 	}
 
-	// TODO: write n's return values.
+	// A suspendible function's out value, if any, is written through an
+	// extra pointer argument. A non-suspendible function returns it.
 	if n.Suspendible() {
 		b.writes("wuffs_base__status ")
-	} else if outFields := n.Out().Fields(); len(outFields) == 0 {
+	} else if len(n.Out().Fields()) == 0 {
 		b.writes("void ")
-	} else if len(outFields) == 1 {
+	} else {
 		// TODO: does this generate the right C if the XType is an array?
-		if err := g.writeCTypeName(b, outFields[0].AsField().XType(), "", ""); err != nil {
+		if err := g.writeOutTypeName(b, n, "", ""); err != nil {
 			return err
 		}
-	} else {
-		return fmt.Errorf("TODO: multiple return values")
 	}
 
 	if cpp != cppInsideStruct {
@@ -137,10 +138,89 @@ func (g *gen) writeFuncSignature(b *buffer, n *a.Func, cpp uint32) error {
 		}
 	}
 
+	if n.Suspendible() && len(n.Out().Fields()) > 0 {
+		if comma {
+			b.writeb(',')
+		}
+		if err := g.writeOutTypeName(b, n, "*", "out_ptr"); err != nil {
+			return err
+		}
+	}
+
 	b.printf(")")
 	return nil
 }
 
+// writeOutTypeName writes the C type of n's out value: the type of its out
+// field if it has exactly one, or else an out struct.
+func (g *gen) writeOutTypeName(b *buffer, n *a.Func, varNamePrefix string, varName string) error {
+	if outFields := n.Out().Fields(); len(outFields) == 1 {
+		return g.writeCTypeName(b, outFields[0].AsField().XType(), varNamePrefix, varName)
+	}
+	b.printf("%s__out %s%s", g.funcCName(n), varNamePrefix, varName)
+	return nil
+}
+
+// writeOutStruct writes the struct type for the out fields of n, if n has
+// more than one out field.
+func (g *gen) writeOutStruct(b *buffer, n *a.Func) error {
+	outFields := n.Out().Fields()
+	if len(outFields) <= 1 {
+		return nil
+	}
+	b.writes("typedef struct {\n")
+	for _, o := range outFields {
+		o := o.AsField()
+		if err := g.writeCTypeName(b, o.XType(), fPrefix, o.Name().Str(g.tm)); err != nil {
+			return err
+		}
+		b.writes(";\n")
+	}
+	b.printf("} %s__out;\n\n", g.funcCName(n))
+	return nil
+}
+
+// writeOutStructs writes the out structs of the funcs, of visibility v, for
+// which f returns true. The banner, if non-empty, is written first, but only
+// if there is at least one such out struct. If declared is non-nil, it is an
+// error for an out field to be of one of this package's struct types that is
+// not in declared.
+func (g *gen) writeOutStructs(b *buffer, v visibility, banner string, f func(*a.Func) bool, declared map[t.QID]bool) error {
+	return g.forEachFunc(b, v, func(g *gen, b *buffer, n *a.Func) error {
+		if len(n.Out().Fields()) <= 1 || !f(n) {
+			return nil
+		}
+		if declared != nil {
+			for _, o := range n.Out().Fields() {
+				qid := o.AsField().XType().Innermost().QID()
+				if g.structMap[qid] != nil && !declared[qid] {
+					return fmt.Errorf("out struct for %q needs struct %q to be declared first",
+						n.QQID().Str(g.tm), qid.Str(g.tm))
+				}
+			}
+		}
+		if banner != "" {
+			b.writes(banner)
+			banner = ""
+		}
+		return g.writeOutStruct(b, n)
+	})
+}
+
+// isEmbeddedOutStruct returns whether n's out struct is part of its receiver
+// struct, as the saved out value of a suspended coroutine. Such an out struct
+// has to be declared before that receiver struct, even if n is private.
+func (g *gen) isEmbeddedOutStruct(n *a.Func) bool {
+	if len(n.Out().Fields()) <= 1 || !n.Suspendible() {
+		return false
+	}
+	if o := g.structMap[n.Receiver()]; o == nil || !o.Suspendible() {
+		return false
+	}
+	k := g.funks[n.QQID()]
+	return k.coroSuspPoint != 0 && k.hasOutVar
+}
+
 func (g *gen) writeFuncPrototype(b *buffer, n *a.Func) error {
 	if err := g.writeFuncSignature(b, n, cppNone); err != nil {
 		return err
@@ -164,8 +244,11 @@ func (g *gen) writeFuncImpl(b *buffer, n *a.Func) error {
 	b.writex(k.bBody)
 	if k.suspendible && k.coroSuspPoint > 0 {
 		b.writex(k.bBodySuspend)
-	} else if k.hasGotoOK {
+	} else if k.hasGotoOK || (k.suspendible && k.hasOutVar) {
 		b.writes("\ngoto ok;ok:\n") // The goto avoids the "unused label" warning.
+		if k.hasOutVar {
+			b.writes("if (out_ptr) { *out_ptr = out; }\n")
+		}
 	}
 	b.writex(k.bFooter)
 	b.writes("}\n\n")
@@ -178,6 +261,7 @@ func (g *gen) gatherFuncImpl(_ *buffer, n *a.Func) error {
 		cName:       g.funcCName(n),
 		public:      n.Public(),
 		suspendible: n.Suspendible(),
+		hasOutVar:   hasOutVar(n),
 	}
 
 	if err := g.writeFuncImplHeader(&g.currFunk.bHeader); err != nil {
@@ -203,7 +287,46 @@ func (g *gen) gatherFuncImpl(_ *buffer, n *a.Func) error {
 	return nil
 }
 
-func (g *gen) writeOutFieldsZeroValue(b *buffer, outFields []*a.Node) error {
+// hasOutVar returns whether n's C code needs an "out" local variable, holding
+// n's out fields. It does if n is suspendible or has multiple out fields.
+// Otherwise, n's single out field (if any) is usually returned directly, but
+// n can still refer to "out" or use a bare "return".
+func hasOutVar(n *a.Func) bool {
+	switch len(n.Out().Fields()) {
+	case 0:
+		return false
+	case 1:
+		if !n.Suspendible() {
+			break
+		}
+		fallthrough
+	default:
+		return true
+	}
+
+	errFound := errors.New("found")
+	for _, o := range n.Body() {
+		if err := o.Walk(func(o *a.Node) error {
+			switch o.Kind() {
+			case a.KExpr:
+				if o := o.AsExpr(); o.Operator() == 0 && o.Ident() == t.IDOut {
+					return errFound
+				}
+			case a.KRet:
+				if o.AsRet().Value() == nil {
+					return errFound
+				}
+			}
+			return nil
+		}); err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *gen) writeOutFieldsZeroValue(b *buffer, n *a.Func) error {
+	outFields := n.Out().Fields()
 	switch len(outFields) {
 	case 0:
 		// No-op.
@@ -218,7 +341,7 @@ func (g *gen) writeOutFieldsZeroValue(b *buffer, outFields []*a.Node) error {
 			b.writes("){})")
 		}
 	default:
-		return fmt.Errorf("TODO: handle structured return types")
+		b.printf("((%s__out){})", g.funcCName(n))
 	}
 	return nil
 }
@@ -226,12 +349,10 @@ func (g *gen) writeOutFieldsZeroValue(b *buffer, outFields []*a.Node) error {
 func (g *gen) writeFuncImplHeader(b *buffer) error {
 	// Check the previous status and the "self" arg.
 	if g.currFunk.public && !g.currFunk.astFunc.Receiver().IsZero() {
-		outFields := g.currFunk.astFunc.Out().Fields()
-
 		b.writes("if (!self) { return ")
 		if g.currFunk.suspendible {
 			b.writes("WUFFS_BASE__ERROR_BAD_RECEIVER")
-		} else if err := g.writeOutFieldsZeroValue(b, outFields); err != nil {
+		} else if err := g.writeOutFieldsZeroValue(b, g.currFunk.astFunc); err != nil {
 			return err
 		}
 		b.writes(";}")
@@ -242,7 +363,7 @@ func (g *gen) writeFuncImplHeader(b *buffer) error {
 		b.writes("if (self->private_impl.status < 0) { return ")
 		if g.currFunk.suspendible {
 			b.writes("self->private_impl.status")
-		} else if err := g.writeOutFieldsZeroValue(b, outFields); err != nil {
+		} else if err := g.writeOutFieldsZeroValue(b, g.currFunk.astFunc); err != nil {
 			return err
 		}
 		b.writes(";}\n")
@@ -265,6 +386,16 @@ func (g *gen) writeFuncImplHeader(b *buffer) error {
 	if err := g.writeVars(b, g.currFunk.astFunc.Body(), false, true); err != nil {
 		return err
 	}
+	if g.currFunk.hasOutVar {
+		if err := g.writeOutTypeName(b, g.currFunk.astFunc, "", "out"); err != nil {
+			return err
+		}
+		b.writes(" = ")
+		if err := g.writeOutFieldsZeroValue(b, g.currFunk.astFunc); err != nil {
+			return err
+		}
+		b.writes(";\n")
+	}
 	b.writes("\n")
 
 	if g.currFunk.suspendible {
@@ -280,15 +411,43 @@ func (g *gen) writeFuncImplHeader(b *buffer) error {
 	return nil
 }
 
+// funcDepth returns n's maximum recursion depth, which is also the number of
+// coroutine frames that n's receiver holds for it.
+func funcDepth(n *a.Func) uint32 {
+	if d := n.Depth(); d != nil {
+		return uint32(d.ConstValue().Uint64())
+	}
+	return 1
+}
+
+// currFrame returns the C expression for the current func's coroutine frame.
+// For a recursive func, that depends on how deeply it has recursed.
+func (g *gen) currFrame() string {
+	index := "0"
+	if g.currFunk.astFunc.Depth() != nil {
+		index = "coro_depth"
+	}
+	return fmt.Sprintf("self->private_impl.%s%s[%s]",
+		cPrefix, g.currFunk.astFunc.FuncName().Str(g.tm), index)
+}
+
 func (g *gen) writeFuncImplBodyResume(b *buffer) error {
 	if g.currFunk.suspendible {
-		// TODO: don't hard-code [0], and allow recursive coroutines.
-		b.printf("uint32_t coro_susp_point = self->private_impl.%s%s[0].coro_susp_point;\n",
-			cPrefix, g.currFunk.astFunc.FuncName().Str(g.tm))
+		if g.currFunk.astFunc.Depth() != nil {
+			name := g.currFunk.astFunc.FuncName().Str(g.tm)
+			b.printf("uint32_t coro_depth = self->private_impl.%s%s__depth;\n", cPrefix, name)
+			b.printf("if (coro_depth >= %d) { return WUFFS_BASE__ERROR_RECURSION_TOO_DEEP; }\n",
+				funcDepth(g.currFunk.astFunc))
+			b.printf("self->private_impl.%s%s__depth = coro_depth + 1;\n", cPrefix, name)
+		}
+		b.printf("uint32_t coro_susp_point = %s.coro_susp_point;\n", g.currFrame())
 		b.printf("if (coro_susp_point) {\n")
 		if err := g.writeResumeSuspend(b, g.currFunk.astFunc.Body(), false, false); err != nil {
 			return err
 		}
+		if g.currFunk.hasOutVar {
+			b.printf("out = %s.out;\n", g.currFrame())
+		}
 		b.writes("} else {\n")
 		if err := g.writeResumeSuspend(b, g.currFunk.astFunc.Body(), false, true); err != nil {
 			return err
@@ -318,23 +477,42 @@ func (g *gen) writeFuncImplBodySuspend(b *buffer) error {
 		// suspension point so that the next call to this function starts at
 		// the top.
 		b.writes("\ngoto ok;ok:") // The goto avoids the "unused label" warning.
-		b.printf("self->private_impl.%s%s[0].coro_susp_point = 0;\n",
-			cPrefix, g.currFunk.astFunc.FuncName().Str(g.tm))
+		if g.currFunk.hasOutVar {
+			b.writes("if (out_ptr) { *out_ptr = out; }\n")
+		}
+		b.printf("%s.coro_susp_point = 0;\n", g.currFrame())
 		b.writes("goto exit; }\n\n") // Close the coroutine switch.
 
 		b.writes("goto suspend;suspend:") // The goto avoids the "unused label" warning.
 
-		b.printf("self->private_impl.%s%s[0].coro_susp_point = coro_susp_point;\n",
-			cPrefix, g.currFunk.astFunc.FuncName().Str(g.tm))
+		b.printf("%s.coro_susp_point = coro_susp_point;\n", g.currFrame())
 		if err := g.writeResumeSuspend(b, g.currFunk.astFunc.Body(), true, false); err != nil {
 			return err
 		}
+		if g.currFunk.hasOutVar {
+			b.printf("%s.out = out;\n", g.currFrame())
+		}
 		b.writes("\n")
 	}
 	return nil
 }
 
+// endsWithReturn returns whether the last statement of body is a return
+// statement, after which there is no implicit return.
+func endsWithReturn(body []*a.Node) bool {
+	if len(body) == 0 {
+		return false
+	}
+	n := body[len(body)-1]
+	return n.Kind() == a.KRet && n.AsRet().Keyword() == t.IDReturn
+}
+
 func (g *gen) writeFuncImplFooter(b *buffer) error {
+	if !g.currFunk.suspendible && g.currFunk.hasOutVar && !endsWithReturn(g.currFunk.astFunc.Body()) {
+		// Falling off the end of the function body is an implicit "return".
+		b.writes("return out;\n")
+	}
+
 	if g.currFunk.suspendible {
 		b.writes("goto exit;exit:") // The goto avoids the "unused label" warning.
 
@@ -346,6 +524,10 @@ func (g *gen) writeFuncImplFooter(b *buffer) error {
 		}
 		b.writes("\n")
 
+		if g.currFunk.astFunc.Depth() != nil && g.currFunk.coroSuspPoint > 0 {
+			b.printf("self->private_impl.%s%s__depth = coro_depth;\n",
+				cPrefix, g.currFunk.astFunc.FuncName().Str(g.tm))
+		}
 		if g.currFunk.public {
 			b.writes("self->private_impl.status = status;\n")
 		}
@@ -43,7 +43,13 @@ func (g *gen) writeStatement(b *buffer, n *a.Node, depth uint32) error {
 	switch n.Kind() {
 	case a.KAssign:
 		n := n.AsAssign()
-		mightIntroduceTemporaries = n.LHS().Suspendible() || n.RHS().Suspendible()
+		mightIntroduceTemporaries = n.RHS().Suspendible()
+		if !n.Destructuring() {
+			mightIntroduceTemporaries = mightIntroduceTemporaries || n.LHS().Suspendible()
+		} else {
+			// The destructured value is held in a temporary variable.
+			mightIntroduceTemporaries = true
+		}
 	case a.KVar:
 		v := n.AsVar().Value()
 		mightIntroduceTemporaries = v != nil && v.Suspendible()
@@ -92,13 +98,16 @@ func (g *gen) writeStatement(b *buffer, n *a.Node, depth uint32) error {
 }
 
 func (g *gen) writeStatementAssign(b *buffer, n *a.Assign, depth uint32) error {
+	if n.Destructuring() {
+		return g.writeStatementDestructuringAssign(b, n, depth)
+	}
 	if err := g.writeSuspendibles(b, n.LHS(), depth); err != nil {
 		return err
 	}
 	if err := g.writeSuspendibles(b, n.RHS(), depth); err != nil {
 		return err
 	}
-	opName, tilde := "", false
+	opName, closer := "", ""
 
 	op := n.Operator()
 	switch op {
@@ -112,7 +121,15 @@ func (g *gen) writeStatementAssign(b *buffer, n *a.Assign, depth uint32) error {
 			uOp = "sub"
 		}
 		b.printf("wuffs_base__u%d__sat_%s_indirect(&", uBits, uOp)
-		opName, tilde = ",", true
+		opName, closer = ",", ")"
+
+	case t.IDTildeModStarEq:
+		opName = cOpName(op)
+		if uBits := uintBits(n.LHS().MType().QID()); uBits == 8 || uBits == 16 {
+			// As for the ~mod* binary operator, avoid multiplying as a
+			// (signed) int, which can overflow.
+			opName, closer = " *= ((uint32_t)(", "))"
+		}
 
 	default:
 		opName = cOpName(op)
@@ -128,10 +145,43 @@ func (g *gen) writeStatementAssign(b *buffer, n *a.Assign, depth uint32) error {
 	if err := g.writeExpr(b, n.RHS(), replaceCallSuspendibles, depth); err != nil {
 		return err
 	}
-	if tilde {
-		b.writeb(')')
+	b.writes(closer)
+	b.writes(";\n")
+	return nil
+}
+
+func (g *gen) writeStatementDestructuringAssign(b *buffer, n *a.Assign, depth uint32) error {
+	rhs := n.RHS()
+	if err := g.writeSuspendibles(b, rhs, depth); err != nil {
+		return err
+	}
+	callee, err := g.userDefinedCallee(rhs)
+	if err != nil {
+		return err
+	}
+	if g.currFunk.tempW > maxTemp {
+		return fmt.Errorf("too many temporary variables required")
+	}
+	temp := g.currFunk.tempW
+	g.currFunk.tempW++
+
+	if err := g.writeOutTypeName(b, callee, tPrefix, fmt.Sprint(temp)); err != nil {
+		return err
+	}
+	b.writes(" = ")
+	if err := g.writeExpr(b, rhs, replaceCallSuspendibles, depth); err != nil {
+		return err
 	}
 	b.writes(";\n")
+	g.currFunk.tempR++
+
+	for i, o := range n.LHSList() {
+		if err := g.writeExpr(b, o.AsExpr(), replaceNothing, depth); err != nil {
+			return err
+		}
+		field := callee.Out().Fields()[i].AsField()
+		b.printf(" = %s%d.%s%s;\n", tPrefix, temp, fPrefix, field.Name().Str(g.tm))
+	}
 	return nil
 }
 
@@ -140,6 +190,12 @@ func (g *gen) writeStatementExpr(b *buffer, n *a.Expr, depth uint32) error {
 		return err
 	}
 	if n.CallSuspendible() {
+		if n.Operator() != t.IDTry {
+			// Discard the out fields, if any, of a user-defined call.
+			if callee, err := g.userDefinedCallee(n); err == nil && len(callee.Out().Fields()) > 0 {
+				g.currFunk.tempR++
+			}
+		}
 		return nil
 	}
 	if err := g.writeExpr(b, n, replaceCallSuspendibles, depth); err != nil {
@@ -276,15 +332,19 @@ func (g *gen) writeStatementIterate(b *buffer, n *a.Iterate, depth uint32) error
 	name := v.Name().Str(g.tm)
 	b.writes("{\n")
 
-	// TODO: don't assume that the slice is a slice of base.u8. In
-	// particular, the code gen can be subtle if the slice element type has
-	// zero size, such as the empty struct.
-	b.printf("wuffs_base__slice_u8 %sslice_%s =", iPrefix, name)
+	// TODO: the code gen can be subtle if the slice element type has zero
+	// size, such as the empty struct. For now, sliceElemName only allows
+	// numeric element types.
+	elem, err := g.sliceElemName(v.XType())
+	if err != nil {
+		return err
+	}
+	b.printf("wuffs_base__slice_%s %sslice_%s =", elem, iPrefix, name)
 	if err := g.writeExpr(b, v.Value(), replaceCallSuspendibles, 0); err != nil {
 		return err
 	}
 	b.writes(";\n")
-	b.printf("wuffs_base__slice_u8 %s%s = %sslice_%s;\n", vPrefix, name, iPrefix, name)
+	b.printf("wuffs_base__slice_%s %s%s = %sslice_%s;\n", elem, vPrefix, name, iPrefix, name)
 	// TODO: look at n.HasContinue() and n.HasBreak().
 
 	round := uint32(0)
@@ -292,7 +352,8 @@ func (g *gen) writeStatementIterate(b *buffer, n *a.Iterate, depth uint32) error
 		length := n.Length().SmallPowerOf2Value()
 		unroll := n.Unroll().SmallPowerOf2Value()
 		for {
-			if err := g.writeIterateRound(b, name, n.Body(), round, depth, length, unroll); err != nil {
+			if err := g.writeIterateRound(b, name, cTypeNames[v.XType().Inner().QID()[1]],
+				n.Body(), round, depth, length, unroll); err != nil {
 				return err
 			}
 			round++
@@ -363,8 +424,7 @@ func (g *gen) writeStatementRet(b *buffer, n *a.Ret, depth uint32) error {
 			return fmt.Errorf("return expression %q incompatible with empty return type", retExpr.Str(g.tm))
 		}
 	} else if retExpr == nil {
-		// TODO: should a bare "return" imply "return out"?
-		return fmt.Errorf("empty return expression incompatible with non-empty return type")
+		b.writes("out")
 	} else if err := g.writeExpr(b, retExpr, replaceCallSuspendibles, depth); err != nil {
 		return err
 	}
@@ -397,12 +457,12 @@ func (g *gen) writeStatementVar(b *buffer, n *a.Var, depth uint32) error {
 			if err := g.writeExpr(b, v, replaceCallSuspendibles, 0); err != nil {
 				return err
 			}
-		} else if nTyp.IsSliceType() {
-			// TODO: don't assume that the slice is a slice of base.u8.
-			b.printf("((wuffs_base__slice_u8){})")
-		} else if nTyp.IsTableType() {
-			// TODO: don't assume that the table is a table of base.u8.
-			b.printf("((wuffs_base__table_u8){})")
+		} else if nTyp.IsSliceType() || nTyp.IsTableType() {
+			elem, err := g.sliceElemName(nTyp)
+			if err != nil {
+				return err
+			}
+			b.printf("((wuffs_base__%s_%s){})", nTyp.Decorator().Str(g.tm), elem)
 		} else if nTyp.IsIOType() {
 			s := "reader"
 			if nTyp.QID()[1] == t.IDIOWriter {
@@ -449,10 +509,10 @@ func (g *gen) writeStatementWhile(b *buffer, n *a.While, depth uint32) error {
 	return nil
 }
 
-func (g *gen) writeIterateRound(b *buffer, name string, body []*a.Node, round uint32, depth uint32, length int, unroll int) error {
+func (g *gen) writeIterateRound(b *buffer, name string, elemCType string, body []*a.Node, round uint32, depth uint32, length int, unroll int) error {
 	b.printf("%s%s.len = %d;\n", vPrefix, name, length)
-	b.printf("uint8_t* %send%d_%s = %sslice_%s.ptr + (%sslice_%s.len / %d) * %d;\n",
-		iPrefix, round, name, iPrefix, name, iPrefix, name, length*unroll, length*unroll)
+	b.printf("%s* %send%d_%s = %sslice_%s.ptr + (%sslice_%s.len / %d) * %d;\n",
+		elemCType, iPrefix, round, name, iPrefix, name, iPrefix, name, length*unroll, length*unroll)
 	b.printf("while (%s%s.ptr < %send%d_%s) {\n", vPrefix, name, iPrefix, round, name)
 	for i := 0; i < unroll; i++ {
 		for _, o := range body {
@@ -527,6 +587,30 @@ func (g *gen) writeCallSuspendibles(b *buffer, n *a.Expr, depth uint32) error {
 		return err
 	}
 
+	callee, err := g.userDefinedCallee(n)
+	if err != nil {
+		return err
+	}
+	outPtr := ""
+	if len(callee.Out().Fields()) > 0 {
+		if n.Operator() == t.IDTry {
+			// A "try" call's value is its status, not its out fields.
+			outPtr = "NULL"
+		} else {
+			if g.currFunk.tempW > maxTemp {
+				return fmt.Errorf("too many temporary variables required")
+			}
+			temp := g.currFunk.tempW
+			g.currFunk.tempW++
+
+			if err := g.writeOutTypeName(b, callee, tPrefix, fmt.Sprint(temp)); err != nil {
+				return err
+			}
+			b.writes(";\n")
+			outPtr = fmt.Sprintf("&%s%d", tPrefix, temp)
+		}
+	}
+
 	if n.Operator() == t.IDTry {
 		if g.currFunk.tempW > maxTemp {
 			return fmt.Errorf("too many temporary variables required")
@@ -539,7 +623,7 @@ func (g *gen) writeCallSuspendibles(b *buffer, n *a.Expr, depth uint32) error {
 		b.writes("status = ")
 	}
 
-	if err := g.writeExprUserDefinedCall(b, n, replaceNothing, depth); err != nil {
+	if err := g.writeExprUserDefinedCall(b, n, replaceNothing, depth, outPtr); err != nil {
 		return err
 	}
 	b.writes(";\n")
@@ -577,12 +661,19 @@ func (g *gen) writeReadUXX(b *buffer, n *a.Expr, name string, size uint32, endia
 	b.writes(";")
 
 	g.currFunk.usesScratch = true
-	// TODO: don't hard-code [0], and allow recursive coroutines.
-	scratchName := fmt.Sprintf("self->private_impl.%s%s[0].scratch",
-		cPrefix, g.currFunk.astFunc.FuncName().Str(g.tm))
+	scratchName := g.currFrame() + ".scratch"
+
+	// For the read_i16le, etc. methods, the bytes are loaded as an unsigned
+	// integer and then converted.
+	asSigned, asSignedEnd := "", ""
+	if n.MType().IsSignedInteger() {
+		asSigned = fmt.Sprintf("wuffs_base__u%d__as_i%d((uint%d_t)(", size, size, size)
+		asSignedEnd = "))"
+	}
 
 	b.printf("if (WUFFS_BASE__LIKELY(iobounds1_src - ioptr_src >= %d)) {", size/8)
-	b.printf("%s%d = wuffs_base__load_u%d%s(ioptr_src);\n", tPrefix, temp1, size, endianness)
+	b.printf("%s%d = %swuffs_base__load_u%d%s(ioptr_src)%s;\n",
+		tPrefix, temp1, asSigned, size, endianness, asSignedEnd)
 	b.printf("ioptr_src += %d;\n", size/8)
 	b.printf("} else {")
 	b.printf("%s = 0;\n", scratchName)
@@ -611,9 +702,9 @@ func (g *gen) writeReadUXX(b *buffer, n *a.Expr, name string, size uint32, endia
 	b.printf("if (%s%d == %d) {", tPrefix, temp0, size-8)
 	switch endianness {
 	case "be":
-		b.printf("%s%d = *scratch >> (64 - %d);", tPrefix, temp1, size)
+		b.printf("%s%d = %s*scratch >> (64 - %d)%s;", tPrefix, temp1, asSigned, size, asSignedEnd)
 	case "le":
-		b.printf("%s%d = *scratch;", tPrefix, temp1)
+		b.printf("%s%d = %s*scratch%s;", tPrefix, temp1, asSigned, asSignedEnd)
 	}
 	b.printf("break;")
 	b.printf("}")
@@ -282,12 +282,12 @@ func (g *gen) writeResumeSuspend1(b *buffer, n *a.Var, suspend bool, initBoolTyp
 					rhs = cTypeNames[key]
 				}
 			}
-		case t.IDSlice:
-			// TODO: don't assume that the slice is a slice of base.u8.
-			rhs = "wuffs_base__slice_u8"
-		case t.IDTable:
-			// TODO: don't assume that the table is a table of base.u8.
-			rhs = "wuffs_base__table_u8"
+		case t.IDSlice, t.IDTable:
+			elem, err := g.sliceElemName(typ)
+			if err != nil {
+				return err
+			}
+			rhs = fmt.Sprintf("wuffs_base__%s_%s", typ.Decorator().Str(g.tm), elem)
 		}
 		if rhs != "" {
 			b.printf("%s = ((%s){});\n", local, rhs)
@@ -297,9 +297,8 @@ func (g *gen) writeResumeSuspend1(b *buffer, n *a.Var, suspend bool, initBoolTyp
 	} else {
 		lhs := local
 		rhs := ""
-		// TODO: don't hard-code [0], and allow recursive coroutines.
 		if !initBoolTypedVars {
-			rhs = fmt.Sprintf("self->private_impl.%s%s[0].%s", cPrefix, g.currFunk.astFunc.FuncName().Str(g.tm), lhs)
+			rhs = fmt.Sprintf("%s.%s", g.currFrame(), lhs)
 		} else if typ.QID() != (t.QID{t.IDBase, t.IDBool}) {
 			return nil
 		} else if typ.Decorator() != 0 {
@@ -345,7 +344,7 @@ func (g *gen) writeResumeSuspend1(b *buffer, n *a.Var, suspend bool, initBoolTyp
 				break
 			}
 			switch qid[1] {
-			case t.IDU8, t.IDU16, t.IDU32, t.IDU64:
+			case t.IDI8, t.IDI16, t.IDI32, t.IDI64, t.IDU8, t.IDU16, t.IDU32, t.IDU64:
 				b.printf("memcpy(%s, %s, sizeof(%s));\n", lhs, rhs, local)
 				return nil
 			}
@@ -23,6 +23,8 @@ import (
 	"os/exec"
 	"time"
 
+	"github.com/google/wuffs/cmd/wuffs-c/internal/cformat"
+
 	cf "github.com/google/wuffs/cmd/commonflags"
 )
 
@@ -102,6 +104,14 @@ func doGenrelease(args []string) error {
 	unformatted.Write(grImplEndsHere)
 	unformatted.WriteString("\n\n#endif  // WUFFS_INCLUDE_GUARD\n\n")
 
+	if *cformatterFlag == "" {
+		formatted, err := cformat.Format(unformatted.Bytes())
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(formatted)
+		return err
+	}
 	cmd := exec.Command(*cformatterFlag, "-style=Chromium")
 	cmd.Stdin = unformatted
 	cmd.Stdout = os.Stdout
@@ -18,12 +18,15 @@ import (
 	"bufio"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
 
+	"github.com/google/wuffs/cmd/internal/jobs"
+
 	cf "github.com/google/wuffs/cmd/commonflags"
 )
 
@@ -35,6 +38,11 @@ func doBenchTest(args []string, bench bool) error {
 	ccompilersFlag := flags.String("ccompilers", cf.CcompilersDefault, cf.CcompilersUsage)
 	focusFlag := flags.String("focus", cf.FocusDefault, cf.FocusUsage)
 	iterscaleFlag := flags.Int("iterscale", cf.IterscaleDefault, cf.IterscaleUsage)
+	jDefault := cf.JDefault
+	if bench {
+		jDefault = cf.JBenchDefault
+	}
+	jFlag := flags.Int("j", jDefault, cf.JUsage)
 	mimicFlag := flags.Bool("mimic", cf.MimicDefault, cf.MimicUsage)
 	repsFlag := flags.Int("reps", cf.RepsDefault, cf.RepsUsage)
 
@@ -52,6 +60,10 @@ func doBenchTest(args []string, bench bool) error {
 		return fmt.Errorf("bad -iterscale flag value %d, outside the range [%d..%d]",
 			*iterscaleFlag, cf.IterscaleMin, cf.IterscaleMax)
 	}
+	if *jFlag < cf.JMin || cf.JMax < *jFlag {
+		return fmt.Errorf("bad -j flag value %d, outside the range [%d..%d]",
+			*jFlag, cf.JMin, cf.JMax)
+	}
 	if *repsFlag < cf.RepsMin || cf.RepsMax < *repsFlag {
 		return fmt.Errorf("bad -reps flag value %d, outside the range [%d..%d]",
 			*repsFlag, cf.RepsMin, cf.RepsMax)
@@ -61,8 +73,8 @@ func doBenchTest(args []string, bench bool) error {
 
 	failed := false
 	for _, arg := range args {
-		f, err := doBenchTest1(arg, bench,
-			*ccompilersFlag, *focusFlag, *iterscaleFlag, *mimicFlag, *repsFlag)
+		f, err := doBenchTest1(arg, bench, *ccompilersFlag, *focusFlag,
+			*iterscaleFlag, cf.NumJobs(*jFlag), *mimicFlag, *repsFlag)
 		if err != nil {
 			return err
 		}
@@ -78,8 +90,12 @@ func doBenchTest(args []string, bench bool) error {
 	return nil
 }
 
+// doBenchTest1 compiles and runs a C test or benchmark program with each of
+// the C compilers, running up to numJobs compilers' builds and runs at a time.
+// Each build and run's output is printed once it has finished, so that
+// concurrent output is not interleaved.
 func doBenchTest1(filename string, bench bool, ccompilers string, focus string,
-	iterscale int, mimic bool, reps int) (failed bool, err error) {
+	iterscale int, numJobs int, mimic bool, reps int) (failed bool, err error) {
 
 	workDir, err := ioutil.TempDir("", "wuffs-c")
 	if err != nil {
@@ -88,7 +104,6 @@ func doBenchTest1(filename string, bench bool, ccompilers string, focus string,
 	defer os.RemoveAll(workDir)
 
 	in := filename + ".c"
-	out := filepath.Join(workDir, "a.out")
 
 	ccArgs := []string(nil)
 	if bench {
@@ -97,7 +112,7 @@ func doBenchTest1(filename string, bench bool, ccompilers string, focus string,
 		// TODO: set these flags even if we pass -O3.
 		ccArgs = append(ccArgs, "-Wall", "-Werror")
 	}
-	ccArgs = append(ccArgs, "-std=c99", "-o", out, in)
+	ccArgs = append(ccArgs, "-std=c99", in)
 	if mimic {
 		extra, err := findWuffsMimicCflags(in)
 		if err != nil {
@@ -106,40 +121,67 @@ func doBenchTest1(filename string, bench bool, ccompilers string, focus string,
 		ccArgs = append(ccArgs, extra...)
 	}
 
+	ccs := []string(nil)
 	for _, cc := range strings.Split(ccompilers, ",") {
 		cc = strings.TrimSpace(cc)
-		if cc == "" {
-			continue
+		if cc != "" {
+			ccs = append(ccs, cc)
 		}
+	}
 
-		ccCmd := exec.Command(cc, ccArgs...)
-		ccCmd.Stdout = os.Stdout
-		ccCmd.Stderr = os.Stderr
-		if err := ccCmd.Run(); err != nil {
-			return false, err
+	fails := make([]bool, len(ccs))
+	errs := make([]error, len(ccs))
+	jobs.Run(len(ccs), numJobs, func(i int) {
+		// Each compiler writes its own binary, as they run concurrently.
+		out := filepath.Join(workDir, fmt.Sprintf("a%d.out", i))
+		o := &jobs.Output{}
+		fails[i], errs[i] = benchTestCC(ccs[i], append([]string{"-o", out}, ccArgs...),
+			out, filename, bench, focus, iterscale, reps, &o.Stdout, &o.Stderr)
+		o.Flush()
+	})
+
+	for i := range errs {
+		if errs[i] != nil {
+			return false, errs[i]
 		}
+		failed = failed || fails[i]
+	}
+	return failed, nil
+}
 
-		outArgs := []string(nil)
-		if bench {
-			outArgs = append(outArgs, "-bench",
-				fmt.Sprintf("-iterscale=%d", iterscale),
-				fmt.Sprintf("-reps=%d", reps),
-			)
-		}
-		if focus != "" {
-			outArgs = append(outArgs, fmt.Sprintf("-focus=%s", focus))
-		}
-		outCmd := exec.Command(out, outArgs...)
-		outCmd.Stdout = os.Stdout
-		outCmd.Stderr = os.Stderr
-		outCmd.Dir = filepath.Dir(filename)
-		if err := outCmd.Run(); err == nil {
-			// No-op.
-		} else if _, ok := err.(*exec.ExitError); ok {
-			failed = true
-		} else {
-			return false, err
-		}
+// benchTestCC compiles a C test or benchmark program with the C compiler cc
+// and runs it, writing both the compiler's and the program's output to stdout
+// and stderr.
+func benchTestCC(cc string, ccArgs []string, out string, filename string, bench bool,
+	focus string, iterscale int, reps int, stdout io.Writer, stderr io.Writer) (failed bool, err error) {
+
+	ccCmd := exec.Command(cc, ccArgs...)
+	ccCmd.Stdout = stdout
+	ccCmd.Stderr = stderr
+	if err := ccCmd.Run(); err != nil {
+		return false, err
+	}
+
+	outArgs := []string(nil)
+	if bench {
+		outArgs = append(outArgs, "-bench",
+			fmt.Sprintf("-iterscale=%d", iterscale),
+			fmt.Sprintf("-reps=%d", reps),
+		)
+	}
+	if focus != "" {
+		outArgs = append(outArgs, fmt.Sprintf("-focus=%s", focus))
+	}
+	outCmd := exec.Command(out, outArgs...)
+	outCmd.Stdout = stdout
+	outCmd.Stderr = stderr
+	outCmd.Dir = filepath.Dir(filename)
+	if err := outCmd.Run(); err == nil {
+		// No-op.
+	} else if _, ok := err.(*exec.ExitError); ok {
+		failed = true
+	} else {
+		return false, err
 	}
 	return failed, nil
 }
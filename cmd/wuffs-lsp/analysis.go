@@ -0,0 +1,426 @@
+// Copyright 2018 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/wuffs/lang/check"
+	"github.com/google/wuffs/lang/generate"
+	"github.com/google/wuffs/lang/parse"
+	"github.com/google/wuffs/lang/render"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// declKey identifies a top level declaration, or a struct's field. The pkg is
+// zero for the package being analyzed, and the used package's base name
+// otherwise. The recv is only used for funcs (the receiver) and fields (the
+// struct).
+type declKey struct {
+	kind a.Kind
+	pkg  t.ID
+	recv t.ID
+	name t.ID
+}
+
+// analysis is the result of parsing and checking a package.
+type analysis struct {
+	tm *t.Map
+
+	// files and srcs are keyed by filename. The srcs also include those of
+	// used packages.
+	files map[string]*a.File
+	srcs  map[string][]byte
+
+	// diags holds the diagnostics for each of the package's files. Every
+	// file has an entry, possibly an empty slice.
+	diags map[string][]diagnostic
+
+	decls map[declKey]*a.Node
+}
+
+// analyze parses and checks the package that contains filename. The docs are
+// the contents of open files, keyed by filename, which take precedence over
+// what's on disk. Used packages are looked for in the roots, the Wuffs root
+// directories.
+func analyze(roots []string, filename string, docs map[string][]byte) *analysis {
+	z := &analysis{
+		tm:    &t.Map{},
+		files: map[string]*a.File{},
+		srcs:  map[string][]byte{},
+		diags: map[string][]diagnostic{},
+		decls: map[declKey]*a.Node{},
+	}
+
+	filenames := packageFilenames(filename, docs)
+	files := []*a.File(nil)
+	for _, filename := range filenames {
+		z.diags[filename] = []diagnostic{}
+		src, ok := docs[filename]
+		if !ok {
+			var err error
+			src, err = ioutil.ReadFile(filename)
+			if err != nil {
+				z.addError(filename, err)
+				continue
+			}
+		}
+		z.srcs[filename] = src
+		f, err := parseSrc(z.tm, filename, src)
+		if err != nil {
+			z.addError(filename, err)
+			continue
+		}
+		z.files[filename] = f
+		files = append(files, f)
+		z.index(0, f)
+	}
+	if len(files) != len(filenames) {
+		return z
+	}
+
+	for _, f := range files {
+		for _, n := range f.TopLevelDecls() {
+			if n.Kind() == a.KUse {
+				z.indexUse(roots, n.AsUse())
+			}
+		}
+	}
+
+	resolveUse := func(usePath string) ([]byte, error) {
+		if len(roots) == 0 {
+			return nil, fmt.Errorf("wuffs-lsp: cannot resolve `use %q` without a Wuffs root directory", usePath)
+		}
+		root, err := generate.PackageRootIn(roots, strings.TrimSuffix(usePath, ".wuffs"))
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.ReadFile(filepath.Join(root, "gen", "wuffs", filepath.FromSlash(usePath)))
+	}
+	_, err := check.Check(z.tm, files, resolveUse, &check.Options{MaxErrors: -1})
+	if errs, ok := err.(check.ErrorList); ok {
+		for _, e := range errs {
+			z.addCheckError(filenames[0], e)
+		}
+	} else if err != nil {
+		z.addError(filenames[0], err)
+	}
+	return z
+}
+
+// packageFilenames returns the sorted names of the .wuffs files in filename's
+// directory, including filename itself and any open docs in that directory.
+func packageFilenames(filename string, docs map[string][]byte) []string {
+	dir := filepath.Dir(filename)
+	m := map[string]bool{filename: true}
+	if infos, err := ioutil.ReadDir(dir); err == nil {
+		for _, o := range infos {
+			name := o.Name()
+			if !o.IsDir() && !strings.HasPrefix(name, ".") && strings.HasSuffix(name, ".wuffs") {
+				m[filepath.Join(dir, name)] = true
+			}
+		}
+	}
+	for k := range docs {
+		if filepath.Dir(k) == dir && strings.HasSuffix(k, ".wuffs") {
+			m[k] = true
+		}
+	}
+	ret := make([]string, 0, len(m))
+	for k := range m {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func parseSrc(tm *t.Map, filename string, src []byte) (*a.File, error) {
+	tokens, _, err := t.Tokenize(tm, filename, src)
+	if err != nil {
+		return nil, err
+	}
+	return parse.Parse(tm, filename, tokens, nil)
+}
+
+// index records the top level declarations of f, a file of the pkg package.
+func (z *analysis) index(pkg t.ID, f *a.File) {
+	for _, n := range f.TopLevelDecls() {
+		switch n.Kind() {
+		case a.KConst:
+			z.decls[declKey{a.KConst, pkg, 0, n.AsConst().QID()[1]}] = n
+		case a.KFunc:
+			qqid := n.AsFunc().QQID()
+			z.decls[declKey{a.KFunc, pkg, qqid[1], qqid[2]}] = n
+		case a.KStatus:
+			z.decls[declKey{a.KStatus, pkg, 0, n.AsStatus().QID()[1]}] = n
+		case a.KStruct:
+			s := n.AsStruct()
+			z.decls[declKey{a.KStruct, pkg, 0, s.QID()[1]}] = n
+			for _, o := range s.Fields() {
+				z.decls[declKey{a.KField, pkg, s.QID()[1], o.AsField().Name()}] = o
+			}
+		}
+	}
+}
+
+// indexUse records the top level declarations of a used package, parsed from
+// its source code. Errors are ignored: they are the used package's problem.
+func (z *analysis) indexUse(roots []string, n *a.Use) {
+	usePath, ok := t.Unescape(n.Path().Str(z.tm))
+	if !ok {
+		return
+	}
+	root, err := generate.PackageRootIn(roots, usePath)
+	if err != nil {
+		return
+	}
+	pkg, err := z.tm.Insert(path.Base(usePath))
+	if err != nil {
+		return
+	}
+	dir := filepath.Join(root, filepath.FromSlash(usePath))
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, o := range infos {
+		if o.IsDir() || !strings.HasSuffix(o.Name(), ".wuffs") {
+			continue
+		}
+		filename := filepath.Join(dir, o.Name())
+		src, err := ioutil.ReadFile(filename)
+		if err != nil {
+			continue
+		}
+		f, err := parseSrc(z.tm, filename, src)
+		if err != nil {
+			continue
+		}
+		z.srcs[filename] = src
+		z.index(pkg, f)
+	}
+}
+
+// errorLocationRegexp matches the " at filename:line" or " at
+// filename:line:col" suffix of the token and parse packages' error messages.
+var errorLocationRegexp = regexp.MustCompile(` at (.*?):([0-9]+)(?::([0-9]+))?$`)
+
+// addError adds a diagnostic for a plain error. Its location is taken from the
+// error message, if present, and is otherwise the start of filename.
+func (z *analysis) addError(filename string, err error) {
+	msg, line, col := err.Error(), 0, 0
+	if m := errorLocationRegexp.FindStringSubmatch(msg); m != nil {
+		if _, ok := z.diags[m[1]]; ok {
+			filename = m[1]
+			line, _ = strconv.Atoi(m[2])
+			col, _ = strconv.Atoi(m[3])
+			msg = msg[:len(msg)-len(m[0])]
+		}
+	}
+	r := lspRange{}
+	if line > 0 {
+		r = z.lineRange(filename, uint32(line), uint32(col))
+	}
+	z.appendDiag(filename, r, msg)
+}
+
+func (z *analysis) addCheckError(defaultFilename string, e *check.Error) {
+	filename := e.Filename
+	if _, ok := z.diags[filename]; !ok {
+		// The error is in a used package, or has no location.
+		z.appendDiag(defaultFilename, lspRange{}, e.Error())
+		return
+	}
+	r := lspRange{}
+	if e.Col != 0 {
+		src := z.srcs[filename]
+		r = lspRange{positionOf(src, int(e.Pos)), positionOf(src, int(e.End))}
+	} else if e.Line != 0 {
+		r = z.lineRange(filename, e.Line, 0)
+	}
+	msg := e.Err.Error()
+	if e.OtherFilename != "" || e.OtherLine != 0 {
+		msg = fmt.Sprintf("%s (see also %s:%d)", msg, e.OtherFilename, e.OtherLine)
+	}
+	if len(e.Facts) > 0 && e.TMap != nil {
+		b := []byte(msg)
+		b = append(b, "\nFacts:"...)
+		for _, f := range e.Facts {
+			b = append(b, "\n\t"...)
+			b = append(b, f.Str(e.TMap)...)
+		}
+		msg = string(b)
+	}
+	z.appendDiag(filename, r, msg)
+}
+
+func (z *analysis) appendDiag(filename string, r lspRange, msg string) {
+	z.diags[filename] = append(z.diags[filename], diagnostic{
+		Range:    r,
+		Severity: severityError,
+		Source:   "wuffs",
+		Message:  msg,
+	})
+}
+
+// lineRange returns the range of the 1-based line in filename, from the
+// 1-based byte column col, or from the start of the line if col is 0, to the
+// end of the line.
+func (z *analysis) lineRange(filename string, line uint32, col uint32) lspRange {
+	src := z.srcs[filename]
+	lineStart := offsetOf(src, position{Line: int(line) - 1})
+	lineEnd := lineStart
+	for lineEnd < len(src) && src[lineEnd] != '\n' {
+		lineEnd++
+	}
+	if col > 0 && lineStart+int(col)-1 <= lineEnd {
+		lineStart += int(col) - 1
+	}
+	return lspRange{positionOf(src, lineStart), positionOf(src, lineEnd)}
+}
+
+// nodeRange returns the range of n, which must have a known position.
+func (z *analysis) nodeRange(n *a.Node) lspRange {
+	filename, _ := n.AsRaw().FilenameLine()
+	src := z.srcs[filename]
+	return lspRange{
+		positionOf(src, int(n.AsRaw().Pos())),
+		positionOf(src, int(n.AsRaw().End())),
+	}
+}
+
+// nodeAt returns the innermost expression or type expression, in the named
+// file, whose position contains the byte offset.
+func (z *analysis) nodeAt(filename string, offset int) *a.Node {
+	f := z.files[filename]
+	if f == nil {
+		return nil
+	}
+	ret := (*a.Node)(nil)
+	f.AsNode().Walk(func(n *a.Node) error {
+		if k := n.Kind(); k != a.KExpr && k != a.KTypeExpr {
+			return nil
+		}
+		raw := n.AsRaw()
+		if nf, _ := raw.FilenameLine(); nf != filename || raw.Col() == 0 {
+			return nil
+		}
+		if pos, end := int(raw.Pos()), int(raw.End()); pos <= offset && offset < end {
+			if ret == nil || (end-pos) < int(ret.AsRaw().End()-ret.AsRaw().Pos()) {
+				ret = n
+			}
+		}
+		return nil
+	})
+	return ret
+}
+
+// definition returns the declaration that the node at the offset refers to.
+func (z *analysis) definition(filename string, offset int) *a.Node {
+	n := z.nodeAt(filename, offset)
+	if n == nil {
+		return nil
+	}
+
+	if n.Kind() == a.KTypeExpr {
+		n := n.AsTypeExpr()
+		if n.Decorator() != 0 {
+			return nil
+		}
+		q := n.QID()
+		return z.decls[declKey{a.KStruct, q[0], 0, q[1]}]
+	}
+
+	e := n.AsExpr()
+	switch e.Operator() {
+	case 0:
+		if e.GlobalIdent() {
+			return z.decls[declKey{a.KConst, 0, 0, e.Ident()}]
+		}
+
+	case t.IDDot:
+		typ := e.LHS().AsExpr().MType().Pointee()
+		if typ == nil || typ.Decorator() != 0 {
+			return nil
+		}
+		q := typ.QID()
+		if d := z.decls[declKey{a.KFunc, q[0], q[1], e.Ident()}]; d != nil {
+			return d
+		}
+		return z.decls[declKey{a.KField, q[0], q[1], e.Ident()}]
+
+	case t.IDError, t.IDStatus, t.IDSuspension:
+		q := e.StatusQID()
+		if d := z.decls[declKey{a.KStatus, q[0], 0, q[1]}]; d != nil {
+			return d
+		}
+		// Status literals don't (yet) name their package, so look for a
+		// used package's status with the same message.
+		for k, d := range z.decls {
+			if k.kind == a.KStatus && k.name == q[1] {
+				return d
+			}
+		}
+	}
+	return nil
+}
+
+// hover returns a description of the expression at the offset, and that
+// expression's node.
+func (z *analysis) hover(filename string, offset int) (string, *a.Node) {
+	n := z.nodeAt(filename, offset)
+	if n == nil || n.Kind() != a.KExpr || n.MType() == nil {
+		return "", nil
+	}
+	e := n.AsExpr()
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "```wuffs\n%s: %s\n```\n", e.Str(z.tm), n.MType().Str(z.tm))
+	if cv := e.ConstValue(); cv != nil {
+		fmt.Fprintf(buf, "value: %v\n", cv)
+	} else if b := n.MBounds(); b[0] != nil && b[1] != nil {
+		fmt.Fprintf(buf, "bounds: %v\n", b)
+	}
+	return buf.String(), n
+}
+
+// format returns src formatted by wuffsfmt's rules.
+func format(filename string, src []byte) ([]byte, error) {
+	tm := &t.Map{}
+	tokens, comments, err := t.Tokenize(tm, filename, src)
+	if err != nil {
+		return nil, err
+	}
+	f, err := parse.Parse(tm, filename, tokens, &parse.Options{
+		AllowDoubleUnderscoreNames: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	buf := &bytes.Buffer{}
+	if err := render.RenderFile(buf, tm, tokens, comments, f, nil); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,70 @@
+// Copyright 2018 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// wuffs-lsp is a Language Server Protocol server for Wuffs programs. It speaks
+// JSON-RPC over standard input and output, and provides:
+//   - diagnostics (parse and check errors) when a file is opened or saved,
+//   - go-to-definition for structs, funcs, fields, statuses and consts,
+//     including those of used packages,
+//   - hover text showing an expression's type and proven bounds,
+//   - document formatting, the same as wuffsfmt.
+//
+// A package is all of the .wuffs files in a directory. A `use "std/foo"`
+// declaration is resolved, like "wuffs gen" does, by the gen/wuffs/std/foo.wuffs
+// file under whichever of the Wuffs root directory and the WUFFSPATH
+// directories provides std/foo, and go-to-definition looks for the used
+// package's source code in that root's std/foo directory.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/google/wuffs/lang/generate"
+)
+
+var wuffsrootFlag = flag.String("wuffsroot", "",
+	"the Wuffs root directory, if not found via GOPATH")
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: wuffs-lsp [flags]\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	if err := main1(); err != nil {
+		os.Stderr.WriteString(err.Error() + "\n")
+		os.Exit(1)
+	}
+}
+
+func main1() error {
+	flag.Usage = usage
+	flag.Parse()
+
+	wuffsRoot := *wuffsrootFlag
+	if wuffsRoot == "" {
+		// Without a Wuffs root directory, `use` declarations can't be
+		// resolved, but everything else still works.
+		wuffsRoot, _ = generate.WuffsRoot()
+	}
+	roots, err := generate.WuffsPathFor(wuffsRoot)
+	if err != nil {
+		return err
+	}
+	s := newServer(bufio.NewReader(os.Stdin), os.Stdout, roots)
+	return s.serve()
+}
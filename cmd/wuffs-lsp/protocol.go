@@ -0,0 +1,180 @@
+// Copyright 2018 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+// This file declares the subset of the Language Server Protocol's types that
+// wuffs-lsp uses. See
+// https://microsoft.github.io/language-server-protocol/specification
+
+import (
+	"net/url"
+	"path/filepath"
+	"unicode/utf8"
+)
+
+// position is zero-based. The character is in UTF-16 code units.
+type position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type lspRange struct {
+	Start position `json:"start"`
+	End   position `json:"end"`
+}
+
+type location struct {
+	URI   string   `json:"uri"`
+	Range lspRange `json:"range"`
+}
+
+const severityError = 1
+
+type diagnostic struct {
+	Range    lspRange `json:"range"`
+	Severity int      `json:"severity"`
+	Source   string   `json:"source"`
+	Message  string   `json:"message"`
+}
+
+type textEdit struct {
+	Range   lspRange `json:"range"`
+	NewText string   `json:"newText"`
+}
+
+type markupContent struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+type hover struct {
+	Contents markupContent `json:"contents"`
+	Range    *lspRange     `json:"range,omitempty"`
+}
+
+type textDocumentIdentifier struct {
+	URI string `json:"uri"`
+}
+
+type textDocumentItem struct {
+	URI  string `json:"uri"`
+	Text string `json:"text"`
+}
+
+type didOpenParams struct {
+	TextDocument textDocumentItem `json:"textDocument"`
+}
+
+type didChangeParams struct {
+	TextDocument   textDocumentIdentifier `json:"textDocument"`
+	ContentChanges []struct {
+		// Range is nil for a full-text change, the only kind that we ask for.
+		Range *lspRange `json:"range"`
+		Text  string    `json:"text"`
+	} `json:"contentChanges"`
+}
+
+type didSaveParams struct {
+	TextDocument textDocumentIdentifier `json:"textDocument"`
+	Text         *string                `json:"text"`
+}
+
+type didCloseParams struct {
+	TextDocument textDocumentIdentifier `json:"textDocument"`
+}
+
+type textDocumentPositionParams struct {
+	TextDocument textDocumentIdentifier `json:"textDocument"`
+	Position     position               `json:"position"`
+}
+
+type formattingParams struct {
+	TextDocument textDocumentIdentifier `json:"textDocument"`
+}
+
+type publishDiagnosticsParams struct {
+	URI         string       `json:"uri"`
+	Diagnostics []diagnostic `json:"diagnostics"`
+}
+
+// documentParams are the params of a message about a single document.
+type documentParams interface {
+	uri() string
+}
+
+func (p *didOpenParams) uri() string              { return p.TextDocument.URI }
+func (p *didChangeParams) uri() string            { return p.TextDocument.URI }
+func (p *didSaveParams) uri() string              { return p.TextDocument.URI }
+func (p *didCloseParams) uri() string             { return p.TextDocument.URI }
+func (p *textDocumentPositionParams) uri() string { return p.TextDocument.URI }
+func (p *formattingParams) uri() string           { return p.TextDocument.URI }
+
+func uriToFilename(uri string) (string, bool) {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return "", false
+	}
+	return filepath.FromSlash(u.Path), true
+}
+
+func filenameToURI(filename string) string {
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(filename)}).String()
+}
+
+// positionOf converts a byte offset in src to an LSP position.
+func positionOf(src []byte, offset int) position {
+	if offset > len(src) {
+		offset = len(src)
+	}
+	p := position{}
+	for i := 0; i < offset; {
+		if src[i] == '\n' {
+			p.Line++
+			p.Character = 0
+			i++
+			continue
+		}
+		r, n := utf8.DecodeRune(src[i:])
+		p.Character += utf16Len(r)
+		i += n
+	}
+	return p
+}
+
+// offsetOf converts an LSP position to a byte offset in src.
+func offsetOf(src []byte, p position) int {
+	i := 0
+	for line := 0; line < p.Line; i++ {
+		if i == len(src) {
+			return len(src)
+		}
+		if src[i] == '\n' {
+			line++
+		}
+	}
+	for c := 0; (c < p.Character) && (i < len(src)) && (src[i] != '\n'); {
+		r, n := utf8.DecodeRune(src[i:])
+		c += utf16Len(r)
+		i += n
+	}
+	return i
+}
+
+func utf16Len(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
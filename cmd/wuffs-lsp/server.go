@@ -0,0 +1,266 @@
+// Copyright 2018 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+)
+
+type server struct {
+	in  *bufio.Reader
+	out io.Writer
+	// roots are the Wuffs root directories that used packages are found in.
+	roots []string
+
+	// docs holds the contents of the open files, keyed by filename.
+	docs map[string][]byte
+
+	shutdown bool
+}
+
+func newServer(in *bufio.Reader, out io.Writer, roots []string) *server {
+	return &server{
+		in:    in,
+		out:   out,
+		roots: roots,
+		docs:  map[string][]byte{},
+	}
+}
+
+// serve handles messages until the client sends an "exit" notification or
+// closes the connection.
+func (s *server) serve() error {
+	for {
+		m, err := readMessage(s.in)
+		if err == io.EOF {
+			return nil
+		} else if e, ok := err.(*rpcError); ok {
+			if err := s.reply(nil, nil, e); err != nil {
+				return err
+			}
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		if m.Method == "exit" {
+			if !s.shutdown {
+				return fmt.Errorf("wuffs-lsp: exit without shutdown")
+			}
+			return nil
+		}
+		if m.Method == "" {
+			// Ignore responses. We don't send requests to the client.
+			continue
+		}
+
+		result, err := s.handle(m.Method, m.Params)
+		if m.ID == nil {
+			// A notification has no response, not even for errors.
+			continue
+		}
+		e, _ := err.(*rpcError)
+		if err != nil && e == nil {
+			e = &rpcError{Code: codeInternalError, Message: err.Error()}
+		}
+		if err := s.reply(m.ID, result, e); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *server) reply(id *json.RawMessage, result interface{}, e *rpcError) error {
+	if id == nil {
+		null := json.RawMessage("null")
+		id = &null
+	}
+	m := &message{ID: id, Error: e}
+	if e == nil {
+		r, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		m.Result = r
+	}
+	return writeMessage(s.out, m)
+}
+
+func (s *server) notify(method string, params interface{}) error {
+	p, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return writeMessage(s.out, &message{Method: method, Params: p})
+}
+
+func (s *server) handle(method string, params json.RawMessage) (interface{}, error) {
+	switch method {
+	case "initialize":
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync": map[string]interface{}{
+					"openClose": true,
+					"change":    1, // Full text.
+					"save":      map[string]interface{}{"includeText": false},
+				},
+				"definitionProvider":         true,
+				"hoverProvider":              true,
+				"documentFormattingProvider": true,
+			},
+			"serverInfo": map[string]interface{}{"name": "wuffs-lsp"},
+		}, nil
+
+	case "initialized":
+		return nil, nil
+
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+
+	case "textDocument/didOpen":
+		p := didOpenParams{}
+		filename, err := s.unmarshal(params, &p)
+		if err != nil {
+			return nil, err
+		}
+		s.docs[filename] = []byte(p.TextDocument.Text)
+		return nil, s.publishDiagnostics(filename)
+
+	case "textDocument/didChange":
+		p := didChangeParams{}
+		filename, err := s.unmarshal(params, &p)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range p.ContentChanges {
+			if c.Range == nil {
+				s.docs[filename] = []byte(c.Text)
+			}
+		}
+		return nil, nil
+
+	case "textDocument/didSave":
+		p := didSaveParams{}
+		filename, err := s.unmarshal(params, &p)
+		if err != nil {
+			return nil, err
+		}
+		if p.Text != nil {
+			s.docs[filename] = []byte(*p.Text)
+		}
+		return nil, s.publishDiagnostics(filename)
+
+	case "textDocument/didClose":
+		p := didCloseParams{}
+		filename, err := s.unmarshal(params, &p)
+		if err != nil {
+			return nil, err
+		}
+		delete(s.docs, filename)
+		return nil, nil
+
+	case "textDocument/definition":
+		p := textDocumentPositionParams{}
+		filename, err := s.unmarshal(params, &p)
+		if err != nil {
+			return nil, err
+		}
+		z := analyze(s.roots, filename, s.docs)
+		n := z.definition(filename, offsetOf(z.srcs[filename], p.Position))
+		if n == nil {
+			return nil, nil
+		}
+		nf, _ := n.AsRaw().FilenameLine()
+		return location{URI: filenameToURI(nf), Range: z.nodeRange(n)}, nil
+
+	case "textDocument/hover":
+		p := textDocumentPositionParams{}
+		filename, err := s.unmarshal(params, &p)
+		if err != nil {
+			return nil, err
+		}
+		z := analyze(s.roots, filename, s.docs)
+		text, n := z.hover(filename, offsetOf(z.srcs[filename], p.Position))
+		if n == nil {
+			return nil, nil
+		}
+		r := z.nodeRange(n)
+		return hover{Contents: markupContent{Kind: "markdown", Value: text}, Range: &r}, nil
+
+	case "textDocument/formatting":
+		p := formattingParams{}
+		filename, err := s.unmarshal(params, &p)
+		if err != nil {
+			return nil, err
+		}
+		src, ok := s.docs[filename]
+		if !ok {
+			if src, err = ioutil.ReadFile(filename); err != nil {
+				return nil, err
+			}
+		}
+		dst, err := format(filename, src)
+		if err != nil {
+			return nil, err
+		}
+		if bytes.Equal(dst, src) {
+			return []textEdit{}, nil
+		}
+		return []textEdit{{
+			Range:   lspRange{End: positionOf(src, len(src))},
+			NewText: string(dst),
+		}}, nil
+	}
+	return nil, &rpcError{Code: codeMethodNotFound, Message: fmt.Sprintf("unknown method %q", method)}
+}
+
+// unmarshal decodes params into p and returns the filename of p's document.
+func (s *server) unmarshal(params json.RawMessage, p documentParams) (filename string, err error) {
+	if err := json.Unmarshal(params, p); err != nil {
+		return "", &rpcError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	filename, ok := uriToFilename(p.uri())
+	if !ok {
+		return "", &rpcError{Code: codeInvalidParams, Message: fmt.Sprintf("unsupported URI %q", p.uri())}
+	}
+	return filename, nil
+}
+
+// publishDiagnostics analyzes the package containing filename and publishes
+// the diagnostics for each of its files. Publishing an empty list clears a
+// file's previous diagnostics.
+func (s *server) publishDiagnostics(filename string) error {
+	z := analyze(s.roots, filename, s.docs)
+	filenames := make([]string, 0, len(z.diags))
+	for k := range z.diags {
+		filenames = append(filenames, k)
+	}
+	sort.Strings(filenames)
+	for _, k := range filenames {
+		if err := s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{
+			URI:         filenameToURI(k),
+			Diagnostics: z.diags[k],
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
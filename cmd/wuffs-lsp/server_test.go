@@ -0,0 +1,332 @@
+// Copyright 2018 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const otherInterface = `packageid "othr"
+
+pub struct thing?()
+pub func thing.twice(x base.u32[..1000])(y base.u32) { }
+`
+
+const otherSrc = `packageid "othr"
+
+pub struct thing?(
+	n base.u32,
+)
+
+pub func thing.twice(x base.u32[..1000])(y base.u32) {
+	return in.x * 2
+}
+`
+
+const testSrc = `packageid "test"
+
+use "test/other"
+
+pri const limit base.u32[..10] = 10
+
+pub struct foo?(
+	t other.thing,
+	n base.u32,
+)
+
+pub func foo.bar!()(ret base.u32) {
+	var y base.u32 = this.t.twice(x:3)
+	var z base.u32[..10] = limit
+	this.n = z
+	return y
+}
+`
+
+// client is a scripted LSP client. The server's messages are read by a
+// separate goroutine, as the server can send notifications at any time, and
+// an io.Pipe write blocks until it is read.
+type client struct {
+	tt       *testing.T
+	w        io.Writer
+	messages chan *message
+	nextID   int
+
+	// notifications holds the notifications received so far.
+	notifications []*message
+}
+
+func (c *client) send(m *message) {
+	if err := writeMessage(c.w, m); err != nil {
+		c.tt.Fatalf("writeMessage: %v", err)
+	}
+}
+
+func (c *client) notify(method string, params interface{}) {
+	p, err := json.Marshal(params)
+	if err != nil {
+		c.tt.Fatalf("Marshal: %v", err)
+	}
+	c.send(&message{Method: method, Params: p})
+}
+
+// call sends a request and decodes the response's result into result. It
+// returns the response, whose Error field may be non-nil.
+func (c *client) call(method string, params interface{}, result interface{}) *message {
+	c.nextID++
+	id := json.RawMessage(strings.Repeat("1", c.nextID))
+	p, err := json.Marshal(params)
+	if err != nil {
+		c.tt.Fatalf("Marshal: %v", err)
+	}
+	c.send(&message{ID: &id, Method: method, Params: p})
+
+	for {
+		m := <-c.messages
+		if m == nil {
+			c.tt.Fatalf("%s: no response", method)
+		}
+		if m.Method != "" {
+			c.notifications = append(c.notifications, m)
+			continue
+		}
+		if m.ID == nil || string(*m.ID) != string(id) {
+			c.tt.Fatalf("%s: got response ID %v, want %s", method, m.ID, id)
+		}
+		if m.Error == nil && result != nil {
+			if err := json.Unmarshal(m.Result, result); err != nil {
+				c.tt.Fatalf("%s: Unmarshal: %v", method, err)
+			}
+		}
+		return m
+	}
+}
+
+// diagnostics returns the diagnostics most recently published for uri.
+func (c *client) diagnostics(uri string) (ret []diagnostic, ok bool) {
+	for _, m := range c.notifications {
+		if m.Method != "textDocument/publishDiagnostics" {
+			continue
+		}
+		p := publishDiagnosticsParams{}
+		if err := json.Unmarshal(m.Params, &p); err != nil {
+			c.tt.Fatalf("Unmarshal: %v", err)
+		}
+		if p.URI == uri {
+			ret, ok = p.Diagnostics, true
+		}
+	}
+	return ret, ok
+}
+
+func writeTestFile(tt *testing.T, filename string, contents string) {
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		tt.Fatalf("MkdirAll: %v", err)
+	}
+	if err := ioutil.WriteFile(filename, []byte(contents), 0644); err != nil {
+		tt.Fatalf("WriteFile: %v", err)
+	}
+}
+
+// positionOfString returns the position of the first occurrence of s in src,
+// plus delta characters.
+func positionOfString(tt *testing.T, src string, s string, delta int) position {
+	i := strings.Index(src, s)
+	if i < 0 {
+		tt.Fatalf("%q not found", s)
+	}
+	return positionOf([]byte(src), i+delta)
+}
+
+func TestServer(tt *testing.T) {
+	root, err := ioutil.TempDir("", "wuffs-lsp-test")
+	if err != nil {
+		tt.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	writeTestFile(tt, filepath.Join(root, "gen", "wuffs", "test", "other.wuffs"), otherInterface)
+	otherFilename := filepath.Join(root, "test", "other", "other.wuffs")
+	writeTestFile(tt, otherFilename, otherSrc)
+	testFilename := filepath.Join(root, "test", "pkg", "pkg.wuffs")
+	writeTestFile(tt, testFilename, testSrc)
+	testURI := filenameToURI(testFilename)
+
+	clientR, serverW := io.Pipe()
+	serverR, clientW := io.Pipe()
+	s := newServer(bufio.NewReader(serverR), serverW, []string{root})
+	done := make(chan error, 1)
+	go func() {
+		done <- s.serve()
+		serverW.Close()
+	}()
+	c := &client{tt: tt, w: clientW, messages: make(chan *message, 100)}
+	go func() {
+		r := bufio.NewReader(clientR)
+		for {
+			m, err := readMessage(r)
+			if err != nil {
+				close(c.messages)
+				return
+			}
+			c.messages <- m
+		}
+	}()
+
+	c.call("initialize", map[string]interface{}{}, nil)
+	c.notify("initialized", map[string]interface{}{})
+
+	// Opening a file with a bounds error should publish a diagnostic.
+	badSrc := strings.Replace(testSrc, "this.n = z", "this.n = z\n\tvar q base.u8 = 300", 1)
+	c.notify("textDocument/didOpen", map[string]interface{}{
+		"textDocument": map[string]interface{}{
+			"uri":        testURI,
+			"languageId": "wuffs",
+			"version":    1,
+			"text":       badSrc,
+		},
+	})
+	// A round trip ensures that the didOpen has been processed.
+	c.call("textDocument/hover", textDocumentPositionParams{
+		TextDocument: textDocumentIdentifier{URI: testURI},
+	}, nil)
+	diags, ok := c.diagnostics(testURI)
+	if !ok || len(diags) != 1 {
+		tt.Fatalf("didOpen: diagnostics: got %v (ok=%t), want 1 diagnostic", diags, ok)
+	}
+	wantRange := lspRange{
+		positionOfString(tt, badSrc, "300", 0),
+		positionOfString(tt, badSrc, "300", 3),
+	}
+	if diags[0].Range != wantRange || !strings.Contains(diags[0].Message, "not within bounds") {
+		tt.Fatalf("didOpen: diagnostic: got %+v, want range %+v", diags[0], wantRange)
+	}
+
+	// A parse error's diagnostic should start at the error's column.
+	badSrc = strings.Replace(testSrc, "this.n = z", "this.n = z\n\tvar q base.u8 = 300 301", 1)
+	c.notify("textDocument/didChange", map[string]interface{}{
+		"textDocument":   map[string]interface{}{"uri": testURI, "version": 2},
+		"contentChanges": []map[string]interface{}{{"text": badSrc}},
+	})
+	c.notify("textDocument/didSave", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": testURI},
+	})
+	c.call("textDocument/hover", textDocumentPositionParams{
+		TextDocument: textDocumentIdentifier{URI: testURI},
+	}, nil)
+	diags, ok = c.diagnostics(testURI)
+	if !ok || len(diags) != 1 {
+		tt.Fatalf("parse error: diagnostics: got %v (ok=%t), want 1 diagnostic", diags, ok)
+	}
+	wantRange = lspRange{
+		positionOfString(tt, badSrc, "301", 0),
+		positionOfString(tt, badSrc, "301", 3),
+	}
+	if diags[0].Range != wantRange {
+		tt.Fatalf("parse error: diagnostic: got %+v, want range %+v", diags[0], wantRange)
+	}
+
+	// Fixing and saving the file should clear the diagnostic.
+	c.notify("textDocument/didChange", map[string]interface{}{
+		"textDocument":   map[string]interface{}{"uri": testURI, "version": 3},
+		"contentChanges": []map[string]interface{}{{"text": testSrc}},
+	})
+	c.notify("textDocument/didSave", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": testURI},
+	})
+	c.call("textDocument/hover", textDocumentPositionParams{
+		TextDocument: textDocumentIdentifier{URI: testURI},
+	}, nil)
+	if diags, _ := c.diagnostics(testURI); len(diags) != 0 {
+		tt.Fatalf("didSave: diagnostics: got %v, want none", diags)
+	}
+
+	// Go-to-definition.
+	testCases := []struct {
+		at         string
+		delta      int
+		wantURI    string
+		wantPrefix string
+	}{
+		{"limit\n", 0, testURI, "pri const limit"},
+		{"this.n =", 5, testURI, "n base.u32"},
+		{"other.thing,", 7, filenameToURI(otherFilename), "pub struct thing?"},
+		{"twice(x:3)", 0, filenameToURI(otherFilename), "pub func thing.twice"},
+	}
+	for _, tc := range testCases {
+		got := location{}
+		c.call("textDocument/definition", textDocumentPositionParams{
+			TextDocument: textDocumentIdentifier{URI: testURI},
+			Position:     positionOfString(tt, testSrc, tc.at, tc.delta),
+		}, &got)
+		if got.URI != tc.wantURI {
+			tt.Errorf("definition at %q: URI: got %q, want %q", tc.at, got.URI, tc.wantURI)
+			continue
+		}
+		src := testSrc
+		if tc.wantURI != testURI {
+			src = otherSrc
+		}
+		start := offsetOf([]byte(src), got.Range.Start)
+		if !strings.HasPrefix(src[start:], tc.wantPrefix) {
+			tt.Errorf("definition at %q: got %q, want prefix %q",
+				tc.at, src[start:offsetOf([]byte(src), got.Range.End)], tc.wantPrefix)
+		}
+	}
+
+	// Hover.
+	h := hover{}
+	c.call("textDocument/hover", textDocumentPositionParams{
+		TextDocument: textDocumentIdentifier{URI: testURI},
+		Position:     positionOfString(tt, testSrc, "= z", 2),
+	}, &h)
+	if want := "z: base.u32[..10]"; !strings.Contains(h.Contents.Value, want) {
+		tt.Errorf("hover: got %q, want it to contain %q", h.Contents.Value, want)
+	}
+	if want := "bounds: [0..10]"; !strings.Contains(h.Contents.Value, want) {
+		tt.Errorf("hover: got %q, want it to contain %q", h.Contents.Value, want)
+	}
+
+	// Formatting.
+	uglySrc := strings.Replace(testSrc, "\tthis.n = z", "  this.n   =   z", 1)
+	c.notify("textDocument/didChange", map[string]interface{}{
+		"textDocument":   map[string]interface{}{"uri": testURI, "version": 4},
+		"contentChanges": []map[string]interface{}{{"text": uglySrc}},
+	})
+	edits := []textEdit(nil)
+	c.call("textDocument/formatting", formattingParams{
+		TextDocument: textDocumentIdentifier{URI: testURI},
+	}, &edits)
+	if len(edits) != 1 || edits[0].NewText != testSrc {
+		tt.Errorf("formatting: got %+v, want one edit with the formatted source", edits)
+	}
+
+	// Unknown methods are an error, but don't stop the server.
+	if m := c.call("wuffs/noSuchMethod", nil, nil); m.Error == nil || m.Error.Code != codeMethodNotFound {
+		tt.Errorf("noSuchMethod: got %+v, want a method-not-found error", m.Error)
+	}
+
+	c.call("shutdown", nil, nil)
+	c.notify("exit", nil)
+	if err := <-done; err != nil {
+		tt.Fatalf("serve: %v", err)
+	}
+}
@@ -0,0 +1,216 @@
+// Copyright 2018 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+// This file implements the build cache for "wuffs gen". Generated code is
+// stored under gen/cache in the Wuffs root directory, in a file named after
+// the hash of everything that the code generator's output depends on: the
+// generator binary, its arguments, any external C formatter binary, the
+// package's source files and the interfaces of the packages that it uses,
+// directly or indirectly. Packages from other Wuffs roots in the WUFFSPATH
+// share that cache.
+//
+// Stale entries are never evicted, so the cache grows with every change to
+// the generated code. "wuffs gen -cleancache" empties it, as does deleting
+// the gen/cache directory.
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/wuffs/lang/generate"
+	"github.com/google/wuffs/lang/parse"
+)
+
+// cacheKey returns the build cache key for running command with cmdArgs on
+// the given source files, from the given Wuffs root, or "" if the key cannot
+// be computed, e.g. because the command or a used package's interface cannot
+// be found. In that case, the code generator is run anyway, to report any
+// error.
+func (h *genHelper) cacheKey(command string, cmdArgs []string,
+	root string, qualFilenames []string, usePaths []string) string {
+
+	generatorHash, err := h.binaryHash(command)
+	if err != nil {
+		return ""
+	}
+	w := sha256.New()
+	fmt.Fprintf(w, "%q\n%x\n", command, generatorHash)
+	for _, arg := range cmdArgs {
+		fmt.Fprintf(w, "arg %q\n", arg)
+		// An external C formatter's output is part of the generated code, so
+		// changing that formatter has to change the key.
+		if cformatter := strings.TrimPrefix(arg, "-cformatter="); cformatter != arg && cformatter != "" {
+			cformatterHash, err := h.binaryHash(cformatter)
+			if err != nil {
+				return ""
+			}
+			fmt.Fprintf(w, "cformatter %x\n", cformatterHash)
+		}
+	}
+	for _, filename := range qualFilenames {
+		if err := hashFile(w, "src", filename, root); err != nil {
+			return ""
+		}
+	}
+	if err := h.hashUses(w, usePaths, map[string]bool{}); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(w.Sum(nil))
+}
+
+// binaryHash returns the hash of the command's binary, such as a code
+// generator or a C formatter, found on the PATH.
+func (h *genHelper) binaryHash(command string) ([]byte, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if x, ok := h.binaryHashes[command]; ok {
+		return x, nil
+	}
+	filename, err := exec.LookPath(command)
+	if err != nil {
+		return nil, err
+	}
+	src, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	x := sha256.Sum256(src)
+	if h.binaryHashes == nil {
+		h.binaryHashes = map[string][]byte{}
+	}
+	h.binaryHashes[command] = x[:]
+	return x[:], nil
+}
+
+// hashUses hashes the interfaces, under their Wuffs roots' gen/wuffs, of the
+// packages with the given use paths and of the packages that they use in turn.
+func (h *genHelper) hashUses(w hash.Hash, usePaths []string, seen map[string]bool) error {
+	for _, usePath := range usePaths {
+		if seen[usePath] {
+			continue
+		}
+		seen[usePath] = true
+
+		root, err := generate.PackageRoot(usePath)
+		if err != nil {
+			return err
+		}
+		filename := genFilename(root, usePath, "wuffs", "wuffs")
+		if err := hashFile(w, "use", filename, root); err != nil {
+			return err
+		}
+		more, err := parseUsePaths([]string{filename}, &parse.Options{
+			AllowDoubleUnderscoreNames: true,
+		})
+		if err != nil {
+			return err
+		}
+		if err := h.hashUses(w, more, seen); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hashFile hashes a file's name, relative to its Wuffs root directory so that
+// the cache survives moving that directory, and its contents.
+func hashFile(w hash.Hash, kind string, filename string, root string) error {
+	src, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	if rel, err := filepath.Rel(root, filename); err == nil {
+		filename = filepath.ToSlash(rel)
+	}
+	fmt.Fprintf(w, "%s %q %d\n", kind, filename, len(src))
+	w.Write(src)
+	return nil
+}
+
+func (h *genHelper) cacheDirname() string {
+	return filepath.Join(h.wuffsRoot, "gen", "cache")
+}
+
+func (h *genHelper) cacheFilename(key string) string {
+	return filepath.Join(h.cacheDirname(), key[:2], key)
+}
+
+// cleanCache deletes every cache entry.
+func (h *genHelper) cleanCache() error {
+	return os.RemoveAll(h.cacheDirname())
+}
+
+// readCache returns the cached output for the given key, or nil if there is
+// none. It reports the cache hit or miss for the generated file to w if
+// verbose.
+func (h *genHelper) readCache(w io.Writer, root string, dirname string, lang string, suffix string, key string) ([]byte, error) {
+	out := []byte(nil)
+	if key != "" {
+		if x, err := ioutil.ReadFile(h.cacheFilename(key)); err == nil {
+			out = x
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	if h.verbose {
+		status := "gen cache hit: "
+		if out == nil {
+			status = "gen cache miss:"
+		}
+		fmt.Fprintln(w, status, genFilename(root, dirname, lang, suffix))
+	}
+	return out, nil
+}
+
+// writeCache stores the output for the given key, if any.
+func (h *genHelper) writeCache(key string, out []byte) error {
+	if key == "" {
+		return nil
+	}
+	filename := h.cacheFilename(key)
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return err
+	}
+	// Write to a temporary file first, so that an interrupted write does not
+	// leave a truncated cache entry. Its name is unique, as concurrent jobs
+	// may write the same entry.
+	tmp, err := ioutil.TempFile(filepath.Dir(filename), key+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(out)
+	if err1 := tmp.Close(); err == nil {
+		err = err1
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filename)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
@@ -0,0 +1,171 @@
+// Copyright 2018 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/wuffs/lang/generate"
+)
+
+func TestCache(tt *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "wuffscache")
+	if err != nil {
+		tt.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	writeFile := func(filename string, contents string, perm os.FileMode) {
+		filename = filepath.Join(tmpDir, filepath.FromSlash(filename))
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			tt.Fatalf("MkdirAll: %v", err)
+		}
+		if err := ioutil.WriteFile(filename, []byte(contents), perm); err != nil {
+			tt.Fatalf("WriteFile: %v", err)
+		}
+	}
+
+	// A fake code generator and C formatter, on the PATH, and a Wuffs root on
+	// the WUFFSPATH holding the "cachetest/main" package, which uses
+	// "cachetest/used".
+	const (
+		command      = "wuffs-cachetest"
+		generatorSrc = "#!/bin/sh\n"
+		cformatter   = "cachetest-format"
+		cformatSrc   = "#!/bin/sh\ncat\n"
+		mainSrc      = "packageid \"main\"\nuse \"cachetest/used\"\n"
+		usedSrc      = "packageid \"used\"\n"
+	)
+	writeFile("bin/"+command, generatorSrc, 0755)
+	writeFile("bin/"+cformatter, cformatSrc, 0755)
+	writeFile("root/"+generate.ManifestFilename, "cachetest/...\n", 0644)
+	writeFile("root/cachetest/main/main.wuffs", mainSrc, 0644)
+	writeFile("root/gen/wuffs/cachetest/used.wuffs", usedSrc, 0644)
+
+	for _, env := range []struct{ key, value string }{
+		{"PATH", filepath.Join(tmpDir, "bin") + string(filepath.ListSeparator) + os.Getenv("PATH")},
+		{"WUFFSPATH", filepath.Join(tmpDir, "root")},
+	} {
+		oldValue := os.Getenv(env.key)
+		defer os.Setenv(env.key, oldValue)
+		os.Setenv(env.key, env.value)
+	}
+
+	root, err := generate.PackageRoot("cachetest/used")
+	if err != nil {
+		tt.Skipf("cannot find the test packages: %v", err)
+	}
+	if want := filepath.Join(tmpDir, "root"); root != want {
+		tt.Skipf("test packages: got root %q, want %q", root, want)
+	}
+	srcFilenames := []string{filepath.Join(root, "cachetest", "main", "main.wuffs")}
+	usePaths := []string{"cachetest/used"}
+	args := []string{"gen", "-package_name", "main"}
+
+	// key returns the cache key with a fresh genHelper, so that nothing is
+	// remembered from earlier calls, and whether that key is a cache hit.
+	key := func(args []string) (string, bool) {
+		h := &genHelper{wuffsRoot: tmpDir}
+		k := h.cacheKey(command, args, root, srcFilenames, usePaths)
+		if k == "" {
+			tt.Fatalf("cacheKey: no key")
+		}
+		out, err := h.readCache(ioutil.Discard, root, "cachetest/main", "c", "h", k)
+		if err != nil {
+			tt.Fatalf("readCache: %v", err)
+		}
+		return k, out != nil
+	}
+
+	h := &genHelper{wuffsRoot: tmpDir}
+	key0, hit := key(args)
+	if hit {
+		tt.Fatalf("first run: got a cache hit, want a miss")
+	}
+	want := []byte("// Generated code.\n")
+	if err := h.writeCache(key0, want); err != nil {
+		tt.Fatalf("writeCache: %v", err)
+	}
+
+	// An unchanged rerun is a cache hit.
+	if k, hit := key(args); k != key0 || !hit {
+		tt.Fatalf("unchanged rerun: got a different key or a cache miss")
+	}
+	if out, err := h.readCache(ioutil.Discard, root, "cachetest/main", "c", "h", key0); err != nil {
+		tt.Fatalf("readCache: %v", err)
+	} else if !bytes.Equal(out, want) {
+		tt.Fatalf("readCache: got %q, want %q", out, want)
+	}
+
+	// Changing a source file, a used package's interface, the generator's
+	// arguments, the generator itself or the C formatter is a cache miss.
+	// Undoing the change is a cache hit again.
+	cformatterArgs := []string{"gen", "-package_name", "main", "-cformatter=" + cformatter}
+	testCases := []struct {
+		desc string
+		// filename, if non-empty, is the file changed to hold contents.
+		filename string
+		contents string
+		original string
+		// args, if non-nil, replaces the generator's arguments, both before
+		// and after the change. newArgs, if non-nil, replaces them after it.
+		args    []string
+		newArgs []string
+	}{
+		{"changed source file", "root/cachetest/main/main.wuffs", mainSrc + "\n", mainSrc, nil, nil},
+		{"changed used package interface", "root/gen/wuffs/cachetest/used.wuffs",
+			usedSrc + "pub const c base.u32 = 1\n", usedSrc, nil, nil},
+		{"changed generator args", "", "", "", nil, cformatterArgs},
+		{"changed generator", "bin/" + command, generatorSrc + "exit 0\n", generatorSrc, nil, nil},
+		{"changed C formatter", "bin/" + cformatter, cformatSrc + "exit 0\n", cformatSrc, cformatterArgs, nil},
+	}
+	for _, tc := range testCases {
+		baseArgs := args
+		if tc.args != nil {
+			baseArgs = tc.args
+		}
+		cmdArgs := baseArgs
+		if tc.newArgs != nil {
+			cmdArgs = tc.newArgs
+		}
+		baseKey, _ := key(baseArgs)
+		if tc.filename != "" {
+			writeFile(tc.filename, tc.contents, 0644)
+		}
+		if k, hit := key(cmdArgs); k == baseKey || hit {
+			tt.Errorf("%s: got the same key or a cache hit, want a miss", tc.desc)
+		}
+		if tc.filename != "" {
+			writeFile(tc.filename, tc.original, 0644)
+		}
+		if k, _ := key(baseArgs); k != baseKey {
+			tt.Errorf("%s, undone: got a different key, want the original", tc.desc)
+		}
+		if k, hit := key(args); k != key0 || !hit {
+			tt.Errorf("%s, undone: got a different key or a cache miss, want a hit", tc.desc)
+		}
+	}
+
+	if err := h.cleanCache(); err != nil {
+		tt.Fatalf("cleanCache: %v", err)
+	}
+	if _, hit := key(args); hit {
+		tt.Fatalf("after cleanCache: got a cache hit, want a miss")
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright 2018 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/wuffs/lang/check"
+	"github.com/google/wuffs/lang/diagnostic"
+	"github.com/google/wuffs/lang/generate"
+	"github.com/google/wuffs/lang/validate"
+
+	cf "github.com/google/wuffs/cmd/commonflags"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+const (
+	suggestInvariantsDefault = false
+	suggestInvariantsUsage   = `whether to print inferred inv conditions for while loops`
+)
+
+func doCheck(wuffsRoot string, args []string) error {
+	flags := flag.NewFlagSet("check", flag.ExitOnError)
+	jsonFlag := flags.Bool("json", cf.JSONDefault, cf.JSONUsage)
+	suggestInvariantsFlag := flags.Bool("suggest-invariants", suggestInvariantsDefault, suggestInvariantsUsage)
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	args = flags.Args()
+	if len(args) == 0 {
+		args = []string{"std/..."}
+	}
+
+	h := checkHelper{
+		wuffsRoot: wuffsRoot,
+		tm:        &t.Map{},
+		opts: &check.Options{
+			InferInvariants: *suggestInvariantsFlag,
+		},
+		files: map[string][]*a.File{},
+	}
+	for _, arg := range args {
+		recursive := strings.HasSuffix(arg, "/...")
+		if recursive {
+			arg = arg[:len(arg)-4]
+		}
+		if arg == "" {
+			continue
+		}
+		if err := h.checkArg(strings.TrimRight(arg, "/"), recursive); err != nil {
+			if *jsonFlag {
+				return diagnostic.JSON("check", err)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+type checkHelper struct {
+	wuffsRoot string
+	tm        *t.Map
+	opts      *check.Options
+
+	// files holds the parsed and checked files of each loaded package, keyed
+	// by the package's directory name, e.g. "std/deflate". A nil value means
+	// that the package is still loading.
+	files map[string][]*a.File
+}
+
+func (h *checkHelper) checkArg(dirname string, recursive bool) error {
+	if !validate.IsValidUsePath(dirname) {
+		return fmt.Errorf("invalid package path %q", dirname)
+	}
+	_, qualFilenames, dirnames, err := listPackageDir(dirname, recursive)
+	if err != nil {
+		return err
+	}
+	if len(qualFilenames) > 0 {
+		if err := h.load(dirname, qualFilenames); err != nil {
+			return err
+		}
+	}
+	for _, d := range dirnames {
+		if err := h.checkArg(dirname+"/"+d, recursive); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// load parses and checks a package, after loading its dependencies.
+func (h *checkHelper) load(dirname string, qualFilenames []string) error {
+	if files, ok := h.files[dirname]; ok {
+		if files == nil {
+			return fmt.Errorf("wuffs check: cyclical use of package %q", dirname)
+		}
+		return nil
+	}
+	h.files[dirname] = nil
+
+	if qualFilenames == nil {
+		var err error
+		_, qualFilenames, _, err = listPackageDir(dirname, false)
+		if err != nil {
+			return err
+		}
+		if len(qualFilenames) == 0 {
+			return fmt.Errorf("wuffs check: no .wuffs files in %q", dirname)
+		}
+	}
+	files, err := generate.ParseFiles(h.tm, qualFilenames, nil)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		for _, n := range f.TopLevelDecls() {
+			if n.Kind() != a.KUse {
+				continue
+			}
+			usePath, ok := t.Unescape(n.AsUse().Path().Str(h.tm))
+			if !ok {
+				return fmt.Errorf("wuffs check: bad use path %q", n.AsUse().Path().Str(h.tm))
+			}
+			if err := h.load(usePath, nil); err != nil {
+				return err
+			}
+		}
+	}
+
+	c, err := check.Check(h.tm, files, h.resolveUse, h.opts)
+	if err != nil {
+		return err
+	}
+	for _, x := range c.InferredInvariants() {
+		filename, line := x.While.AsNode().AsRaw().FilenameLine()
+		if rel, err := filepath.Rel(h.wuffsRoot, filename); err == nil {
+			filename = rel
+		}
+		fmt.Printf("%s:%d: while %s\n", filename, line, x.While.Condition().Str(h.tm))
+		for _, o := range x.Conditions {
+			fmt.Printf("\tinv %s,\n", o.Str(h.tm))
+		}
+	}
+	h.files[dirname] = files
+	return nil
+}
+
+// resolveUse returns the public interface of a loaded package, instead of
+// reading the gen/wuffs files written by "wuffs gen".
+func (h *checkHelper) resolveUse(usePath string) ([]byte, error) {
+	files := h.files[strings.TrimSuffix(usePath, ".wuffs")]
+	if files == nil {
+		return nil, fmt.Errorf("wuffs check: cannot resolve `use %q`", usePath)
+	}
+	return wuffsInterface(h.tm, files)
+}
@@ -0,0 +1,317 @@
+// Copyright 2018 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/google/wuffs/lang/generate"
+	"github.com/google/wuffs/lang/parse"
+	"github.com/google/wuffs/lang/validate"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+const (
+	dotDefault = false
+	dotUsage   = `whether to print the graph in the Graphviz DOT language`
+
+	reverseDefault = false
+	reverseUsage   = `whether to print, for each package, the packages that use it instead of those that it uses`
+)
+
+func doDeps(wuffsRoot string, args []string) error {
+	flags := flag.NewFlagSet("deps", flag.ExitOnError)
+	dotFlag := flags.Bool("dot", dotDefault, dotUsage)
+	reverseFlag := flags.Bool("reverse", reverseDefault, reverseUsage)
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	args = flags.Args()
+	if len(args) == 0 {
+		args = []string{"std/..."}
+	}
+
+	g := depGraph{}
+	if err := g.addArgs(args); err != nil {
+		return err
+	}
+	sorted, err := g.sort()
+	if err != nil {
+		return err
+	}
+
+	edges := func(p *depPackage) []*depPackage { return p.deps }
+	if *reverseFlag {
+		edges = func(p *depPackage) []*depPackage { return p.rdeps }
+	}
+	w := bufio.NewWriter(os.Stdout)
+	if *dotFlag {
+		writeDepsDot(w, sorted, edges)
+	} else {
+		writeDepsText(w, sorted, edges)
+	}
+	return w.Flush()
+}
+
+// writeDepsText writes one line per package: its path, a colon and the paths
+// of the packages that it has edges to.
+func writeDepsText(w io.Writer, packages []*depPackage, edges func(*depPackage) []*depPackage) {
+	for _, p := range packages {
+		fmt.Fprintf(w, "%s:", p.dirname)
+		for _, q := range edges(p) {
+			fmt.Fprintf(w, " %s", q.dirname)
+		}
+		fmt.Fprintf(w, "\n")
+	}
+}
+
+func writeDepsDot(w io.Writer, packages []*depPackage, edges func(*depPackage) []*depPackage) {
+	fmt.Fprintf(w, "digraph wuffs {\n")
+	for _, p := range packages {
+		fmt.Fprintf(w, "\t%q;\n", p.dirname)
+	}
+	for _, p := range packages {
+		for _, q := range edges(p) {
+			fmt.Fprintf(w, "\t%q -> %q;\n", p.dirname, q.dirname)
+		}
+	}
+	fmt.Fprintf(w, "}\n")
+}
+
+// depGraph is the graph of packages and the packages that they `use`.
+type depGraph struct {
+	// skipUses is whether to not parse packages' `use` declarations, leaving
+	// the graph without edges.
+	skipUses bool
+	// skipDeps is whether to not add the packages that added packages use.
+	// Edges to them are then left out of the graph.
+	skipDeps bool
+	// withBase is whether to also add the base package, which every package
+	// implicitly depends on, unless g.skipDeps.
+	withBase bool
+
+	// packages are the packages in the order that they were added.
+	packages  []*depPackage
+	byDirname map[string]*depPackage
+}
+
+// depPackage is a node of a depGraph.
+type depPackage struct {
+	// root is the Wuffs root directory that provides the package.
+	root          string
+	dirname       string
+	qualFilenames []string
+	usePaths      []string
+
+	// deps and rdeps are the packages that this package uses and that use
+	// this package. They are set by depGraph.sort.
+	deps  []*depPackage
+	rdeps []*depPackage
+}
+
+// addArgs adds the packages named by args, where a "/..." suffix means to
+// include sub-directories.
+func (g *depGraph) addArgs(args []string) error {
+	for _, arg := range args {
+		recursive := strings.HasSuffix(arg, "/...")
+		if recursive {
+			arg = arg[:len(arg)-4]
+		}
+		if arg == "" {
+			continue
+		}
+
+		if err := g.add(arg, recursive); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// add adds the package in dirname, and the packages that it uses unless
+// g.skipDeps, to the graph.
+func (g *depGraph) add(dirname string, recursive bool) error {
+	for len(dirname) > 0 && dirname[len(dirname)-1] == '/' {
+		dirname = dirname[:len(dirname)-1]
+	}
+
+	if g.byDirname == nil {
+		g.byDirname = map[string]*depPackage{}
+	} else if _, ok := g.byDirname[dirname]; ok {
+		return nil
+	}
+	// Mark dirname as seen, before adding its dependencies, so that a `use`
+	// cycle does not recurse forever. The cycle is reported by sort.
+	g.byDirname[dirname] = nil
+
+	if dirname == "base" {
+		root, err := generate.PackageRoot(dirname)
+		if err != nil {
+			return err
+		}
+		return g.addDir(root, dirname, nil)
+	}
+
+	if !validate.IsValidUsePath(dirname) {
+		return fmt.Errorf("invalid package path %q", dirname)
+	}
+
+	root, qualFilenames, dirnames, err := listPackageDir(dirname, recursive)
+	if err != nil {
+		return err
+	}
+	if len(qualFilenames) > 0 {
+		if err := g.addDir(root, dirname, qualFilenames); err != nil {
+			return err
+		}
+	}
+	if len(dirnames) > 0 {
+		for _, d := range dirnames {
+			if err := g.add(dirname+"/"+d, recursive); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (g *depGraph) addDir(root string, dirname string, qualFilenames []string) error {
+	packageName := path.Base(dirname)
+	if !validName(packageName) {
+		return fmt.Errorf(`invalid package %q, not in [a-z0-9]+`, packageName)
+	}
+
+	p := &depPackage{
+		root:          root,
+		dirname:       dirname,
+		qualFilenames: qualFilenames,
+	}
+	if !g.skipUses {
+		usePaths, err := parseUsePaths(qualFilenames, nil)
+		if err != nil {
+			return err
+		}
+		p.usePaths = usePaths
+	}
+	if !g.skipDeps {
+		for _, usePath := range p.usePaths {
+			if err := g.add(usePath, false); err != nil {
+				return err
+			}
+		}
+		if g.withBase {
+			if err := g.add("base", false); err != nil {
+				return err
+			}
+		}
+	}
+	g.packages = append(g.packages, p)
+	g.byDirname[dirname] = p
+	return nil
+}
+
+// sort sets the packages' edges and returns the packages in topological
+// order: every package comes after the packages that it uses. Packages are
+// otherwise kept in the order that they were added. It returns an error if
+// there is a `use` cycle.
+func (g *depGraph) sort() ([]*depPackage, error) {
+	for _, p := range g.packages {
+		p.deps, p.rdeps = nil, nil
+	}
+	for _, p := range g.packages {
+		for _, usePath := range p.usePaths {
+			if q := g.byDirname[usePath]; q != nil {
+				p.deps = append(p.deps, q)
+				q.rdeps = append(q.rdeps, p)
+			}
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := map[*depPackage]int{}
+	stack := []*depPackage(nil)
+	sorted := make([]*depPackage, 0, len(g.packages))
+
+	var visit func(p *depPackage) error
+	visit = func(p *depPackage) error {
+		switch state[p] {
+		case visiting:
+			cycle := []string(nil)
+			for i := len(stack) - 1; i >= 0; i-- {
+				if stack[i] == p {
+					for _, q := range stack[i:] {
+						cycle = append(cycle, q.dirname)
+					}
+					break
+				}
+			}
+			cycle = append(cycle, p.dirname)
+			return fmt.Errorf("use cycle: %s", strings.Join(cycle, " -> "))
+		case visited:
+			return nil
+		}
+		state[p] = visiting
+		stack = append(stack, p)
+		for _, q := range p.deps {
+			if err := visit(q); err != nil {
+				return err
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[p] = visited
+		sorted = append(sorted, p)
+		return nil
+	}
+
+	for _, p := range g.packages {
+		if err := visit(p); err != nil {
+			return nil, err
+		}
+	}
+	return sorted, nil
+}
+
+// parseUsePaths returns the paths of the packages that the given files `use`.
+func parseUsePaths(qualifiedFilenames []string, opts *parse.Options) ([]string, error) {
+	tm := &t.Map{}
+	files, err := generate.ParseFiles(tm, qualifiedFilenames, opts)
+	if err != nil {
+		return nil, err
+	}
+	ret := []string(nil)
+	for _, f := range files {
+		for _, n := range f.TopLevelDecls() {
+			if n.Kind() != a.KUse {
+				continue
+			}
+			usePath, _ := t.Unescape(tm.ByID(n.AsUse().Path()))
+			ret = append(ret, usePath)
+		}
+	}
+	return ret, nil
+}
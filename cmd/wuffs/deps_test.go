@@ -0,0 +1,98 @@
+// Copyright 2018 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// newTestDepGraph returns a graph of packages, in the given order, that use
+// the packages listed after a colon, such as "a: b c".
+func newTestDepGraph(specs ...string) *depGraph {
+	g := &depGraph{byDirname: map[string]*depPackage{}}
+	for _, spec := range specs {
+		i := strings.IndexByte(spec, ':')
+		p := &depPackage{
+			dirname:  spec[:i],
+			usePaths: strings.Fields(spec[i+1:]),
+		}
+		g.packages = append(g.packages, p)
+		g.byDirname[p.dirname] = p
+	}
+	return g
+}
+
+func TestDepGraphSort(tt *testing.T) {
+	g := newTestDepGraph(
+		"std/gif: std/lzw",
+		"std/zlib: std/adler32 std/deflate",
+		"std/lzw:",
+		"std/deflate:",
+		"std/adler32:",
+		"std/gzip: std/crc32 std/deflate",
+	)
+	sorted, err := g.sort()
+	if err != nil {
+		tt.Fatalf("sort: %v", err)
+	}
+
+	buf := &bytes.Buffer{}
+	writeDepsText(buf, sorted, func(p *depPackage) []*depPackage { return p.deps })
+	got := buf.String()
+	want := "" +
+		"std/lzw:\n" +
+		"std/gif: std/lzw\n" +
+		"std/adler32:\n" +
+		"std/deflate:\n" +
+		"std/zlib: std/adler32 std/deflate\n" +
+		"std/gzip: std/deflate\n"
+	if got != want {
+		tt.Fatalf("deps:\ngot:\n%s\nwant:\n%s", got, want)
+	}
+
+	buf.Reset()
+	writeDepsText(buf, sorted, func(p *depPackage) []*depPackage { return p.rdeps })
+	got = buf.String()
+	want = "" +
+		"std/lzw: std/gif\n" +
+		"std/gif:\n" +
+		"std/adler32: std/zlib\n" +
+		"std/deflate: std/zlib std/gzip\n" +
+		"std/zlib:\n" +
+		"std/gzip:\n"
+	if got != want {
+		tt.Fatalf("reverse deps:\ngot:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestDepGraphCycle(tt *testing.T) {
+	g := newTestDepGraph(
+		"test/a: test/b",
+		"test/b: test/c",
+		"test/c: test/d test/b",
+		"test/d:",
+	)
+	_, err := g.sort()
+	if err == nil {
+		tt.Fatalf("sort: got no error, want a use cycle")
+	}
+	got := err.Error()
+	want := "use cycle: test/b -> test/c -> test/b"
+	if got != want {
+		tt.Fatalf("sort: got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,404 @@
+// Copyright 2018 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/google/wuffs/lang/builtin"
+	"github.com/google/wuffs/lang/parse"
+	"github.com/google/wuffs/lang/validate"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+const (
+	formatDefault = "text"
+	formatUsage   = `output format: "text", "markdown" or "html"`
+)
+
+func doDoc(wuffsRoot string, args []string) error {
+	flags := flag.NewFlagSet("doc", flag.ExitOnError)
+	formatFlag := flags.String("format", formatDefault, formatUsage)
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	write := (func(w io.Writer, p *docPackage))(nil)
+	switch *formatFlag {
+	case "text":
+		write = writeDocText
+	case "markdown":
+		write = writeDocMarkdown
+	case "html":
+		write = writeDocHTML
+	default:
+		return fmt.Errorf("bad -format flag value %q", *formatFlag)
+	}
+	args = flags.Args()
+	if len(args) == 0 {
+		return fmt.Errorf("wuffs doc: no packages given")
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	for i, arg := range args {
+		dirname := strings.TrimRight(arg, "/")
+		if !validate.IsValidUsePath(dirname) {
+			return fmt.Errorf("invalid package path %q", dirname)
+		}
+		p, err := loadDocPackage(dirname)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			fmt.Fprintf(w, "\n")
+		}
+		write(w, p)
+	}
+	return w.Flush()
+}
+
+// docPackage is the public surface of a Wuffs package.
+type docPackage struct {
+	dirname string // e.g. "std/gif".
+	name    string // e.g. "gif".
+	comment []string
+
+	statuses []*docDecl
+	consts   []*docDecl
+	funcs    []*docDecl
+	structs  []*docDecl
+}
+
+// docDecl is a public top level declaration.
+type docDecl struct {
+	// wuffs is the declaration as Wuffs source code, without any body.
+	wuffs string
+	// cName is the name of the corresponding C function, struct, constant or
+	// #define, e.g. "wuffs_gif__decoder__decode_frame".
+	cName string
+	// asserts are a func's "pre", "inv" and "post" conditions.
+	asserts []string
+	// comment is the doc comment, one element per line, without the "//"
+	// prefix.
+	comment []string
+	// methods are a struct's pub methods.
+	methods []*docDecl
+}
+
+func loadDocPackage(dirname string) (*docPackage, error) {
+	_, qualFilenames, _, err := listPackageDir(dirname, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(qualFilenames) == 0 {
+		return nil, fmt.Errorf("wuffs doc: no .wuffs files in %q", dirname)
+	}
+	srcs := make([][]byte, len(qualFilenames))
+	for i, filename := range qualFilenames {
+		if srcs[i], err = ioutil.ReadFile(filename); err != nil {
+			return nil, err
+		}
+	}
+	return newDocPackage(dirname, qualFilenames, srcs)
+}
+
+// newDocPackage returns the docPackage for the package with the given path,
+// whose source files have the given names and contents.
+func newDocPackage(dirname string, filenames []string, srcs [][]byte) (*docPackage, error) {
+	p := &docPackage{
+		dirname: dirname,
+		name:    path.Base(dirname),
+	}
+	if !validName(p.name) {
+		return nil, fmt.Errorf(`invalid package %q, not in [a-z0-9]+`, p.name)
+	}
+	pkgPrefix := "wuffs_" + p.name + "__"
+	tm := &t.Map{}
+	structs := map[t.ID]*docDecl{}
+	methods := []*a.Func(nil)
+	methodComments := [][]string(nil)
+
+	for i, filename := range filenames {
+		tokens, comments, err := t.Tokenize(tm, filename, srcs[i])
+		if err != nil {
+			return nil, err
+		}
+		f, err := parse.Parse(tm, filename, tokens, &parse.Options{
+			AllowDoubleUnderscoreNames: true,
+		})
+		if err != nil {
+			return nil, err
+		}
+		codeLines := map[uint32]bool{}
+		for _, tok := range tokens {
+			codeLines[tok.Line] = true
+		}
+		docComment := func(line uint32) []string {
+			i := line
+			for i > 1 && !codeLines[i-1] && int(i-1) < len(comments) && comments[i-1] != "" {
+				i--
+			}
+			ret := []string(nil)
+			for ; i < line; i++ {
+				s := strings.TrimPrefix(comments[i], "//")
+				ret = append(ret, strings.TrimPrefix(s, " "))
+			}
+			return ret
+		}
+
+		for _, n := range f.TopLevelDecls() {
+			switch n.Kind() {
+			case a.KConst:
+				n := n.AsConst()
+				if !n.Public() {
+					continue
+				}
+				p.consts = append(p.consts, &docDecl{
+					wuffs: fmt.Sprintf("pub const %s %s = %s",
+						n.QID().Str(tm), n.XType().Str(tm), n.Value().Str(tm)),
+					cName:   pkgPrefix + n.QID()[1].Str(tm),
+					comment: docComment(n.Line()),
+				})
+
+			case a.KFunc:
+				n := n.AsFunc()
+				if !n.Public() {
+					continue
+				}
+				if !n.Receiver().IsZero() {
+					// Methods are attached to their receiver struct below,
+					// after every file's structs have been seen.
+					methods = append(methods, n)
+					methodComments = append(methodComments, docComment(n.Line()))
+					continue
+				}
+				p.funcs = append(p.funcs, docFunc(tm, pkgPrefix, n, docComment(n.Line())))
+
+			case a.KPackageID:
+				if p.comment == nil {
+					p.comment = docComment(n.AsPackageID().Line())
+				}
+
+			case a.KStatus:
+				n := n.AsStatus()
+				if !n.Public() {
+					continue
+				}
+				raw := n.QID()[1].Str(tm)
+				msg, ok := t.Unescape(raw)
+				if !ok {
+					return nil, fmt.Errorf("bad status message %q", raw)
+				}
+				prefix := "SUSPENSION_"
+				if n.Keyword() == t.IDError {
+					prefix = "ERROR_"
+				}
+				p.statuses = append(p.statuses, &docDecl{
+					wuffs: fmt.Sprintf("pub %s (%s) %s",
+						n.Keyword().Str(tm), n.Value().Str(tm), n.QID().Str(tm)),
+					cName:   strings.ToUpper(builtin.CName(prefix+msg, pkgPrefix)),
+					comment: docComment(n.Line()),
+				})
+
+			case a.KStruct:
+				n := n.AsStruct()
+				if !n.Public() {
+					continue
+				}
+				effect := ""
+				if n.Suspendible() {
+					effect = "?"
+				}
+				d := &docDecl{
+					wuffs:   fmt.Sprintf("pub struct %s%s", n.QID().Str(tm), effect),
+					cName:   pkgPrefix + n.QID()[1].Str(tm),
+					comment: docComment(n.Line()),
+				}
+				p.structs = append(p.structs, d)
+				structs[n.QID()[1]] = d
+			}
+		}
+	}
+
+	for i, n := range methods {
+		d := structs[n.Receiver()[1]]
+		if d == nil || n.Receiver()[0] != 0 {
+			return nil, fmt.Errorf("wuffs doc: no pub struct for method %s.%s",
+				n.Receiver().Str(tm), n.FuncName().Str(tm))
+		}
+		d.methods = append(d.methods, docFunc(tm, pkgPrefix, n, methodComments[i]))
+	}
+	return p, nil
+}
+
+func docFunc(tm *t.Map, pkgPrefix string, n *a.Func, comment []string) *docDecl {
+	b := []byte("pub func ")
+	cn := pkgPrefix
+	if r := n.Receiver(); !r.IsZero() {
+		b = append(b, r.Str(tm)...)
+		b = append(b, '.')
+		cn += r.Str(tm) + "__"
+	}
+	b = append(b, n.FuncName().Str(tm)...)
+	b = append(b, n.Effect().String()...)
+	cn += n.FuncName().Str(tm)
+	for _, param := range [2]*a.Struct{n.In(), n.Out()} {
+		b = append(b, '(')
+		for j, field := range param.Fields() {
+			field := field.AsField()
+			if j > 0 {
+				b = append(b, ", "...)
+			}
+			b = append(b, field.Name().Str(tm)...)
+			b = append(b, ' ')
+			b = append(b, field.XType().Str(tm)...)
+		}
+		b = append(b, ')')
+	}
+
+	asserts := []string(nil)
+	for _, o := range n.Asserts() {
+		asserts = append(asserts, assertStr(tm, o.AsAssert()))
+	}
+
+	return &docDecl{
+		wuffs:   string(b),
+		cName:   cn,
+		asserts: asserts,
+		comment: comment,
+	}
+}
+
+// docSections returns the package's non-empty sections, in output order. Each
+// struct is followed by its methods.
+func (p *docPackage) docSections() (titles []string, sections [][]*docDecl) {
+	for _, x := range []struct {
+		title string
+		decls []*docDecl
+	}{
+		{"Statuses", p.statuses},
+		{"Constants", p.consts},
+		{"Structs", p.structs},
+		{"Functions", p.funcs},
+	} {
+		if len(x.decls) > 0 {
+			titles = append(titles, x.title)
+			sections = append(sections, x.decls)
+		}
+	}
+	return titles, sections
+}
+
+func writeDocText(w io.Writer, p *docPackage) {
+	fmt.Fprintf(w, "package %s // use %q\n", p.name, p.dirname)
+	if len(p.comment) > 0 {
+		fmt.Fprintf(w, "\n")
+		for _, s := range p.comment {
+			fmt.Fprintf(w, "%s\n", s)
+		}
+	}
+	var writeDecl func(d *docDecl, indent string)
+	writeDecl = func(d *docDecl, indent string) {
+		fmt.Fprintf(w, "\n%s%s\n", indent, d.wuffs)
+		for _, s := range d.asserts {
+			fmt.Fprintf(w, "%s\t%s\n", indent, s)
+		}
+		fmt.Fprintf(w, "%s\tC: %s\n", indent, d.cName)
+		for _, s := range d.comment {
+			fmt.Fprintf(w, "%s\t%s\n", indent, s)
+		}
+		for _, m := range d.methods {
+			writeDecl(m, indent+"\t")
+		}
+	}
+	titles, sections := p.docSections()
+	for i, decls := range sections {
+		fmt.Fprintf(w, "\n%s\n", strings.ToUpper(titles[i]))
+		for _, d := range decls {
+			writeDecl(d, "")
+		}
+	}
+}
+
+func writeDocMarkdown(w io.Writer, p *docPackage) {
+	fmt.Fprintf(w, "# Package %s\n\n", p.dirname)
+	fmt.Fprintf(w, "```\nuse %q\n```\n", p.dirname)
+	if len(p.comment) > 0 {
+		fmt.Fprintf(w, "\n%s\n", strings.Join(p.comment, "\n"))
+	}
+	var writeDecl func(d *docDecl, level string)
+	writeDecl = func(d *docDecl, level string) {
+		fmt.Fprintf(w, "\n%s `%s`\n\n", level, d.cName)
+		fmt.Fprintf(w, "```\n%s\n", d.wuffs)
+		for _, s := range d.asserts {
+			fmt.Fprintf(w, "\t%s\n", s)
+		}
+		fmt.Fprintf(w, "```\n")
+		if len(d.comment) > 0 {
+			fmt.Fprintf(w, "\n%s\n", strings.Join(d.comment, "\n"))
+		}
+		for _, m := range d.methods {
+			writeDecl(m, level+"#")
+		}
+	}
+	titles, sections := p.docSections()
+	for i, decls := range sections {
+		fmt.Fprintf(w, "\n## %s\n", titles[i])
+		for _, d := range decls {
+			writeDecl(d, "###")
+		}
+	}
+}
+
+func writeDocHTML(w io.Writer, p *docPackage) {
+	esc := html.EscapeString
+	fmt.Fprintf(w, "<h1>Package %s</h1>\n", esc(p.dirname))
+	fmt.Fprintf(w, "<pre>use %s</pre>\n", esc(fmt.Sprintf("%q", p.dirname)))
+	if len(p.comment) > 0 {
+		fmt.Fprintf(w, "<p>%s</p>\n", esc(strings.Join(p.comment, "\n")))
+	}
+	var writeDecl func(d *docDecl, level int)
+	writeDecl = func(d *docDecl, level int) {
+		fmt.Fprintf(w, "<h%d id=\"%s\"><code>%s</code></h%d>\n", level, esc(d.cName), esc(d.cName), level)
+		fmt.Fprintf(w, "<pre>%s\n", esc(d.wuffs))
+		for _, s := range d.asserts {
+			fmt.Fprintf(w, "\t%s\n", esc(s))
+		}
+		fmt.Fprintf(w, "</pre>\n")
+		if len(d.comment) > 0 {
+			fmt.Fprintf(w, "<p>%s</p>\n", esc(strings.Join(d.comment, "\n")))
+		}
+		for _, m := range d.methods {
+			writeDecl(m, level+1)
+		}
+	}
+	titles, sections := p.docSections()
+	for i, decls := range sections {
+		fmt.Fprintf(w, "<h2>%s</h2>\n", esc(titles[i]))
+		for _, d := range decls {
+			writeDecl(d, 3)
+		}
+	}
+}
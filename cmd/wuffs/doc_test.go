@@ -0,0 +1,57 @@
+// Copyright 2018 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// TestDoc compares each format's documentation for testdata/geom.wuffs, which
+// has public and private statuses, constants, methods and functions, with
+// the golden files testdata/geom.*.
+func TestDoc(tt *testing.T) {
+	src, err := ioutil.ReadFile(filepath.Join("testdata", "geom.wuffs"))
+	if err != nil {
+		tt.Fatalf("ReadFile: %v", err)
+	}
+	p, err := newDocPackage("test/geom", []string{"geom.wuffs"}, [][]byte{src})
+	if err != nil {
+		tt.Fatalf("newDocPackage: %v", err)
+	}
+
+	testCases := []struct {
+		golden string
+		write  func(w io.Writer, p *docPackage)
+	}{
+		{"geom.txt", writeDocText},
+		{"geom.md", writeDocMarkdown},
+		{"geom.html", writeDocHTML},
+	}
+	for _, tc := range testCases {
+		want, err := ioutil.ReadFile(filepath.Join("testdata", tc.golden))
+		if err != nil {
+			tt.Fatalf("ReadFile: %v", err)
+		}
+		buf := &bytes.Buffer{}
+		tc.write(buf, p)
+		if got := buf.Bytes(); !bytes.Equal(got, want) {
+			tt.Errorf("%s:\ngot:\n%s\nwant:\n%s", tc.golden, got, want)
+		}
+	}
+}
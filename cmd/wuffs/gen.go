@@ -16,16 +16,20 @@ package main
 
 import (
 	"bytes"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 
-	"github.com/google/wuffs/lang/generate"
-	"github.com/google/wuffs/lang/parse"
+	"github.com/google/wuffs/cmd/internal/jobs"
+	"github.com/google/wuffs/lang/diagnostic"
 
 	cf "github.com/google/wuffs/cmd/commonflags"
 
@@ -39,8 +43,12 @@ func doGenlib(wuffsRoot string, args []string) error { return doGenGenlib(wuffsR
 func doGenGenlib(wuffsRoot string, args []string, genlib bool) error {
 	flags := flag.NewFlagSet("gen", flag.ExitOnError)
 	cformatterFlag := flags.String("cformatter", cf.CformatterDefault, cf.CformatterUsage)
+	cleancacheFlag := flags.Bool("cleancache", cleancacheDefault, cleancacheUsage)
+	jFlag := flags.Int("j", cf.JDefault, cf.JUsage)
+	jsonFlag := flags.Bool("json", cf.JSONDefault, cf.JSONUsage)
 	langsFlag := flags.String("langs", langsDefault, langsUsage)
 	skipgendepsFlag := flags.Bool("skipgendeps", skipgendepsDefault, skipgendepsUsage)
+	vFlag := flags.Bool("v", vDefault, vUsage)
 
 	skipgenFlag := (*bool)(nil)
 	if genlib {
@@ -57,6 +65,10 @@ func doGenGenlib(wuffsRoot string, args []string, genlib bool) error {
 	if !cf.IsAlphaNumericIsh(*cformatterFlag) {
 		return fmt.Errorf("bad -cformatter flag value %q", *cformatterFlag)
 	}
+	if *jFlag < cf.JMin || cf.JMax < *jFlag {
+		return fmt.Errorf("bad -j flag value %d, outside the range [%d..%d]",
+			*jFlag, cf.JMin, cf.JMax)
+	}
 	langs, err := parseLangs(*langsFlag)
 	if err != nil {
 		return err
@@ -78,23 +90,24 @@ func doGenGenlib(wuffsRoot string, args []string, genlib bool) error {
 		wuffsRoot:   wuffsRoot,
 		langs:       langs,
 		cformatter:  *cformatterFlag,
+		json:        *jsonFlag,
+		jobs:        cf.NumJobs(*jFlag),
 		skipgen:     genlib && *skipgenFlag,
 		skipgendeps: *skipgendepsFlag,
+		verbose:     *vFlag,
 	}
 
-	for _, arg := range args {
-		recursive := strings.HasSuffix(arg, "/...")
-		if recursive {
-			arg = arg[:len(arg)-4]
-		}
-		if arg == "" {
-			continue
-		}
-
-		if err := h.gen(arg, recursive); err != nil {
+	if *cleancacheFlag {
+		if err := h.cleanCache(); err != nil {
 			return err
 		}
 	}
+	if err := h.genArgs(args); err != nil {
+		if *jsonFlag {
+			return diagnostic.JSON("gen", err)
+		}
+		return err
+	}
 
 	if genlib {
 		return h.genlibAffected()
@@ -106,90 +119,223 @@ type genHelper struct {
 	wuffsRoot   string
 	langs       []string
 	cformatter  string
+	json        bool
+	jobs        int
 	skipgen     bool
 	skipgendeps bool
-
-	affected []string
-	seen     map[string]struct{}
-	tm       t.Map
+	verbose     bool
+
+	// affected are the packages given, and those they use, grouped by the
+	// Wuffs root directory that provides them. affectedRoots are those roots,
+	// in the order first seen.
+	affected      map[string][]string
+	affectedRoots []string
+	packages      []*genPackage
+
+	// mu guards binaryHashes and failed, which are shared by concurrent
+	// jobs.
+	mu sync.Mutex
+	// binaryHashes caches the hashes of the wuffs-foo binaries and of the C
+	// formatter.
+	binaryHashes map[string][]byte
+	// failed is whether a job has failed, after which no new jobs start.
+	failed bool
 }
 
-func (h *genHelper) gen(dirname string, recursive bool) error {
-	for len(dirname) > 0 && dirname[len(dirname)-1] == '/' {
-		dirname = dirname[:len(dirname)-1]
-	}
-
-	if h.seen == nil {
-		h.seen = map[string]struct{}{}
-	} else if _, ok := h.seen[dirname]; ok {
-		return nil
-	}
-	h.seen[dirname] = struct{}{}
+// genPackage is a package to generate.
+type genPackage struct {
+	root          string
+	dirname       string
+	qualFilenames []string
+	usePaths      []string
+
+	// deps are the packages, also being generated, that this package uses.
+	// They are generated first, as this package's generated code depends on
+	// their interfaces under gen/wuffs.
+	deps []*genPackage
+	done chan struct{}
+	err  error
+}
 
-	if dirname == "base" {
-		if err := h.genDir(dirname, nil); err != nil {
-			return err
-		}
-		h.affected = append(h.affected, dirname)
-		return nil
+// errSkipped is a genPackage's error when it was not generated because
+// another package failed.
+var errSkipped = errors.New("skipped")
+
+// genArgs generates the packages named by args, where a "/..." suffix means
+// to include sub-directories, and unless h.skipgendeps, the packages that they
+// use.
+func (h *genHelper) genArgs(args []string) error {
+	g := depGraph{
+		skipUses: h.skipgen,
+		skipDeps: h.skipgendeps,
+		withBase: true,
 	}
-
-	if !cf.IsValidUsePath(dirname) {
-		return fmt.Errorf("invalid package path %q", dirname)
+	if err := g.addArgs(args); err != nil {
+		return err
 	}
-
-	qualFilenames, dirnames, err := listDir(
-		filepath.Join(h.wuffsRoot, filepath.FromSlash(dirname)), ".wuffs", recursive)
+	sorted, err := g.sort()
 	if err != nil {
 		return err
 	}
-	if len(qualFilenames) > 0 {
-		if err := h.genDir(dirname, qualFilenames); err != nil {
-			return err
+
+	byDep := map[*depPackage]*genPackage{}
+	for _, d := range sorted {
+		if h.affected == nil {
+			h.affected = map[string][]string{}
+		}
+		if _, ok := h.affected[d.root]; !ok {
+			h.affectedRoots = append(h.affectedRoots, d.root)
 		}
-		h.affected = append(h.affected, dirname)
+		h.affected[d.root] = append(h.affected[d.root], d.dirname)
+		if h.skipgen {
+			continue
+		}
+		p := &genPackage{
+			root:          d.root,
+			dirname:       d.dirname,
+			qualFilenames: d.qualFilenames,
+			usePaths:      d.usePaths,
+			done:          make(chan struct{}),
+		}
+		for _, q := range d.deps {
+			p.deps = append(p.deps, byDep[q])
+		}
+		byDep[d] = p
+		h.packages = append(h.packages, p)
 	}
-	if len(dirnames) > 0 {
-		for _, d := range dirnames {
-			if err := h.gen(dirname+"/"+d, recursive); err != nil {
-				return err
+	return h.genPackages()
+}
+
+// genPackages generates h.packages, running up to h.jobs code generators at a
+// time. A package is generated once all of its dependencies are. The error
+// returned, if any, is that of the first failed package in topological order.
+func (h *genHelper) genPackages() error {
+	numJobs := h.jobs
+	if numJobs <= 0 {
+		numJobs = 1
+	}
+	sem := make(jobs.Semaphore, numJobs)
+	wg := sync.WaitGroup{}
+	for _, p := range h.packages {
+		wg.Add(1)
+		go func(p *genPackage) {
+			defer wg.Done()
+			defer close(p.done)
+			for _, q := range p.deps {
+				<-q.done
+			}
+			p.err = h.genDir(p, sem)
+			if p.err != nil && p.err != errSkipped {
+				h.mu.Lock()
+				h.failed = true
+				h.mu.Unlock()
 			}
+		}(p)
+	}
+	wg.Wait()
+
+	for _, p := range h.packages {
+		if p.err != nil && p.err != errSkipped {
+			return p.err
 		}
 	}
 	return nil
 }
 
-func (h *genHelper) genDir(dirname string, qualFilenames []string) error {
-	// TODO: skip the generation if the output file already exists and its
-	// mtime is newer than all inputs and the wuffs-gen-foo command.
+// startJob acquires a job slot, returning false, with no slot held, if a job
+// has already failed.
+func (h *genHelper) startJob(sem jobs.Semaphore) bool {
+	sem.Acquire()
+	h.mu.Lock()
+	failed := h.failed
+	h.mu.Unlock()
+	if failed {
+		sem.Release()
+		return false
+	}
+	return true
+}
 
-	packageName := path.Base(dirname)
-	if !validName(packageName) {
-		return fmt.Errorf(`invalid package %q, not in [a-z0-9]+`, packageName)
+func (h *genHelper) genDir(p *genPackage, sem jobs.Semaphore) error {
+	for _, q := range p.deps {
+		if q.err != nil {
+			return errSkipped
+		}
 	}
 
-	if h.skipgen {
-		return nil
+	// Generate each language concurrently.
+	errs := make([]error, len(h.langs))
+	wg := sync.WaitGroup{}
+	for i, lang := range h.langs {
+		wg.Add(1)
+		go func(i int, lang string) {
+			defer wg.Done()
+			if !h.startJob(sem) {
+				errs[i] = errSkipped
+				return
+			}
+			defer sem.Release()
+			o := &jobs.Output{}
+			errs[i] = h.genLang(p, lang, o)
+			o.Flush()
+		}(i, lang)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil && err != errSkipped {
+			return err
+		}
 	}
-	if !h.skipgendeps {
-		if err := h.genDirDependencies(qualFilenames); err != nil {
+	for _, err := range errs {
+		if err != nil {
 			return err
 		}
 	}
 
-	for _, lang := range h.langs {
-		command := "wuffs-" + lang
-		cmdArgs := []string{"gen", "-package_name", packageName}
-		if lang == "c" {
-			cmdArgs = append(cmdArgs, fmt.Sprintf("-cformatter=%s", h.cformatter))
+	if len(h.langs) > 0 && path.Base(p.dirname) != "base" {
+		if !h.startJob(sem) {
+			return errSkipped
+		}
+		defer sem.Release()
+		o := &jobs.Output{}
+		defer o.Flush()
+		if err := h.genWuffs(p.root, p.dirname, p.qualFilenames, o); err != nil {
+			return err
 		}
-		cmdArgs = append(cmdArgs, qualFilenames...)
+	}
+	return nil
+}
+
+// genLang generates a package's code in one language, writing what it does,
+// and the code generator's error messages, to o.
+func (h *genHelper) genLang(p *genPackage, lang string, o *jobs.Output) error {
+	command := "wuffs-" + lang
+	cmdArgs := []string{"gen", "-package_name", path.Base(p.dirname)}
+	if lang == "c" {
+		cmdArgs = append(cmdArgs, fmt.Sprintf("-cformatter=%s", h.cformatter))
+	}
+	if h.json {
+		cmdArgs = append(cmdArgs, "-json")
+	}
+
+	suffix := lang
+	if suffix == "c" {
+		suffix = "h"
+	}
+
+	key := h.cacheKey(command, cmdArgs, p.root, p.qualFilenames, p.usePaths)
+	out, err := h.readCache(&o.Stdout, p.root, p.dirname, lang, suffix, key)
+	if err != nil {
+		return err
+	}
+	if out == nil {
+		cmdArgs = append(cmdArgs, p.qualFilenames...)
 		stdout := &bytes.Buffer{}
 
 		cmd := exec.Command(command, cmdArgs...)
 		cmd.Stdin = nil
 		cmd.Stdout = stdout
-		cmd.Stderr = os.Stderr
+		cmd.Stderr = &o.Stderr
 		if err := cmd.Run(); err == nil {
 			// No-op.
 		} else if _, ok := err.(*exec.ExitError); ok {
@@ -197,59 +343,50 @@ func (h *genHelper) genDir(dirname string, qualFilenames []string) error {
 		} else {
 			return err
 		}
-		out := stdout.Bytes()
-
-		suffix := lang
-		if suffix == "c" {
-			suffix = "h"
-		}
+		out = stdout.Bytes()
 
-		if err := h.genFile(dirname, lang, suffix, out); err != nil {
+		if err := h.writeCache(key, out); err != nil {
 			return err
 		}
 	}
-	if len(h.langs) > 0 && packageName != "base" {
-		if err := h.genWuffs(dirname, qualFilenames); err != nil {
-			return err
-		}
-	}
-	return nil
+
+	return h.genFile(&o.Stdout, p.root, p.dirname, lang, suffix, out)
 }
 
-func (h *genHelper) genDirDependencies(qualifiedFilenames []string) error {
-	files, err := generate.ParseFiles(&h.tm, qualifiedFilenames, nil)
-	if err != nil {
-		return err
-	}
-	for _, f := range files {
-		for _, n := range f.TopLevelDecls() {
-			if n.Kind() != a.KUse {
-				continue
-			}
-			useDirname := h.tm.ByID(n.AsUse().Path())
-			useDirname, _ = t.Unescape(useDirname)
-			if err := h.gen(useDirname, false); err != nil {
-				return err
-			}
-		}
-	}
-	return h.gen("base", false)
+// genFilename returns the name of the file, under the gen directory of the
+// package's Wuffs root, that holds the package's generated code.
+func genFilename(root string, dirname string, lang string, suffix string) string {
+	return filepath.Join(root, "gen", lang, filepath.FromSlash(dirname)+"."+suffix)
 }
 
-func (h *genHelper) genFile(dirname string, lang string, suffix string, out []byte) error {
-	return writeFile(
-		filepath.Join(h.wuffsRoot, "gen", lang, filepath.FromSlash(dirname)+"."+suffix),
-		out,
-	)
+func (h *genHelper) genFile(w io.Writer, root string, dirname string, lang string, suffix string, out []byte) error {
+	return writeFile(w, genFilename(root, dirname, lang, suffix), out)
 }
 
-func (h *genHelper) genWuffs(dirname string, qualifiedFilenames []string) error {
-	files, err := generate.ParseFiles(&h.tm, qualifiedFilenames, &parse.Options{
-		AllowDoubleUnderscoreNames: true,
-	})
+func (h *genHelper) genWuffs(root string, dirname string, qualifiedFilenames []string, o *jobs.Output) error {
+	// Check the package, loading its dependencies from source, so that pub
+	// consts' values, such as "1 << 4", are known and can be written out as
+	// plain numbers.
+	tm := &t.Map{}
+	c := checkHelper{
+		wuffsRoot: h.wuffsRoot,
+		tm:        tm,
+		files:     map[string][]*a.File{},
+	}
+	if err := c.load(dirname, qualifiedFilenames); err != nil {
+		return err
+	}
+	out, err := wuffsInterface(tm, c.files[dirname])
 	if err != nil {
 		return err
 	}
+	return h.genFile(&o.Stdout, root, dirname, "wuffs", "wuffs", out)
+}
+
+// wuffsInterface returns the public interface of a Wuffs package, as Wuffs
+// source code, such as the files under gen/wuffs that `use` declarations
+// resolve to.
+func wuffsInterface(tm *t.Map, files []*a.File) ([]byte, error) {
 	pkgIDNode := (*a.PackageID)(nil)
 	for _, f := range files {
 		for _, n := range f.TopLevelDecls() {
@@ -259,17 +396,44 @@ func (h *genHelper) genWuffs(dirname string, qualifiedFilenames []string) error
 		}
 	}
 	if pkgIDNode == nil {
-		return fmt.Errorf("missing packageid declaration")
+		return nil, fmt.Errorf("missing packageid declaration")
 	}
-	pkgIDStr, ok := t.Unescape(pkgIDNode.ID().Str(&h.tm))
+	pkgIDStr, ok := t.Unescape(pkgIDNode.ID().Str(tm))
 	if !ok {
-		return fmt.Errorf("invalid packageid declaration")
+		return nil, fmt.Errorf("invalid packageid declaration")
 	}
 
 	out := &bytes.Buffer{}
 	fmt.Fprintf(out, "// Code generated by running \"wuffs gen\". DO NOT EDIT.\n\n")
 	fmt.Fprintf(out, "packageid %q\n\n", pkgIDStr)
 
+	// Repeat the package's own `use` declarations, so that types from other
+	// packages, such as "deflate.decoder", resolve in the interface too.
+	usePaths := map[string]bool{}
+	for _, f := range files {
+		for _, n := range f.TopLevelDecls() {
+			if n.Kind() != a.KUse {
+				continue
+			}
+			usePath, ok := t.Unescape(n.AsUse().Path().Str(tm))
+			if !ok {
+				return nil, fmt.Errorf("bad use path %q", n.AsUse().Path().Str(tm))
+			}
+			usePaths[usePath] = true
+		}
+	}
+	if len(usePaths) > 0 {
+		sorted := make([]string, 0, len(usePaths))
+		for usePath := range usePaths {
+			sorted = append(sorted, usePath)
+		}
+		sort.Strings(sorted)
+		for _, usePath := range sorted {
+			fmt.Fprintf(out, "use %q\n", usePath)
+		}
+		fmt.Fprintf(out, "\n")
+	}
+
 	for _, f := range files {
 		for _, n := range f.TopLevelDecls() {
 			switch n.Kind() {
@@ -278,24 +442,19 @@ func (h *genHelper) genWuffs(dirname string, qualifiedFilenames []string) error
 				if !n.Public() {
 					continue
 				}
-				return fmt.Errorf("TODO: genWuffs for consts")
+				fmt.Fprintf(out, "pub const %s %s = %s\n",
+					n.QID().Str(tm), n.XType().Str(tm), constValueStr(tm, n.Value()))
 
 			case a.KFunc:
 				n := n.AsFunc()
 				if !n.Public() {
 					continue
 				}
-				effect := ""
-				if n.Suspendible() {
-					effect = "?"
-				} else if n.Impure() {
-					effect = "!"
-				}
-				if n.Receiver().IsZero() {
-					return fmt.Errorf("TODO: genWuffs for a free-standing function")
+				fmt.Fprintf(out, "pub func ")
+				if r := n.Receiver(); !r.IsZero() {
+					fmt.Fprintf(out, "%s.", r.Str(tm))
 				}
-				// TODO: look at n.Asserts().
-				fmt.Fprintf(out, "pub func %s.%s%s(", n.Receiver().Str(&h.tm), n.FuncName().Str(&h.tm), effect)
+				fmt.Fprintf(out, "%s%s(", n.FuncName().Str(tm), n.Effect())
 				for i, param := range [2]*a.Struct{n.In(), n.Out()} {
 					if i > 0 {
 						fmt.Fprintf(out, ")(")
@@ -305,12 +464,20 @@ func (h *genHelper) genWuffs(dirname string, qualifiedFilenames []string) error
 						if j > 0 {
 							fmt.Fprintf(out, ", ")
 						}
-						// TODO: what happens if the XType is from another
-						// package?
-						fmt.Fprintf(out, "%s %s", field.Name().Str(&h.tm), field.XType().Str(&h.tm))
+						fmt.Fprintf(out, "%s %s", field.Name().Str(tm), field.XType().Str(tm))
+					}
+				}
+				fmt.Fprintf(out, ")")
+				for _, o := range n.Asserts() {
+					// Struct fields are private to their package, and left out
+					// of the interface below, so a dependent package could
+					// neither prove nor use an assert about this's fields.
+					if mentionsThis(o) {
+						continue
 					}
+					fmt.Fprintf(out, ", %s", assertStr(tm, o.AsAssert()))
 				}
-				fmt.Fprintf(out, ") { }\n")
+				fmt.Fprintf(out, " { }\n")
 
 			case a.KStatus:
 				n := n.AsStatus()
@@ -318,7 +485,7 @@ func (h *genHelper) genWuffs(dirname string, qualifiedFilenames []string) error
 					continue
 				}
 				fmt.Fprintf(out, "pub %s (%s) %s\n",
-					n.Keyword().Str(&h.tm), n.Value().Str(&h.tm), n.QID().Str(&h.tm))
+					n.Keyword().Str(tm), n.Value().Str(tm), n.QID().Str(tm))
 
 			case a.KStruct:
 				n := n.AsStruct()
@@ -329,25 +496,73 @@ func (h *genHelper) genWuffs(dirname string, qualifiedFilenames []string) error
 				if n.Suspendible() {
 					effect = "?"
 				}
-				fmt.Fprintf(out, "pub struct %s%s()\n", n.QID().Str(&h.tm), effect)
+				fmt.Fprintf(out, "pub struct %s%s()\n", n.QID().Str(tm), effect)
 			}
 		}
 	}
-	return h.genFile(dirname, "wuffs", "wuffs", out.Bytes())
+	return out.Bytes(), nil
 }
 
+// constValueStr returns n as Wuffs source code, replacing it by its value if
+// that is known. A list is replaced element-wise.
+func constValueStr(tm *t.Map, n *a.Expr) string {
+	if cv := n.ConstValue(); cv != nil {
+		return cv.String()
+	}
+	if n.Operator() == t.IDDollar {
+		args := []string(nil)
+		for _, o := range n.Args() {
+			args = append(args, constValueStr(tm, o.AsExpr()))
+		}
+		return "$(" + strings.Join(args, ", ") + ")"
+	}
+	return n.Str(tm)
+}
+
+// mentionsThis returns whether n refers to the receiver, "this".
+func mentionsThis(n *a.Node) bool {
+	found := false
+	n.Walk(func(o *a.Node) error {
+		if o.Kind() == a.KExpr && o.AsExpr().Operator() == 0 && o.AsExpr().Ident() == t.IDThis {
+			found = true
+		}
+		return nil
+	})
+	return found
+}
+
+// assertStr returns n as Wuffs source code, such as "pre x > 0" or "post y
+// via "a<b: b>a"(a: x, b: y)".
+func assertStr(tm *t.Map, n *a.Assert) string {
+	s := n.Keyword().Str(tm) + " " + n.Condition().Str(tm)
+	if r := n.Reason(); r != 0 {
+		args := []string(nil)
+		for _, o := range n.Args() {
+			o := o.AsArg()
+			args = append(args, o.Name().Str(tm)+":"+o.Value().Str(tm))
+		}
+		s += " via " + r.Str(tm) + "(" + strings.Join(args, ", ") + ")"
+	}
+	return s
+}
+
+// genlibAffected builds libraries from the affected packages' generated code.
+// Each Wuffs root's packages are built from, and into, that root's gen
+// directory.
 func (h *genHelper) genlibAffected() error {
 	for _, lang := range h.langs {
-		command := "wuffs-" + lang
-		args := []string{"genlib"}
-		args = append(args, "-dstdir", filepath.Join(h.wuffsRoot, "gen", "lib", lang))
-		args = append(args, "-srcdir", filepath.Join(h.wuffsRoot, "gen", lang))
-		args = append(args, h.affected...)
-		cmd := exec.Command(command, args...)
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		if err := cmd.Run(); err != nil {
-			return err
+		for _, root := range h.affectedRoots {
+			command := "wuffs-" + lang
+			args := []string{"genlib"}
+			args = append(args, "-dstdir", filepath.Join(root, "gen", "lib", lang))
+			args = append(args, "-srcdir", filepath.Join(root, "gen", lang))
+			args = append(args, h.affected[root]...)
+			cmd := exec.Command(command, args...)
+			cmd.Stdout = os.Stdout
+			cmd.Stderr = os.Stderr
+			if err := cmd.Run(); err != nil {
+				return err
+			}
 		}
 	}
 	return nil
@@ -0,0 +1,234 @@
+// Copyright 2018 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/wuffs/lang/check"
+	"github.com/google/wuffs/lang/parse"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// interfaceTester checks in-memory packages, resolving `use` declarations to
+// the interfaces of previously checked packages.
+type interfaceTester struct {
+	tm         t.Map
+	interfaces map[string][]byte
+}
+
+func (z *interfaceTester) resolveUse(usePath string) ([]byte, error) {
+	if src, ok := z.interfaces[usePath]; ok {
+		return src, nil
+	}
+	return nil, fmt.Errorf("cannot resolve `use %q`", usePath)
+}
+
+// check parses and checks a single file package.
+func (z *interfaceTester) check(filename string, src []byte) ([]*a.File, error) {
+	tokens, _, err := t.Tokenize(&z.tm, filename, src)
+	if err != nil {
+		return nil, err
+	}
+	f, err := parse.Parse(&z.tm, filename, tokens, &parse.Options{
+		AllowDoubleUnderscoreNames: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	files := []*a.File{f}
+	if _, err := check.Check(&z.tm, files, z.resolveUse, nil); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// add checks a package and records its interface, which must itself check.
+func (z *interfaceTester) add(usePath string, src string) (string, error) {
+	files, err := z.check(usePath+".wuffs", []byte(src))
+	if err != nil {
+		return "", err
+	}
+	out, err := wuffsInterface(&z.tm, files)
+	if err != nil {
+		return "", err
+	}
+	if _, err := z.check("gen/wuffs/"+usePath+".wuffs", out); err != nil {
+		return "", fmt.Errorf("checking the interface: %v\n%s", err, out)
+	}
+	z.interfaces[usePath+".wuffs"] = out
+	return string(out), nil
+}
+
+const genTestShapesSrc = `packageid "shap"
+
+pub error (0x01) "bad shape"
+
+pri const sides base.u32 = 4
+
+pub const num_sides base.u32 = 0x08
+pub const primes array[3] base.u8 = $(2, 3, 0x05)
+
+pub struct square?(
+	side base.u32,
+)
+
+pub func square.area(x base.u32[..100])(ret base.u32[..10000]),
+	pre in.x > 0,
+{
+	return in.x * in.x
+}
+
+pub func square.grow!(x base.u32[..100])(),
+	pre in.x > 0,
+	pre this.side < 50,
+{
+	this.side = in.x
+}
+
+pub func perimeter(x base.u32[..100])(ret base.u32[..400]) {
+	return in.x * 4
+}
+
+pri func helper()() {
+}
+`
+
+const genTestShapesWant = `// Code generated by running "wuffs gen". DO NOT EDIT.
+
+packageid "shap"
+
+pub error (0x01) "bad shape"
+pub const num_sides base.u32 = 8
+pub const primes array[3] base.u8 = $(2, 3, 5)
+pub struct square?()
+pub func square.area(x base.u32[..100])(ret base.u32[..10000]), pre in.x > 0 { }
+pub func square.grow!(x base.u32[..100])(), pre in.x > 0 { }
+pub func perimeter(x base.u32[..100])(ret base.u32[..400]) { }
+`
+
+const genTestBoxesSrc = `packageid "boxs"
+
+use "test/shapes"
+
+pub struct box?(
+	s shapes.square,
+)
+
+pub func box.fill!(s ptr shapes.square)() {
+}
+
+pub func box.size()(ret base.u32[..10]) {
+	return 3
+}
+`
+
+const genTestBoxesWant = `// Code generated by running "wuffs gen". DO NOT EDIT.
+
+packageid "boxs"
+
+use "test/shapes"
+
+pub struct box?()
+pub func box.fill!(s ptr shapes.square)() { }
+pub func box.size()(ret base.u32[..10]) { }
+`
+
+const genTestUserSrc = `packageid "user"
+
+use "test/boxes"
+use "test/shapes"
+
+pri struct thing?(
+	b boxes.box,
+	s shapes.square,
+)
+
+pri func thing.run!()(ret base.u32) {
+	this.s.grow!(x:1)
+	return this.s.area(x:this.b.size())
+}
+`
+
+func TestWuffsInterface(tt *testing.T) {
+	z := &interfaceTester{interfaces: map[string][]byte{}}
+	testCases := []struct {
+		usePath string
+		src     string
+		want    string
+	}{
+		{"test/shapes", genTestShapesSrc, genTestShapesWant},
+		{"test/boxes", genTestBoxesSrc, genTestBoxesWant},
+	}
+	for _, tc := range testCases {
+		got, err := z.add(tc.usePath, tc.src)
+		if err != nil {
+			tt.Fatalf("%s: %v", tc.usePath, err)
+		}
+		if got != tc.want {
+			tt.Fatalf("%s:\ngot:\n%s\nwant:\n%s", tc.usePath, got, tc.want)
+		}
+	}
+
+	if _, err := z.check("user.wuffs", []byte(genTestUserSrc)); err != nil {
+		tt.Fatalf("user: %v", err)
+	}
+}
+
+func TestGenlibAffected(tt *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "wuffsgenlib")
+	if err != nil {
+		tt.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// A fake code generator, for the "log" lang, that logs its arguments.
+	logFilename := filepath.Join(tmpDir, "log.txt")
+	generatorSrc := "#!/bin/sh\necho \"$@\" >> " + logFilename + "\n"
+	if err := ioutil.WriteFile(filepath.Join(tmpDir, "wuffs-log"), []byte(generatorSrc), 0755); err != nil {
+		tt.Fatalf("WriteFile: %v", err)
+	}
+	oldPath := os.Getenv("PATH")
+	defer os.Setenv("PATH", oldPath)
+	os.Setenv("PATH", tmpDir+string(filepath.ListSeparator)+oldPath)
+
+	h := &genHelper{
+		langs: []string{"log"},
+		affected: map[string][]string{
+			"/root1": {"std/a", "std/b"},
+			"/root2": {"ext/c"},
+		},
+		affectedRoots: []string{"/root1", "/root2"},
+	}
+	if err := h.genlibAffected(); err != nil {
+		tt.Fatalf("genlibAffected: %v", err)
+	}
+	got, err := ioutil.ReadFile(logFilename)
+	if err != nil {
+		tt.Fatalf("ReadFile: %v", err)
+	}
+	want := "" +
+		"genlib -dstdir /root1/gen/lib/log -srcdir /root1/gen/log std/a std/b\n" +
+		"genlib -dstdir /root2/gen/lib/log -srcdir /root2/gen/log ext/c\n"
+	if string(got) != want {
+		tt.Fatalf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -19,8 +19,10 @@ import (
 	"bytes"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"sort"
 	"strings"
@@ -33,8 +35,12 @@ var commands = []struct {
 	do   func(wuffsRoot string, args []string) error
 }{
 	{"bench", doBench},
+	{"check", doCheck},
+	{"deps", doDeps},
+	{"doc", doDoc},
 	{"gen", doGen},
 	{"genlib", doGenlib},
+	{"run", doRun},
 	{"test", doTest},
 }
 
@@ -48,8 +54,12 @@ Usage:
 The commands are:
 
 	bench   benchmark packages
+	check   check packages
+	deps    print the package dependency graph
+	doc     print packages' public API documentation
 	gen     generate code for packages and dependencies
 	genlib  generate software libraries
+	run     run a package's function in the interpreter
 	test    test packages
 `)
 }
@@ -114,6 +124,19 @@ func listDir(qualDirname string, suffix string, returnSubdirs bool) (qualFilenam
 	return qualFilenames, relDirnames, nil
 }
 
+// listPackageDir is like listDir, for the directory of the package, or of the
+// packages, with the given path, in whichever Wuffs root provides it. It also
+// returns that root.
+func listPackageDir(dirname string, recursive bool) (root string, qualFilenames []string, relDirnames []string, err error) {
+	root, err = generate.PackageRoot(dirname)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	qualFilenames, relDirnames, err = listDir(
+		filepath.Join(root, filepath.FromSlash(dirname)), ".wuffs", recursive)
+	return root, qualFilenames, relDirnames, err
+}
+
 func appendDir(dstQF []string, qualDirname string, suffix string, returnSubdirs bool) (qualFilenames []string, relDirnames []string, err error) {
 	f, err := os.Open(qualDirname)
 	if err != nil {
@@ -139,9 +162,11 @@ func appendDir(dstQF []string, qualDirname string, suffix string, returnSubdirs
 	return dstQF, relDirnames, nil
 }
 
-func writeFile(filename string, contents []byte) error {
+// writeFile writes contents to filename, unless it already holds them,
+// reporting to w what it did.
+func writeFile(w io.Writer, filename string, contents []byte) error {
 	if existing, err := ioutil.ReadFile(filename); err == nil && bytes.Equal(existing, contents) {
-		fmt.Println("gen unchanged: ", filename)
+		fmt.Fprintln(w, "gen unchanged: ", filename)
 		return nil
 	}
 	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
@@ -150,27 +175,39 @@ func writeFile(filename string, contents []byte) error {
 	if err := ioutil.WriteFile(filename, contents, 0644); err != nil {
 		return err
 	}
-	fmt.Println("gen wrote:     ", filename)
+	fmt.Fprintln(w, "gen wrote:     ", filename)
 	return nil
 }
 
 const (
+	cleancacheDefault = false
+	cleancacheUsage   = `whether to empty the build cache, which otherwise keeps every version of the generated code, before generating`
+
 	langsDefault = "c"
-	langsUsage   = `comma-separated list of target languages (file extensions), e.g. "c,go,rs"`
+	langsUsage   = `comma-separated list of target languages (file extensions), e.g. "c"; each needs a "wuffs-lang" code generator, such as wuffs-c, on the PATH`
 
 	skipgenDefault = false
 	skipgenUsage   = `whether to skip automatically generating code when testing`
 
 	skipgendepsDefault = false
 	skipgendepsUsage   = `whether to skip automatically generating packages' dependencies`
+
+	vDefault = false
+	vUsage   = `whether to report which generated files were found in the build cache`
 )
 
+// parseLangs parses the -langs flag. Each lang is generated, tested and
+// released by its "wuffs-lang" command, and it is an error for that command to
+// be missing. The Wuffs repository only provides wuffs-c.
 func parseLangs(commaSeparated string) ([]string, error) {
 	ret := []string(nil)
 	for _, s := range strings.Split(commaSeparated, ",") {
 		if !validName(s) {
 			return nil, fmt.Errorf(`invalid lang %q, not in [a-z0-9]+`, s)
 		}
+		if _, err := exec.LookPath("wuffs-" + s); err != nil {
+			return nil, fmt.Errorf(`unsupported lang %q: no "wuffs-%s" code generator on the PATH`, s, s)
+		}
 		ret = append(ret, s)
 	}
 	return ret, nil
@@ -0,0 +1,53 @@
+// Copyright 2018 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseLangs(tt *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "wuffslangs")
+	if err != nil {
+		tt.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	if err := ioutil.WriteFile(filepath.Join(tmpDir, "wuffs-c"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		tt.Fatalf("WriteFile: %v", err)
+	}
+	oldPath := os.Getenv("PATH")
+	defer os.Setenv("PATH", oldPath)
+	os.Setenv("PATH", tmpDir)
+
+	testCases := []struct {
+		commaSeparated string
+		wantOK         bool
+	}{
+		{"c", true},
+		{"go", false},
+		{"c,go", false},
+		{"C", false},
+		{"", false},
+	}
+	for _, tc := range testCases {
+		_, err := parseLangs(tc.commaSeparated)
+		if gotOK := err == nil; gotOK != tc.wantOK {
+			tt.Errorf("%q: got err %v, want ok=%t", tc.commaSeparated, err, tc.wantOK)
+		}
+	}
+}
@@ -21,6 +21,9 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
+
+	"github.com/google/wuffs/lang/generate"
 
 	cf "github.com/google/wuffs/cmd/commonflags"
 )
@@ -37,7 +40,7 @@ func genrelease(wuffsRoot string, langs []string, v cf.Version) error {
 		if err != nil {
 			return err
 		}
-		if err := writeFile(filename, contents); err != nil {
+		if err := writeFile(os.Stdout, filename, contents); err != nil {
 			return err
 		}
 	}
@@ -45,7 +48,7 @@ func genrelease(wuffsRoot string, langs []string, v cf.Version) error {
 }
 
 func genreleaseLang(wuffsRoot string, revision string, v cf.Version, lang string, suffix string) (filename string, contents []byte, err error) {
-	qualFilenames, err := findFiles(filepath.Join(wuffsRoot, "gen", lang), "."+suffix)
+	qualFilenames, err := genreleaseFiles(lang, suffix)
 	if err != nil {
 		return "", nil, err
 	}
@@ -78,6 +81,42 @@ func genreleaseLang(wuffsRoot string, revision string, v cf.Version, lang string
 	return filepath.Join(wuffsRoot, "release", lang, base+"."+ext), stdout.Bytes(), nil
 }
 
+// genreleaseFiles returns the generated code of every package in every Wuffs
+// root, with the first root's (base and std) packages first. Files under a
+// root's gen directory whose package is provided by another root are stale
+// and are skipped.
+func genreleaseFiles(lang string, suffix string) ([]string, error) {
+	roots, err := generate.WuffsPath()
+	if err != nil {
+		return nil, err
+	}
+	ret := []string(nil)
+	for _, root := range roots {
+		genDir := filepath.Join(root, "gen", lang)
+		qualFilenames, err := findFiles(genDir, "."+suffix)
+		if err != nil {
+			if os.IsNotExist(err) && root != roots[0] {
+				continue
+			}
+			return nil, err
+		}
+		for _, filename := range qualFilenames {
+			rel, err := filepath.Rel(genDir, filename)
+			if err != nil {
+				return nil, err
+			}
+			pkgRoot, err := generate.PackageRoot(filepath.ToSlash(strings.TrimSuffix(rel, "."+suffix)))
+			if err != nil {
+				return nil, err
+			}
+			if pkgRoot == root {
+				ret = append(ret, filename)
+			}
+		}
+	}
+	return ret, nil
+}
+
 func findRevision(wuffsRoot string) string {
 	// Assume that we're using git.
 
@@ -0,0 +1,202 @@
+// Copyright 2018 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/google/wuffs/lang/check"
+	"github.com/google/wuffs/lang/generate"
+	"github.com/google/wuffs/lang/interp"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+const (
+	bufsizeDefault = 65536
+	bufsizeUsage   = `the size, in bytes, of the io_writer's buffer`
+
+	funcUsage = `the method to call, e.g. "decoder.decode"`
+	pkgUsage  = `the package to run, e.g. "std/gzip"`
+)
+
+func doRun(wuffsRoot string, args []string) error {
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	bufsizeFlag := flags.Int("bufsize", bufsizeDefault, bufsizeUsage)
+	funcFlag := flags.String("func", "", funcUsage)
+	pkgFlag := flags.String("pkg", "", pkgUsage)
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *bufsizeFlag <= 0 {
+		return fmt.Errorf("bad -bufsize flag value %d", *bufsizeFlag)
+	}
+	if *pkgFlag == "" {
+		return fmt.Errorf("missing -pkg flag")
+	}
+	recvName, methodName := "", ""
+	if i := strings.IndexByte(*funcFlag, '.'); i >= 0 {
+		recvName, methodName = (*funcFlag)[:i], (*funcFlag)[i+1:]
+	}
+	if recvName == "" || methodName == "" {
+		return fmt.Errorf(`bad -func flag value %q, want "receiver.method"`, *funcFlag)
+	}
+
+	tm := &t.Map{}
+	h := runHelper{
+		tm:    tm,
+		m:     interp.NewMachine(tm),
+		files: map[string][]*a.File{},
+	}
+	pkgName := strings.TrimSuffix(*pkgFlag, "/")
+	if err := h.load(pkgName); err != nil {
+		return err
+	}
+	o, err := h.m.NewObject(path.Base(pkgName), recvName)
+	if err != nil {
+		return err
+	}
+	// Abandon any method call that is still suspended when we are done.
+	defer h.m.Reset(o)
+	f, err := h.m.Func(o, methodName)
+	if err != nil {
+		return err
+	}
+
+	in, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		return err
+	}
+	src := &interp.IOBuffer{Data: in, WI: len(in), Closed: true}
+	dst := &interp.IOBuffer{Data: make([]byte, *bufsizeFlag)}
+
+	for {
+		// The io_reader and io_writer arguments are re-made for each call, so
+		// that their marks are at the buffers' current positions.
+		callArgs := []interp.Value(nil)
+		for _, field := range f.In().Fields() {
+			field := field.AsField()
+			switch typ := field.XType(); {
+			case typ.Decorator() == 0 && typ.QID() == t.QID{t.IDBase, t.IDIOReader}:
+				callArgs = append(callArgs, interp.NewReader(src))
+			case typ.Decorator() == 0 && typ.QID() == t.QID{t.IDBase, t.IDIOWriter}:
+				callArgs = append(callArgs, interp.NewWriter(dst))
+			case typ.IsSliceType() && typ.Inner().QID() == t.QID{t.IDBase, t.IDU8}:
+				callArgs = append(callArgs, src.Data[src.RI:src.WI])
+			default:
+				return fmt.Errorf("wuffs run: cannot pass an argument of type %q", typ.Str(tm))
+			}
+		}
+
+		ret, err := h.m.Call(o, methodName, callArgs...)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stdout.Write(dst.Data[dst.RI:dst.WI]); err != nil {
+			return err
+		}
+		dst.RI = dst.WI
+		dst.Compact()
+
+		switch ret := ret.(type) {
+		case interp.Status:
+			if ret.IsSuspension() && ret.Package == "" && ret.Message == "short write" {
+				continue
+			}
+			if !ret.IsOK() {
+				return fmt.Errorf("wuffs run: %v", ret)
+			}
+		case struct{}:
+			// No-op.
+		default:
+			fmt.Println(ret)
+		}
+		return nil
+	}
+}
+
+type runHelper struct {
+	tm *t.Map
+	m  *interp.Machine
+
+	// files holds the parsed and checked files of each loaded package, keyed
+	// by the package's directory name, e.g. "std/deflate". A nil value means
+	// that the package is still loading.
+	files map[string][]*a.File
+}
+
+// load parses and checks a package and its dependencies, and adds them to the
+// interpreter.
+func (h *runHelper) load(dirname string) error {
+	if files, ok := h.files[dirname]; ok {
+		if files == nil {
+			return fmt.Errorf("wuffs run: cyclical use of package %q", dirname)
+		}
+		return nil
+	}
+	h.files[dirname] = nil
+
+	_, qualFilenames, _, err := listPackageDir(dirname, false)
+	if err != nil {
+		return err
+	}
+	if len(qualFilenames) == 0 {
+		return fmt.Errorf("wuffs run: no .wuffs files in %q", dirname)
+	}
+	files, err := generate.ParseFiles(h.tm, qualFilenames, nil)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		for _, n := range f.TopLevelDecls() {
+			if n.Kind() != a.KUse {
+				continue
+			}
+			usePath, ok := t.Unescape(n.AsUse().Path().Str(h.tm))
+			if !ok {
+				return fmt.Errorf("wuffs run: bad use path %q", n.AsUse().Path().Str(h.tm))
+			}
+			if err := h.load(usePath); err != nil {
+				return err
+			}
+		}
+	}
+
+	if _, err := check.Check(h.tm, files, h.resolveUse, nil); err != nil {
+		return err
+	}
+	if err := h.m.AddPackage(dirname, files); err != nil {
+		return err
+	}
+	h.files[dirname] = files
+	return nil
+}
+
+// resolveUse returns the public interface of a loaded package, instead of
+// reading the gen/wuffs files written by "wuffs gen".
+func (h *runHelper) resolveUse(usePath string) ([]byte, error) {
+	files := h.files[strings.TrimSuffix(usePath, ".wuffs")]
+	if files == nil {
+		return nil, fmt.Errorf("wuffs run: cannot resolve `use %q`", usePath)
+	}
+	return wuffsInterface(h.tm, files)
+}
@@ -17,11 +17,13 @@ package main
 import (
 	"flag"
 	"fmt"
-	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
 
+	"github.com/google/wuffs/cmd/internal/jobs"
+	"github.com/google/wuffs/lang/diagnostic"
+
 	cf "github.com/google/wuffs/cmd/commonflags"
 )
 
@@ -34,6 +36,8 @@ func doBenchTest(wuffsRoot string, args []string, bench bool) error {
 	cformatterFlag := flags.String("cformatter", cf.CformatterDefault, cf.CformatterUsage)
 	focusFlag := flags.String("focus", cf.FocusDefault, cf.FocusUsage)
 	iterscaleFlag := flags.Int("iterscale", cf.IterscaleDefault, cf.IterscaleUsage)
+	jFlag := flags.Int("j", jDefault(bench), cf.JUsage)
+	jsonFlag := flags.Bool("json", cf.JSONDefault, cf.JSONUsage)
 	langsFlag := flags.String("langs", langsDefault, langsUsage)
 	mimicFlag := flags.Bool("mimic", cf.MimicDefault, cf.MimicUsage)
 	repsFlag := flags.Int("reps", cf.RepsDefault, cf.RepsUsage)
@@ -61,10 +65,15 @@ func doBenchTest(wuffsRoot string, args []string, bench bool) error {
 		return fmt.Errorf("bad -iterscale flag value %d, outside the range [%d..%d]",
 			*iterscaleFlag, cf.IterscaleMin, cf.IterscaleMax)
 	}
+	if *jFlag < cf.JMin || cf.JMax < *jFlag {
+		return fmt.Errorf("bad -j flag value %d, outside the range [%d..%d]",
+			*jFlag, cf.JMin, cf.JMax)
+	}
 	if *repsFlag < cf.RepsMin || cf.RepsMax < *repsFlag {
 		return fmt.Errorf("bad -reps flag value %d, outside the range [%d..%d]",
 			*repsFlag, cf.RepsMin, cf.RepsMax)
 	}
+	numJobs := cf.NumJobs(*jFlag)
 
 	args = flags.Args()
 	if len(args) == 0 {
@@ -92,6 +101,7 @@ func doBenchTest(wuffsRoot string, args []string, bench bool) error {
 		langs:      langs,
 		cmdArgs:    cmdArgs,
 		ccompilers: *ccompilersFlag,
+		jobs:       numJobs,
 	}
 
 	// Ensure that we are testing the latest version of the generated code.
@@ -100,28 +110,22 @@ func doBenchTest(wuffsRoot string, args []string, bench bool) error {
 			wuffsRoot:   wuffsRoot,
 			langs:       langs,
 			cformatter:  *cformatterFlag,
+			json:        *jsonFlag,
+			jobs:        numJobs,
 			skipgen:     *skipgenFlag,
 			skipgendeps: *skipgendepsFlag,
 		}
-		for _, arg := range args {
-			recursive := strings.HasSuffix(arg, "/...")
-			if recursive {
-				arg = arg[:len(arg)-4]
-			}
-			if arg == "" {
-				continue
-			}
-
-			if err := gh.gen(arg, recursive); err != nil {
-				return err
+		if err := gh.genArgs(args); err != nil {
+			if *jsonFlag {
+				return diagnostic.JSON("gen", err)
 			}
+			return err
 		}
 		if err := genrelease(wuffsRoot, langs, cf.Version{}); err != nil {
 			return err
 		}
 	}
 
-	failed := false
 	for _, arg := range args {
 		recursive := strings.HasSuffix(arg, "/...")
 		if recursive {
@@ -131,78 +135,117 @@ func doBenchTest(wuffsRoot string, args []string, bench bool) error {
 			continue
 		}
 
-		// Proceed with benching / testing the generated code.
-		f, err := h.benchTest(arg, recursive)
-		if err != nil {
+		if err := h.add(arg, recursive); err != nil {
 			return err
 		}
-		failed = failed || f
+	}
+
+	// Proceed with benching / testing the generated code.
+	failed, err := h.benchTest()
+	if err != nil {
+		return err
 	}
 	if failed {
 		s0, s1 := "test", "tests"
 		if bench {
 			s0, s1 = "bench", "benchmarks"
 		}
-		return fmt.Errorf("wuffs %s: some %s failed", s0, s1)
+		err := fmt.Errorf("wuffs %s: some %s failed", s0, s1)
+		if *jsonFlag {
+			return diagnostic.JSON(s0, err)
+		}
+		return err
 	}
 	return nil
 }
 
+// jDefault returns the default -j flag value. Benchmarks run one at a time by
+// default, so that they do not compete with each other for the CPU.
+func jDefault(bench bool) int {
+	if bench {
+		return cf.JBenchDefault
+	}
+	return cf.JDefault
+}
+
 type testHelper struct {
 	wuffsRoot  string
 	langs      []string
 	cmdArgs    []string
 	ccompilers string
+	jobs       int
+
+	// dirnames are the packages to bench or test, and roots are the Wuffs
+	// root directories that provide them.
+	dirnames []string
+	roots    []string
 }
 
-func (h *testHelper) benchTest(dirname string, recursive bool) (failed bool, err error) {
-	qualFilenames, dirnames, err := listDir(
-		filepath.Join(h.wuffsRoot, filepath.FromSlash(dirname)), ".wuffs", recursive)
+// add adds the package in dirname, and if recursive, its sub-directories'
+// packages, to the packages to bench or test.
+func (h *testHelper) add(dirname string, recursive bool) error {
+	root, qualFilenames, dirnames, err := listPackageDir(dirname, recursive)
 	if err != nil {
-		return false, err
+		return err
 	}
 	if len(qualFilenames) > 0 {
-		f, err := h.benchTestDir(dirname)
-		if err != nil {
-			return false, err
+		if packageName := filepath.Base(dirname); !validName(packageName) {
+			return fmt.Errorf(`invalid package %q, not in [a-z0-9]+`, packageName)
 		}
-		failed = failed || f
+		h.dirnames = append(h.dirnames, dirname)
+		h.roots = append(h.roots, root)
 	}
 	if len(dirnames) > 0 {
 		for _, d := range dirnames {
-			f, err := h.benchTest(filepath.Join(dirname, d), recursive)
-			if err != nil {
-				return false, err
+			if err := h.add(filepath.Join(dirname, d), recursive); err != nil {
+				return err
 			}
-			failed = failed || f
 		}
 	}
-	return failed, nil
+	return nil
 }
 
-func (h *testHelper) benchTestDir(dirname string) (failed bool, err error) {
-	if packageName := filepath.Base(dirname); !validName(packageName) {
-		return false, fmt.Errorf(`invalid package %q, not in [a-z0-9]+`, packageName)
+// benchTest benches or tests every added package in every language. Each of
+// those runs a child process that itself runs concurrent jobs, such as C
+// compilers, so h.jobs is split between the children that run at a time and
+// each child's -j flag.
+func (h *testHelper) benchTest() (failed bool, err error) {
+	n := len(h.langs)
+	fails := make([]bool, len(h.dirnames)*n)
+	errs := make([]error, len(h.dirnames)*n)
+	outer, inner := jobs.Split(len(h.dirnames)*n, h.jobs)
+	jobs.Run(len(h.dirnames)*n, outer, func(i int) {
+		o := &jobs.Output{}
+		fails[i], errs[i] = h.benchTestDir(h.roots[i/n], h.dirnames[i/n], h.langs[i%n], inner, o)
+		o.Flush()
+	})
+	for i := range errs {
+		if errs[i] != nil {
+			return false, errs[i]
+		}
+		failed = failed || fails[i]
 	}
+	return failed, nil
+}
 
-	for _, lang := range h.langs {
-		command := "wuffs-" + lang
-		args := []string(nil)
-		args = append(args, h.cmdArgs...)
-		if lang == "c" {
-			args = append(args, fmt.Sprintf("-ccompilers=%s", h.ccompilers))
-		}
-		args = append(args, filepath.Join(h.wuffsRoot, "test", lang, filepath.FromSlash(dirname)))
-		cmd := exec.Command(command, args...)
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		if err := cmd.Run(); err == nil {
-			// No-op.
-		} else if _, ok := err.(*exec.ExitError); ok {
-			failed = true
-		} else {
-			return false, err
-		}
+func (h *testHelper) benchTestDir(root string, dirname string, lang string, numJobs int, o *jobs.Output) (failed bool, err error) {
+	command := "wuffs-" + lang
+	args := []string(nil)
+	args = append(args, h.cmdArgs...)
+	args = append(args, fmt.Sprintf("-j=%d", numJobs))
+	if lang == "c" {
+		args = append(args, fmt.Sprintf("-ccompilers=%s", h.ccompilers))
+	}
+	args = append(args, filepath.Join(root, "test", lang, filepath.FromSlash(dirname)))
+	cmd := exec.Command(command, args...)
+	cmd.Stdout = &o.Stdout
+	cmd.Stderr = &o.Stderr
+	if err := cmd.Run(); err == nil {
+		// No-op.
+	} else if _, ok := err.(*exec.ExitError); ok {
+		failed = true
+	} else {
+		return false, err
 	}
 	return failed, nil
 }
@@ -15,33 +15,46 @@
 // wuffsfmt formats Wuffs programs.
 //
 // Without explicit paths, it rewrites the standard input to standard output.
-// Otherwise, the -l or -w or both flags must be given. Given a file path, it
-// operates on that file; given a directory path, it operates on all .wuffs
-// files in that directory, recursively. Files starting with a period are
-// ignored.
+// Otherwise, at least one of the -d, -l or -w flags must be given. Given a
+// file path, it operates on that file; given a directory path, it operates on
+// all .wuffs files in that directory, recursively. Files starting with a
+// period are ignored.
+//
+// The -fix flag also repairs source code that is otherwise rejected or
+// non-canonical: it sorts assertion chains into "pre", "inv", "post" order and
+// sorts runs of consecutive `use` lines.
 package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"runtime"
 	"strings"
 
+	"github.com/google/wuffs/lang/diagnostic"
 	"github.com/google/wuffs/lang/parse"
 	"github.com/google/wuffs/lang/render"
 
+	cf "github.com/google/wuffs/cmd/commonflags"
 	t "github.com/google/wuffs/lang/token"
 )
 
 var (
-	lFlag = flag.Bool("l", false, "list files whose formatting differs from wuffsfmt's")
-	wFlag = flag.Bool("w", false, "write result to (source) file instead of stdout")
+	alignFlag = flag.Bool("align", false, "align the types of struct fields and func parameters written one per line")
+	dFlag     = flag.Bool("d", false, "display diffs instead of rewriting files")
+	fixFlag   = flag.Bool("fix", false, "sort assertion chains and use lines instead of rejecting or keeping their order")
+	jsonFlag  = flag.Bool("json", cf.JSONDefault, cf.JSONUsage+"; with -l, also list files as JSON records")
+	lFlag     = flag.Bool("l", false, "list files whose formatting differs from wuffsfmt's")
+	wFlag     = flag.Bool("w", false, "write result to (source) file instead of stdout")
+	widthFlag = flag.Int("width", 0, "if positive, break lines longer than this many columns")
 )
 
 func usage() {
@@ -51,6 +64,9 @@ func usage() {
 
 func main() {
 	if err := main1(); err != nil {
+		if *jsonFlag {
+			err = diagnostic.JSON("format", err)
+		}
 		os.Stderr.WriteString(err.Error() + "\n")
 		os.Exit(1)
 	}
@@ -70,8 +86,8 @@ func main1() error {
 		return do(os.Stdin, "<standard input>")
 	}
 
-	if !*lFlag && !*wFlag {
-		return errors.New("must use -l or -w if paths are given")
+	if !*dFlag && !*lFlag && !*wFlag {
+		return errors.New("must use -d, -l or -w if paths are given")
 	}
 
 	for i := 0; i < flag.NArg(); i++ {
@@ -124,34 +140,149 @@ func do(r io.Reader, filename string) error {
 	if err != nil {
 		return err
 	}
-	// We don't need the AST node to pretty-print, but it's worth rejecting
-	// syntax errors early. This is just a parse, not a full type check.
-	if _, err := parse.Parse(tm, filename, tokens, &parse.Options{
+	// This is just a parse, not a full type check.
+	f, err := parse.Parse(tm, filename, tokens, &parse.Options{
 		AllowDoubleUnderscoreNames: true,
-	}); err != nil {
+		SortAsserts:                *fixFlag,
+	})
+	if err != nil {
 		return err
 	}
 	buf := &bytes.Buffer{}
-	if err := render.Render(buf, tm, tokens, comments); err != nil {
+	if err := render.RenderFile(buf, tm, tokens, comments, f, &render.Options{
+		Width:       *widthFlag,
+		AlignFields: *alignFlag,
+		SortUses:    *fixFlag,
+	}); err != nil {
 		return err
 	}
 	dst := buf.Bytes()
 
 	if r != nil {
-		if _, err := os.Stdout.Write(dst); err != nil {
+		// The standard input is never listed or written to, only printed,
+		// formatted or as a diff.
+		if *lFlag || *wFlag {
+			return errors.New("cannot use -l or -w with standard input")
+		}
+		if !*dFlag {
+			_, err := os.Stdout.Write(dst)
 			return err
 		}
-	} else if !bytes.Equal(dst, src) {
+		if !bytes.Equal(dst, src) {
+			return printDiff(src, dst, filename)
+		}
+		return nil
+	}
+
+	if !bytes.Equal(dst, src) {
 		if *lFlag {
-			fmt.Println(filename)
+			if err := list(filename); err != nil {
+				return err
+			}
 		}
 		if *wFlag {
 			if err := writeFile(filename, dst); err != nil {
 				return err
 			}
 		}
+		if *dFlag {
+			if err := printDiff(src, dst, filename); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// printDiff prints the unified diff of b0 and b1, the before and after
+// contents of filename.
+func printDiff(b0 []byte, b1 []byte, filename string) error {
+	d, err := diff(b0, b1, filename)
+	if err != nil {
+		return fmt.Errorf("computing diff: %v", err)
 	}
+	fmt.Printf("diff -u %s %s\n", filepath.ToSlash(filename+".orig"), filepath.ToSlash(filename))
+	_, err = os.Stdout.Write(d)
+	return err
+}
 
+// diff returns the unified diff, as per the external diff program, of b0 and
+// b1, the before and after contents of filename.
+func diff(b0 []byte, b1 []byte, filename string) ([]byte, error) {
+	f0, err := writeTempFile(b0)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f0)
+	f1, err := writeTempFile(b1)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f1)
+
+	data, err := exec.Command("diff", "-u", f0, f1).CombinedOutput()
+	if len(data) == 0 {
+		return nil, err
+	}
+	// diff exits with a non-zero status when the files differ. Ignore that, as
+	// long as there is output, but replace the temporary file names in the
+	// "---" and "+++" header lines.
+	lines := bytes.SplitN(data, []byte("\n"), 3)
+	if len(lines) < 3 ||
+		!bytes.HasPrefix(lines[0], []byte("--- ")) ||
+		!bytes.HasPrefix(lines[1], []byte("+++ ")) {
+		return data, nil
+	}
+	label := filepath.ToSlash(filename)
+	b := []byte(nil)
+	b = append(b, "--- "+label+".orig"+tabSuffix(lines[0])+"\n"...)
+	b = append(b, "+++ "+label+tabSuffix(lines[1])+"\n"...)
+	b = append(b, lines[2]...)
+	return b, nil
+}
+
+// tabSuffix returns the part of a diff header line from its first tab, which
+// separates the file name from the timestamp, onwards.
+func tabSuffix(line []byte) string {
+	if i := bytes.IndexByte(line, '\t'); i >= 0 {
+		return string(line[i:])
+	}
+	return ""
+}
+
+func writeTempFile(b []byte) (string, error) {
+	f, err := ioutil.TempFile("", "wuffsfmt")
+	if err != nil {
+		return "", err
+	}
+	_, werr := f.Write(b)
+	cerr := f.Close()
+	if werr != nil {
+		os.Remove(f.Name())
+		return "", werr
+	}
+	if cerr != nil {
+		os.Remove(f.Name())
+		return "", cerr
+	}
+	return f.Name(), nil
+}
+
+func list(filename string) error {
+	if !*jsonFlag {
+		fmt.Println(filename)
+		return nil
+	}
+	b, err := json.Marshal(diagnostic.Record{
+		Phase:    "format",
+		Filename: filename,
+		Message:  "formatting differs from wuffsfmt's",
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s\n", b)
 	return nil
 }
 
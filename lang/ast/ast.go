@@ -47,6 +47,7 @@ const (
 	KIf
 	KIterate
 	KJump
+	KLemma
 	KPackageID
 	KRet
 	KStatus
@@ -79,6 +80,7 @@ var kindStrings = [...]string{
 	KIf:        "KIf",
 	KIterate:   "KIterate",
 	KJump:      "KJump",
+	KLemma:     "KLemma",
 	KPackageID: "KPackageID",
 	KRet:       "KRet",
 	KStatus:    "KStatus",
@@ -101,6 +103,7 @@ const (
 	FlagsHasBreak        = Flags(0x00000040)
 	FlagsHasContinue     = Flags(0x00000080)
 	FlagsGlobalIdent     = Flags(0x00000100)
+	FlagsHasElse         = Flags(0x00000200)
 )
 
 const (
@@ -142,6 +145,12 @@ type Node struct {
 
 	filename string
 	line     uint32
+	// col, pos and end are the node's column and its start and end byte
+	// offsets, in the same form as a token.Token's Col, Pos and End. They
+	// are zero if unknown, such as for synthesized nodes.
+	col uint32
+	pos uint32
+	end uint32
 
 	// The idX fields' meaning depend on what kind of node it is.
 	//
@@ -159,6 +168,7 @@ type Node struct {
 	// If            .             .             .             If
 	// Iterate       unroll        label         length        Iterate
 	// Jump          keyword       label         .             Jump
+	// Lemma         .             pkg           name          Lemma
 	// PackageID     .             .             lit(pkgID)    PackageID
 	// Ret           keyword       .             .             Ret
 	// Status        keyword       pkg           lit(message)  Status
@@ -198,6 +208,7 @@ func (n *Node) AsIOBind() *IOBind       { return (*IOBind)(n) }
 func (n *Node) AsIf() *If               { return (*If)(n) }
 func (n *Node) AsIterate() *Iterate     { return (*Iterate)(n) }
 func (n *Node) AsJump() *Jump           { return (*Jump)(n) }
+func (n *Node) AsLemma() *Lemma         { return (*Lemma)(n) }
 func (n *Node) AsPackageID() *PackageID { return (*PackageID)(n) }
 func (n *Node) AsRaw() *Raw             { return (*Raw)(n) }
 func (n *Node) AsRet() *Ret             { return (*Ret)(n) }
@@ -245,10 +256,14 @@ type Raw Node
 func (n *Raw) AsNode() *Node                  { return (*Node)(n) }
 func (n *Raw) Flags() Flags                   { return n.flags }
 func (n *Raw) FilenameLine() (string, uint32) { return n.filename, n.line }
+func (n *Raw) Col() uint32                    { return n.col }
+func (n *Raw) Pos() uint32                    { return n.pos }
+func (n *Raw) End() uint32                    { return n.end }
 func (n *Raw) SubNodes() [3]*Node             { return [3]*Node{n.lhs, n.mhs, n.rhs} }
 func (n *Raw) SubLists() [3][]*Node           { return [3][]*Node{n.list0, n.list1, n.list2} }
 
 func (n *Raw) SetFilenameLine(f string, l uint32) { n.filename, n.line = f, l }
+func (n *Raw) SetColPosEnd(c, p, e uint32)        { n.col, n.pos, n.end = c, p, e }
 
 func (n *Raw) SetPackage(tm *t.Map, pkg t.ID) error {
 	return n.AsNode().Walk(func(o *Node) error {
@@ -256,7 +271,7 @@ func (n *Raw) SetPackage(tm *t.Map, pkg t.ID) error {
 		default:
 			return nil
 
-		case KConst, KFunc, KStatus, KStruct:
+		case KConst, KFunc, KLemma, KStatus, KStruct:
 			// No-op.
 
 		case KExpr:
@@ -271,6 +286,11 @@ func (n *Raw) SetPackage(tm *t.Map, pkg t.ID) error {
 			if o.id0 != 0 {
 				return nil
 			}
+			if o.id1 != 0 {
+				// The type is already qualified, e.g. "deflate.decoder" in a
+				// package that uses "std/deflate".
+				return nil
+			}
 		}
 
 		if o.id1 == t.IDBase {
@@ -381,7 +401,7 @@ func NewExpr(flags Flags, operator t.ID, statusPkg t.ID, ident t.ID, lhs *Node,
 
 // Assert is "assert RHS via ID2(args)", "pre etc", "inv etc" or "post etc":
 //  - ID0:   <IDAssert|IDPre|IDInv|IDPost>
-//  - ID2:   <string literal> reason
+//  - ID2:   <string literal|ident> reason, either built-in or a lemma
 //  - RHS:   <Expr>
 //  - List0: <Arg> reason arguments
 type Assert Node
@@ -419,16 +439,22 @@ func NewArg(name t.ID, value *Expr) *Arg {
 	}
 }
 
-// Assign is "LHS = RHS" or "LHS op= RHS":
+// Assign is "LHS = RHS" or "LHS op= RHS" or, to destructure a call to a
+// function with multiple out fields, "List0[0], List0[1], etc = RHS":
 //  - ID0:   operator
-//  - LHS:   <Expr>
+//  - LHS:   <nil|Expr>
 //  - RHS:   <Expr>
+//  - List0: <Expr> destructuring assignees
+//
+// Exactly one of LHS and List0 is non-empty.
 type Assign Node
 
-func (n *Assign) AsNode() *Node  { return (*Node)(n) }
-func (n *Assign) Operator() t.ID { return n.id0 }
-func (n *Assign) LHS() *Expr     { return n.lhs.AsExpr() }
-func (n *Assign) RHS() *Expr     { return n.rhs.AsExpr() }
+func (n *Assign) AsNode() *Node       { return (*Node)(n) }
+func (n *Assign) Operator() t.ID      { return n.id0 }
+func (n *Assign) LHS() *Expr          { return n.lhs.AsExpr() }
+func (n *Assign) RHS() *Expr          { return n.rhs.AsExpr() }
+func (n *Assign) Destructuring() bool { return len(n.list0) > 0 }
+func (n *Assign) LHSList() []*Node    { return n.list0 }
 
 func NewAssign(operator t.ID, lhs *Expr, rhs *Expr) *Assign {
 	return &Assign{
@@ -439,6 +465,15 @@ func NewAssign(operator t.ID, lhs *Expr, rhs *Expr) *Assign {
 	}
 }
 
+func NewDestructuringAssign(lhsList []*Node, rhs *Expr) *Assign {
+	return &Assign{
+		kind:  KAssign,
+		id0:   t.IDEq,
+		rhs:   rhs.AsNode(),
+		list0: lhsList,
+	}
+}
+
 // Var is "var ID2 LHS" or "var ID2 LHS = RHS" or an iterate variable
 // declaration "ID1 LHS =: RHS":
 //  - ID0:   <0|IDEq|IDEqColon>
@@ -572,6 +607,7 @@ func NewWhile(label t.ID, condition *Expr, asserts []*Node, body []*Node) *While
 }
 
 // If is "if MHS { List2 } else RHS" or "if MHS { List2 } else { List1 }":
+//  - FlagsHasElse is the if has an "else { List1 }", even if List1 is empty
 //  - MHS:   <Expr>
 //  - RHS:   <nil|If>
 //  - List1: <Statement> if-false body
@@ -583,6 +619,9 @@ func (n *If) Condition() *Expr     { return n.mhs.AsExpr() }
 func (n *If) ElseIf() *If          { return n.rhs.AsIf() }
 func (n *If) BodyIfTrue() []*Node  { return n.list2 }
 func (n *If) BodyIfFalse() []*Node { return n.list1 }
+func (n *If) HasElse() bool        { return n.flags&FlagsHasElse != 0 }
+
+func (n *If) SetHasElse() { n.flags |= FlagsHasElse }
 
 func NewIf(condition *Expr, bodyIfTrue []*Node, bodyIfFalse []*Node, elseIf *If) *If {
 	return &If{
@@ -636,7 +675,7 @@ const MaxTypeExprDepth = 63
 
 // TypeExpr is a type expression, such as "base.u32", "base.u32[..8]", "foo",
 // "pkg.bar", "ptr T", "array[8] T", "slice T" or "table T":
-//  - ID0:   <0|IDArray|IDFunc|IDNptr|IDPtr|IDSlice|IDTable>
+//  - ID0:   <0|IDArray|IDFunc|IDNptr|IDOut|IDPtr|IDSlice|IDTable>
 //  - ID1:   <0|pkg>
 //  - ID2:   <0|type name>
 //  - LHS:   <nil|Expr>
@@ -655,6 +694,9 @@ const MaxTypeExprDepth = 63
 // type. LHS is the receiver type, which may be nil. If non-nil, it will be a
 // pointee type: "T" instead of "ptr T", "ptr ptr T", etc.
 //
+// An IDOut ID0 means "out ID2" or "out (LHS).ID2", the type of a call to a
+// function or method that has multiple out fields. LHS is as for IDFunc.
+//
 // TODO: method effects: "foo" vs "foo!" vs "foo?".
 //
 // A zero ID0 means a (possibly package-qualified) type like "pkg.foo" or
@@ -733,6 +775,11 @@ func (n *TypeExpr) IsTableType() bool {
 	return n.id0 == t.IDTable
 }
 
+func (n *TypeExpr) IsSignedInteger() bool {
+	return n.id0 == 0 && n.id1 == t.IDBase &&
+		(n.id2 == t.IDI8 || n.id2 == t.IDI16 || n.id2 == t.IDI32 || n.id2 == t.IDI64)
+}
+
 func (n *TypeExpr) IsUnsignedInteger() bool {
 	return n.id0 == 0 && n.id1 == t.IDBase &&
 		(n.id2 == t.IDU8 || n.id2 == t.IDU16 || n.id2 == t.IDU32 || n.id2 == t.IDU64)
@@ -789,6 +836,7 @@ const MaxBodyDepth = 255
 //  - ID1:   <0|receiverPkg> (set by calling SetPackage)
 //  - ID2:   <0|receiverName>
 //  - LHS:   <Struct> in-parameters
+//  - MHS:   <nil|Expr> maximum recursion depth
 //  - RHS:   <Struct> out-parameters
 //  - List1: <Assert> asserts
 //  - List2: <Statement> body
@@ -818,11 +866,15 @@ func (n *Func) QQID() t.QQID      { return t.QQID{n.id1, n.id2, n.id0} }
 func (n *Func) Receiver() t.QID   { return t.QID{n.id1, n.id2} }
 func (n *Func) FuncName() t.ID    { return n.id0 }
 func (n *Func) In() *Struct       { return n.lhs.AsStruct() }
+func (n *Func) Depth() *Expr      { return n.mhs.AsExpr() }
 func (n *Func) Out() *Struct      { return n.rhs.AsStruct() }
 func (n *Func) Asserts() []*Node  { return n.list1 }
 func (n *Func) Body() []*Node     { return n.list2 }
 
-func NewFunc(flags Flags, filename string, line uint32, receiverName t.ID, funcName t.ID, in *Struct, out *Struct, asserts []*Node, body []*Node) *Func {
+// MaxFuncDepth is the largest maximum recursion depth that a func can declare.
+const MaxFuncDepth = 1024
+
+func NewFunc(flags Flags, filename string, line uint32, receiverName t.ID, funcName t.ID, in *Struct, depth *Expr, out *Struct, asserts []*Node, body []*Node) *Func {
 	return &Func{
 		kind:     KFunc,
 		flags:    flags,
@@ -831,12 +883,48 @@ func NewFunc(flags Flags, filename string, line uint32, receiverName t.ID, funcN
 		id0:      funcName,
 		id2:      receiverName,
 		lhs:      in.AsNode(),
+		mhs:      depth.AsNode(),
 		rhs:      out.AsNode(),
 		list1:    asserts,
 		list2:    body,
 	}
 }
 
+// Lemma is "lemma ID2(List0), List1 { List2 }":
+//  - FlagsPublic      is "pub" vs "pri"
+//  - ID1:   <0|pkg> (set by calling SetPackage)
+//  - ID2:   name
+//  - List0: <Field> parameters
+//  - List1: <Assert> pre- and post-conditions
+//  - List2: <Assert> body
+//
+// A lemma is proof-only: it generates no code. Once the checker has proven
+// that the pre-conditions imply the post-conditions, an assert statement can
+// cite it, like a built-in reason, by writing "assert etc via ID2(args)".
+type Lemma Node
+
+func (n *Lemma) AsNode() *Node    { return (*Node)(n) }
+func (n *Lemma) Public() bool     { return n.flags&FlagsPublic != 0 }
+func (n *Lemma) Filename() string { return n.filename }
+func (n *Lemma) Line() uint32     { return n.line }
+func (n *Lemma) QID() t.QID       { return t.QID{n.id1, n.id2} }
+func (n *Lemma) Params() []*Node  { return n.list0 }
+func (n *Lemma) Asserts() []*Node { return n.list1 }
+func (n *Lemma) Body() []*Node    { return n.list2 }
+
+func NewLemma(flags Flags, filename string, line uint32, name t.ID, params []*Node, asserts []*Node, body []*Node) *Lemma {
+	return &Lemma{
+		kind:     KLemma,
+		flags:    flags,
+		filename: filename,
+		line:     line,
+		id2:      name,
+		list0:    params,
+		list1:    asserts,
+		list2:    body,
+	}
+}
+
 // Status is "error (RHS) ID2" or "suspension (RHS) ID2":
 //  - FlagsPublic      is "pub" vs "pri"
 //  - ID0:   <IDError|IDSuspension>
@@ -956,7 +1044,7 @@ func NewUse(filename string, line uint32, path t.ID) *Use {
 }
 
 // File is a file of source code:
-//  - List0: <Const|Func|PackageID|Status|Struct|Use> top-level declarations
+//  - List0: <Const|Func|Lemma|PackageID|Status|Struct|Use> top-level declarations
 type File Node
 
 func (n *File) AsNode() *Node          { return (*Node)(n) }
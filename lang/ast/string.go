@@ -168,28 +168,31 @@ var opStrings = [...]string{
 	t.IDXUnaryRef:   "ref ",
 	t.IDXUnaryDeref: "deref ",
 
-	t.IDXBinaryPlus:          " + ",
-	t.IDXBinaryMinus:         " - ",
-	t.IDXBinaryStar:          " * ",
-	t.IDXBinarySlash:         " / ",
-	t.IDXBinaryShiftL:        " << ",
-	t.IDXBinaryShiftR:        " >> ",
-	t.IDXBinaryAmp:           " & ",
-	t.IDXBinaryPipe:          " | ",
-	t.IDXBinaryHat:           " ^ ",
-	t.IDXBinaryTildeModPlus:  " ~mod+ ",
-	t.IDXBinaryTildeModMinus: " ~mod- ",
-	t.IDXBinaryTildeSatPlus:  " ~sat+ ",
-	t.IDXBinaryTildeSatMinus: " ~sat- ",
-	t.IDXBinaryNotEq:         " != ",
-	t.IDXBinaryLessThan:      " < ",
-	t.IDXBinaryLessEq:        " <= ",
-	t.IDXBinaryEqEq:          " == ",
-	t.IDXBinaryGreaterEq:     " >= ",
-	t.IDXBinaryGreaterThan:   " > ",
-	t.IDXBinaryAnd:           " and ",
-	t.IDXBinaryOr:            " or ",
-	t.IDXBinaryAs:            " as ",
+	t.IDXBinaryPlus:           " + ",
+	t.IDXBinaryMinus:          " - ",
+	t.IDXBinaryStar:           " * ",
+	t.IDXBinarySlash:          " / ",
+	t.IDXBinaryPercent:        " % ",
+	t.IDXBinaryShiftL:         " << ",
+	t.IDXBinaryShiftR:         " >> ",
+	t.IDXBinaryAmp:            " & ",
+	t.IDXBinaryPipe:           " | ",
+	t.IDXBinaryHat:            " ^ ",
+	t.IDXBinaryTildeModShiftL: " ~mod<< ",
+	t.IDXBinaryTildeModPlus:   " ~mod+ ",
+	t.IDXBinaryTildeModMinus:  " ~mod- ",
+	t.IDXBinaryTildeModStar:   " ~mod* ",
+	t.IDXBinaryTildeSatPlus:   " ~sat+ ",
+	t.IDXBinaryTildeSatMinus:  " ~sat- ",
+	t.IDXBinaryNotEq:          " != ",
+	t.IDXBinaryLessThan:       " < ",
+	t.IDXBinaryLessEq:         " <= ",
+	t.IDXBinaryEqEq:           " == ",
+	t.IDXBinaryGreaterEq:      " >= ",
+	t.IDXBinaryGreaterThan:    " > ",
+	t.IDXBinaryAnd:            " and ",
+	t.IDXBinaryOr:             " or ",
+	t.IDXBinaryAs:             " as ",
 
 	t.IDXAssociativePlus: " + ",
 	t.IDXAssociativeStar: " * ",
@@ -240,8 +243,12 @@ func (n *TypeExpr) appendStr(buf []byte, tm *t.Map, depth uint32) []byte {
 	case t.IDTable:
 		buf = append(buf, "table "...)
 		return n.Inner().appendStr(buf, tm, depth)
-	case t.IDFunc:
-		buf = append(buf, "func "...)
+	case t.IDFunc, t.IDOut:
+		if n.Decorator() == t.IDFunc {
+			buf = append(buf, "func "...)
+		} else {
+			buf = append(buf, "out "...)
+		}
 		if r := n.Receiver(); r != nil {
 			buf = append(buf, '(')
 			buf = r.appendStr(buf, tm, depth)
@@ -50,6 +50,7 @@ var StatusList = [...]Status{
 	{t.IDError, -0x12, "invalid call sequence"},
 
 	{t.IDError, -0x20, "cannot return a suspension"},
+	{t.IDError, -0x21, "recursion too deep"},
 
 	{t.IDError, -0x30, "unexpected EOF"},    // Used if reading when closed == true.
 	{t.IDError, -0x31, "closed for writes"}, // TODO: is this unused? Should callee or caller check closed-ness?
@@ -67,11 +68,39 @@ func init() {
 	}
 }
 
+// CName returns the C name for a Wuffs name, such as a status message or a
+// struct or method name: pkgPrefix followed by name, lower-cased, with each
+// run of characters other than letters and digits replaced by one underscore,
+// and without a trailing underscore.
+func CName(name string, pkgPrefix string) string {
+	s := []byte(pkgPrefix)
+	underscore := true
+	for _, r := range name {
+		if 'A' <= r && r <= 'Z' {
+			s = append(s, byte(r+'a'-'A'))
+			underscore = false
+		} else if ('a' <= r && r <= 'z') || ('0' <= r && r <= '9') {
+			s = append(s, byte(r))
+			underscore = false
+		} else if !underscore {
+			s = append(s, '_')
+			underscore = true
+		}
+	}
+	if underscore && len(s) > 0 {
+		s = s[:len(s)-1]
+	}
+	return string(s)
+}
+
 // TODO: a collection of forbidden variable names like and, or, not, as, ref,
 // deref, false, true, in, out, this, u8, u16, etc?
 
 var Types = []string{
-	// TODO: i8, i16, i32, i64.
+	"i8",
+	"i16",
+	"i32",
+	"i64",
 	"u8",
 	"u16",
 	"u32",
@@ -99,6 +128,18 @@ var Types = []string{
 }
 
 var Funcs = []string{
+	"i8.max(x i8)(ret i8)",
+	"i8.min(x i8)(ret i8)",
+
+	"i16.max(x i16)(ret i16)",
+	"i16.min(x i16)(ret i16)",
+
+	"i32.max(x i32)(ret i32)",
+	"i32.min(x i32)(ret i32)",
+
+	"i64.max(x i64)(ret i64)",
+	"i64.min(x i64)(ret i64)",
+
 	"u8.high_bits(n u32[..8])(ret u8)",
 	"u8.low_bits(n u32[..8])(ret u8)",
 	"u8.max(x u8)(ret u8)",
@@ -149,6 +190,14 @@ var Funcs = []string{
 	"io_reader.read_u64be?()(ret u64)",
 	"io_reader.read_u64le?()(ret u64)",
 
+	"io_reader.read_i8?()(ret i8)",
+	"io_reader.read_i16be?()(ret i16)",
+	"io_reader.read_i16le?()(ret i16)",
+	"io_reader.read_i32be?()(ret i32)",
+	"io_reader.read_i32le?()(ret i32)",
+	"io_reader.read_i64be?()(ret i64)",
+	"io_reader.read_i64le?()(ret i64)",
+
 	// TODO: these should have an explicit pre-condition "available() >= N".
 	// For now, that's implicitly checked (i.e. hard coded).
 	//
@@ -316,6 +316,11 @@ func (q *checker) proveBinaryOp(op t.ID, lhs *a.Expr, rhs *a.Expr) error {
 			}
 		}
 	}
+
+	// As a last resort, consult the linear arithmetic decision procedure.
+	if q.proveLinear(op, lhs, rhs) {
+		return nil
+	}
 	return errFailed
 }
 
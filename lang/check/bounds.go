@@ -19,6 +19,8 @@ import (
 	"fmt"
 	"math/big"
 
+	"github.com/google/wuffs/lang/interval"
+
 	a "github.com/google/wuffs/lang/ast"
 	t "github.com/google/wuffs/lang/token"
 )
@@ -212,7 +214,7 @@ loop:
 }
 
 func (q *checker) bcheckStatement(n *a.Node) error {
-	q.errFilename, q.errLine = n.AsRaw().FilenameLine()
+	q.errNode, q.errExpr = n, nil
 
 	switch n.Kind() {
 	case a.KAssert:
@@ -222,7 +224,11 @@ func (q *checker) bcheckStatement(n *a.Node) error {
 
 	case a.KAssign:
 		n := n.AsAssign()
-		if err := q.bcheckAssignment(n.LHS(), n.Operator(), n.RHS()); err != nil {
+		if n.Destructuring() {
+			if err := q.bcheckDestructuringAssignment(n.LHSList(), n.RHS()); err != nil {
+				return err
+			}
+		} else if err := q.bcheckAssignment(n.LHS(), n.Operator(), n.RHS()); err != nil {
 			return err
 		}
 
@@ -288,6 +294,9 @@ func (q *checker) bcheckStatement(n *a.Node) error {
 				return err
 			}
 		}
+		if err := q.bcheckInferred(n.JumpTarget()); err != nil {
+			return err
+		}
 		q.facts = q.facts[:0]
 
 	case a.KRet:
@@ -341,6 +350,8 @@ func (q *checker) bcheckAssert(n *a.Assert) error {
 	} else if reasonID := n.Reason(); reasonID != 0 {
 		if reasonFunc := q.reasonMap[reasonID]; reasonFunc != nil {
 			err = reasonFunc(q, n)
+		} else if l := q.c.lemmas[reasonID]; l != nil {
+			err = q.citeLemma(l, n)
 		} else {
 			err = fmt.Errorf("no such reason %s", reasonID.Str(q.tm))
 		}
@@ -421,6 +432,48 @@ func (q *checker) bcheckAssignment(lhs *a.Expr, op t.ID, rhs *a.Expr) error {
 	return nil
 }
 
+func (q *checker) bcheckDestructuringAssignment(lhsList []*a.Node, rhs *a.Expr) error {
+	if _, err := q.bcheckExpr(rhs, 0); err != nil {
+		return err
+	}
+	f, err := q.c.resolveFunc(rhs.MType())
+	if err != nil {
+		return err
+	}
+	outFields := f.Out().Fields()
+
+	for i, o := range lhsList {
+		lhs := o.AsExpr()
+		if _, err := q.bcheckExpr(lhs, 0); err != nil {
+			return err
+		}
+		lb, err := q.bcheckTypeExpr(lhs.MType())
+		if err != nil {
+			return err
+		}
+		outField := outFields[i].AsField()
+		ob, err := q.bcheckTypeExpr(outField.XType())
+		if err != nil {
+			return err
+		}
+		if (ob[0].Cmp(lb[0]) < 0) || (ob[1].Cmp(lb[1]) > 0) {
+			return fmt.Errorf("check: out field %q bounds %v is not within bounds %v for %q",
+				outField.Name().Str(q.tm), ob, lb, lhs.Str(q.tm))
+		}
+
+		// Drop any facts involving lhs.
+		if err := q.facts.update(func(x *a.Expr) (*a.Expr, error) {
+			if x.Mentions(lhs) {
+				return nil, nil
+			}
+			return x, nil
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (q *checker) bcheckAssignment1(lhs *a.Expr, lTyp *a.TypeExpr, op t.ID, rhs *a.Expr) error {
 	if lhs == nil && op != t.IDEq {
 		return fmt.Errorf("check: internal error: missing LHS for op key 0x%02X", op)
@@ -443,6 +496,7 @@ func (q *checker) bcheckAssignment1(lhs *a.Expr, lTyp *a.TypeExpr, op t.ID, rhs
 
 	if (rb[0].Cmp(lb[0]) < 0) || (rb[1].Cmp(lb[1]) > 0) {
 		if op == t.IDEq {
+			q.noteErrExpr(rhs)
 			return fmt.Errorf("check: expression %q bounds %v is not within bounds %v",
 				rhs.Str(q.tm), rb, lb)
 		} else {
@@ -570,6 +624,38 @@ func (q *checker) bcheckIf(n *a.If) error {
 }
 
 func (q *checker) bcheckWhile(n *a.While) error {
+	// Infer any inv conditions from the facts on entry. Like the explicit
+	// ones, they are checked on entry, on each explicit continue and on the
+	// implicit continue after the body.
+	inferred := []*a.Expr(nil)
+	if q.c.inferInvariants {
+		inferred = q.inferInvariants(n)
+		if len(inferred) > 0 {
+			if q.inferred == nil {
+				q.inferred = map[a.Loop][]*a.Expr{}
+			}
+			q.inferred[n] = inferred
+			defer delete(q.inferred, n)
+		}
+
+		suggested := []*a.Expr(nil)
+	loop:
+		for _, x := range inferred {
+			for _, o := range n.Asserts() {
+				if o.AsAssert().Condition().Eq(x) {
+					continue loop
+				}
+			}
+			suggested = append(suggested, x)
+		}
+		if len(suggested) > 0 {
+			q.c.inferredInvariants = append(q.c.inferredInvariants, InferredInvariant{
+				While:      n,
+				Conditions: suggested,
+			})
+		}
+	}
+
 	// Check the pre and inv conditions on entry.
 	for _, o := range n.Asserts() {
 		if o.AsAssert().Keyword() == t.IDPost {
@@ -579,6 +665,9 @@ func (q *checker) bcheckWhile(n *a.While) error {
 			return err
 		}
 	}
+	if err := q.bcheckInferred(n); err != nil {
+		return err
+	}
 
 	// Check the while condition.
 	//
@@ -606,6 +695,9 @@ func (q *checker) bcheckWhile(n *a.While) error {
 			}
 			q.facts.appendFact(o.AsAssert().Condition())
 		}
+		for _, x := range inferred {
+			q.facts.appendFact(x)
+		}
 		if inverse, err := invert(q.tm, n.Condition()); err != nil {
 			return err
 		} else {
@@ -632,6 +724,9 @@ func (q *checker) bcheckWhile(n *a.While) error {
 			}
 			q.facts.appendFact(o.AsAssert().Condition())
 		}
+		for _, x := range inferred {
+			q.facts.appendFact(x)
+		}
 		// ...and the while condition, unless it is the redundant "true".
 		if cv == nil {
 			q.facts.appendFact(n.Condition())
@@ -651,6 +746,9 @@ func (q *checker) bcheckWhile(n *a.While) error {
 					return err
 				}
 			}
+			if err := q.bcheckInferred(n); err != nil {
+				return err
+			}
 		}
 	}
 
@@ -662,6 +760,19 @@ func (q *checker) bcheckWhile(n *a.While) error {
 		}
 		q.facts.appendFact(o.AsAssert().Condition())
 	}
+	for _, x := range inferred {
+		q.facts.appendFact(x)
+	}
+	return nil
+}
+
+// bcheckInferred checks the inv conditions inferred for the loop n, if any.
+func (q *checker) bcheckInferred(n a.Loop) error {
+	for _, x := range q.inferred[n] {
+		if err := q.bcheckAssert(a.NewAssert(t.IDInv, x, 0, nil)); err != nil {
+			return fmt.Errorf("%v, inferred as an inv condition", err)
+		}
+	}
 	return nil
 }
 
@@ -697,18 +808,22 @@ func (q *checker) bcheckExpr(n *a.Expr, depth uint32) (a.Bounds, error) {
 
 	nb, err := q.bcheckExpr1(n, depth)
 	if err != nil {
+		q.noteErrExpr(n)
 		return a.Bounds{}, err
 	}
 	nb, err = q.facts.refine(n, nb, q.tm)
 	if err != nil {
+		q.noteErrExpr(n)
 		return a.Bounds{}, err
 	}
 	tb, err := q.bcheckTypeExpr(n.MType())
 	if err != nil {
+		q.noteErrExpr(n)
 		return a.Bounds{}, err
 	}
 
 	if (nb[0].Cmp(tb[0]) < 0) || (nb[1].Cmp(tb[1]) > 0) {
+		q.noteErrExpr(n)
 		return a.Bounds{}, fmt.Errorf("check: expression %q bounds %v is not within bounds %v",
 			n.Str(q.tm), nb, tb)
 	}
@@ -960,15 +1075,9 @@ func (q *checker) bcheckExprCallSpecialCases(n *a.Expr, depth uint32) (a.Bounds,
 				return a.Bounds{}, err
 			}
 			if method == t.IDMin {
-				return a.Bounds{
-					min(lb[0], ab[0]),
-					min(lb[1], ab[1]),
-				}, nil
+				return a.Bounds(interval.IntRange(lb).Min(interval.IntRange(ab))), nil
 			} else {
-				return a.Bounds{
-					max(lb[0], ab[0]),
-					max(lb[1], ab[1]),
-				}, nil
+				return a.Bounds(interval.IntRange(lb).Max(interval.IntRange(ab))), nil
 			}
 		}
 
@@ -1287,37 +1396,24 @@ func (q *checker) bcheckExprBinaryOp1(op t.ID, lhs *a.Expr, lb a.Bounds, rhs *a.
 		return q.bcheckExprXBinaryMinus(lhs, lb, rhs, rb)
 
 	case t.IDXBinaryStar:
-		// TODO: handle multiplication by negative numbers. Note that this
-		// might reverse the inequality: if 0 < a < b but c < 0 then a*c > b*c.
-		if lb[0].Sign() < 0 {
-			return a.Bounds{}, fmt.Errorf("check: multiply op argument %q is possibly negative", lhs.Str(q.tm))
-		}
-		if rb[0].Sign() < 0 {
-			return a.Bounds{}, fmt.Errorf("check: multiply op argument %q is possibly negative", rhs.Str(q.tm))
-		}
-		return a.Bounds{
-			big.NewInt(0).Mul(lb[0], rb[0]),
-			big.NewInt(0).Mul(lb[1], rb[1]),
-		}, nil
+		// Multiplying by a negative number reverses the inequality: if 0 < a
+		// < b but c < 0 then a*c > b*c. The interval package handles that.
+		return a.Bounds(interval.IntRange(lb).Mul(interval.IntRange(rb))), nil
 
 	case t.IDXBinarySlash, t.IDXBinaryPercent:
 		// Prohibit division by zero.
-		if lb[0].Sign() < 0 {
-			return a.Bounds{}, fmt.Errorf("check: divide/modulus op argument %q is possibly negative", lhs.Str(q.tm))
-		}
-		if rb[0].Sign() <= 0 {
-			return a.Bounds{}, fmt.Errorf("check: divide/modulus op argument %q is possibly non-positive", rhs.Str(q.tm))
+		if rb[0].Sign() <= 0 && rb[1].Sign() >= 0 {
+			return a.Bounds{}, fmt.Errorf("check: divide/modulus op argument %q is possibly zero", rhs.Str(q.tm))
 		}
 		if op == t.IDXBinarySlash {
-			return a.Bounds{
-				big.NewInt(0).Mul(lb[0], rb[1]),
-				big.NewInt(0).Mul(lb[1], rb[0]),
-			}, nil
+			// Like C, division truncates towards zero.
+			nb, _ := interval.IntRange(lb).Quo(interval.IntRange(rb))
+			return a.Bounds(nb), nil
 		}
-		return a.Bounds{
-			zero,
-			big.NewInt(0).Sub(rb[1], one),
-		}, nil
+		// Like C, the modulus has the sign of the dividend, and its magnitude
+		// is less than the divisor's magnitude.
+		nb, _ := interval.IntRange(lb).Rem(interval.IntRange(rb))
+		return a.Bounds(nb), nil
 
 	case t.IDXBinaryShiftL, t.IDXBinaryTildeModShiftL:
 		if lb[0].Sign() < 0 {
@@ -1334,18 +1430,31 @@ func (q *checker) bcheckExprBinaryOp1(op t.ID, lhs *a.Expr, lb a.Bounds, rhs *a.
 		if op == t.IDXBinaryTildeModShiftL {
 			if qid := lhs.MType().QID(); qid[0] == t.IDBase {
 				b := numTypeBounds[qid[1]]
-				nMax = min(nMax, b[1])
+				// Shifting by the type's width or more is undefined in C.
+				if b[0].Sign() == 0 && rb[1].Cmp(big.NewInt(int64(b[1].BitLen()))) >= 0 {
+					return a.Bounds{}, fmt.Errorf("check: shift %q out of range", rhs.Str(q.tm))
+				}
+				if nMax.Cmp(b[1]) > 0 {
+					// The result can wrap around.
+					return b, nil
+				}
 			}
 		}
 		return a.Bounds{nMin, nMax}, nil
 
 	case t.IDXBinaryShiftR:
-		if lb[0].Sign() < 0 {
-			return a.Bounds{}, fmt.Errorf("check: shift op argument %q is possibly negative", lhs.Str(q.tm))
-		}
 		if rb[0].Sign() < 0 {
 			return a.Bounds{}, fmt.Errorf("check: shift op argument %q is possibly negative", rhs.Str(q.tm))
 		}
+		if lb[0].Sign() < 0 {
+			// A signed right shift is an arithmetic shift, rounding towards
+			// negative infinity.
+			if rb[1].Cmp(maxIntBits) > 0 {
+				rb[1] = maxIntBits
+			}
+			nb, _ := interval.IntRange(lb).Rsh(interval.IntRange(rb))
+			return a.Bounds(nb), nil
+		}
 		if rb[0].Cmp(maxIntBits) >= 0 {
 			return a.Bounds{zero, zero}, nil
 		}
@@ -1377,8 +1486,11 @@ func (q *checker) bcheckExprBinaryOp1(op t.ID, lhs *a.Expr, lb a.Bounds, rhs *a.
 		switch op {
 		case t.IDXBinaryAmp:
 			z = min(lb[1], rb[1])
-		case t.IDXBinaryPipe, t.IDXBinaryHat:
+		case t.IDXBinaryPipe:
 			z = max(lb[1], rb[1])
+		case t.IDXBinaryHat:
+			nb, _ := interval.IntRange(lb).Xor(interval.IntRange(rb))
+			return a.Bounds(nb), nil
 		}
 		// Return [0, z rounded up to the next power-of-2-minus-1]. This is
 		// conservative, but works fine in practice.
@@ -1387,7 +1499,7 @@ func (q *checker) bcheckExprBinaryOp1(op t.ID, lhs *a.Expr, lb a.Bounds, rhs *a.
 			bitMask(z.BitLen()),
 		}, nil
 
-	case t.IDXBinaryTildeModPlus, t.IDXBinaryTildeModMinus:
+	case t.IDXBinaryTildeModPlus, t.IDXBinaryTildeModMinus, t.IDXBinaryTildeModStar:
 		typ := lhs.MType()
 		if typ.IsIdeal() {
 			typ = rhs.MType()
@@ -1497,6 +1609,11 @@ func (q *checker) bcheckTypeExpr1(typ *a.TypeExpr) (a.Bounds, error) {
 			return a.Bounds{}, err
 		}
 		return a.Bounds{one, one}, nil
+	case t.IDOut:
+		if _, err := q.bcheckTypeExpr(typ.Receiver()); err != nil {
+			return a.Bounds{}, err
+		}
+		return a.Bounds{zero, zero}, nil
 	case t.IDNptr:
 		return a.Bounds{zero, one}, nil
 	case t.IDPtr:
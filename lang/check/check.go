@@ -19,7 +19,10 @@ package check
 import (
 	"errors"
 	"fmt"
+	"math/big"
 	"path"
+	"sort"
+	"strings"
 
 	"github.com/google/wuffs/lang/base38"
 	"github.com/google/wuffs/lang/builtin"
@@ -30,28 +33,58 @@ import (
 )
 
 type Error struct {
-	Err           error
-	Filename      string
-	Line          uint32
+	Err      error
+	Filename string
+	Line     uint32
+	// Col, Pos and End, if non-zero, narrow the location down to a column and
+	// to a range of byte offsets, in the same form as a token.Token's.
+	Col           uint32
+	Pos           uint32
+	End           uint32
 	OtherFilename string
 	OtherLine     uint32
 
+	// Src, if non-nil, is the contents of Filename. It is used to show an
+	// excerpt of the offending source code.
+	Src []byte
+
 	TMap  *t.Map
 	Facts []*a.Expr
 }
 
+func (e *Error) setPosition(n *a.Node) {
+	raw := n.AsRaw()
+	e.Filename, e.Line = raw.FilenameLine()
+	e.Col, e.Pos, e.End = raw.Col(), raw.Pos(), raw.End()
+}
+
 func (e *Error) Error() string {
 	s := ""
-	if e.OtherFilename != "" || e.OtherLine != 0 {
-		s = fmt.Sprintf("%s at %s:%d and %s:%d",
-			e.Err, e.Filename, e.Line, e.OtherFilename, e.OtherLine)
+	loc := fmt.Sprintf("%s:%d", e.Filename, e.Line)
+	if e.Col != 0 {
+		loc = fmt.Sprintf("%s:%d", loc, e.Col)
+	}
+	if e.Filename == "" && e.Line == 0 {
+		s = e.Err.Error()
+	} else if e.OtherFilename != "" || e.OtherLine != 0 {
+		s = fmt.Sprintf("%s at %s and %s:%d",
+			e.Err, loc, e.OtherFilename, e.OtherLine)
 	} else {
-		s = fmt.Sprintf("%s at %s:%d", e.Err, e.Filename, e.Line)
+		s = fmt.Sprintf("%s at %s", e.Err, loc)
 	}
-	if e.TMap == nil {
+	excerpt := e.Excerpt()
+	if excerpt != "" {
+		s += "\n" + excerpt
+	}
+	if e.TMap == nil || len(e.Facts) == 0 {
 		return s
 	}
-	b := append([]byte(s), ". Facts:\n"...)
+	b := []byte(s)
+	if excerpt != "" {
+		b = append(b, "\nFacts:\n"...)
+	} else {
+		b = append(b, ". Facts:\n"...)
+	}
 	for _, f := range e.Facts {
 		b = append(b, '\t')
 		b = append(b, f.Str(e.TMap)...)
@@ -60,7 +93,73 @@ func (e *Error) Error() string {
 	return string(b)
 }
 
-func Check(tm *t.Map, files []*a.File, resolveUse func(usePath string) ([]byte, error)) (*Checker, error) {
+// Excerpt returns the source code line that the error is on, followed by a
+// line of carets under the offending part of it. It returns "" if e.Src is
+// nil or if e's position is unknown or out of range.
+func (e *Error) Excerpt() string {
+	if e.Src == nil || e.Col == 0 || uint64(e.Pos) >= uint64(len(e.Src)) || e.Pos < e.Col-1 {
+		return ""
+	}
+	lineStart := int(e.Pos - (e.Col - 1))
+	lineEnd := lineStart
+	for lineEnd < len(e.Src) && e.Src[lineEnd] != '\n' {
+		lineEnd++
+	}
+	// A multi-line span is cut short at the end of its first line.
+	end := int(e.End)
+	if end > lineEnd {
+		end = lineEnd
+	}
+
+	b := append([]byte(nil), e.Src[lineStart:lineEnd]...)
+	b = append(b, '\n')
+	// Preserve tabs, so that the carets line up with the source code.
+	for i := lineStart; i < int(e.Pos); i++ {
+		if e.Src[i] == '\t' {
+			b = append(b, '\t')
+		} else {
+			b = append(b, ' ')
+		}
+	}
+	b = append(b, '^')
+	for i := int(e.Pos) + 1; i < end; i++ {
+		b = append(b, '^')
+	}
+	return string(b)
+}
+
+// ErrorList is the error returned by Check. It holds one or more errors, in
+// the order that they were found.
+type ErrorList []*Error
+
+func (e ErrorList) Error() string {
+	b := []byte(nil)
+	for i, x := range e {
+		if i > 0 {
+			b = append(b, '\n')
+		}
+		b = append(b, strings.TrimSuffix(x.Error(), "\n")...)
+	}
+	return string(b)
+}
+
+// DefaultMaxErrors is the maximum number of errors that Check reports if the
+// Options do not say otherwise.
+const DefaultMaxErrors = 10
+
+type Options struct {
+	// MaxErrors is the maximum number of errors that Check reports. Zero
+	// means DefaultMaxErrors. Negative means no limit.
+	MaxErrors int
+
+	// InferInvariants is whether to infer, for each while loop, inv conditions
+	// on the numeric local variables that the loop assigns to. The inferred
+	// conditions are assumed in addition to any written explicitly, and are
+	// available afterwards from the Checker's InferredInvariants method.
+	InferInvariants bool
+}
+
+func Check(tm *t.Map, files []*a.File, resolveUse func(usePath string) ([]byte, error), opts *Options) (*Checker, error) {
 	for _, f := range files {
 		if f == nil {
 			return nil, errors.New("check: Check given a nil *ast.File")
@@ -93,7 +192,8 @@ func Check(tm *t.Map, files []*a.File, resolveUse func(usePath string) ([]byte,
 		localVars:    map[t.QQID]typeMap{},
 		statuses:     map[t.QID]*a.Status{},
 		structs:      map[t.QID]*a.Struct{},
-		useBaseNames: map[t.ID]struct{}{},
+		useBaseNames: map[t.ID]*a.Use{},
+		usedPackages: map[t.ID]string{},
 	}
 
 	_, err := c.parseBuiltInFuncs(builtin.Funcs, false)
@@ -109,11 +209,24 @@ func Check(tm *t.Map, files []*a.File, resolveUse func(usePath string) ([]byte,
 		return nil, err
 	}
 
+	maxErrors := DefaultMaxErrors
+	if opts != nil {
+		if opts.MaxErrors != 0 {
+			maxErrors = opts.MaxErrors
+		}
+		c.inferInvariants = opts.InferInvariants
+	}
+	errs := ErrorList(nil)
+
+	// Within a phase, the checks of top level declarations are independent,
+	// so an error doesn't stop the other declarations from being checked. A
+	// later phase can depend on an earlier one, so we stop between phases.
 	for _, phase := range phases {
 		for _, f := range files {
 			if phase.kind == a.KInvalid {
 				if err := phase.check(c, nil); err != nil {
-					return nil, err
+					errs = append(errs, toError(err, nil))
+					return nil, errs
 				}
 				continue
 			}
@@ -122,34 +235,67 @@ func Check(tm *t.Map, files []*a.File, resolveUse func(usePath string) ([]byte,
 					continue
 				}
 				if err := phase.check(c, n); err != nil {
-					return nil, err
+					errs = append(errs, toError(err, n))
+					if !phase.independent || len(errs) == maxErrors {
+						return nil, errs
+					}
 				}
 			}
 			setPlaceholderMBoundsMType(f.AsNode())
 		}
+		if len(errs) > 0 {
+			return nil, errs
+		}
 	}
 
 	return c, nil
 }
 
+// toError converts err to an *Error. If it isn't one already, the location is
+// that of n, the top level declaration being checked, if non-nil.
+func toError(err error, n *a.Node) *Error {
+	if e, ok := err.(*Error); ok {
+		if n != nil && e.Col == 0 {
+			// Refine a whole-line location with the column of n, if they
+			// agree on the line.
+			if filename, line := n.AsRaw().FilenameLine(); filename == e.Filename && line == e.Line {
+				e.Col, e.Pos, e.End = n.AsRaw().Col(), n.AsRaw().Pos(), n.AsRaw().End()
+			}
+		}
+		return e
+	}
+	e := &Error{Err: err}
+	if n != nil {
+		e.setPosition(n)
+	}
+	return e
+}
+
 var phases = [...]struct {
 	kind  a.Kind
 	check func(*Checker, *a.Node) error
+
+	// independent is whether an error checking one top level declaration
+	// still lets us check the others of the same kind in this phase.
+	independent bool
 }{
-	{a.KPackageID, (*Checker).checkPackageID},
-	{a.KInvalid, (*Checker).checkPackageIDExists},
-	{a.KUse, (*Checker).checkUse},
-	{a.KStatus, (*Checker).checkStatus},
-	{a.KConst, (*Checker).checkConst},
-	{a.KStruct, (*Checker).checkStructDecl},
-	{a.KInvalid, (*Checker).checkStructCycles},
-	{a.KStruct, (*Checker).checkStructFields},
-	{a.KFunc, (*Checker).checkFuncSignature},
-	{a.KFunc, (*Checker).checkFuncContract},
-	{a.KFunc, (*Checker).checkFuncBody},
-	{a.KStruct, (*Checker).checkFieldMethodCollisions},
-	{a.KInvalid, (*Checker).checkAllTypeChecked},
-	// TODO: check consts, funcs, structs and uses for name collisions.
+	{a.KPackageID, (*Checker).checkPackageID, false},
+	{a.KInvalid, (*Checker).checkPackageIDExists, false},
+	{a.KUse, (*Checker).checkUse, false},
+	{a.KStatus, (*Checker).checkStatus, false},
+	{a.KConst, (*Checker).checkConst, true},
+	{a.KStruct, (*Checker).checkStructDecl, false},
+	{a.KInvalid, (*Checker).checkStructCycles, false},
+	{a.KStruct, (*Checker).checkStructFields, true},
+	{a.KLemma, (*Checker).checkLemmaDecl, true},
+	{a.KLemma, (*Checker).checkLemma, true},
+	{a.KFunc, (*Checker).checkFuncSignature, true},
+	{a.KInvalid, (*Checker).checkNameCollisions, false},
+	{a.KFunc, (*Checker).checkFuncContract, true},
+	{a.KFunc, (*Checker).checkFuncBody, true},
+	{a.KFunc, (*Checker).checkFuncRecursion, true},
+	{a.KStruct, (*Checker).checkFieldMethodCollisions, true},
+	{a.KInvalid, (*Checker).checkAllTypeChecked, false},
 }
 
 type reason func(q *checker, n *a.Assert) error
@@ -172,7 +318,25 @@ type Checker struct {
 
 	// useBaseNames are the base names of packages referred to by `use
 	// "foo/bar"` lines. The keys are `bar`, not `"foo/bar"`.
-	useBaseNames map[t.ID]struct{}
+	useBaseNames map[t.ID]*a.Use
+
+	// usedPackages are the use paths, such as "std/deflate", of every package
+	// whose interface has been loaded, keyed by base name. It includes the
+	// packages used by used packages, whose types can appear in the latter's
+	// interfaces.
+	usedPackages map[t.ID]string
+
+	// lemmas are this package's lemmas, keyed by name.
+	lemmas map[t.ID]*lemma
+
+	// inferInvariants and inferredInvariants are as per the Options field
+	// and the method of the same names.
+	inferInvariants    bool
+	inferredInvariants []InferredInvariant
+
+	// callees maps a func to the suspendible funcs that it calls. It is
+	// populated lazily, after the func bodies are type checked.
+	callees map[t.QQID][]t.QQID
 
 	builtInSliceFuncs map[t.QQID]*a.Func
 	builtInTableFuncs map[t.QQID]*a.Func
@@ -183,6 +347,10 @@ type Checker struct {
 
 func (c *Checker) PackageID() uint32 { return c.packageID }
 
+// Func returns the function or method with the given name, which may be from
+// a used package or a built-in. It returns nil if there is no such function.
+func (c *Checker) Func(qqid t.QQID) *a.Func { return c.funcs[qqid] }
+
 func (c *Checker) checkPackageID(node *a.Node) error {
 	n := node.AsPackageID()
 	if c.otherPackageID != nil {
@@ -235,10 +403,38 @@ func (c *Checker) checkUse(node *a.Node) error {
 		return fmt.Errorf("check: cannot resolve `use %s`: %v", usePath.Str(c.tm), err)
 	}
 	filename += ".wuffs"
-	if _, ok := c.useBaseNames[baseName]; ok {
-		return fmt.Errorf("check: duplicate `use \"etc\"` base name %q", baseName.Str(c.tm))
+	if other, ok := c.useBaseNames[baseName]; ok {
+		n := node.AsUse()
+		return &Error{
+			Err:           fmt.Errorf("check: duplicate `use \"etc\"` base name %q", baseName.Str(c.tm)),
+			Filename:      n.Filename(),
+			Line:          n.Line(),
+			OtherFilename: other.Filename(),
+			OtherLine:     other.Line(),
+		}
 	}
 
+	if err := c.loadUse(filename, baseName); err != nil {
+		return err
+	}
+	c.useBaseNames[baseName] = node.AsUse()
+	setPlaceholderMBoundsMType(node)
+	return nil
+}
+
+// loadUse loads the interface of the package with the given use path (with a
+// ".wuffs" suffix) and base name, unless already loaded, after loading the
+// interfaces of the packages that it uses in turn.
+func (c *Checker) loadUse(filename string, baseName t.ID) error {
+	if other, ok := c.usedPackages[baseName]; ok {
+		if other != filename {
+			return fmt.Errorf("check: cannot use both %q and %q, as they have the same base name",
+				strings.TrimSuffix(other, ".wuffs"), strings.TrimSuffix(filename, ".wuffs"))
+		}
+		return nil
+	}
+	c.usedPackages[baseName] = filename
+
 	if c.resolveUse == nil {
 		return fmt.Errorf("check: cannot resolve a use declaration")
 	}
@@ -258,17 +454,40 @@ func (c *Checker) checkUse(node *a.Node) error {
 	}
 
 	for _, n := range f.TopLevelDecls() {
+		if n.Kind() != a.KUse {
+			continue
+		}
+		usePath, ok := t.Unescape(n.AsUse().Path().Str(c.tm))
+		if !ok {
+			return fmt.Errorf("check: cannot resolve `use %s` in %s", n.AsUse().Path().Str(c.tm), filename)
+		}
+		useBaseName, err := c.tm.Insert(path.Base(usePath))
+		if err != nil {
+			return fmt.Errorf("check: cannot resolve `use %s` in %s: %v", n.AsUse().Path().Str(c.tm), filename, err)
+		}
+		if err := c.loadUse(usePath+".wuffs", useBaseName); err != nil {
+			return err
+		}
+	}
+
+	// Funcs are checked last, as their signatures can refer to structs
+	// declared after them.
+	funcs := []*a.Node(nil)
+	for _, n := range f.TopLevelDecls() {
+		if n.Kind() == a.KUse {
+			continue
+		}
 		if err := n.AsRaw().SetPackage(c.tm, baseName); err != nil {
 			return err
 		}
 
 		switch n.Kind() {
 		case a.KConst:
-			return fmt.Errorf("TODO: type-check a used-package const")
-		case a.KFunc:
-			if err := c.checkFuncSignature(n); err != nil {
+			if err := c.checkConst(n); err != nil {
 				return err
 			}
+		case a.KFunc:
+			funcs = append(funcs, n)
 		case a.KStatus:
 			if err := c.checkStatus(n); err != nil {
 				return err
@@ -279,8 +498,14 @@ func (c *Checker) checkUse(node *a.Node) error {
 			}
 		}
 	}
-	c.useBaseNames[baseName] = struct{}{}
-	setPlaceholderMBoundsMType(node)
+	for _, n := range funcs {
+		if err := c.checkFuncSignature(n); err != nil {
+			return err
+		}
+		if err := c.checkFuncContract(n); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -420,7 +645,7 @@ func (c *Checker) checkStructDecl(node *a.Node) error {
 	// A struct declaration implies a reset method.
 	in := a.NewStruct(0, n.Filename(), n.Line(), t.IDIn, nil)
 	out := a.NewStruct(0, n.Filename(), n.Line(), t.IDOut, nil)
-	f := a.NewFunc(0, n.Filename(), n.Line(), qid[1], t.IDReset, in, out, nil, nil)
+	f := a.NewFunc(0, n.Filename(), n.Line(), qid[1], t.IDReset, in, nil, out, nil, nil)
 	if qid[0] != 0 {
 		f.AsNode().AsRaw().SetPackage(c.tm, qid[0])
 	}
@@ -523,13 +748,24 @@ func (c *Checker) checkFuncSignature(node *a.Node) error {
 	}
 	c.funcs[qqid] = n
 
-	if qqid[0] != 0 {
-		// No need to populate c.localVars for built-in or used-package funcs.
-		// In any case, the remaining type checking code in this function
-		// doesn't handle the base.† dagger type.
+	if qqid[0] == t.IDBase {
+		// No need to populate c.localVars for built-in funcs. In any case, the
+		// remaining type checking code in this function doesn't handle the
+		// base.† dagger type. Used-package funcs do need them, to check their
+		// pre and post conditions.
 		return nil
 	}
 
+	if n.Depth() != nil {
+		if err := c.checkFuncDepth(n); err != nil {
+			return &Error{
+				Err:      fmt.Errorf("%v for func %s", err, qqid.Str(c.tm)),
+				Filename: n.Filename(),
+				Line:     n.Line(),
+			}
+		}
+	}
+
 	iQID := n.In().QID()
 	inTyp := a.NewTypeExpr(0, iQID[0], iQID[1], nil, nil, nil)
 	inTyp.AsNode().SetMBounds(a.Bounds{zero, zero})
@@ -567,19 +803,51 @@ func (c *Checker) checkFuncSignature(node *a.Node) error {
 	return nil
 }
 
+func (c *Checker) checkFuncDepth(n *a.Func) error {
+	if !n.Suspendible() {
+		return fmt.Errorf("check: depth given for a non-suspendible func")
+	}
+	q := &checker{
+		c:  c,
+		tm: c.tm,
+	}
+	d := n.Depth()
+	if err := q.tcheckExpr(d, 0); err != nil {
+		return err
+	}
+	if _, err := q.bcheckExpr(d, 0); err != nil {
+		return err
+	}
+	if cv := d.ConstValue(); cv == nil {
+		return fmt.Errorf("check: depth %q is not a constant expression", d.Str(c.tm))
+	} else if cv.Cmp(one) < 0 || cv.Cmp(big.NewInt(a.MaxFuncDepth)) > 0 {
+		return fmt.Errorf("check: depth %v is out of range [1..%d]", cv, a.MaxFuncDepth)
+	}
+	return nil
+}
+
 func (c *Checker) checkFuncContract(node *a.Node) error {
 	n := node.AsFunc()
 	if len(n.Asserts()) == 0 {
 		return nil
 	}
 	q := &checker{
-		c:  c,
-		tm: c.tm,
+		c:         c,
+		tm:        c.tm,
+		astFunc:   n,
+		localVars: c.localVars[n.QQID()],
+		errNode:   node,
 	}
 	for _, o := range n.Asserts() {
 		if err := q.tcheckAssert(o.AsAssert()); err != nil {
-			return err
+			return q.newError(err)
+		}
+		// Proving the conditions at call sites is a TODO in bcheckExprCall,
+		// but their sub-expressions still need bounds.
+		if _, err := q.bcheckExpr(o.AsAssert().Condition(), 0); err != nil {
+			return q.newError(err)
 		}
+		setPlaceholderMBoundsMType(o)
 	}
 	return nil
 }
@@ -602,46 +870,214 @@ func (c *Checker) checkFuncBody(node *a.Node) error {
 	// function scope and can be hoisted, JavaScript style, a la
 	// https://developer.mozilla.org/en/docs/Web/JavaScript/Reference/Statements/var
 	if err := q.tcheckVars(n.Body()); err != nil {
-		return &Error{
-			Err:      err,
-			Filename: q.errFilename,
-			Line:     q.errLine,
-		}
+		return q.newError(err)
 	}
 
 	// TODO: check that variables are never used before they're initialized.
 
 	for _, o := range n.Body() {
 		if err := q.tcheckStatement(o); err != nil {
-			return &Error{
-				Err:      err,
-				Filename: q.errFilename,
-				Line:     q.errLine,
-			}
+			return q.newError(err)
 		}
 	}
 
 	if err := q.bcheckBlock(n.Body()); err != nil {
-		return &Error{
-			Err:      err,
-			Filename: q.errFilename,
-			Line:     q.errLine,
-			TMap:     c.tm,
-			Facts:    q.facts,
+		e := q.newError(err)
+		e.TMap = c.tm
+		e.Facts = q.facts
+		return e
+	}
+
+	return nil
+}
+
+// checkFuncRecursion checks that a suspendible func declares a maximum
+// recursion depth if and only if it can call itself, directly or indirectly.
+// Coroutine state is allocated up front, one frame per level of recursion.
+func (c *Checker) checkFuncRecursion(node *a.Node) error {
+	n := node.AsFunc()
+	if !n.Suspendible() {
+		return nil
+	}
+	qqid := n.QQID()
+	recursive := false
+	seen := map[t.QQID]bool{}
+	stack := append([]t.QQID(nil), c.suspendibleCallees(n)...)
+	for len(stack) > 0 && !recursive {
+		x := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if x == qqid {
+			recursive = true
+		} else if !seen[x] {
+			seen[x] = true
+			stack = append(stack, c.suspendibleCallees(c.funcs[x])...)
 		}
 	}
 
+	if recursive && n.Depth() == nil {
+		return fmt.Errorf("check: func %s is recursive but does not declare a depth", qqid.Str(c.tm))
+	} else if !recursive && n.Depth() != nil {
+		return fmt.Errorf("check: func %s declares a depth but is not recursive", qqid.Str(c.tm))
+	}
 	return nil
 }
 
+// suspendibleCallees returns the suspendible funcs, in this package, that n's
+// body calls. The results are memoized.
+func (c *Checker) suspendibleCallees(n *a.Func) []t.QQID {
+	qqid := n.QQID()
+	if callees, ok := c.callees[qqid]; ok {
+		return callees
+	}
+	callees := []t.QQID(nil)
+	for _, o := range n.Body() {
+		o.Walk(func(x *a.Node) error {
+			if x.Kind() != a.KExpr || !x.AsExpr().CallSuspendible() {
+				return nil
+			}
+			method := x.AsExpr().LHS().AsExpr()
+			if method.Operator() != t.IDDot {
+				return nil
+			}
+			recvTyp := method.LHS().AsExpr().MType().Pointee()
+			if recvTyp == nil || recvTyp.Decorator() != 0 {
+				return nil
+			}
+			qid := recvTyp.QID()
+			callee := t.QQID{qid[0], qid[1], method.Ident()}
+			if f := c.funcs[callee]; f != nil && qid[0] == 0 && f.Suspendible() {
+				callees = append(callees, callee)
+			}
+			return nil
+		})
+	}
+	if c.callees == nil {
+		c.callees = map[t.QQID][]t.QQID{}
+	}
+	c.callees[qqid] = callees
+	return callees
+}
+
 func (c *Checker) checkFieldMethodCollisions(node *a.Node) error {
 	n := node.AsStruct()
 	for _, o := range n.Fields() {
 		nQID := n.QID()
 		qqid := t.QQID{nQID[0], nQID[1], o.AsField().Name()}
-		if _, ok := c.funcs[qqid]; ok {
-			return fmt.Errorf("check: struct %q has both a field and method named %q",
-				nQID.Str(c.tm), qqid[2].Str(c.tm))
+		if f, ok := c.funcs[qqid]; ok {
+			filename, line := o.AsRaw().FilenameLine()
+			return &Error{
+				Err: fmt.Errorf("check: struct %q has both a field and method named %q",
+					nQID.Str(c.tm), qqid[2].Str(c.tm)),
+				Filename:      filename,
+				Line:          line,
+				OtherFilename: f.Filename(),
+				OtherLine:     f.Line(),
+			}
+		}
+	}
+	return nil
+}
+
+// namedDecl is a top level declaration, or a `use` line, that claims a name
+// in this package's namespace.
+type namedDecl struct {
+	what string
+	name t.ID
+	n    *a.Node
+}
+
+// checkNameCollisions checks that no two of this package's consts, structs,
+// funcs (other than methods) and `use` base names share a name, and that no
+// two of its statuses share a C name. Duplicates of the same kind are caught
+// earlier, by checkConst, checkStructDecl and so on, but a const and a struct
+// (for example) with the same name would otherwise only clash in the
+// generated code.
+func (c *Checker) checkNameCollisions(_ *a.Node) error {
+	decls := []namedDecl(nil)
+	for qid, v := range c.consts {
+		if qid[0] == 0 {
+			decls = append(decls, namedDecl{"const", qid[1], v.AsNode()})
+		}
+	}
+	for qid, v := range c.structs {
+		if qid[0] == 0 {
+			decls = append(decls, namedDecl{"struct", qid[1], v.AsNode()})
+		}
+	}
+	for qqid, v := range c.funcs {
+		if qqid[0] == 0 && qqid[1] == 0 {
+			decls = append(decls, namedDecl{"func", qqid[2], v.AsNode()})
+		}
+	}
+	for id, v := range c.useBaseNames {
+		decls = append(decls, namedDecl{"`use \"etc\"` base name", id, v.AsNode()})
+	}
+	if err := c.checkNamedDecls(decls, nil); err != nil {
+		return err
+	}
+
+	// Status messages are string literals, not identifiers, so they don't
+	// collide with the names above. Distinct messages can still map to the
+	// same C name, such as "bad zero" and "bad-zero", as the C code
+	// generator folds case and squashes runs of punctuation.
+	decls = decls[:0]
+	cNames := map[string]t.ID{}
+	for qid, v := range c.statuses {
+		if qid[0] != 0 {
+			continue
+		}
+		msg, ok := t.Unescape(qid[1].Str(c.tm))
+		if !ok {
+			continue
+		}
+		key := v.Keyword().Str(c.tm) + " " + builtin.CName(msg, "")
+		id, ok := cNames[key]
+		if !ok {
+			id = qid[1]
+			cNames[key] = id
+		}
+		decls = append(decls, namedDecl{"status", id, v.AsNode()})
+	}
+	return c.checkNamedDecls(decls, func(d namedDecl) string {
+		return d.n.AsStatus().QID()[1].Str(c.tm)
+	})
+}
+
+// checkNamedDecls returns an error for the first (in source order) of decls
+// whose name is already claimed by an earlier one. The error is positioned at
+// the later declaration and mentions the earlier one. If str is nil, the
+// declarations are described by their name.
+func (c *Checker) checkNamedDecls(decls []namedDecl, str func(namedDecl) string) error {
+	sort.Slice(decls, func(i, j int) bool {
+		fi, li := decls[i].n.AsRaw().FilenameLine()
+		fj, lj := decls[j].n.AsRaw().FilenameLine()
+		if fi != fj {
+			return fi < fj
+		}
+		if li != lj {
+			return li < lj
+		}
+		return decls[i].n.AsRaw().Col() < decls[j].n.AsRaw().Col()
+	})
+	if str == nil {
+		str = func(d namedDecl) string { return d.name.Str(c.tm) }
+	}
+	seen := map[t.ID]namedDecl{}
+	for _, d := range decls {
+		other, ok := seen[d.name]
+		if !ok {
+			seen[d.name] = d
+			continue
+		}
+		filename, line := d.n.AsRaw().FilenameLine()
+		otherFilename, otherLine := other.n.AsRaw().FilenameLine()
+		return &Error{
+			Err: fmt.Errorf("check: name collision between %s %s and %s %s",
+				other.what, str(other), d.what, str(d)),
+			Filename:      filename,
+			Line:          line,
+			OtherFilename: otherFilename,
+			OtherLine:     otherLine,
 		}
 	}
 	return nil
@@ -658,6 +1094,11 @@ func (c *Checker) checkAllTypeChecked(node *a.Node) error {
 			return err
 		}
 	}
+	for _, v := range c.lemmas {
+		if err := allTypeChecked(c.tm, v.n.AsNode()); err != nil {
+			return err
+		}
+	}
 	for _, v := range c.statuses {
 		if err := allTypeChecked(c.tm, v.AsNode()); err != nil {
 			return err
@@ -681,6 +1122,8 @@ func nodeDebugString(tm *t.Map, n *a.Node) string {
 		return fmt.Sprintf("%s node %q", n.Kind(), n.AsFunc().QQID().Str(tm))
 	case a.KTypeExpr:
 		return fmt.Sprintf("%s node %q", n.Kind(), n.AsTypeExpr().Str(tm))
+	case a.KLemma:
+		return fmt.Sprintf("%s node %q", n.Kind(), n.AsLemma().QID().Str(tm))
 	case a.KStatus:
 		return fmt.Sprintf("%s node %q", n.Kind(), n.AsStatus().QID().Str(tm))
 	case a.KStruct:
@@ -729,10 +1172,38 @@ type checker struct {
 	astFunc   *a.Func
 	localVars typeMap
 
-	errFilename string
-	errLine     uint32
+	// errNode is the statement being checked and errExpr is the innermost
+	// expression, if any, that failed to check. Together, they locate the
+	// first error.
+	errNode *a.Node
+	errExpr *a.Expr
 
 	jumpTargets []a.Loop
 
+	// inferred are the inv conditions inferred for the loops being checked.
+	inferred map[a.Loop][]*a.Expr
+
 	facts facts
 }
+
+func (q *checker) noteErrExpr(n *a.Expr) {
+	if q.errExpr == nil {
+		q.errExpr = n
+	}
+}
+
+// newError returns an *Error for err, located at q.errExpr if it has a known
+// position, otherwise at q.errNode.
+func (q *checker) newError(err error) *Error {
+	e := &Error{Err: err}
+	n := q.errNode
+	if q.errExpr != nil {
+		if filename, _ := q.errExpr.AsNode().AsRaw().FilenameLine(); filename != "" {
+			n = q.errExpr.AsNode()
+		}
+	}
+	if n != nil {
+		e.setPosition(n)
+	}
+	return e
+}
@@ -112,7 +112,7 @@ func TestCheck(tt *testing.T) {
 		tt.Fatalf("compareToWuffsfmt: %v", err)
 	}
 
-	c, err := Check(tm, []*a.File{file}, nil)
+	c, err := Check(tm, []*a.File{file}, nil, nil)
 	if err != nil {
 		tt.Fatalf("Check: %v", err)
 	}
@@ -220,7 +220,7 @@ func TestConstValues(tt *testing.T) {
 			continue
 		}
 
-		c, err := Check(tm, []*a.File{file}, nil)
+		c, err := Check(tm, []*a.File{file}, nil, nil)
 		if err != nil {
 			tt.Errorf("%q: Check: %v", s, err)
 			continue
@@ -315,3 +315,513 @@ func TestBuiltInTypeMap(tt *testing.T) {
 		}
 	}
 }
+
+func TestMultipleErrors(tt *testing.T) {
+	const filename = "test.wuffs"
+	src := strings.TrimSpace(`
+packageid "test"
+pri func foo()() {
+	var x base.u8 = 300
+}
+pri func bar()() {
+	var y base.u8 = 1
+}
+pri func qux()() {
+	var z base.u8 = 400
+}
+`) + "\n"
+
+	testCases := []struct {
+		maxErrors int
+		wantLines []uint32
+	}{
+		{0, []uint32{3, 9}},
+		{1, []uint32{3}},
+		{-1, []uint32{3, 9}},
+	}
+
+	for _, tc := range testCases {
+		tm := &t.Map{}
+		tokens, _, err := t.Tokenize(tm, filename, []byte(src))
+		if err != nil {
+			tt.Fatalf("Tokenize: %v", err)
+		}
+		file, err := parse.Parse(tm, filename, tokens, nil)
+		if err != nil {
+			tt.Fatalf("Parse: %v", err)
+		}
+
+		_, err = Check(tm, []*a.File{file}, nil, &Options{MaxErrors: tc.maxErrors})
+		errs, ok := err.(ErrorList)
+		if !ok {
+			tt.Fatalf("maxErrors=%d: got %v, want an ErrorList", tc.maxErrors, err)
+		}
+		gotLines := []uint32(nil)
+		for _, e := range errs {
+			if e.Filename != filename {
+				tt.Errorf("maxErrors=%d: Filename: got %q, want %q", tc.maxErrors, e.Filename, filename)
+			}
+			gotLines = append(gotLines, e.Line)
+		}
+		if !reflect.DeepEqual(gotLines, tc.wantLines) {
+			tt.Errorf("maxErrors=%d: lines: got %v, want %v", tc.maxErrors, gotLines, tc.wantLines)
+		}
+	}
+}
+
+func TestErrorPosition(tt *testing.T) {
+	const filename = "test.wuffs"
+	src := "packageid \"test\"\npri func foo()() {\n\tvar x base.u8 = 0\n\tx = x + (3 * 100)\n}\n"
+
+	tm := &t.Map{}
+	tokens, _, err := t.Tokenize(tm, filename, []byte(src))
+	if err != nil {
+		tt.Fatalf("Tokenize: %v", err)
+	}
+	file, err := parse.Parse(tm, filename, tokens, nil)
+	if err != nil {
+		tt.Fatalf("Parse: %v", err)
+	}
+	_, err = Check(tm, []*a.File{file}, nil, nil)
+	errs, ok := err.(ErrorList)
+	if !ok || len(errs) != 1 {
+		tt.Fatalf("got %v, want an ErrorList with 1 element", err)
+	}
+	e := errs[0]
+
+	if got, want := fmt.Sprintf("%d:%d", e.Line, e.Col), "4:6"; got != want {
+		tt.Errorf("line:col: got %q, want %q", got, want)
+	}
+	if got, want := src[e.Pos:e.End], "x + (3 * 100)"; got != want {
+		tt.Errorf("src[Pos:End]: got %q, want %q", got, want)
+	}
+
+	e.Src = []byte(src)
+	if got, want := e.Excerpt(), "\tx = x + (3 * 100)\n\t    ^^^^^^^^^^^^^"; got != want {
+		tt.Errorf("Excerpt:\ngot  %q\nwant %q", got, want)
+	}
+	if got, want := e.Error(), "at test.wuffs:4:6\n"; !strings.Contains(got, want) {
+		tt.Errorf("Error: got %q, want it to contain %q", got, want)
+	}
+
+	e.Facts = nil
+	if got := e.Error(); strings.Contains(got, "Facts") {
+		tt.Errorf("Error with no facts: got %q, want no Facts header", got)
+	}
+}
+
+func TestNameCollisions(tt *testing.T) {
+	testCases := []struct {
+		src0    string
+		src1    string
+		wantErr string
+	}{
+		{
+			"pri const foo base.u32 = 1\n",
+			"pri const bar base.u32 = 2\n",
+			"",
+		},
+		{
+			"pri const foo base.u32 = 1\n",
+			"pri struct foo(\n\tx base.u32,\n)\n",
+			"name collision between const foo and struct foo at b.wuffs:1 and a.wuffs:2",
+		},
+		{
+			"pri struct foo(\n\tx base.u32,\n)\n",
+			"pri func foo()() {\n}\n",
+			"name collision between struct foo and func foo at b.wuffs:1 and a.wuffs:2",
+		},
+		{
+			"pri struct foo(\n\tx base.u32,\n)\n",
+			"pri func foo.bar()() {\n}\n",
+			"",
+		},
+		{
+			"pri struct foo(\n\tx base.u32,\n)\n",
+			"pri func foo.x()() {\n}\n",
+			`struct "foo" has both a field and method named "x" at a.wuffs:3 and b.wuffs:1`,
+		},
+		{
+			"use \"std/foo\"\n",
+			"pri const foo base.u32 = 1\n",
+			"name collision between `use \"etc\"` base name foo and const foo at b.wuffs:1 and a.wuffs:2",
+		},
+		{
+			"use \"std/foo\"\n",
+			"use \"other/foo\"\n",
+			"duplicate `use \"etc\"` base name \"foo\" at b.wuffs:1:1 and a.wuffs:2",
+		},
+		{
+			"pri error (0x01) \"bad zero\"\n",
+			"pri error (0x02) \"Bad-Zero!\"\n",
+			`name collision between status "bad zero" and status "Bad-Zero!" at b.wuffs:1 and a.wuffs:2`,
+		},
+		{
+			"pri error (0x01) \"bad zero\"\n",
+			"pri suspension (0x01) \"bad-zero\"\n",
+			"",
+		},
+	}
+
+	resolveUse := func(usePath string) ([]byte, error) {
+		return nil, nil
+	}
+
+	for _, tc := range testCases {
+		tm := &t.Map{}
+		files := []*a.File(nil)
+		for i, src := range []string{"packageid \"test\"\n" + tc.src0, tc.src1} {
+			filename := string('a'+rune(i)) + ".wuffs"
+			tokens, _, err := t.Tokenize(tm, filename, []byte(src))
+			if err != nil {
+				tt.Fatalf("%q: Tokenize: %v", tc.src1, err)
+			}
+			file, err := parse.Parse(tm, filename, tokens, nil)
+			if err != nil {
+				tt.Fatalf("%q: Parse: %v", tc.src1, err)
+			}
+			files = append(files, file)
+		}
+
+		_, err := Check(tm, files, resolveUse, nil)
+		if tc.wantErr == "" {
+			if err != nil {
+				tt.Errorf("%q: got %v, want no error", tc.src1, err)
+			}
+		} else if err == nil {
+			tt.Errorf("%q: got no error, want %q", tc.src1, tc.wantErr)
+		} else if got := err.Error(); !strings.Contains(got, tc.wantErr) {
+			tt.Errorf("%q: got %q, want it to contain %q", tc.src1, got, tc.wantErr)
+		}
+	}
+}
+
+func TestSignedIntegers(tt *testing.T) {
+	const filename = "test.wuffs"
+	testCases := []struct {
+		args    string
+		body    string
+		wantErr string
+	}{
+		{"", "var x base.i8 = -128", ""},
+		{"", "var x base.i8 = -129", "not within bounds"},
+		{"x base.i16", "var y base.i16[-30..30] = in.x * in.x", "not within bounds"},
+		{"x base.i16[-10..10]", "var y base.i16[-100..100] = in.x * in.x", ""},
+		{"x base.i16[-10..10]", "var y base.i16[-100..100] = in.x * -10", ""},
+		{"x base.i32[-9..9]", "var y base.i32[-3..3] = in.x / 3", ""},
+		{"x base.i32[-9..9]", "var y base.i32[-3..3] = 9 / in.x", "possibly zero"},
+		{"x base.i32[-9..9]", "var y base.i32[-2..0] = in.x % -3", "not within bounds"},
+		{"x base.i32[-9..9]", "var y base.i32[-2..2] = in.x % -3", ""},
+		{"x base.i32[5..6]", "var y base.i32[1..2] = in.x % 4", ""},
+		{"x base.i32[5..6]", "var y base.i32[1..1] = in.x % 4", "not within bounds"},
+		{"x base.i32[-6..-5]", "var y base.i32[-2..-1] = in.x % 4", ""},
+		{"x base.u32[4..5]", "var y base.u32[6..7] = in.x ^ 2", ""},
+		{"x base.u32[4..5]", "var y base.u32[..6] = in.x ^ 2", "not within bounds"},
+		{"x base.i32[-9..9]", "var y base.i32[-9..3] = in.x.min(x:3)", ""},
+		{"x base.i32[-9..9]", "var y base.i32[3..9] = in.x.max(x:3)", ""},
+		{"x base.i32[-9..9]", "var y base.i32[-3..2] = in.x >> 2", ""},
+		{"x base.i32[-9..9]", "var y base.i32 = in.x << 2", "possibly negative"},
+		{"x base.i64", "var y base.u64 = in.x as base.u64", "not within bounds"},
+		{"x base.i64[0..100]", "var y base.u8 = in.x as base.u8", ""},
+		{"x base.u8", "var y base.i8 = in.x as base.i8", "not within bounds"},
+	}
+
+	for _, tc := range testCases {
+		src := "packageid \"test\"\npri func foo(" + tc.args + ")() {\n\t" + tc.body + "\n}\n"
+		tm := &t.Map{}
+		tokens, _, err := t.Tokenize(tm, filename, []byte(src))
+		if err != nil {
+			tt.Fatalf("%q: Tokenize: %v", tc.body, err)
+		}
+		file, err := parse.Parse(tm, filename, tokens, nil)
+		if err != nil {
+			tt.Fatalf("%q: Parse: %v", tc.body, err)
+		}
+		_, err = Check(tm, []*a.File{file}, nil, nil)
+		if tc.wantErr == "" {
+			if err != nil {
+				tt.Errorf("%q: got %v, want no error", tc.body, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			tt.Errorf("%q: got %v, want an error containing %q", tc.body, err, tc.wantErr)
+		}
+	}
+}
+
+func TestTildeOperators(tt *testing.T) {
+	const filename = "test.wuffs"
+	testCases := []struct {
+		args    string
+		body    string
+		wantErr string
+	}{
+		{"x base.u8", "var y base.u8 = in.x * in.x", "not within bounds"},
+		{"x base.u8", "var y base.u8 = in.x ~mod* in.x", ""},
+		{"x base.u16", "var y base.u16 = in.x\n\ty ~mod*= 0x9E37", ""},
+		{"x base.i8", "var y base.i8 = in.x ~mod* in.x", "unsigned integer"},
+		{"", "var y base.u8 = 3 ~mod* 5", "non-ideal"},
+		{"x base.u8[200..]", "var y base.u8 = in.x ~mod<< 1", ""},
+		{"x base.u8[200..]", "var y base.u8[..127] = in.x ~mod<< 1", "not within bounds"},
+		{"x base.u8", "var y base.u8 = in.x ~mod<< 8", "out of range"},
+		{"x base.i16", "var y base.i16 = in.x\n\ty ~mod<<= 1", "unsigned integer"},
+		{"x base.u8[..100]", "var y base.u8[200..] = in.x ~sat+ 200", ""},
+		{"x base.u8[..100]", "var y base.u8[..254] = in.x ~sat+ 200", "not within bounds"},
+		{"x base.u8[..100]", "var y base.u8[..0] = in.x ~sat- 100", ""},
+	}
+
+	for _, tc := range testCases {
+		src := "packageid \"test\"\npri func foo(" + tc.args + ")() {\n\t" + tc.body + "\n}\n"
+		tm := &t.Map{}
+		tokens, _, err := t.Tokenize(tm, filename, []byte(src))
+		if err != nil {
+			tt.Fatalf("%q: Tokenize: %v", tc.body, err)
+		}
+		file, err := parse.Parse(tm, filename, tokens, nil)
+		if err != nil {
+			tt.Fatalf("%q: Parse: %v", tc.body, err)
+		}
+		_, err = Check(tm, []*a.File{file}, nil, nil)
+		if tc.wantErr == "" {
+			if err != nil {
+				tt.Errorf("%q: got %v, want no error", tc.body, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			tt.Errorf("%q: got %v, want an error containing %q", tc.body, err, tc.wantErr)
+		}
+	}
+}
+
+func TestFuncDepth(tt *testing.T) {
+	const filename = "test.wuffs"
+	testCases := []struct {
+		funcs   string
+		wantErr string
+	}{
+		{"pri func s.f?()(), depth 4 {\n\tthis.f?()\n}\n", ""},
+		{"pri func s.f?()() {\n\tthis.f?()\n}\n", "is recursive but does not declare a depth"},
+		{"pri func s.f?()(), depth 4 {\n}\n", "declares a depth but is not recursive"},
+		{"pri func s.f!()(), depth 4 {\n}\n", "depth given for a non-suspendible func"},
+		{"pri func s.f?()(), depth 0 {\n\tthis.f?()\n}\n", "out of range"},
+		{"pri func s.f?()(), depth 4 {\n\tthis.g?()\n}\n" +
+			"pri func s.g?()(), depth 2 {\n\tthis.f?()\n}\n", ""},
+		{"pri func s.f?()(), depth 4 {\n\tthis.g?()\n}\n" +
+			"pri func s.g?()() {\n\tthis.f?()\n}\n", "func s.g is recursive"},
+		{"pri func s.f?()(), depth 2 * 4 {\n\tthis.f?()\n}\n", ""},
+	}
+
+	for _, tc := range testCases {
+		src := "packageid \"test\"\npri struct s?()\n" + tc.funcs
+		tm := &t.Map{}
+		tokens, _, err := t.Tokenize(tm, filename, []byte(src))
+		if err != nil {
+			tt.Fatalf("%q: Tokenize: %v", tc.funcs, err)
+		}
+		file, err := parse.Parse(tm, filename, tokens, nil)
+		if err != nil {
+			tt.Fatalf("%q: Parse: %v", tc.funcs, err)
+		}
+		_, err = Check(tm, []*a.File{file}, nil, nil)
+		if tc.wantErr == "" {
+			if err != nil {
+				tt.Errorf("%q: got %v, want no error", tc.funcs, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			tt.Errorf("%q: got %v, want an error containing %q", tc.funcs, err, tc.wantErr)
+		}
+	}
+}
+
+func TestLemmas(tt *testing.T) {
+	const filename = "test.wuffs"
+	const ltTrans = "pri lemma lt_trans(a base.u32, b base.u32, c base.u32),\n" +
+		"\tpre a < c,\n\tpre c <= b,\n\tpost a < b,\n{\n" +
+		"\tassert a < b via \"a < b: a < c; c <= b\"(c:c)\n}\n"
+	// min_lt's conditions mention params inside a call's args.
+	const minLt = "pri lemma min_lt(a base.u32, b base.u32, c base.u32),\n" +
+		"\tpre c > a.min(x:b),\n\tpost a.min(x:b) < c,\n{\n}\n"
+	testCases := []struct {
+		decls   string
+		wantErr string
+	}{
+		{ltTrans + "pri func s.f!(x base.u32, y base.u32, z base.u32)() {\n" +
+			"\tif (in.x < in.z) and (in.z <= in.y) {\n\t\tassert in.x < in.y via lt_trans(c:in.z)\n\t}\n}\n", ""},
+		{ltTrans + "pri func s.f!(x base.u32, y base.u32, z base.u32)() {\n" +
+			"\tassert in.x < in.y via lt_trans(c:in.z)\n}\n", `cannot prove "in.x < in.z"`},
+		{ltTrans + "pri func s.f!(x base.u32, y base.u32, z base.u32)() {\n" +
+			"\tif (in.x < in.z) and (in.z <= in.y) {\n\t\tassert in.x <= in.y via lt_trans(c:in.z)\n\t}\n}\n",
+			"does not match a post-condition"},
+		{ltTrans + "pri func s.f!(x base.u32, y base.u32, z base.u32)() {\n" +
+			"\tif (in.x < in.z) and (in.z <= in.y) {\n\t\tassert in.x < in.y via lt_trans()\n\t}\n}\n",
+			`param "c" is not given`},
+		{ltTrans + "pri func s.f!(x base.u64, y base.u64, z base.u64)() {\n" +
+			"\tif (in.x < in.z) and (in.z <= in.y) {\n\t\tassert in.x < in.y via lt_trans(c:in.z)\n\t}\n}\n",
+			"is not within bounds"},
+		{ltTrans + "pri lemma lt_trans2(p base.u32, q base.u32, r base.u32),\n" +
+			"\tpre p < r,\n\tpre r <= q,\n\tpost p < q,\n{\n\tassert p < q via lt_trans(c:r)\n}\n", ""},
+		{"pri lemma bad(a base.u32, b base.u32),\n\tpre a < b,\n\tpost b < a,\n{\n}\n",
+			`cannot prove "b < a"`},
+		{"pri lemma cyc(a base.u32, b base.u32, c base.u32),\n\tpre a < c,\n\tpre c < b,\n\tpost a < b,\n{\n" +
+			"\tassert a < b via cyc(c:c)\n}\n", "cites itself"},
+		{"pri lemma none(a base.u32),\n\tpre a < 4,\n{\n}\n", "has no post-condition"},
+		{"pri lemma body(a base.u32),\n\tpost a >= 0,\n{\n\tvar x base.u32\n}\n",
+			"can only contain assert statements"},
+		{ltTrans + ltTrans, "duplicate lemma lt_trans"},
+		{minLt + "pri func s.f!(x base.u32, y base.u32, z base.u32)() {\n" +
+			"\tif in.z > in.x.min(x:in.y) {\n\t\tassert in.x.min(x:in.y) < in.z via min_lt()\n\t}\n}\n", ""},
+		{minLt + "pri func s.f!(x base.u32, y base.u32, z base.u32)() {\n" +
+			"\tif in.z > in.x.min(x:in.y) {\n\t\tassert in.x.min(x:in.z) < in.z via min_lt()\n\t}\n}\n",
+			`cannot prove "in.z > in.x.min(x:in.z)"`},
+	}
+
+	for _, tc := range testCases {
+		src := "packageid \"test\"\npri struct s()\n" + tc.decls
+		tm := &t.Map{}
+		tokens, _, err := t.Tokenize(tm, filename, []byte(src))
+		if err != nil {
+			tt.Fatalf("%q: Tokenize: %v", tc.decls, err)
+		}
+		file, err := parse.Parse(tm, filename, tokens, nil)
+		if err != nil {
+			tt.Fatalf("%q: Parse: %v", tc.decls, err)
+		}
+		_, err = Check(tm, []*a.File{file}, nil, nil)
+		if tc.wantErr == "" {
+			if err != nil {
+				tt.Errorf("%q: got %v, want no error", tc.decls, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			tt.Errorf("%q: got %v, want an error containing %q", tc.decls, err, tc.wantErr)
+		}
+	}
+}
+
+func TestLinearArithmetic(tt *testing.T) {
+	const filename = "test.wuffs"
+	testCases := []struct {
+		body    string
+		wantErr string
+	}{
+		{"if (in.x < in.y) and (in.y <= in.z) {\n\tassert in.x < in.z\n}\n", ""},
+		{"assert in.x < in.z\n", `cannot prove "in.x < in.z"`},
+		{"if (in.x < in.y) and (in.y < in.z) {\n\tassert (in.x + 2) <= in.z\n}\n", ""},
+		{"if (in.x < in.y) and (in.y < in.z) {\n\tassert (in.x + 3) <= in.z\n}\n", "cannot prove"},
+		{"if (in.x + in.y) < 10 {\n\tassert in.x < 10\n}\n", ""},
+		{"if (in.x <= in.y) and (in.y <= in.x) {\n\tassert in.x == in.y\n}\n", ""},
+		{"if in.x < in.y {\n\tassert in.x != in.y\n}\n", ""},
+		{"if (in.x * in.y) < in.z {\n\tassert (in.x * in.y) <= in.z\n}\n", ""},
+	}
+
+	for _, tc := range testCases {
+		src := "packageid \"test\"\npri struct s()\n" +
+			"pri func s.f!(x base.u32[..100], y base.u32[..100], z base.u32[..100])() {\n" +
+			tc.body + "}\n"
+		tm := &t.Map{}
+		tokens, _, err := t.Tokenize(tm, filename, []byte(src))
+		if err != nil {
+			tt.Fatalf("%q: Tokenize: %v", tc.body, err)
+		}
+		file, err := parse.Parse(tm, filename, tokens, nil)
+		if err != nil {
+			tt.Fatalf("%q: Parse: %v", tc.body, err)
+		}
+		_, err = Check(tm, []*a.File{file}, nil, nil)
+		if tc.wantErr == "" {
+			if err != nil {
+				tt.Errorf("%q: got %v, want no error", tc.body, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			tt.Errorf("%q: got %v, want an error containing %q", tc.body, err, tc.wantErr)
+		}
+	}
+}
+
+func TestInferInvariants(tt *testing.T) {
+	const filename = "test.wuffs"
+	testCases := []struct {
+		body string
+		// want is the inferred conditions, other than those written
+		// explicitly, joined by "; ".
+		want string
+		// needed is whether the body fails to check without inference.
+		needed bool
+		// unsound is whether the body fails to check even with inference,
+		// as the assertions after the loop don't actually hold.
+		unsound bool
+	}{{
+		"var i base.u32\nwhile i < 10 {\n\ti += 1\n}\nassert i <= 10\n",
+		"i <= 10",
+		true,
+		false,
+	}, {
+		"var i base.u32\nwhile i < 10,\n\tinv i <= 10,\n{\n\ti += 1\n}\nassert i <= 10\n",
+		"",
+		false,
+		false,
+	}, {
+		"var i base.u32\nvar j base.u32\nwhile i < 16 {\n\tj = i\n\ti += 1\n}\nassert j < 16\n",
+		"j <= 15; i <= 16",
+		true,
+		false,
+	}, {
+		// The while true loop's body can only overflow i without an inv.
+		"var i base.u32\nwhile true {\n\ti += 1\n\tif i >= 5 {\n\t\tbreak\n\t}\n}\nassert i <= 5\n",
+		"i <= 5",
+		true,
+		false,
+	}, {
+		"var i base.u32 = 3\nwhile i < in.x {\n\tif (i & 1) == 0 {\n\t\ti += 2\n\t} else {\n\t\ti += 1\n\t}\n}\n",
+		"i >= 3; i <= 101",
+		true,
+		false,
+	}, {
+		// Variables declared inside the loop don't get suggestions.
+		"var i base.u32\nwhile i < 10 {\n\tvar j base.u32[..10] = i + 1\n\ti = j\n}\n",
+		"i <= 10",
+		false,
+		false,
+	}, {
+		// in.x is assigned in the loop, so its bounds on entry don't bound i.
+		"if in.x > 10 {\n\treturn\n}\nvar i base.u32\nwhile i < in.x {\n\tin.x = 100\n\ti += 1\n}\nassert i <= 10\n",
+		"",
+		true,
+		true,
+	}}
+
+	for _, tc := range testCases {
+		src := "packageid \"test\"\npri struct s()\n" +
+			"pri func s.f!(x base.u32[..100])() {\n" + tc.body + "}\n"
+		for _, infer := range []bool{false, true} {
+			tm := &t.Map{}
+			tokens, _, err := t.Tokenize(tm, filename, []byte(src))
+			if err != nil {
+				tt.Fatalf("%q: Tokenize: %v", tc.body, err)
+			}
+			file, err := parse.Parse(tm, filename, tokens, nil)
+			if err != nil {
+				tt.Fatalf("%q: Parse: %v", tc.body, err)
+			}
+			c, err := Check(tm, []*a.File{file}, nil, &Options{InferInvariants: infer})
+			if !infer {
+				if gotNeeded := err != nil; gotNeeded != tc.needed {
+					tt.Errorf("%q: without inference: got %v, want error: %t", tc.body, err, tc.needed)
+				}
+				continue
+			}
+			if gotUnsound := err != nil; gotUnsound != tc.unsound {
+				tt.Errorf("%q: with inference: got %v, want error: %t", tc.body, err, tc.unsound)
+				continue
+			} else if gotUnsound {
+				continue
+			}
+			got := []string(nil)
+			for _, x := range c.InferredInvariants() {
+				for _, o := range x.Conditions {
+					got = append(got, o.Str(tm))
+				}
+			}
+			if g := strings.Join(got, "; "); g != tc.want {
+				tt.Errorf("%q: got %q, want %q", tc.body, g, tc.want)
+			}
+		}
+	}
+}
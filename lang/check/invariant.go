@@ -0,0 +1,705 @@
+// Copyright 2018 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package check
+
+import (
+	"math/big"
+
+	"github.com/google/wuffs/lang/interval"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// InferredInvariant is the inv conditions inferred for a while loop, when
+// checking with Options.InferInvariants.
+type InferredInvariant struct {
+	While      *a.While
+	Conditions []*a.Expr
+}
+
+// InferredInvariants returns the inv conditions inferred for each while loop,
+// other than those already written explicitly, in the order that the loops
+// were checked. It is empty unless Options.InferInvariants was set.
+func (c *Checker) InferredInvariants() []InferredInvariant { return c.inferredInvariants }
+
+const (
+	// invWidenAfter is the number of times that a loop's body is analyzed
+	// before its variables' growing bounds are widened to their types'
+	// bounds.
+	invWidenAfter = 3
+
+	// invNarrowings is the maximum number of times that a loop's body is
+	// re-analyzed, after widening, to tighten its variables' bounds.
+	invNarrowings = 3
+
+	// invMaxIterations bounds the analysis of a single loop. Widening
+	// guarantees termination well before this, but it's cheap insurance.
+	invMaxIterations = 100
+)
+
+// inferInvariants returns inv conditions for the while loop n: bounds on the
+// numeric local variables that n assigns to, holding whenever the loop's
+// condition is evaluated and after any break.
+//
+// The inference is an abstract interpretation of n over intervals: the loop
+// body's effect on each variable is applied repeatedly, starting from the
+// variable's bounds on entry, until the bounds stop growing. Bounds that are
+// still growing after a few iterations are widened to the type's bounds, and
+// then narrowed by re-applying the body's effect.
+//
+// The arithmetic assumes that nothing overflows, which is sound since the
+// checker separately proves that, for each iteration, assuming the inferred
+// conditions at the start of that iteration. The checker also proves the
+// inferred conditions themselves, just like explicit inv conditions.
+func (q *checker) inferInvariants(n *a.While) []*a.Expr {
+	z := &inferrer{
+		q:        q,
+		tracked:  map[t.ID]interval.IntRange{},
+		declared: map[t.ID]bool{},
+		jumps:    map[a.Loop]*invJumps{},
+		fixed:    map[string]interval.IntRange{},
+		inFields: map[t.ID]bool{},
+	}
+	z.collect(n.Body())
+	if len(z.order) == 0 {
+		return nil
+	}
+
+	entry := invEnv{}
+	for _, id := range z.order {
+		entry[id] = z.fixedBounds(z.makeIdent(id))
+	}
+	head, brk, _, ok := z.fixpoint(n, entry)
+	if !ok {
+		return nil
+	}
+	inv := head.unite(brk)
+	if inv == nil {
+		return nil
+	}
+
+	ret := []*a.Expr(nil)
+	for _, id := range z.order {
+		if z.declared[id] {
+			continue
+		}
+		r, tb := inv[id], z.tracked[id]
+		if r.Empty() || r[0] == nil || r[1] == nil {
+			continue
+		}
+		lo, hi := r[0].Cmp(tb[0]) > 0, r[1].Cmp(tb[1]) < 0
+		if lo && hi && r[0].Cmp(r[1]) == 0 {
+			ret = z.appendCondition(ret, id, t.IDXBinaryEqEq, r[0])
+			continue
+		}
+		if lo {
+			ret = z.appendCondition(ret, id, t.IDXBinaryGreaterEq, r[0])
+		}
+		if hi {
+			ret = z.appendCondition(ret, id, t.IDXBinaryLessEq, r[1])
+		}
+	}
+	return ret
+}
+
+// invEnv maps each tracked variable to its possible values. A nil invEnv
+// means an unreachable program point.
+type invEnv map[t.ID]interval.IntRange
+
+func (x invEnv) clone() invEnv {
+	ret := make(invEnv, len(x))
+	for id, r := range x {
+		ret[id] = r
+	}
+	return ret
+}
+
+// with returns a copy of x with id's values replaced by r. An empty r means
+// that the program point is unreachable.
+func (x invEnv) with(id t.ID, r interval.IntRange) invEnv {
+	if x == nil || r.Empty() {
+		return nil
+	}
+	ret := x.clone()
+	ret[id] = r
+	return ret
+}
+
+func (x invEnv) unite(y invEnv) invEnv {
+	if x == nil {
+		return y
+	}
+	if y == nil {
+		return x
+	}
+	ret := make(invEnv, len(x))
+	for id, r := range x {
+		ret[id] = r.Unite(y[id])
+	}
+	return ret
+}
+
+// within returns whether x's values are a subset of y's.
+func (x invEnv) within(y invEnv) bool {
+	if x == nil {
+		return true
+	}
+	if y == nil {
+		return false
+	}
+	for id, r := range x {
+		if !r.Unite(y[id]).Eq(y[id]) {
+			return false
+		}
+	}
+	return true
+}
+
+// invJumps accumulates the variables' values at the continue and break
+// statements of a loop being analyzed.
+type invJumps struct {
+	cont invEnv
+	brk  invEnv
+}
+
+type inferrer struct {
+	q *checker
+
+	// tracked maps the variables assigned to in the loop to their types'
+	// bounds. order lists the same variables, in order of first assignment.
+	tracked map[t.ID]interval.IntRange
+	order   []t.ID
+
+	// declared are the variables declared inside the loop. Their values on
+	// entry to the loop are irrelevant, so they aren't worth suggesting
+	// conditions for.
+	declared map[t.ID]bool
+
+	jumps map[a.Loop]*invJumps
+
+	// fixed caches the bounds of expressions that are constant throughout the
+	// loop, keyed by their string form.
+	fixed map[string]interval.IntRange
+
+	// inFields are the "in.foo" arguments assigned to in the loop, and
+	// yields is whether the loop can yield, after which every argument can
+	// have a new value. Otherwise, the arguments are constant throughout the
+	// loop.
+	inFields map[t.ID]bool
+	yields   bool
+}
+
+func (z *inferrer) collect(block []*a.Node) {
+	for _, o := range block {
+		switch o.Kind() {
+		case a.KAssign:
+			o := o.AsAssign()
+			if o.Destructuring() {
+				for _, p := range o.LHSList() {
+					z.track(p.AsExpr())
+				}
+			} else {
+				z.track(o.LHS())
+			}
+		case a.KIf:
+			for o := o.AsIf(); o != nil; o = o.ElseIf() {
+				z.collect(o.BodyIfTrue())
+				z.collect(o.BodyIfFalse())
+			}
+		case a.KIOBind:
+			z.collect(o.AsIOBind().Body())
+		case a.KIterate:
+			for o := o.AsIterate(); o != nil; o = o.ElseIterate() {
+				z.collect(o.Body())
+			}
+		case a.KRet:
+			if o.AsRet().Keyword() == t.IDYield {
+				z.yields = true
+			}
+		case a.KVar:
+			if z.declared != nil {
+				z.declared[o.AsVar().Name()] = true
+			}
+			z.trackID(o.AsVar().Name())
+		case a.KWhile:
+			z.collect(o.AsWhile().Body())
+		}
+	}
+}
+
+func (z *inferrer) track(n *a.Expr) {
+	if n == nil {
+		return
+	}
+	switch n.Operator() {
+	case 0:
+		z.trackID(n.Ident())
+	case t.IDDot:
+		if lhs := n.LHS().AsExpr(); lhs.Operator() == 0 && lhs.Ident() == t.IDIn && z.inFields != nil {
+			z.inFields[n.Ident()] = true
+		}
+	}
+}
+
+func (z *inferrer) trackID(id t.ID) {
+	if _, ok := z.tracked[id]; ok {
+		return
+	}
+	typ := z.q.localVars[id]
+	if typ == nil || !typ.IsNumType() {
+		return
+	}
+	tb := z.typeBounds(typ)
+	if tb[0] == nil || tb[1] == nil {
+		return
+	}
+	z.tracked[id] = tb
+	z.order = append(z.order, id)
+}
+
+// fixpoint analyzes the while loop n, given the variables' values on entry.
+// It returns their values whenever n's condition is evaluated (head), at any
+// break statement (brk) and after n (exit). ok is false if the analysis gave
+// up.
+func (z *inferrer) fixpoint(n *a.While, entry invEnv) (head invEnv, brk invEnv, exit invEnv, ok bool) {
+	js := &invJumps{}
+	z.jumps[n] = js
+	defer delete(z.jumps, n)
+
+	step := func(head invEnv) invEnv {
+		*js = invJumps{}
+		body := z.exec(z.refine(head, n.Condition()), n.Body())
+		return entry.unite(body).unite(js.cont)
+	}
+
+	head = entry
+	for i := 0; ; i++ {
+		if i == invMaxIterations {
+			return nil, nil, nil, false
+		}
+		next := step(head)
+		if next.within(head) {
+			break
+		}
+		if i >= invWidenAfter {
+			next = z.widen(head, next)
+		}
+		head = next
+	}
+
+	for i := 0; i < invNarrowings; i++ {
+		next := step(head)
+		if head.within(next) || !step(next).within(next) {
+			break
+		}
+		head = next
+	}
+
+	step(head)
+	exit = head
+	if inverse, err := invert(z.q.tm, n.Condition()); err == nil {
+		exit = z.refine(head, inverse)
+	} else if cv := n.Condition().ConstValue(); cv != nil && cv.Sign() != 0 {
+		exit = nil
+	}
+	return head, js.brk, exit.unite(js.brk), true
+}
+
+// widen returns next, except that any bounds that have grown since prev are
+// widened to their types' bounds.
+func (z *inferrer) widen(prev invEnv, next invEnv) invEnv {
+	if prev == nil || next == nil {
+		return next
+	}
+	ret := make(invEnv, len(next))
+	for id, r := range next {
+		p, tb := prev[id], z.tracked[id]
+		if r[0].Cmp(p[0]) < 0 {
+			r[0] = tb[0]
+		}
+		if r[1].Cmp(p[1]) > 0 {
+			r[1] = tb[1]
+		}
+		ret[id] = r
+	}
+	return ret
+}
+
+func (z *inferrer) exec(env invEnv, block []*a.Node) invEnv {
+	for _, o := range block {
+		if env == nil {
+			break
+		}
+		env = z.execStatement(env, o)
+	}
+	return env
+}
+
+func (z *inferrer) execStatement(env invEnv, n *a.Node) invEnv {
+	switch n.Kind() {
+	case a.KAssert:
+		return z.refine(env, n.AsAssert().Condition())
+
+	case a.KAssign:
+		n := n.AsAssign()
+		if n.Destructuring() {
+			for _, o := range n.LHSList() {
+				if o := o.AsExpr(); o.Operator() == 0 {
+					if tb, ok := z.tracked[o.Ident()]; ok {
+						env = env.with(o.Ident(), tb)
+					}
+				}
+			}
+			return env
+		}
+		lhs := n.LHS()
+		if lhs.Operator() != 0 {
+			return env
+		}
+		tb, ok := z.tracked[lhs.Ident()]
+		if !ok {
+			return env
+		}
+		r := tb
+		if n.Operator() == t.IDEq {
+			r = z.eval(env, n.RHS())
+		} else if op := n.Operator().BinaryForm(); op != 0 {
+			r = evalBinaryOp(op, env[lhs.Ident()], z.eval(env, n.RHS()))
+		}
+		return env.with(lhs.Ident(), r.Intersect(tb))
+
+	case a.KIf:
+		return z.execIf(env, n.AsIf())
+
+	case a.KIOBind:
+		return z.exec(env, n.AsIOBind().Body())
+
+	case a.KIterate:
+		// Rather than find a fixed point for the iterate loop, assume the
+		// worst for the variables that it assigns to.
+		for o := n.AsIterate(); o != nil; o = o.ElseIterate() {
+			env = z.havoc(env, o.Body())
+		}
+		for o := n.AsIterate(); o != nil; o = o.ElseIterate() {
+			z.exec(env, o.Body())
+		}
+		return env
+
+	case a.KJump:
+		n := n.AsJump()
+		if js := z.jumps[n.JumpTarget()]; js != nil {
+			if n.Keyword() == t.IDBreak {
+				js.brk = js.brk.unite(env)
+			} else {
+				js.cont = js.cont.unite(env)
+			}
+		}
+		return nil
+
+	case a.KRet:
+		if n.AsRet().Keyword() == t.IDReturn {
+			return nil
+		}
+		// A yield statement resumes with the local variables unchanged.
+		return env
+
+	case a.KVar:
+		n := n.AsVar()
+		tb, ok := z.tracked[n.Name()]
+		if !ok {
+			return env
+		}
+		r := interval.IntRange{zero, zero}
+		if v := n.Value(); v != nil {
+			r = z.eval(env, v)
+		}
+		return env.with(n.Name(), r.Intersect(tb))
+
+	case a.KWhile:
+		n := n.AsWhile()
+		if _, _, exit, ok := z.fixpoint(n, env); ok {
+			return exit
+		}
+		env = z.havoc(env, n.Body())
+		z.exec(env, n.Body())
+		return env
+	}
+	return env
+}
+
+// havoc returns env, except that the variables assigned to in block can have
+// any value of their type. Executing block, any number of times, does not
+// escape the returned invEnv. Nonetheless, block should still be analyzed,
+// for any jumps to an enclosing loop.
+func (z *inferrer) havoc(env invEnv, block []*a.Node) invEnv {
+	sub := &inferrer{q: z.q, tracked: map[t.ID]interval.IntRange{}}
+	sub.collect(block)
+	for _, id := range sub.order {
+		if tb, ok := z.tracked[id]; ok {
+			env = env.with(id, tb)
+		}
+	}
+	return env
+}
+
+func (z *inferrer) execIf(env invEnv, n *a.If) invEnv {
+	ifTrue := z.exec(z.refine(env, n.Condition()), n.BodyIfTrue())
+	ifFalse := env
+	if inverse, err := invert(z.q.tm, n.Condition()); err == nil {
+		ifFalse = z.refine(env, inverse)
+	} else if cv := n.Condition().ConstValue(); cv != nil && cv.Sign() != 0 {
+		ifFalse = nil
+	}
+	if o := n.ElseIf(); o != nil {
+		ifFalse = z.execIf(ifFalse, o)
+	} else {
+		ifFalse = z.exec(ifFalse, n.BodyIfFalse())
+	}
+	return ifTrue.unite(ifFalse)
+}
+
+// refine returns env, restricted to where the condition n is true.
+func (z *inferrer) refine(env invEnv, n *a.Expr) invEnv {
+	if env == nil {
+		return nil
+	}
+	if cv := n.ConstValue(); cv != nil {
+		if cv.Sign() == 0 {
+			return nil
+		}
+		return env
+	}
+
+	switch op := n.Operator(); op {
+	case t.IDXUnaryNot:
+		// invert returns another "not" if it can't push the negation inwards.
+		if inverse, err := invert(z.q.tm, n.RHS().AsExpr()); err == nil && inverse.Operator() != t.IDXUnaryNot {
+			return z.refine(env, inverse)
+		}
+
+	case t.IDXBinaryAnd:
+		return z.refine(z.refine(env, n.LHS().AsExpr()), n.RHS().AsExpr())
+
+	case t.IDXBinaryOr:
+		return z.refine(env, n.LHS().AsExpr()).unite(z.refine(env, n.RHS().AsExpr()))
+
+	case t.IDXAssociativeAnd:
+		for _, o := range n.Args() {
+			env = z.refine(env, o.AsExpr())
+		}
+		return env
+
+	case t.IDXAssociativeOr:
+		ret := invEnv(nil)
+		for _, o := range n.Args() {
+			ret = ret.unite(z.refine(env, o.AsExpr()))
+		}
+		return ret
+
+	case t.IDXBinaryNotEq, t.IDXBinaryLessThan, t.IDXBinaryLessEq,
+		t.IDXBinaryEqEq, t.IDXBinaryGreaterEq, t.IDXBinaryGreaterThan:
+		lhs, rhs := n.LHS().AsExpr(), n.RHS().AsExpr()
+		env = z.refineComparison(env, op, lhs, rhs)
+		return z.refineComparison(env, swapComparison(op), rhs, lhs)
+	}
+	return env
+}
+
+// refineComparison returns env, restricted to where "x op y" is true, if x is
+// a tracked variable.
+func (z *inferrer) refineComparison(env invEnv, op t.ID, x *a.Expr, y *a.Expr) invEnv {
+	if env == nil || x.Operator() != 0 {
+		return env
+	}
+	xr, ok := env[x.Ident()]
+	if !ok {
+		return env
+	}
+	yr := z.eval(env, y)
+
+	allowed := interval.IntRange{}
+	switch op {
+	case t.IDXBinaryNotEq:
+		if yr[0] == nil || yr[1] == nil || yr[0].Cmp(yr[1]) != 0 {
+			return env
+		}
+		if xr[0] != nil && xr[0].Cmp(yr[0]) == 0 {
+			allowed[0] = add1(xr[0])
+		} else if xr[1] != nil && xr[1].Cmp(yr[1]) == 0 {
+			allowed[1] = sub1(xr[1])
+		}
+	case t.IDXBinaryLessThan:
+		if yr[1] != nil {
+			allowed[1] = sub1(yr[1])
+		}
+	case t.IDXBinaryLessEq:
+		allowed[1] = yr[1]
+	case t.IDXBinaryEqEq:
+		allowed = yr
+	case t.IDXBinaryGreaterEq:
+		allowed[0] = yr[0]
+	case t.IDXBinaryGreaterThan:
+		if yr[0] != nil {
+			allowed[0] = add1(yr[0])
+		}
+	}
+	return env.with(x.Ident(), xr.Intersect(allowed))
+}
+
+func swapComparison(op t.ID) t.ID {
+	switch op {
+	case t.IDXBinaryLessThan:
+		return t.IDXBinaryGreaterThan
+	case t.IDXBinaryLessEq:
+		return t.IDXBinaryGreaterEq
+	case t.IDXBinaryGreaterEq:
+		return t.IDXBinaryLessEq
+	case t.IDXBinaryGreaterThan:
+		return t.IDXBinaryLessThan
+	}
+	return op
+}
+
+// eval returns the possible values of n, given the tracked variables' values.
+func (z *inferrer) eval(env invEnv, n *a.Expr) interval.IntRange {
+	if cv := n.ConstValue(); cv != nil {
+		return interval.IntRange{cv, cv}
+	}
+	tb := z.typeBounds(n.MType())
+
+	r := tb
+	switch op := n.Operator(); op {
+	case 0:
+		if x, ok := env[n.Ident()]; ok {
+			r = x
+		} else {
+			r = z.fixedBounds(n)
+		}
+
+	case t.IDDot:
+		// "in.foo" is constant throughout the loop, unless assigned to.
+		if lhs := n.LHS().AsExpr(); lhs.Operator() == 0 && lhs.Ident() == t.IDIn &&
+			!z.yields && !z.inFields[n.Ident()] {
+			r = z.fixedBounds(n)
+		}
+
+	case t.IDXUnaryPlus:
+		r = z.eval(env, n.RHS().AsExpr())
+
+	case t.IDXUnaryMinus:
+		r = interval.IntRange{zero, zero}.Sub(z.eval(env, n.RHS().AsExpr()))
+
+	case t.IDXBinaryAs:
+		r = z.eval(env, n.LHS().AsExpr())
+
+	case t.IDXBinaryPlus, t.IDXBinaryMinus, t.IDXBinaryStar, t.IDXBinarySlash,
+		t.IDXBinaryPercent, t.IDXBinaryShiftL, t.IDXBinaryShiftR,
+		t.IDXBinaryAmp, t.IDXBinaryPipe, t.IDXBinaryHat:
+		r = evalBinaryOp(op, z.eval(env, n.LHS().AsExpr()), z.eval(env, n.RHS().AsExpr()))
+
+	case t.IDXAssociativePlus, t.IDXAssociativeStar,
+		t.IDXAssociativeAmp, t.IDXAssociativePipe, t.IDXAssociativeHat:
+		op = op.BinaryForm()
+		for i, o := range n.Args() {
+			if i == 0 {
+				r = z.eval(env, o.AsExpr())
+			} else {
+				r = evalBinaryOp(op, r, z.eval(env, o.AsExpr()))
+			}
+		}
+	}
+	return r.Intersect(tb)
+}
+
+func evalBinaryOp(op t.ID, x interval.IntRange, y interval.IntRange) interval.IntRange {
+	ok := true
+	switch op {
+	case t.IDXBinaryPlus:
+		return x.Add(y)
+	case t.IDXBinaryMinus:
+		return x.Sub(y)
+	case t.IDXBinaryStar:
+		return x.Mul(y)
+	case t.IDXBinarySlash:
+		x, ok = x.Quo(y)
+	case t.IDXBinaryPercent:
+		x, ok = x.Rem(y)
+	case t.IDXBinaryShiftL:
+		x, ok = x.Lsh(y)
+	case t.IDXBinaryShiftR:
+		x, ok = x.Rsh(y)
+	case t.IDXBinaryAmp:
+		x, ok = x.And(y)
+	case t.IDXBinaryPipe:
+		x, ok = x.Or(y)
+	case t.IDXBinaryHat:
+		x, ok = x.Xor(y)
+	default:
+		return interval.IntRange{}
+	}
+	if !ok {
+		return interval.IntRange{}
+	}
+	return x
+}
+
+// fixedBounds returns the bounds of n, an expression that is constant
+// throughout the loop, as implied by the facts on entry to the loop.
+func (z *inferrer) fixedBounds(n *a.Expr) interval.IntRange {
+	key := n.Str(z.q.tm)
+	if r, ok := z.fixed[key]; ok {
+		return r
+	}
+	r := z.typeBounds(n.MType())
+	if r[0] != nil && r[1] != nil {
+		if nb, err := z.q.facts.refine(n, a.Bounds(r), z.q.tm); err == nil {
+			r = interval.IntRange(nb)
+		}
+	}
+	z.fixed[key] = r
+	return r
+}
+
+// typeBounds returns typ's bounds, or unbounded if typ is not a numeric type.
+func (z *inferrer) typeBounds(typ *a.TypeExpr) interval.IntRange {
+	if typ == nil || !typ.IsNumType() {
+		return interval.IntRange{}
+	}
+	b, err := z.q.bcheckTypeExpr(typ)
+	if err != nil {
+		return interval.IntRange{}
+	}
+	return interval.IntRange(b)
+}
+
+func (z *inferrer) makeIdent(id t.ID) *a.Expr {
+	o := a.NewExpr(0, 0, 0, id, nil, nil, nil, nil)
+	o.SetMType(z.q.localVars[id])
+	return o
+}
+
+func (z *inferrer) appendCondition(conditions []*a.Expr, id t.ID, op t.ID, v *big.Int) []*a.Expr {
+	vID, err := z.q.tm.Insert(v.String())
+	if err != nil {
+		return conditions
+	}
+	rhs := a.NewExpr(0, 0, 0, vID, nil, nil, nil, nil)
+	rhs.SetConstValue(v)
+	rhs.SetMType(typeExprIdeal)
+	o := a.NewExpr(0, op, 0, 0, z.makeIdent(id).AsNode(), nil, rhs.AsNode(), nil)
+	o.SetMType(typeExprBool)
+	return append(conditions, o)
+}
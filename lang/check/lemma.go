@@ -0,0 +1,368 @@
+// Copyright 2018 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package check
+
+import (
+	"fmt"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// lemma is a user-written proof step. Like a built-in reason, an assert
+// statement can cite it with the "via" keyword.
+//
+// A lemma is proven at most once per package, either in its own checking
+// phase or, if cited by another lemma, on demand.
+type lemma struct {
+	n         *a.Lemma
+	localVars typeMap
+	state     lemmaState
+	err       error
+}
+
+type lemmaState uint8
+
+const (
+	lemmaUnproven = lemmaState(iota)
+	lemmaProving
+	lemmaProven
+	lemmaFailed
+)
+
+func (c *Checker) checkLemmaDecl(node *a.Node) error {
+	n := node.AsLemma()
+	name := n.QID()[1]
+	if other, ok := c.lemmas[name]; ok {
+		return &Error{
+			Err:           fmt.Errorf("check: duplicate lemma %s", name.Str(c.tm)),
+			Filename:      n.Filename(),
+			Line:          n.Line(),
+			OtherFilename: other.n.Filename(),
+			OtherLine:     other.n.Line(),
+		}
+	}
+
+	if err := c.checkFields(n.Params(), true, false); err != nil {
+		return fmt.Errorf("%v in params for lemma %s", err, name.Str(c.tm))
+	}
+	localVars := typeMap{}
+	for _, o := range n.Params() {
+		f := o.AsField()
+		if !f.XType().IsNumType() {
+			return fmt.Errorf("check: param %q, of type %q, for lemma %s does not have a numeric type",
+				f.Name().Str(c.tm), f.XType().Str(c.tm), name.Str(c.tm))
+		}
+		localVars[f.Name()] = f.XType()
+	}
+
+	q := &checker{
+		c:         c,
+		tm:        c.tm,
+		localVars: localVars,
+		errNode:   node,
+	}
+	nPosts := 0
+	for _, o := range n.Asserts() {
+		switch o.AsAssert().Keyword() {
+		case t.IDInv:
+			return fmt.Errorf("check: lemma %s cannot have an inv, only pre and post", name.Str(c.tm))
+		case t.IDPost:
+			nPosts++
+		}
+		if err := q.tcheckStatement(o); err != nil {
+			return q.newError(err)
+		}
+		if op := o.AsAssert().Condition().Operator(); !op.IsXBinaryOp() || !isComparison(op) {
+			return fmt.Errorf("check: lemma %s condition %q is not a comparison",
+				name.Str(c.tm), o.AsAssert().Condition().Str(c.tm))
+		}
+	}
+	if nPosts == 0 {
+		return fmt.Errorf("check: lemma %s has no post-condition", name.Str(c.tm))
+	}
+	for _, o := range n.Body() {
+		if o.Kind() != a.KAssert {
+			q.errNode = o
+			return q.newError(fmt.Errorf("check: lemma %s body can only contain assert statements",
+				name.Str(c.tm)))
+		}
+		if err := q.tcheckStatement(o); err != nil {
+			return q.newError(err)
+		}
+	}
+
+	if c.lemmas == nil {
+		c.lemmas = map[t.ID]*lemma{}
+	}
+	c.lemmas[name] = &lemma{
+		n:         n,
+		localVars: localVars,
+	}
+	setPlaceholderMBoundsMType(n.AsNode())
+	return nil
+}
+
+func (c *Checker) checkLemma(node *a.Node) error {
+	return c.proveLemma(c.lemmas[node.AsLemma().QID()[1]])
+}
+
+// proveLemma proves that l's pre-conditions and body imply its
+// post-conditions. The result is cached, so that l is proven only once.
+func (c *Checker) proveLemma(l *lemma) error {
+	if l.state != lemmaUnproven {
+		return l.err
+	}
+	l.state = lemmaProving
+
+	q := &checker{
+		c:         c,
+		tm:        c.tm,
+		reasonMap: c.reasonMap,
+		localVars: l.localVars,
+	}
+	l.err = q.proveLemma(l.n)
+	if l.err != nil {
+		l.state = lemmaFailed
+	} else {
+		l.state = lemmaProven
+	}
+	return l.err
+}
+
+func (q *checker) proveLemma(n *a.Lemma) error {
+	for _, o := range n.Asserts() {
+		if o.AsAssert().Keyword() != t.IDPre {
+			continue
+		}
+		q.errNode, q.errExpr = o, nil
+		condition := o.AsAssert().Condition()
+		if _, err := q.bcheckExpr(condition, 0); err != nil {
+			return q.newError(err)
+		}
+		q.facts.appendFact(condition)
+	}
+	for _, o := range n.Body() {
+		q.errNode, q.errExpr = o, nil
+		if err := q.bcheckAssert(o.AsAssert()); err != nil {
+			return q.newError(err)
+		}
+	}
+	for _, o := range n.Asserts() {
+		if o.AsAssert().Keyword() != t.IDPost {
+			continue
+		}
+		q.errNode, q.errExpr = o, nil
+		if err := q.bcheckAssert(o.AsAssert()); err != nil {
+			return q.newError(fmt.Errorf("%v in lemma %s", err, n.QID()[1].Str(q.tm)))
+		}
+	}
+	return nil
+}
+
+// citeLemma proves the assert statement n via the lemma l. The condition of n
+// must match one of l's post-conditions, binding l's params to expressions.
+// Any params not so bound must be given as n's args. Each of l's
+// pre-conditions, after substituting those expressions, must then be proven.
+func (q *checker) citeLemma(l *lemma, n *a.Assert) error {
+	name := l.n.QID()[1].Str(q.tm)
+	switch l.state {
+	case lemmaUnproven:
+		if err := q.c.proveLemma(l); err != nil {
+			return fmt.Errorf("cannot use lemma %s: it is not proven", name)
+		}
+	case lemmaProving:
+		return fmt.Errorf("lemma %s cites itself, directly or indirectly", name)
+	case lemmaFailed:
+		return fmt.Errorf("cannot use lemma %s: it is not proven", name)
+	}
+
+	params := map[t.ID]*a.TypeExpr{}
+	for _, o := range l.n.Params() {
+		params[o.AsField().Name()] = o.AsField().XType()
+	}
+
+	bindings := map[t.ID]*a.Expr(nil)
+	for _, o := range l.n.Asserts() {
+		if o.AsAssert().Keyword() != t.IDPost {
+			continue
+		}
+		b := map[t.ID]*a.Expr{}
+		if matchLemma(o.AsAssert().Condition(), n.Condition(), params, b) {
+			bindings = b
+			break
+		}
+	}
+	if bindings == nil {
+		return fmt.Errorf("it does not match a post-condition of lemma %s", name)
+	}
+
+	for _, o := range n.Args() {
+		arg := o.AsArg()
+		if _, ok := params[arg.Name()]; !ok {
+			return fmt.Errorf("lemma %s has no param named %q", name, arg.Name().Str(q.tm))
+		}
+		if x := bindings[arg.Name()]; x != nil && !x.Eq(arg.Value()) {
+			return fmt.Errorf("lemma %s param %q is given as %q but matched as %q",
+				name, arg.Name().Str(q.tm), arg.Value().Str(q.tm), x.Str(q.tm))
+		}
+		bindings[arg.Name()] = arg.Value()
+	}
+
+	for _, o := range l.n.Params() {
+		f := o.AsField()
+		x := bindings[f.Name()]
+		if x == nil {
+			return fmt.Errorf("lemma %s param %q is not given", name, f.Name().Str(q.tm))
+		}
+		// The lemma was only proven for values within its params' bounds.
+		xb, err := q.bcheckExpr(x, 0)
+		if err != nil {
+			return err
+		}
+		fb, err := q.bcheckTypeExpr(f.XType())
+		if err != nil {
+			return err
+		}
+		if xb[0].Cmp(fb[0]) < 0 || xb[1].Cmp(fb[1]) > 0 {
+			return fmt.Errorf("lemma %s param %q, %q with bounds %v, is not within bounds %v",
+				name, f.Name().Str(q.tm), x.Str(q.tm), xb, fb)
+		}
+	}
+
+	for _, o := range l.n.Asserts() {
+		if o.AsAssert().Keyword() != t.IDPre {
+			continue
+		}
+		op, lhs, rhs := parseBinaryOp(substituteLemma(o.AsAssert().Condition(), bindings))
+		if err := proveReasonRequirement(q, op, lhs, rhs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// matchLemma returns whether x matches the pattern, which is an expression
+// from a lemma. Each of the lemma's params matches any expression, but the
+// same param must always match equal expressions. The matches are recorded in
+// bindings.
+func matchLemma(pattern *a.Expr, x *a.Expr, params map[t.ID]*a.TypeExpr, bindings map[t.ID]*a.Expr) bool {
+	if pattern == nil || x == nil {
+		return pattern == x
+	}
+	if pattern.Operator() == 0 {
+		if _, ok := params[pattern.Ident()]; ok {
+			if b := bindings[pattern.Ident()]; b != nil {
+				return b.Eq(x)
+			}
+			bindings[pattern.Ident()] = x
+			return true
+		}
+	}
+	if pattern.ConstValue() != nil {
+		return x.ConstValue() != nil && pattern.ConstValue().Cmp(x.ConstValue()) == 0
+	}
+
+	if pattern.Operator() != x.Operator() || pattern.StatusQID() != x.StatusQID() {
+		return false
+	}
+	if !matchLemma(pattern.LHS().AsExpr(), x.LHS().AsExpr(), params, bindings) ||
+		!matchLemma(pattern.MHS().AsExpr(), x.MHS().AsExpr(), params, bindings) {
+		return false
+	}
+	if pattern.Operator() == t.IDXBinaryAs {
+		if !pattern.RHS().AsTypeExpr().Eq(x.RHS().AsTypeExpr()) {
+			return false
+		}
+	} else if !matchLemma(pattern.RHS().AsExpr(), x.RHS().AsExpr(), params, bindings) {
+		return false
+	}
+
+	if len(pattern.Args()) != len(x.Args()) {
+		return false
+	}
+	for i, o := range pattern.Args() {
+		xo := x.Args()[i]
+		if o.Kind() != xo.Kind() {
+			return false
+		}
+		switch o.Kind() {
+		case a.KArg:
+			// A call's "name:value" arg.
+			if o.AsArg().Name() != xo.AsArg().Name() ||
+				!matchLemma(o.AsArg().Value(), xo.AsArg().Value(), params, bindings) {
+				return false
+			}
+		case a.KExpr:
+			if !matchLemma(o.AsExpr(), xo.AsExpr(), params, bindings) {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// substituteLemma returns n, an expression from a lemma, after replacing each
+// of the lemma's params by its bound expression.
+func substituteLemma(n *a.Expr, bindings map[t.ID]*a.Expr) *a.Expr {
+	if n == nil {
+		return nil
+	}
+	if n.Operator() == 0 {
+		if x := bindings[n.Ident()]; x != nil {
+			return x
+		}
+		return n
+	}
+	if n.ConstValue() != nil {
+		return n
+	}
+
+	lhs := substituteLemma(n.LHS().AsExpr(), bindings)
+	mhs := substituteLemma(n.MHS().AsExpr(), bindings)
+	rhs := n.RHS()
+	if n.Operator() != t.IDXBinaryAs {
+		rhs = substituteLemma(rhs.AsExpr(), bindings).AsNode()
+	}
+	args := []*a.Node(nil)
+	if len(n.Args()) > 0 {
+		args = make([]*a.Node, len(n.Args()))
+		for i, o := range n.Args() {
+			switch o.Kind() {
+			case a.KArg:
+				o = a.NewArg(o.AsArg().Name(), substituteLemma(o.AsArg().Value(), bindings)).AsNode()
+			case a.KExpr:
+				o = substituteLemma(o.AsExpr(), bindings).AsNode()
+			}
+			args[i] = o
+		}
+	}
+
+	o := a.NewExpr(n.AsNode().AsRaw().Flags(), n.Operator(), n.StatusQID()[0], n.Ident(),
+		lhs.AsNode(), mhs.AsNode(), rhs, args)
+	o.SetMType(n.MType())
+	return o
+}
+
+func isComparison(op t.ID) bool {
+	switch op {
+	case t.IDXBinaryNotEq, t.IDXBinaryLessThan, t.IDXBinaryLessEq,
+		t.IDXBinaryEqEq, t.IDXBinaryGreaterEq, t.IDXBinaryGreaterThan:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,142 @@
+// Copyright 2018 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package check
+
+import (
+	"github.com/google/wuffs/lang/linear"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// proveLinear returns whether "lhs op rhs" follows from the known facts by
+// linear arithmetic. For example, "a < b" and "b <= c" imply "a < c".
+//
+// Sub-expressions that aren't linear, such as "x * y" or "f(x)", are treated
+// as opaque variables, bounded only by their types.
+func (q *checker) proveLinear(op t.ID, lhs *a.Expr, rhs *a.Expr) bool {
+	z := linearizer{}
+	s := &linear.System{}
+	for _, x := range q.facts {
+		factOp, factLHS, factRHS := parseBinaryOp(x)
+		if factOp == t.IDXBinaryNotEq || !isComparison(factOp) {
+			// "x != y" is not convex, so it can't be a linear constraint.
+			continue
+		}
+		addLinearConstraint(s, factOp, z.linearize(factLHS), z.linearize(factRHS))
+	}
+	l, r := z.linearize(lhs), z.linearize(rhs)
+
+	for i, o := range z.atoms {
+		typ := o.MType()
+		if typ == nil || !typ.IsNumType() {
+			continue
+		}
+		b, err := q.bcheckTypeExpr(typ)
+		if err != nil {
+			continue
+		}
+		v := linear.Term(one, linear.Var(i))
+		s.AddLessEq(linear.Const(b[0]), v)
+		s.AddLessEq(v, linear.Const(b[1]))
+	}
+
+	// Prove the claim by showing that its negation is infeasible.
+	switch op {
+	case t.IDXBinaryNotEq:
+		s.AddEq(l, r)
+	case t.IDXBinaryLessThan:
+		s.AddLessEq(r, l)
+	case t.IDXBinaryLessEq:
+		s.AddLessThan(r, l)
+	case t.IDXBinaryEqEq:
+		// The negation, "lhs < rhs or lhs > rhs", is a disjunction, so check
+		// each half separately.
+		s0 := s.Clone()
+		s0.AddLessThan(l, r)
+		if !s0.Infeasible() {
+			return false
+		}
+		s.AddLessThan(r, l)
+	case t.IDXBinaryGreaterEq:
+		s.AddLessThan(l, r)
+	case t.IDXBinaryGreaterThan:
+		s.AddLessEq(l, r)
+	default:
+		return false
+	}
+	return s.Infeasible()
+}
+
+func addLinearConstraint(s *linear.System, op t.ID, l linear.Expr, r linear.Expr) {
+	switch op {
+	case t.IDXBinaryLessThan:
+		s.AddLessThan(l, r)
+	case t.IDXBinaryLessEq:
+		s.AddLessEq(l, r)
+	case t.IDXBinaryEqEq:
+		s.AddEq(l, r)
+	case t.IDXBinaryGreaterEq:
+		s.AddLessEq(r, l)
+	case t.IDXBinaryGreaterThan:
+		s.AddLessThan(r, l)
+	}
+}
+
+// linearizer converts expressions to linear expressions. Each distinct
+// non-linear sub-expression becomes a linear.Var, indexing the atoms slice.
+type linearizer struct {
+	atoms []*a.Expr
+}
+
+func (z *linearizer) linearize(n *a.Expr) linear.Expr {
+	if cv := n.ConstValue(); cv != nil {
+		return linear.Const(cv)
+	}
+	switch n.Operator() {
+	case t.IDXUnaryPlus:
+		return z.linearize(n.RHS().AsExpr())
+	case t.IDXUnaryMinus:
+		return z.linearize(n.RHS().AsExpr()).Mul(minusOne)
+	case t.IDXBinaryPlus:
+		return z.linearize(n.LHS().AsExpr()).Add(z.linearize(n.RHS().AsExpr()))
+	case t.IDXBinaryMinus:
+		return z.linearize(n.LHS().AsExpr()).Sub(z.linearize(n.RHS().AsExpr()))
+	case t.IDXBinaryStar:
+		if cv := n.LHS().AsExpr().ConstValue(); cv != nil {
+			return z.linearize(n.RHS().AsExpr()).Mul(cv)
+		}
+		if cv := n.RHS().AsExpr().ConstValue(); cv != nil {
+			return z.linearize(n.LHS().AsExpr()).Mul(cv)
+		}
+	case t.IDXAssociativePlus:
+		sum := linear.Expr{}
+		for _, o := range n.Args() {
+			sum = sum.Add(z.linearize(o.AsExpr()))
+		}
+		return sum
+	}
+	return linear.Term(one, z.atom(n))
+}
+
+func (z *linearizer) atom(n *a.Expr) linear.Var {
+	for i, o := range z.atoms {
+		if o.Eq(n) {
+			return linear.Var(i)
+		}
+	}
+	z.atoms = append(z.atoms, n)
+	return linear.Var(len(z.atoms) - 1)
+}
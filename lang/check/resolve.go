@@ -42,6 +42,10 @@ var (
 	typeExprPlaceholder = a.NewTypeExpr(0, t.IDBase, t.IDQPlaceholder, nil, nil, nil)
 	typeExprTypeExpr    = a.NewTypeExpr(0, t.IDBase, t.IDQTypeExpr, nil, nil, nil)
 
+	typeExprI8  = a.NewTypeExpr(0, t.IDBase, t.IDI8, nil, nil, nil)
+	typeExprI16 = a.NewTypeExpr(0, t.IDBase, t.IDI16, nil, nil, nil)
+	typeExprI32 = a.NewTypeExpr(0, t.IDBase, t.IDI32, nil, nil, nil)
+	typeExprI64 = a.NewTypeExpr(0, t.IDBase, t.IDI64, nil, nil, nil)
 	typeExprU8  = a.NewTypeExpr(0, t.IDBase, t.IDU8, nil, nil, nil)
 	typeExprU16 = a.NewTypeExpr(0, t.IDBase, t.IDU16, nil, nil, nil)
 	typeExprU32 = a.NewTypeExpr(0, t.IDBase, t.IDU32, nil, nil, nil)
@@ -80,6 +84,10 @@ func setPlaceholderMBoundsMType(n *a.Node) {
 type typeMap map[t.ID]*a.TypeExpr
 
 var builtInTypeMap = typeMap{
+	t.IDI8:  typeExprI8,
+	t.IDI16: typeExprI16,
+	t.IDI32: typeExprI32,
+	t.IDI64: typeExprI64,
 	t.IDU8:  typeExprU8,
 	t.IDU16: typeExprU16,
 	t.IDU32: typeExprU32,
@@ -158,8 +166,10 @@ func (c *Checker) parseBuiltInFuncs(ss []string, generic bool) (map[t.QQID]*a.Fu
 	return m, nil
 }
 
+// resolveFunc returns the function or method for typ, which is either a func
+// type or, for a call to a function with multiple out fields, an out type.
 func (c *Checker) resolveFunc(typ *a.TypeExpr) (*a.Func, error) {
-	if typ.Decorator() != t.IDFunc {
+	if d := typ.Decorator(); d != t.IDFunc && d != t.IDOut {
 		return nil, fmt.Errorf("check: resolveFunc cannot look up non-func TypeExpr %q", typ.Str(c.tm))
 	}
 	lTyp := typ.Receiver()
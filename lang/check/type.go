@@ -26,7 +26,7 @@ import (
 
 func (q *checker) tcheckVars(block []*a.Node) error {
 	for _, o := range block {
-		q.errFilename, q.errLine = o.AsRaw().FilenameLine()
+		q.errNode, q.errExpr = o, nil
 
 		switch o.Kind() {
 		case a.KIf:
@@ -75,7 +75,7 @@ func (q *checker) tcheckVars(block []*a.Node) error {
 }
 
 func (q *checker) tcheckStatement(n *a.Node) error {
-	q.errFilename, q.errLine = n.AsRaw().FilenameLine()
+	q.errNode, q.errExpr = n, nil
 
 	switch n.Kind() {
 	case a.KAssert:
@@ -190,6 +190,10 @@ func (q *checker) tcheckStatement(n *a.Node) error {
 			}
 			// TODO: type-check that value is assignable to the return value.
 			// This needs the context of what func we're in.
+			if !q.astFunc.Suspendible() && len(q.astFunc.Out().Fields()) > 1 {
+				return fmt.Errorf("check: cannot return %q from a func with multiple out fields; "+
+					"assign to the out fields and use a bare return", value.Str(q.tm))
+			}
 		}
 
 	case a.KVar:
@@ -279,6 +283,9 @@ func (q *checker) tcheckEq(lID t.ID, lhs *a.Expr, lTyp *a.TypeExpr, rhs *a.Expr,
 }
 
 func (q *checker) tcheckAssign(n *a.Assign) error {
+	if n.Destructuring() {
+		return q.tcheckDestructuringAssign(n)
+	}
 	lhs := n.LHS()
 	rhs := n.RHS()
 	if err := q.tcheckExpr(lhs, 0); err != nil {
@@ -305,8 +312,13 @@ func (q *checker) tcheckAssign(n *a.Assign) error {
 			return fmt.Errorf("check: assignment %q: shift %q, of type %q, does not have numeric type",
 				n.Operator().Str(q.tm), rhs.Str(q.tm), rTyp.Str(q.tm))
 		}
+		if n.Operator() == t.IDTildeModShiftLEq && !lTyp.IsUnsignedInteger() {
+			return fmt.Errorf("check: assignment %q: %q, of type %q, does not have unsigned integer type",
+				n.Operator().Str(q.tm), lhs.Str(q.tm), lTyp.Str(q.tm))
+		}
 		return nil
-	case t.IDTildeModPlusEq, t.IDTildeModMinusEq, t.IDTildeSatPlusEq, t.IDTildeSatMinusEq:
+	case t.IDTildeModPlusEq, t.IDTildeModMinusEq, t.IDTildeModStarEq,
+		t.IDTildeSatPlusEq, t.IDTildeSatMinusEq:
 		if !lTyp.IsUnsignedInteger() {
 			return fmt.Errorf("check: assignment %q: %q, of type %q, does not have unsigned integer type",
 				n.Operator().Str(q.tm), lhs.Str(q.tm), lTyp.Str(q.tm))
@@ -323,6 +335,41 @@ func (q *checker) tcheckAssign(n *a.Assign) error {
 	)
 }
 
+func (q *checker) tcheckDestructuringAssign(n *a.Assign) error {
+	rhs := n.RHS()
+	if err := q.tcheckExpr(rhs, 0); err != nil {
+		return err
+	}
+	rTyp := rhs.MType()
+	if rTyp.Decorator() != t.IDOut {
+		return fmt.Errorf("check: cannot destructure %q, of type %q, as it is not a call to a func "+
+			"with multiple out fields", rhs.Str(q.tm), rTyp.Str(q.tm))
+	}
+	f, err := q.c.resolveFunc(rTyp)
+	if err != nil {
+		return err
+	}
+
+	outFields := f.Out().Fields()
+	lhsList := n.LHSList()
+	if len(lhsList) != len(outFields) {
+		return fmt.Errorf("check: %q has %d out fields but %d assignees were given",
+			f.QQID().Str(q.tm), len(outFields), len(lhsList))
+	}
+	for i, o := range lhsList {
+		o := o.AsExpr()
+		if err := q.tcheckExpr(o, 0); err != nil {
+			return err
+		}
+		outField := outFields[i].AsField()
+		if !o.MType().EqIgnoringRefinements(outField.XType()) {
+			return fmt.Errorf("check: cannot assign out field %q of type %q to %q of type %q",
+				outField.Name().Str(q.tm), outField.XType().Str(q.tm), o.Str(q.tm), o.MType().Str(q.tm))
+		}
+	}
+	return nil
+}
+
 func (q *checker) tcheckLoop(n a.Loop) error {
 	for _, o := range n.Asserts() {
 		if err := q.tcheckAssert(o.AsAssert()); err != nil {
@@ -352,15 +399,21 @@ func (q *checker) tcheckExpr(n *a.Expr, depth uint32) error {
 		return nil
 	}
 
+	err := error(nil)
 	switch op := n.Operator(); {
 	case op.IsXUnaryOp():
-		return q.tcheckExprUnaryOp(n, depth)
+		err = q.tcheckExprUnaryOp(n, depth)
 	case op.IsXBinaryOp():
-		return q.tcheckExprBinaryOp(n, depth)
+		err = q.tcheckExprBinaryOp(n, depth)
 	case op.IsXAssociativeOp():
-		return q.tcheckExprAssociativeOp(n, depth)
+		err = q.tcheckExprAssociativeOp(n, depth)
+	default:
+		err = q.tcheckExprOther(n, depth)
 	}
-	return q.tcheckExprOther(n, depth)
+	if err != nil {
+		q.noteErrExpr(n)
+	}
+	return err
 }
 
 func (q *checker) tcheckExprOther(n *a.Expr, depth uint32) error {
@@ -584,9 +637,9 @@ func (q *checker) tcheckExprCall(n *a.Expr, depth uint32) error {
 		outFields := f.Out().Fields()
 		switch len(outFields) {
 		default:
-			// TODO: figure out how to translate f.Out(), which is an
-			// *ast.Struct, to an *ast.TypeExpr we can pass to n.SetMType.
-			return fmt.Errorf("TODO: translate an *ast.Struct to an *ast.TypeExpr")
+			// The call's value can only be destructured, in an assignment like
+			// "x, y = etc". Its type refers back to f.
+			n.SetMType(a.NewTypeExpr(t.IDOut, 0, f.FuncName(), lhs.MType().Receiver().AsNode(), nil, nil))
 		case 0:
 			n.SetMType(typeExprEmptyStruct)
 		case 1:
@@ -640,11 +693,13 @@ func (q *checker) tcheckDot(n *a.Expr, depth uint32) error {
 	}
 
 	s := (*a.Struct)(nil)
-	if q.astFunc != nil && lQID[0] == 0 {
-		switch lQID[1] {
-		case t.IDIn:
+	if q.astFunc != nil {
+		// For a used-package func, the "in" and "out" QIDs are qualified by
+		// that package's name.
+		switch lQID {
+		case q.astFunc.In().QID():
 			s = q.astFunc.In()
-		case t.IDOut:
+		case q.astFunc.Out().QID():
 			s = q.astFunc.Out()
 		}
 	}
@@ -803,7 +858,8 @@ func (q *checker) tcheckExprBinaryOp(n *a.Expr, depth uint32) error {
 	}
 
 	switch op {
-	case t.IDXBinaryTildeModPlus, t.IDXBinaryTildeModMinus,
+	case t.IDXBinaryTildeModShiftL,
+		t.IDXBinaryTildeModPlus, t.IDXBinaryTildeModMinus, t.IDXBinaryTildeModStar,
 		t.IDXBinaryTildeSatPlus, t.IDXBinaryTildeSatMinus:
 		typ := lTyp
 		if typ.IsIdeal() {
@@ -899,7 +955,7 @@ func evalConstValueBinaryOp(tm *t.Map, n *a.Expr, l *big.Int, r *big.Int) (*big.
 	case t.IDXBinaryOr:
 		return btoi((l.Sign() != 0) || (r.Sign() != 0)), nil
 	case t.IDXBinaryTildeModShiftL,
-		t.IDXBinaryTildeModPlus, t.IDXBinaryTildeModMinus,
+		t.IDXBinaryTildeModPlus, t.IDXBinaryTildeModMinus, t.IDXBinaryTildeModStar,
 		t.IDXBinaryTildeSatPlus, t.IDXBinaryTildeSatMinus:
 		return nil, fmt.Errorf("check: cannot apply tilde-operators to ideal numbers")
 	}
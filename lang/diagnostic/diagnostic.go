@@ -0,0 +1,148 @@
+// Copyright 2018 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package diagnostic converts the errors of the Wuffs tools to machine-readable
+// records, for the tools' -json flags.
+//
+// Token, parse and check errors all map onto the same Record schema. Check
+// errors are structured, as *check.Error values. Token and parse errors are
+// plain errors whose messages look like "parse: etc at filename:line", and
+// the location is recovered from that message.
+package diagnostic
+
+import (
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/google/wuffs/lang/check"
+)
+
+// Record is a single diagnostic.
+type Record struct {
+	// Phase is what produced the diagnostic, such as "token", "parse",
+	// "check" or, for other errors, the tool's phase, such as "gen".
+	Phase string `json:"phase"`
+
+	Filename string `json:"file,omitempty"`
+	Line     uint32 `json:"line,omitempty"`
+	Col      uint32 `json:"col,omitempty"`
+
+	// Message does not include the Phase prefix or the location suffix.
+	Message string `json:"message"`
+
+	// Facts are what the checker knew to be true at the failure point.
+	Facts []string `json:"facts,omitempty"`
+
+	// OtherFilename and OtherLine are a related location, such as the
+	// previous declaration for a duplicate declaration error.
+	OtherFilename string `json:"otherFile,omitempty"`
+	OtherLine     uint32 `json:"otherLine,omitempty"`
+}
+
+var phases = [...]string{"token", "parse", "check"}
+
+// locationRegexp matches the " at filename:line" or " at filename:line:col"
+// suffix of an error message.
+var locationRegexp = regexp.MustCompile(` at ([^ ]*?):([0-9]+)(?::([0-9]+))?$`)
+
+// splitPhase returns the phase prefix of msg (or defaultPhase if there is no
+// known prefix) and the rest of msg.
+func splitPhase(defaultPhase string, msg string) (phase string, rest string) {
+	for _, p := range phases {
+		if strings.HasPrefix(msg, p+": ") {
+			return p, msg[len(p)+2:]
+		}
+	}
+	return defaultPhase, msg
+}
+
+// Records converts err to diagnostic records. A check.ErrorList becomes
+// multiple records. The defaultPhase is used for errors that don't otherwise
+// say which phase they came from.
+func Records(defaultPhase string, err error) []Record {
+	switch err := err.(type) {
+	case nil:
+		return nil
+	case check.ErrorList:
+		ret := make([]Record, 0, len(err))
+		for _, e := range err {
+			ret = append(ret, fromCheckError(e))
+		}
+		return ret
+	case *check.Error:
+		return []Record{fromCheckError(err)}
+	}
+
+	r := Record{}
+	r.Phase, r.Message = splitPhase(defaultPhase, err.Error())
+	if m := locationRegexp.FindStringSubmatch(r.Message); m != nil {
+		if line, err := strconv.ParseUint(m[2], 10, 32); err == nil {
+			r.Filename = m[1]
+			r.Line = uint32(line)
+			if col, err := strconv.ParseUint(m[3], 10, 32); err == nil {
+				r.Col = uint32(col)
+			}
+			r.Message = r.Message[:len(r.Message)-len(m[0])]
+		}
+	}
+	return []Record{r}
+}
+
+func fromCheckError(e *check.Error) Record {
+	r := Record{
+		Phase:         "check",
+		Filename:      e.Filename,
+		Line:          e.Line,
+		Col:           e.Col,
+		OtherFilename: e.OtherFilename,
+		OtherLine:     e.OtherLine,
+	}
+	r.Phase, r.Message = splitPhase("check", e.Err.Error())
+	if e.TMap != nil {
+		for _, f := range e.Facts {
+			r.Facts = append(r.Facts, f.Str(e.TMap))
+		}
+	}
+	return r
+}
+
+// JSON returns an error whose message is err's records, one JSON object per
+// line. It returns nil if err is nil.
+func JSON(defaultPhase string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return jsonError(Records(defaultPhase, err))
+}
+
+type jsonError []Record
+
+func (e jsonError) Error() string {
+	b := []byte(nil)
+	for i, r := range e {
+		if i > 0 {
+			b = append(b, '\n')
+		}
+		line, err := json.Marshal(r)
+		if err != nil {
+			// This shouldn't happen, as a Record only holds strings and
+			// integers.
+			panic(err)
+		}
+		b = append(b, line...)
+	}
+	return string(b)
+}
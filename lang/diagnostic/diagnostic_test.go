@@ -0,0 +1,106 @@
+// Copyright 2018 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diagnostic
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/wuffs/lang/check"
+	"github.com/google/wuffs/lang/parse"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+const filename = "test.wuffs"
+
+// errorOf returns the first token, parse or check error for src.
+func errorOf(tt *testing.T, src string) error {
+	tm := &t.Map{}
+	tokens, _, err := t.Tokenize(tm, filename, []byte(src))
+	if err != nil {
+		return err
+	}
+	file, err := parse.Parse(tm, filename, tokens, nil)
+	if err != nil {
+		return err
+	}
+	_, err = check.Check(tm, []*a.File{file}, nil, nil)
+	if err == nil {
+		tt.Fatalf("Check: got nil error")
+	}
+	return err
+}
+
+func TestRecords(tt *testing.T) {
+	testCases := []struct {
+		src       string
+		wantPhase string
+		wantLine  uint32
+		wantCol   uint32
+	}{
+		{"packageid \"test\"\npri const x base.u8 = 012\n", "token", 2, 23},
+		{"packageid \"test\"\npri func foo()() {\n\tvar x base.u8 = 300 300\n}\n", "parse", 3, 22},
+		{"packageid \"test\"\npri func foo()() {\n\tvar x base.u8 = \n", "parse", 3, 0},
+		{"packageid \"test\"\npri func foo()() {\n\tvar x base.u8 = 300\n}\n", "check", 3, 18},
+	}
+
+	for _, tc := range testCases {
+		rs := Records("gen", errorOf(tt, tc.src))
+		if len(rs) != 1 {
+			tt.Errorf("%q: got %d records, want 1", tc.src, len(rs))
+			continue
+		}
+		r := rs[0]
+		if r.Phase != tc.wantPhase || r.Filename != filename ||
+			r.Line != tc.wantLine || r.Col != tc.wantCol {
+			tt.Errorf("%q: got %+v, want phase %q, file %q, line %d, col %d",
+				tc.src, r, tc.wantPhase, filename, tc.wantLine, tc.wantCol)
+		}
+		if strings.HasPrefix(r.Message, r.Phase+":") || strings.Contains(r.Message, " at "+filename) {
+			tt.Errorf("%q: message %q still has its phase prefix or location suffix", tc.src, r.Message)
+		}
+	}
+}
+
+func TestCheckRecordFacts(tt *testing.T) {
+	src := "packageid \"test\"\npri func foo(x base.u8)() {\n\tif in.x < 10 {\n\t\tassert in.x > 20\n\t}\n}\n"
+	rs := Records("gen", errorOf(tt, src))
+	if len(rs) != 1 {
+		tt.Fatalf("got %d records, want 1", len(rs))
+	}
+	if got, want := rs[0].Facts, "in.x < 10"; len(got) != 1 || got[0] != want {
+		tt.Errorf("Facts: got %q, want [%q]", got, want)
+	}
+}
+
+func TestJSON(tt *testing.T) {
+	if err := JSON("gen", nil); err != nil {
+		tt.Fatalf("JSON(nil): got %v, want nil", err)
+	}
+
+	err := JSON("gen", errors.New(`prohibited package name "x y"`))
+	r := Record{}
+	if err := json.Unmarshal([]byte(err.Error()), &r); err != nil {
+		tt.Fatalf("Unmarshal: %v", err)
+	}
+	want := Record{Phase: "gen", Message: `prohibited package name "x y"`}
+	if r.Phase != want.Phase || r.Message != want.Message || r.Filename != "" {
+		tt.Errorf("got %+v, want %+v", r, want)
+	}
+}
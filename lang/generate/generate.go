@@ -36,12 +36,18 @@ type Generator func(packageName string, tm *t.Map, c *check.Checker, files []*a.
 
 func Do(flags *flag.FlagSet, args []string, g Generator) error {
 	packageName := flags.String("package_name", "", "the package name of the Wuffs input code")
+	maxErrors := flags.Int("max_errors", check.DefaultMaxErrors,
+		"the maximum number of check errors to report, or -1 for no limit")
 	if err := flags.Parse(args); err != nil {
 		return err
 	}
+	return do(flags, *packageName, *maxErrors, g)
+}
+
+func do(flags *flag.FlagSet, packageName string, maxErrors int, g Generator) error {
 	out := []byte(nil)
 
-	if *packageName == "base" && len(flags.Args()) == 0 {
+	if packageName == "base" && len(flags.Args()) == 0 {
 		var err error
 		out, err = g("base", nil, nil, nil)
 		if err != nil {
@@ -49,19 +55,29 @@ func Do(flags *flag.FlagSet, args []string, g Generator) error {
 		}
 
 	} else {
-		pkgName := checkPackageName(*packageName)
+		pkgName := checkPackageName(packageName)
 		if pkgName == "" {
-			return fmt.Errorf("prohibited package name %q", *packageName)
+			return fmt.Errorf("prohibited package name %q", packageName)
 		}
 
 		tm := &t.Map{}
-		files, err := parseFiles(tm, flags.Args())
+		srcs := map[string][]byte{}
+		files, err := parseFiles(tm, flags.Args(), srcs)
 		if err != nil {
 			return err
 		}
 
-		c, err := check.Check(tm, files, resolveUse)
+		c, err := check.Check(tm, files, resolveUse, &check.Options{
+			MaxErrors: maxErrors,
+		})
 		if err != nil {
+			if errs, ok := err.(check.ErrorList); ok {
+				for _, e := range errs {
+					if e.Src == nil {
+						e.Src = srcs[e.Filename]
+					}
+				}
+			}
 			return err
 		}
 
@@ -98,13 +114,16 @@ func checkPackageName(s string) string {
 	return s
 }
 
-func parseFiles(tm *t.Map, filenames []string) (files []*a.File, err error) {
+// parseFiles is like ParseFiles, except that it reads from stdin if there are
+// no filenames, and it records each file's source code in srcs.
+func parseFiles(tm *t.Map, filenames []string, srcs map[string][]byte) (files []*a.File, err error) {
 	if len(filenames) == 0 {
 		const filename = "stdin"
 		src, err := ioutil.ReadAll(os.Stdin)
 		if err != nil {
 			return nil, err
 		}
+		srcs[filename] = src
 		tokens, _, err := t.Tokenize(tm, filename, src)
 		if err != nil {
 			return nil, err
@@ -115,15 +134,22 @@ func parseFiles(tm *t.Map, filenames []string) (files []*a.File, err error) {
 		}
 		return []*a.File{f}, nil
 	}
-	return ParseFiles(tm, filenames, nil)
+	return parseFiles1(tm, filenames, nil, srcs)
 }
 
 func ParseFiles(tm *t.Map, filenames []string, opts *parse.Options) (files []*a.File, err error) {
+	return parseFiles1(tm, filenames, opts, nil)
+}
+
+func parseFiles1(tm *t.Map, filenames []string, opts *parse.Options, srcs map[string][]byte) (files []*a.File, err error) {
 	for _, filename := range filenames {
 		src, err := ioutil.ReadFile(filename)
 		if err != nil {
 			return nil, err
 		}
+		if srcs != nil {
+			srcs[filename] = src
+		}
 		tokens, _, err := t.Tokenize(tm, filename, src)
 		if err != nil {
 			return nil, err
@@ -137,12 +163,14 @@ func ParseFiles(tm *t.Map, filenames []string, opts *parse.Options) (files []*a.
 	return files, nil
 }
 
+// resolveUse returns the interface, written by "wuffs gen", of the used
+// package, from whichever Wuffs root provides that package.
 func resolveUse(usePath string) ([]byte, error) {
-	wuffsRoot, err := WuffsRoot()
+	root, err := PackageRoot(strings.TrimSuffix(usePath, ".wuffs"))
 	if err != nil {
 		return nil, err
 	}
-	return ioutil.ReadFile(filepath.Join(wuffsRoot, "gen", "wuffs", filepath.FromSlash(usePath)))
+	return ioutil.ReadFile(filepath.Join(root, "gen", "wuffs", filepath.FromSlash(usePath)))
 }
 
 var cachedWuffsRoot struct {
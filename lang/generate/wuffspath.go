@@ -0,0 +1,228 @@
+// Copyright 2018 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generate
+
+// This file implements the Wuffs path: the list of Wuffs root directories
+// that packages are found in. The first root is the Wuffs repository itself,
+// holding the base and std packages. Further roots, such as other
+// repositories holding third party packages, are listed in the WUFFSPATH
+// environment variable.
+//
+// Each root holds its packages' source code, such as root/foo/bar/*.wuffs
+// for the package "foo/bar", and the code generated from it, under root/gen.
+// A root may have a ManifestFilename file that lists the package paths that
+// it provides. A root without one provides the packages whose directories it
+// contains.
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/google/wuffs/lang/validate"
+)
+
+// ManifestFilename is the name of a Wuffs root's manifest file. Each line of
+// that file is a package path, such as "foo/bar", or a package path pattern,
+// such as "foo/...", which also matches the packages under "foo". Blank lines
+// and lines starting with "#" are ignored.
+const ManifestFilename = "wuffs.manifest"
+
+var cachedWuffsPath struct {
+	mu       sync.Mutex
+	roots    []string
+	packages map[string]string
+}
+
+// WuffsPath returns the Wuffs root directories: WuffsRoot followed by the
+// directories listed in the WUFFSPATH environment variable.
+func WuffsPath() ([]string, error) {
+	cachedWuffsPath.mu.Lock()
+	roots := cachedWuffsPath.roots
+	cachedWuffsPath.mu.Unlock()
+
+	if roots != nil {
+		return roots, nil
+	}
+
+	wuffsRoot, err := WuffsRoot()
+	if err != nil {
+		return nil, err
+	}
+	roots, err = WuffsPathFor(wuffsRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	cachedWuffsPath.mu.Lock()
+	cachedWuffsPath.roots = roots
+	cachedWuffsPath.mu.Unlock()
+
+	return roots, nil
+}
+
+// WuffsPathFor is like WuffsPath, but with the given Wuffs root directory
+// instead of WuffsRoot. If wuffsRoot is empty, it returns only the WUFFSPATH
+// directories.
+func WuffsPathFor(wuffsRoot string) ([]string, error) {
+	return wuffsPath(wuffsRoot, os.Getenv("WUFFSPATH"))
+}
+
+// wuffsPath returns wuffsRoot, if non-empty, followed by the directories in
+// the list wuffsPathEnv, without any duplicates.
+func wuffsPath(wuffsRoot string, wuffsPathEnv string) ([]string, error) {
+	roots := []string(nil)
+	seen := map[string]bool{}
+	if wuffsRoot != "" {
+		roots = append(roots, wuffsRoot)
+		seen[wuffsRoot] = true
+	}
+	for _, p := range filepath.SplitList(wuffsPathEnv) {
+		if p == "" {
+			continue
+		}
+		p, err := filepath.Abs(p)
+		if err != nil {
+			return nil, err
+		}
+		if seen[p] {
+			continue
+		}
+		seen[p] = true
+		if o, err := os.Stat(p); err != nil {
+			return nil, fmt.Errorf("bad WUFFSPATH entry: %v", err)
+		} else if !o.IsDir() {
+			return nil, fmt.Errorf("bad WUFFSPATH entry %q: not a directory", p)
+		}
+		roots = append(roots, p)
+	}
+	return roots, nil
+}
+
+// PackageRoot returns the Wuffs root directory that provides the package, or
+// the directory of packages, with the given path, such as "std/deflate". It
+// is an error if no root, or more than one root, provides it. The base
+// package, which is built into the code generators, is provided by WuffsRoot.
+func PackageRoot(pkgPath string) (string, error) {
+	cachedWuffsPath.mu.Lock()
+	root, ok := cachedWuffsPath.packages[pkgPath]
+	cachedWuffsPath.mu.Unlock()
+
+	if ok {
+		return root, nil
+	}
+
+	roots, err := WuffsPath()
+	if err != nil {
+		return "", err
+	}
+	root, err = PackageRootIn(roots, pkgPath)
+	if err != nil {
+		return "", err
+	}
+
+	cachedWuffsPath.mu.Lock()
+	if cachedWuffsPath.packages == nil {
+		cachedWuffsPath.packages = map[string]string{}
+	}
+	cachedWuffsPath.packages[pkgPath] = root
+	cachedWuffsPath.mu.Unlock()
+
+	return root, nil
+}
+
+// PackageRootIn is like PackageRoot, but looks in the given Wuffs root
+// directories instead of those returned by WuffsPath, and does not cache its
+// result.
+func PackageRootIn(roots []string, pkgPath string) (string, error) {
+	if pkgPath == "base" && len(roots) > 0 {
+		return roots[0], nil
+	}
+	if !validate.IsValidUsePath(pkgPath) {
+		return "", fmt.Errorf("invalid package path %q", pkgPath)
+	}
+	found := []string(nil)
+	for _, root := range roots {
+		ok, err := provides(root, pkgPath)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			found = append(found, root)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return "", fmt.Errorf("cannot find package %q in any of %s",
+			pkgPath, strings.Join(roots, string(filepath.ListSeparator)))
+	case 1:
+		return found[0], nil
+	}
+	return "", fmt.Errorf("ambiguous package path %q, provided by all of %s",
+		pkgPath, strings.Join(found, string(filepath.ListSeparator)))
+}
+
+// provides returns whether the Wuffs root provides the package with the given
+// path, according to its manifest if it has one.
+func provides(root string, pkgPath string) (bool, error) {
+	patterns, err := readManifest(root)
+	if err != nil {
+		return false, err
+	}
+	if patterns == nil {
+		o, err := os.Stat(filepath.Join(root, filepath.FromSlash(pkgPath)))
+		return err == nil && o.IsDir(), nil
+	}
+	for _, pattern := range patterns {
+		if pattern == pkgPath {
+			return true, nil
+		}
+		if prefix := strings.TrimSuffix(pattern, "/..."); prefix != pattern &&
+			(pkgPath == prefix || strings.HasPrefix(pkgPath, prefix+"/")) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// readManifest returns the package path patterns listed in the Wuffs root's
+// manifest, or nil if it has no manifest.
+func readManifest(root string) (patterns []string, err error) {
+	filename := filepath.Join(root, ManifestFilename)
+	f, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	patterns = []string{}
+	s := bufio.NewScanner(f)
+	for line := 1; s.Scan(); line++ {
+		pattern := strings.TrimSpace(s.Text())
+		if pattern == "" || pattern[0] == '#' {
+			continue
+		}
+		if !validate.IsValidUsePath(strings.TrimSuffix(pattern, "/...")) {
+			return nil, fmt.Errorf("%s:%d: invalid package path %q", filename, line, pattern)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, s.Err()
+}
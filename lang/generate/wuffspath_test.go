@@ -0,0 +1,91 @@
+// Copyright 2018 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generate
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPackageRoot(tt *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "wuffspath")
+	if err != nil {
+		tt.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// The "wuffs" root has no manifest, so it provides the packages whose
+	// directories it contains. The "third" root's manifest provides only
+	// "acme/..." and "std/deflate", the latter clashing with the "wuffs" root.
+	dirs := []string{
+		"wuffs/std/deflate",
+		"wuffs/std/gif",
+		"third/acme/png",
+		"third/acme/tiff",
+		"third/std/deflate",
+		"third/std/lzw",
+	}
+	for _, d := range dirs {
+		if err := os.MkdirAll(filepath.Join(tmpDir, filepath.FromSlash(d)), 0755); err != nil {
+			tt.Fatalf("MkdirAll: %v", err)
+		}
+	}
+	manifest := "# Our formats.\nacme/...\n\nstd/deflate\n"
+	if err := ioutil.WriteFile(filepath.Join(tmpDir, "third", ManifestFilename), []byte(manifest), 0644); err != nil {
+		tt.Fatalf("WriteFile: %v", err)
+	}
+
+	wuffsRoot := filepath.Join(tmpDir, "wuffs")
+	thirdRoot := filepath.Join(tmpDir, "third")
+	roots, err := wuffsPath(wuffsRoot, strings.Join([]string{thirdRoot, "", wuffsRoot}, string(filepath.ListSeparator)))
+	if err != nil {
+		tt.Fatalf("wuffsPath: %v", err)
+	}
+	if len(roots) != 2 || roots[0] != wuffsRoot || roots[1] != thirdRoot {
+		tt.Fatalf("wuffsPath: got %q, want %q", roots, []string{wuffsRoot, thirdRoot})
+	}
+
+	testCases := []struct {
+		pkgPath string
+		want    string
+		wantErr string
+	}{
+		{"base", wuffsRoot, ""},
+		{"std", wuffsRoot, ""},
+		{"std/gif", wuffsRoot, ""},
+		{"acme", thirdRoot, ""},
+		{"acme/png", thirdRoot, ""},
+		{"std/deflate", "", "ambiguous package path"},
+		{"std/lzw", "", "cannot find package"},
+		{"acme/../std/gif", "", "invalid package path"},
+	}
+	for _, tc := range testCases {
+		got, err := PackageRootIn(roots, tc.pkgPath)
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				tt.Errorf("%q: got error %v, want %q", tc.pkgPath, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			tt.Errorf("%q: %v", tc.pkgPath, err)
+		} else if got != tc.want {
+			tt.Errorf("%q: got %q, want %q", tc.pkgPath, got, tc.want)
+		}
+	}
+}
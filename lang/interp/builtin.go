@@ -0,0 +1,469 @@
+// Copyright 2018 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package interp
+
+import (
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+func (f *frame) evalCall(n *a.Expr, depth uint32) Value {
+	method := n.LHS().AsExpr()
+	recv := method.LHS().AsExpr()
+	recvTyp := recv.MType()
+
+	switch recvTyp.Decorator() {
+	case 0:
+		// No-op.
+	case t.IDNptr, t.IDPtr:
+		recvTyp = recvTyp.Inner()
+	case t.IDSlice:
+		return f.callBuiltinSlice(n, recv, method.Ident(), depth)
+	case t.IDTable:
+		return f.callBuiltinTable(n, recv, method.Ident(), depth)
+	default:
+		fail("cannot call %q", n.Str(f.m.tm))
+	}
+
+	if qid := recvTyp.QID(); qid[0] == t.IDBase {
+		if n.Operator() == t.IDTry {
+			fail("TODO: try a built-in method call %q", n.Str(f.m.tm))
+		}
+		switch {
+		case qid[1].IsNumType():
+			return f.callBuiltinNumType(n, recv, method.Ident(), depth)
+		case qid[1] == t.IDIOReader:
+			return f.callBuiltinIOReader(n, recv, method.Ident(), depth)
+		case qid[1] == t.IDIOWriter:
+			return f.callBuiltinIOWriter(n, recv, method.Ident(), depth)
+		case qid[1] == t.IDStatus:
+			return f.callBuiltinStatus(n, recv, method.Ident(), depth)
+		}
+		fail("TODO: built-in method call %q", n.Str(f.m.tm))
+	}
+	return f.callUserDefined(n, recv, recvTyp, method.Ident(), depth)
+}
+
+func (f *frame) evalArgs(n *a.Expr, depth uint32) map[t.ID]Value {
+	args := map[t.ID]Value{}
+	for _, o := range n.Args() {
+		o := o.AsArg()
+		args[o.Name()] = copyArg(f.eval(o.Value(), depth))
+	}
+	return args
+}
+
+func (f *frame) callUserDefined(n *a.Expr, recv *a.Expr, recvTyp *a.TypeExpr, method t.ID, depth uint32) Value {
+	p, err := f.m.resolve(f.pkg, recvTyp.QID()[0])
+	if err != nil {
+		panic(interpError{err})
+	}
+	o, ok := f.eval(recv, depth).(*Object)
+	if !ok || o == nil {
+		fail("cannot call %q on a nil receiver", n.Str(f.m.tm))
+	}
+	if method == t.IDReset {
+		f.m.resetObject(o)
+		return struct{}{}
+	}
+
+	fn := p.funcs[t.QQID{0, recvTyp.QID()[1], method}]
+	if fn == nil {
+		fail("cannot resolve method call %q", n.Str(f.m.tm))
+	}
+	if !fn.Suspendible() {
+		return f.m.callFunc(p, fn, o, f.evalArgs(n, depth), nil)
+	}
+
+	for {
+		z, out := f.m.callSuspendible(p, fn, o, f.evalArgs(n, depth))
+		if n.Operator() == t.IDTry {
+			return z
+		}
+		if z.IsSuspension() {
+			// Suspend this coroutine too, and on resumption, evaluate the
+			// arguments again (as the generated C code does) and resume the
+			// callee.
+			f.suspend(z)
+			continue
+		}
+		if !z.IsOK() {
+			panic(statusReturn{z})
+		}
+		return out
+	}
+}
+
+func (f *frame) arg(n *a.Expr, i int, depth uint32) Value {
+	return f.eval(n.Args()[i].AsArg().Value(), depth)
+}
+
+func (f *frame) argInt(n *a.Expr, i int, depth uint32) int {
+	return int(f.arg(n, i, depth).(uint64))
+}
+
+func (f *frame) callBuiltinNumType(n *a.Expr, recv *a.Expr, method t.ID, depth uint32) Value {
+	x := f.eval(recv, depth).(uint64)
+	switch method {
+	case t.IDLowBits:
+		return mask(x, uint32(f.argInt(n, 0, depth)))
+	case t.IDHighBits:
+		return x >> (numBits(recv.MType()) - uint32(f.argInt(n, 0, depth)))
+	case t.IDMax, t.IDMin:
+		y := f.arg(n, 0, depth).(uint64)
+		less := x < y
+		if recv.MType().IsSignedInteger() {
+			less = int64(x) < int64(y)
+		}
+		if less == (method == t.IDMax) {
+			return y
+		}
+		return x
+	}
+	fail("TODO: built-in method call %q", n.Str(f.m.tm))
+	return nil
+}
+
+func (f *frame) callBuiltinSlice(n *a.Expr, recv *a.Expr, method t.ID, depth uint32) Value {
+	x := f.eval(recv, depth)
+	switch method {
+	case t.IDCopyFromSlice:
+		switch x := x.(type) {
+		case []byte:
+			return uint64(copy(x, f.arg(n, 0, depth).([]byte)))
+		case []Value:
+			return uint64(copy(x, f.arg(n, 0, depth).([]Value)))
+		}
+
+	case t.IDLength:
+		return uint64(sliceLen(x))
+
+	case t.IDPrefix:
+		length, upTo := sliceLen(x), f.arg(n, 0, depth).(uint64)
+		if upTo < uint64(length) {
+			return subSlice(x, 0, int(upTo))
+		}
+		return x
+
+	case t.IDSuffix:
+		length, upTo := sliceLen(x), f.arg(n, 0, depth).(uint64)
+		if upTo < uint64(length) {
+			return subSlice(x, length-int(upTo), length)
+		}
+		return x
+	}
+	fail("TODO: built-in method call %q", n.Str(f.m.tm))
+	return nil
+}
+
+func (f *frame) callBuiltinTable(n *a.Expr, recv *a.Expr, method t.ID, depth uint32) Value {
+	x, ok := f.eval(recv, depth).(Table)
+	if !ok {
+		fail("TODO: built-in method call %q", n.Str(f.m.tm))
+	}
+	switch method {
+	case t.IDHeight:
+		return x.Height
+	case t.IDStride:
+		return x.Stride
+	case t.IDWidth:
+		return x.Width
+	case t.IDRow:
+		if y := f.arg(n, 0, depth).(uint64); y < x.Height {
+			i := x.Stride * y
+			return x.Data[i : i+x.Width]
+		}
+		return []byte(nil)
+	}
+	fail("TODO: built-in method call %q", n.Str(f.m.tm))
+	return nil
+}
+
+func (f *frame) callBuiltinStatus(n *a.Expr, recv *a.Expr, method t.ID, depth uint32) Value {
+	z := f.eval(recv, depth).(Status)
+	switch method {
+	case t.IDIsError:
+		return z.IsError()
+	case t.IDIsOK:
+		return z.IsOK()
+	case t.IDIsSuspension:
+		return z.IsSuspension()
+	}
+	fail("TODO: built-in method call %q", n.Str(f.m.tm))
+	return nil
+}
+
+// numBytes returns the number of bytes, and whether they are little-endian,
+// for the methods like read_u8, read_u16be, read_u16le, etc. up to
+// read_u64le, given the offset of the method's ID from the first (u8) ID.
+func numBytes(offset t.ID) (n int, littleEndian bool) {
+	return 1 + int(offset+1)/2, (offset != 0) && (offset&1 == 0)
+}
+
+func decodeUint(b []byte, littleEndian bool) uint64 {
+	x := uint64(0)
+	for i := range b {
+		if littleEndian {
+			x |= uint64(b[i]) << (8 * uint(i))
+		} else {
+			x = x<<8 | uint64(b[i])
+		}
+	}
+	return x
+}
+
+func encodeUint(b []byte, x uint64, littleEndian bool) {
+	for i := range b {
+		if littleEndian {
+			b[i] = uint8(x >> (8 * uint(i)))
+		} else {
+			b[i] = uint8(x >> (8 * uint(len(b)-1-i)))
+		}
+	}
+}
+
+// readBytes reads nBytes bytes from r, suspending on a short read.
+func (f *frame) readBytes(r *Reader, recv *a.Expr, nBytes int, depth uint32) []byte {
+	buf := make([]byte, nBytes)
+	for i := range buf {
+		for r.available() <= 0 {
+			f.suspendShortRead(r)
+			r = f.eval(recv, depth).(*Reader)
+		}
+		buf[i] = r.buf.Data[r.buf.RI]
+		r.buf.RI++
+	}
+	return buf
+}
+
+func (f *frame) callBuiltinIOReader(n *a.Expr, recv *a.Expr, method t.ID, depth uint32) Value {
+	r := f.eval(recv, depth).(*Reader)
+
+	switch {
+	case t.IDReadU8 <= method && method <= t.IDReadU64LE:
+		nBytes, littleEndian := numBytes(method - t.IDReadU8)
+		return decodeUint(f.readBytes(r, recv, nBytes, depth), littleEndian)
+
+	case t.IDReadI8 <= method && method <= t.IDReadI64LE:
+		// The read_i8, read_i16be, read_i16le, etc. methods don't have the
+		// odd sizes (such as 24 bits) that the read_u8, etc. methods have.
+		offset := method - t.IDReadI8
+		nBytes, littleEndian := 1<<uint((offset+1)/2), offset&1 == 0
+		return fit(decodeUint(f.readBytes(r, recv, nBytes, depth), littleEndian), n.MType())
+
+	case t.IDPeekU8 <= method && method <= t.IDPeekU64LE:
+		nBytes, littleEndian := numBytes(method - t.IDPeekU8)
+		if r.available() < nBytes {
+			fail("%q: insufficient bytes available", n.Str(f.m.tm))
+		}
+		return decodeUint(r.buf.Data[r.buf.RI:r.buf.RI+nBytes], littleEndian)
+	}
+
+	switch method {
+	case t.IDAvailable:
+		return uint64(r.available())
+
+	case t.IDCanUndoByte:
+		return r.buf != nil && r.buf.RI > r.mark
+
+	case t.IDUndoByte:
+		r.buf.RI--
+		return struct{}{}
+
+	case t.IDSet:
+		s := f.arg(n, 0, depth).([]byte)
+		closed := f.arg(n, 1, depth).(bool)
+		*r = Reader{
+			buf:   &IOBuffer{Data: s, WI: len(s), Closed: closed},
+			limit: -1,
+		}
+		return struct{}{}
+
+	case t.IDSetLimit:
+		if r.buf != nil {
+			r.limit = r.buf.RI + f.argInt(n, 0, depth)
+		}
+		return struct{}{}
+
+	case t.IDSetMark:
+		if r.buf != nil {
+			r.mark = r.buf.RI
+		}
+		return struct{}{}
+
+	case t.IDSinceMark:
+		if r.buf == nil {
+			return []byte(nil)
+		}
+		return r.buf.Data[r.mark:r.buf.RI]
+
+	case t.IDSkip:
+		for remaining := f.argInt(n, 0, depth); ; {
+			k := r.available()
+			if k > remaining {
+				k = remaining
+			}
+			if k > 0 {
+				r.buf.RI += k
+				remaining -= k
+			}
+			if remaining == 0 {
+				return struct{}{}
+			}
+			f.suspendShortRead(r)
+			r = f.eval(recv, depth).(*Reader)
+		}
+
+	case t.IDSkipFast:
+		r.buf.RI += f.argInt(n, 0, depth)
+		return struct{}{}
+	}
+	fail("TODO: built-in method call %q", n.Str(f.m.tm))
+	return nil
+}
+
+// suspendShortRead suspends, as the generated C code does when an io_reader
+// has no more bytes available. If the reader's buffer is closed, then no more
+// bytes will ever arrive, and the function returns an error instead.
+func (f *frame) suspendShortRead(r *Reader) {
+	if r.buf != nil && r.buf.Closed && (r.limit < 0 || r.buf.WI <= r.limit) {
+		panic(statusReturn{statusUnexpectedEOF})
+	}
+	f.suspend(statusShortRead)
+}
+
+func (f *frame) callBuiltinIOWriter(n *a.Expr, recv *a.Expr, method t.ID, depth uint32) Value {
+	w := f.eval(recv, depth).(*Writer)
+
+	switch {
+	case t.IDWriteU8 <= method && method <= t.IDWriteU64LE:
+		nBytes, littleEndian := numBytes(method - t.IDWriteU8)
+		buf := make([]byte, nBytes)
+		encodeUint(buf, f.arg(n, 0, depth).(uint64), littleEndian)
+		for i := range buf {
+			for w.available() <= 0 {
+				f.suspend(statusShortWrite)
+				w = f.eval(recv, depth).(*Writer)
+			}
+			w.buf.Data[w.buf.WI] = buf[i]
+			w.buf.WI++
+		}
+		return struct{}{}
+
+	case t.IDWriteFastU8 <= method && method <= t.IDWriteFastU64LE:
+		nBytes, littleEndian := numBytes(method - t.IDWriteFastU8)
+		if w.available() < nBytes {
+			fail("%q: insufficient space available", n.Str(f.m.tm))
+		}
+		encodeUint(w.buf.Data[w.buf.WI:w.buf.WI+nBytes], f.arg(n, 0, depth).(uint64), littleEndian)
+		w.buf.WI += nBytes
+		return struct{}{}
+	}
+
+	switch method {
+	case t.IDAvailable:
+		return uint64(w.available())
+
+	case t.IDSet:
+		*w = Writer{
+			buf:   &IOBuffer{Data: f.arg(n, 0, depth).([]byte)},
+			limit: -1,
+		}
+		return struct{}{}
+
+	case t.IDSetLimit:
+		if w.buf != nil {
+			w.limit = w.buf.WI + f.argInt(n, 0, depth)
+		}
+		return struct{}{}
+
+	case t.IDSetMark:
+		if w.buf != nil {
+			w.mark = w.buf.WI
+		}
+		return struct{}{}
+
+	case t.IDSinceMark:
+		if w.buf == nil {
+			return []byte(nil)
+		}
+		return w.buf.Data[w.mark:w.buf.WI]
+
+	case t.IDCopyFromSlice:
+		s := f.arg(n, 0, depth).([]byte)
+		k := w.available()
+		if k > len(s) {
+			k = len(s)
+		}
+		if k > 0 {
+			w.buf.WI += copy(w.buf.Data[w.buf.WI:], s[:k])
+		}
+		return uint64(k)
+
+	case t.IDCopyNFromHistory, t.IDCopyNFromHistoryFast:
+		length := f.argInt(n, 0, depth)
+		distance := f.argInt(n, 1, depth)
+		if method == t.IDCopyNFromHistory {
+			if (distance == 0) || (w.buf == nil) || (w.buf.WI-w.mark < distance) {
+				return uint64(0)
+			}
+			if k := w.available(); length > k {
+				length = k
+			}
+		} else if (distance == 0) || (w.buf.WI-w.mark < distance) || (w.available() < length) {
+			fail("%q: pre-condition failed", n.Str(f.m.tm))
+		}
+		// The source and destination may overlap, so copy one byte at a time.
+		d := w.buf.Data
+		for i := 0; i < length; i++ {
+			d[w.buf.WI] = d[w.buf.WI-distance]
+			w.buf.WI++
+		}
+		return uint64(length)
+
+	case t.IDCopyNFromReader:
+		k := f.argInt(n, 0, depth)
+		r := f.arg(n, 1, depth).(*Reader)
+		if avail := w.available(); k > avail {
+			k = avail
+		}
+		if avail := r.available(); k > avail {
+			k = avail
+		}
+		if k > 0 {
+			copy(w.buf.Data[w.buf.WI:], r.buf.Data[r.buf.RI:r.buf.RI+k])
+			w.buf.WI += k
+			r.buf.RI += k
+		}
+		return uint64(k)
+
+	case t.IDCopyNFromSlice:
+		k := f.argInt(n, 0, depth)
+		s := f.arg(n, 1, depth).([]byte)
+		if k > len(s) {
+			k = len(s)
+		}
+		if avail := w.available(); k > avail {
+			k = avail
+		}
+		if k > 0 {
+			copy(w.buf.Data[w.buf.WI:], s[:k])
+			w.buf.WI += k
+		}
+		return uint64(k)
+	}
+	fail("TODO: built-in method call %q", n.Str(f.m.tm))
+	return nil
+}
@@ -0,0 +1,337 @@
+// Copyright 2018 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package interp
+
+import (
+	"math/big"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+func (f *frame) eval(n *a.Expr, depth uint32) Value {
+	if depth > a.MaxExprDepth {
+		fail("expression recursion depth too large")
+	}
+	depth++
+
+	if cv := n.ConstValue(); cv != nil {
+		return constValue(n.MType(), cv)
+	}
+
+	switch op := n.Operator(); {
+	case op.IsXUnaryOp():
+		return f.evalUnaryOp(n, depth)
+	case op.IsXBinaryOp():
+		if op == t.IDXBinaryAnd || op == t.IDXBinaryOr {
+			// Short-circuit evaluation.
+			x := f.eval(n.LHS().AsExpr(), depth).(bool)
+			if x == (op == t.IDXBinaryOr) {
+				return x
+			}
+			return f.eval(n.RHS().AsExpr(), depth).(bool)
+		}
+		if op == t.IDXBinaryAs {
+			x := f.eval(n.LHS().AsExpr(), depth)
+			return fit(x.(uint64), n.MType())
+		}
+		lhs, rhs := n.LHS().AsExpr(), n.RHS().AsExpr()
+		typ := lhs.MType()
+		if typ.IsIdeal() {
+			typ = rhs.MType()
+		}
+		return f.binaryOp(op, f.eval(lhs, depth), f.eval(rhs, depth), typ)
+	case op.IsXAssociativeOp():
+		return f.evalAssociativeOp(n, depth)
+	}
+	return f.evalOther(n, depth)
+}
+
+func constValue(typ *a.TypeExpr, cv *big.Int) Value {
+	switch {
+	case typ.IsBool():
+		return cv.Sign() != 0
+	case typ.IsNullptr():
+		return nil
+	case cv.IsUint64():
+		return cv.Uint64()
+	case cv.IsInt64():
+		return uint64(cv.Int64())
+	}
+	fail("constant value %v is out of range", cv)
+	return nil
+}
+
+func (f *frame) evalIndex(n *a.Expr) int {
+	x := f.eval(n, 0).(uint64)
+	if x > uint64(int(^uint(0)>>1)) {
+		fail("index %d is out of range", x)
+	}
+	return int(x)
+}
+
+func (f *frame) evalOther(n *a.Expr, depth uint32) Value {
+	switch n.Operator() {
+	case 0:
+		id := n.Ident()
+		if id == t.IDThis {
+			return f.this
+		}
+		if n.GlobalIdent() {
+			return f.m.constant(f.pkg, id)
+		}
+		if v, ok := f.vars[id]; ok {
+			return v
+		}
+		fail("unknown identifier %q", id.Str(f.m.tm))
+
+	case t.IDOpenParen, t.IDTry:
+		return f.evalCall(n, depth)
+
+	case t.IDOpenBracket:
+		i := f.evalIndex(n.RHS().AsExpr())
+		switch x := f.eval(n.LHS().AsExpr(), depth).(type) {
+		case []byte:
+			return uint64(x[i])
+		case []Value:
+			return x[i]
+		}
+
+	case t.IDColon:
+		x := f.eval(n.LHS().AsExpr(), depth)
+		i, j := 0, sliceLen(x)
+		if mhs := n.MHS().AsExpr(); mhs != nil {
+			i = f.evalIndex(mhs)
+		}
+		if rhs := n.RHS().AsExpr(); rhs != nil {
+			j = f.evalIndex(rhs)
+		}
+		return subSlice(x, i, j)
+
+	case t.IDDot:
+		lhs := n.LHS().AsExpr()
+		if lhs.Ident() == t.IDIn {
+			if v, ok := f.args[n.Ident()]; ok {
+				return v
+			}
+			fail("unknown argument %q", n.Ident().Str(f.m.tm))
+		}
+		if o, ok := f.eval(lhs, depth).(*Object); ok && o != nil {
+			return o.fields[n.Ident()]
+		}
+
+	case t.IDError, t.IDStatus, t.IDSuspension:
+		return f.m.status(f.pkg, n)
+	}
+	fail("cannot evaluate %q", n.Str(f.m.tm))
+	return nil
+}
+
+func (f *frame) evalUnaryOp(n *a.Expr, depth uint32) Value {
+	x := f.eval(n.RHS().AsExpr(), depth)
+	switch n.Operator() {
+	case t.IDXUnaryPlus:
+		return x
+	case t.IDXUnaryMinus:
+		return fit(-x.(uint64), n.MType())
+	case t.IDXUnaryNot:
+		return !x.(bool)
+	}
+	fail("unrecognized operator %q", n.Operator().AmbiguousForm().Str(f.m.tm))
+	return nil
+}
+
+func (f *frame) evalAssociativeOp(n *a.Expr, depth uint32) Value {
+	op := n.Operator()
+	switch op {
+	case t.IDXAssociativeAnd, t.IDXAssociativeOr:
+		// Short-circuit evaluation.
+		for _, o := range n.Args() {
+			if x := f.eval(o.AsExpr(), depth).(bool); x == (op == t.IDXAssociativeOr) {
+				return x
+			}
+		}
+		return op == t.IDXAssociativeAnd
+	}
+
+	binOp := op.AmbiguousForm().BinaryForm()
+	ret := Value(nil)
+	for i, o := range n.Args() {
+		x := f.eval(o.AsExpr(), depth)
+		if i == 0 {
+			ret = x
+		} else {
+			ret = f.binaryOp(binOp, ret, x, n.MType())
+		}
+	}
+	return ret
+}
+
+// binaryOp applies op, a t.IDXBinaryEtc operator, to x and y. The typ is the
+// operands' type (for shifts, the left operand's type), which determines the
+// bit width and signedness of numeric operations.
+func (f *frame) binaryOp(op t.ID, x Value, y Value, typ *a.TypeExpr) Value {
+	switch op {
+	case t.IDXBinaryEqEq:
+		return x == y
+	case t.IDXBinaryNotEq:
+		return x != y
+	case t.IDXBinaryAnd:
+		return x.(bool) && y.(bool)
+	case t.IDXBinaryOr:
+		return x.(bool) || y.(bool)
+	}
+
+	u, v := x.(uint64), y.(uint64)
+	if typ.IsSignedInteger() {
+		if ret, ok := signedBinaryOp(op, int64(u), int64(v)); ok {
+			return ret
+		}
+	}
+
+	nBits := numBits(typ)
+	switch op {
+	case t.IDXBinaryLessThan:
+		return u < v
+	case t.IDXBinaryLessEq:
+		return u <= v
+	case t.IDXBinaryGreaterEq:
+		return u >= v
+	case t.IDXBinaryGreaterThan:
+		return u > v
+
+	case t.IDXBinaryPlus, t.IDXBinaryTildeModPlus:
+		return fit(u+v, typ)
+	case t.IDXBinaryMinus, t.IDXBinaryTildeModMinus:
+		return fit(u-v, typ)
+	case t.IDXBinaryStar, t.IDXBinaryTildeModStar:
+		return fit(u*v, typ)
+	case t.IDXBinarySlash:
+		if v == 0 {
+			fail("division by zero")
+		}
+		return u / v
+	case t.IDXBinaryPercent:
+		if v == 0 {
+			fail("division by zero")
+		}
+		return u % v
+	case t.IDXBinaryShiftL, t.IDXBinaryTildeModShiftL:
+		return fit(u<<v, typ)
+	case t.IDXBinaryShiftR:
+		return u >> v
+	case t.IDXBinaryAmp:
+		return u & v
+	case t.IDXBinaryPipe:
+		return u | v
+	case t.IDXBinaryHat:
+		return u ^ v
+
+	case t.IDXBinaryTildeSatPlus:
+		max := mask(^uint64(0), nBits)
+		if ret := u + v; (ret >= u) && (ret <= max) {
+			return ret
+		}
+		return max
+	case t.IDXBinaryTildeSatMinus:
+		if u < v {
+			return uint64(0)
+		}
+		return u - v
+	}
+	fail("unrecognized operator %q (0x%X)", op.AmbiguousForm().Str(f.m.tm), op)
+	return nil
+}
+
+// signedBinaryOp applies those operators whose result depends on whether the
+// operands are signed. The bounds checker has already proven that the results
+// don't overflow.
+func signedBinaryOp(op t.ID, x int64, y int64) (ret Value, ok bool) {
+	switch op {
+	case t.IDXBinaryLessThan:
+		return x < y, true
+	case t.IDXBinaryLessEq:
+		return x <= y, true
+	case t.IDXBinaryGreaterEq:
+		return x >= y, true
+	case t.IDXBinaryGreaterThan:
+		return x > y, true
+	case t.IDXBinarySlash, t.IDXBinaryPercent:
+		if y == 0 {
+			fail("division by zero")
+		}
+		// Like C, Go's signed division truncates towards zero.
+		if op == t.IDXBinarySlash {
+			return uint64(x / y), true
+		}
+		return uint64(x % y), true
+	case t.IDXBinaryShiftR:
+		return uint64(x >> uint64(y)), true
+	}
+	return nil, false
+}
+
+func (m *Machine) constant(p *pkg, id t.ID) Value {
+	if v, ok := p.values[id]; ok {
+		return v
+	}
+	c := p.consts[id]
+	if c == nil {
+		fail("unknown constant %q", id.Str(m.tm))
+	}
+	v := m.constElement(c.Value(), c.XType())
+	p.values[id] = v
+	return v
+}
+
+func (m *Machine) constElement(n *a.Expr, typ *a.TypeExpr) Value {
+	if n.Operator() != t.IDDollar {
+		cv := n.ConstValue()
+		if cv == nil {
+			fail("%q is not a constant expression", n.Str(m.tm))
+		}
+		return constValue(typ, cv)
+	}
+	args := n.Args()
+	if isU8(typ.Inner()) {
+		ret := make([]byte, len(args))
+		for i, o := range args {
+			ret[i] = uint8(m.constElement(o.AsExpr(), typ.Inner()).(uint64))
+		}
+		return ret
+	}
+	ret := make([]Value, len(args))
+	for i, o := range args {
+		ret[i] = m.constElement(o.AsExpr(), typ.Inner())
+	}
+	return ret
+}
+
+func (m *Machine) status(p *pkg, n *a.Expr) Status {
+	msg, _ := t.Unescape(n.Ident().Str(m.tm))
+	if msg == "ok" {
+		return Status{}
+	}
+	z := Status{
+		Keyword: n.Operator(),
+		Message: msg,
+	}
+	if q, err := m.resolve(p, n.StatusQID()[0]); err == nil {
+		if _, ok := q.statuss[n.StatusQID()[1]]; ok {
+			z.Package = q.name
+		}
+	}
+	return z
+}
@@ -0,0 +1,210 @@
+// Copyright 2018 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package interp
+
+import (
+	"fmt"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// frame is the state of one function call.
+type frame struct {
+	m    *Machine
+	pkg  *pkg
+	fn   *a.Func
+	this *Object
+	args map[t.ID]Value
+	vars map[t.ID]Value
+
+	// out holds the out fields, for functions that have any. It is also the
+	// value of the "out" local variable.
+	out *Object
+
+	// co is the coroutine that runs this call, for suspendible functions. It
+	// is nil otherwise.
+	co *coroutine
+
+	// jumpTarget is the loop targeted by the pending break or continue.
+	jumpTarget a.Loop
+	// retValue is the value of the pending return.
+	retValue Value
+}
+
+// coroutine is a suspendible function call running on its own goroutine.
+// When suspended, that goroutine blocks until the coroutine is resumed, with
+// a fresh set of arguments, or abandoned, by closing resume.
+type coroutine struct {
+	resume chan map[t.ID]Value
+	out    chan outcome
+	// done is closed when the coroutine's goroutine exits.
+	done chan struct{}
+
+	// outValue is set, on the coroutine's goroutine, when the call finishes.
+	outValue Value
+}
+
+type outcome struct {
+	status    Status
+	out       Value
+	suspended bool
+	err       interface{}
+}
+
+// abandon ends the suspended coroutine's goroutine, and waits for it to exit.
+func (co *coroutine) abandon() {
+	close(co.resume)
+	<-co.done
+}
+
+// coroutineAbandoned is a panic value that unwinds a suspended coroutine's
+// goroutine when the coroutine is abandoned.
+type coroutineAbandoned struct{}
+
+// statusReturn is a panic value that unwinds a coroutine's goroutine when a
+// (non-try) call returns an error, which the caller then also returns.
+type statusReturn struct {
+	status Status
+}
+
+// suspend passes z to the coroutine's caller and blocks until resumed.
+func (f *frame) suspend(z Status) {
+	if f.co == nil {
+		fail("cannot suspend in non-suspendible %s", f.fn.QQID().Str(f.m.tm))
+	}
+	f.co.out <- outcome{status: z, suspended: true}
+	args, ok := <-f.co.resume
+	if !ok {
+		panic(coroutineAbandoned{})
+	}
+	f.args = args
+}
+
+func (m *Machine) callFunc(p *pkg, fn *a.Func, this *Object, args map[t.ID]Value, co *coroutine) Value {
+	f := &frame{
+		m:    m,
+		pkg:  p,
+		fn:   fn,
+		this: this,
+		args: args,
+		vars: map[t.ID]Value{},
+		co:   co,
+	}
+	if len(fn.Out().Fields()) > 0 {
+		f.out = &Object{pkg: p, decl: fn.Out()}
+		m.resetObject(f.out)
+		f.vars[t.IDOut] = f.out
+	}
+
+	c := f.execBlock(fn.Body(), 0)
+	if fn.Suspendible() {
+		if co != nil {
+			co.outValue = f.outValue()
+		}
+		if c == ctlReturn {
+			return f.retValue
+		}
+		return Status{}
+	}
+	if c == ctlReturn {
+		return f.retValue
+	}
+	return f.outValue()
+}
+
+// outValue is what a function returns, other than its status: nothing, the
+// single out field or, for multiple out fields, an *Object holding them all.
+func (f *frame) outValue() Value {
+	switch outFields := f.fn.Out().Fields(); len(outFields) {
+	case 0:
+		return struct{}{}
+	case 1:
+		return f.out.fields[outFields[0].AsField().Name()]
+	}
+	return f.out
+}
+
+// callSuspendible calls, or resumes, a suspendible method. Like the generated
+// C code, the coroutine state is per receiver, per method, per recursion
+// depth. The out value is only meaningful if the returned status is OK.
+func (m *Machine) callSuspendible(p *pkg, fn *a.Func, this *Object, args map[t.ID]Value) (Status, Value) {
+	depth := this.active[fn]
+	if depth >= maxDepth(fn) {
+		return statusRecursionTooDeep, nil
+	}
+	if this.active == nil {
+		this.active = map[*a.Func]uint32{}
+	}
+	this.active[fn] = depth + 1
+	defer func() { this.active[fn] = depth }()
+
+	key := coroKey{fn, depth}
+	co := this.coros[key]
+	if co == nil {
+		co = &coroutine{
+			resume: make(chan map[t.ID]Value),
+			out:    make(chan outcome),
+			done:   make(chan struct{}),
+		}
+		if this.coros == nil {
+			this.coros = map[coroKey]*coroutine{}
+		}
+		this.coros[key] = co
+		go m.runCoroutine(p, fn, this, args, co)
+	} else {
+		co.resume <- args
+	}
+
+	o := <-co.out
+	if !o.suspended {
+		delete(this.coros, key)
+	}
+	if o.err != nil {
+		panic(o.err)
+	}
+	return o.status, o.out
+}
+
+// maxDepth returns the maximum recursion depth of the suspendible method fn.
+func maxDepth(fn *a.Func) uint32 {
+	if d := fn.Depth(); d != nil {
+		return uint32(d.ConstValue().Uint64())
+	}
+	return 1
+}
+
+func (m *Machine) runCoroutine(p *pkg, fn *a.Func, this *Object, args map[t.ID]Value, co *coroutine) {
+	o := outcome{}
+	defer close(co.done)
+	defer func() {
+		if x := recover(); x != nil {
+			switch x := x.(type) {
+			case coroutineAbandoned:
+				// There is no caller to pass an outcome to.
+				return
+			case statusReturn:
+				o = outcome{status: x.status}
+			case interpError:
+				o = outcome{err: x}
+			default:
+				o = outcome{err: interpError{fmt.Errorf("interp: %v in %s", x, fn.QQID().Str(m.tm))}}
+			}
+		}
+		co.out <- o
+	}()
+	z, _ := m.callFunc(p, fn, this, args, co).(Status)
+	o = outcome{status: z, out: co.outValue}
+}
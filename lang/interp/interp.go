@@ -0,0 +1,437 @@
+// Copyright 2018 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package interp is a tree-walking interpreter for checked Wuffs code.
+//
+// It gives a reference semantics for Wuffs programs that does not need a C
+// compiler: the interpreter walks the AST nodes annotated by the lang/check
+// package, and implements the built-in io_reader, io_writer, slice, table and
+// status methods in Go.
+//
+// Coroutines (suspendible functions) are implemented with one goroutine per
+// suspended call. A suspended coroutine is parked until it is resumed by
+// calling the same method on the same receiver again, mirroring the generated
+// C code's coro_susp_point mechanism, or until the receiver is reset, which
+// ends the goroutine.
+package interp
+
+import (
+	"fmt"
+	"path"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// Value is an interpreted Wuffs value. Its dynamic type is one of:
+//   - uint64, for every integer type. A signed integer is held as its
+//     sign-extended two's complement bit pattern
+//   - bool
+//   - Status
+//   - []byte, for arrays and slices of base.u8
+//   - []Value, for arrays and slices of other element types
+//   - Table
+//   - *Object, for structs and pointers to structs, and for the out fields
+//     of a function that has more than one
+//   - *Reader and *Writer, for base.io_reader and base.io_writer
+//   - struct{}, for base.empty_struct, base.utility and other opaque types
+//   - nil, for the nullptr value
+type Value interface{}
+
+// Table is a 2-dimensional table of base.u8 elements.
+type Table struct {
+	Data   []byte
+	Width  uint64
+	Height uint64
+	Stride uint64
+}
+
+// Object is an instance of a Wuffs struct.
+type Object struct {
+	pkg    *pkg
+	decl   *a.Struct
+	fields map[t.ID]Value
+	coros  map[coroKey]*coroutine
+
+	// active counts, per method, the calls that are in progress. It is the
+	// recursion depth of the next call to that method.
+	active map[*a.Func]uint32
+}
+
+// coroKey identifies a coroutine frame: a method and a recursion depth.
+type coroKey struct {
+	fn    *a.Func
+	depth uint32
+}
+
+// Field returns the named field's value.
+func (o *Object) Field(name t.ID) Value { return o.fields[name] }
+
+type pkg struct {
+	name    string
+	consts  map[t.ID]*a.Const
+	values  map[t.ID]Value
+	funcs   map[t.QQID]*a.Func
+	statuss map[t.ID]*a.Status
+	structs map[t.ID]*a.Struct
+}
+
+// Machine holds the packages that can be interpreted.
+type Machine struct {
+	tm   *t.Map
+	pkgs map[t.ID]*pkg
+}
+
+// NewMachine returns a Machine whose packages' AST nodes use the given token
+// map. Every package added to the Machine must share that map.
+func NewMachine(tm *t.Map) *Machine {
+	return &Machine{
+		tm:   tm,
+		pkgs: map[t.ID]*pkg{},
+	}
+}
+
+// AddPackage adds a checked package. Its name is the base name of its use
+// path, e.g. "deflate" for `use "std/deflate"`.
+func (m *Machine) AddPackage(name string, files []*a.File) error {
+	id, err := m.tm.Insert(path.Base(name))
+	if err != nil {
+		return err
+	}
+	if _, ok := m.pkgs[id]; ok {
+		return fmt.Errorf("interp: duplicate package %q", name)
+	}
+	p := &pkg{
+		name:    path.Base(name),
+		consts:  map[t.ID]*a.Const{},
+		values:  map[t.ID]Value{},
+		funcs:   map[t.QQID]*a.Func{},
+		statuss: map[t.ID]*a.Status{},
+		structs: map[t.ID]*a.Struct{},
+	}
+	for _, f := range files {
+		for _, n := range f.TopLevelDecls() {
+			switch n.Kind() {
+			case a.KConst:
+				o := n.AsConst()
+				p.consts[o.QID()[1]] = o
+			case a.KFunc:
+				o := n.AsFunc()
+				p.funcs[o.QQID()] = o
+			case a.KStatus:
+				o := n.AsStatus()
+				p.statuss[o.QID()[1]] = o
+			case a.KStruct:
+				o := n.AsStruct()
+				p.structs[o.QID()[1]] = o
+			}
+		}
+	}
+	m.pkgs[id] = p
+	return nil
+}
+
+// resolve returns the package for the first element of a QID: zero means the
+// package that contains the node being interpreted.
+func (m *Machine) resolve(curr *pkg, id t.ID) (*pkg, error) {
+	if id == 0 {
+		return curr, nil
+	}
+	if p := m.pkgs[id]; p != nil {
+		return p, nil
+	}
+	return nil, fmt.Errorf("interp: unknown package %q", id.Str(m.tm))
+}
+
+// NewObject returns a zero-valued instance of the named struct.
+func (m *Machine) NewObject(pkgName string, structName string) (*Object, error) {
+	p := m.pkgs[m.tm.ByName(pkgName)]
+	if p == nil {
+		return nil, fmt.Errorf("interp: unknown package %q", pkgName)
+	}
+	s := p.structs[m.tm.ByName(structName)]
+	if s == nil {
+		return nil, fmt.Errorf("interp: unknown struct %s.%s", pkgName, structName)
+	}
+	var o *Object
+	err := catch(func() {
+		o = m.newObject(p, s)
+	})
+	return o, err
+}
+
+func (m *Machine) newObject(p *pkg, s *a.Struct) *Object {
+	o := &Object{
+		pkg:  p,
+		decl: s,
+	}
+	m.resetObject(o)
+	return o
+}
+
+// Reset resets an object to its zero state, like the Wuffs reset method. Any
+// suspended method calls are abandoned. An object that is no longer needed
+// while a method call is suspended should be reset, so that the goroutines
+// running those calls exit.
+func (m *Machine) Reset(o *Object) {
+	m.resetObject(o)
+}
+
+func (m *Machine) resetObject(o *Object) {
+	m.abandonCoroutines(o)
+	o.fields = map[t.ID]Value{}
+	o.coros = nil
+	o.active = nil
+	for _, f := range o.decl.Fields() {
+		f := f.AsField()
+		o.fields[f.Name()] = m.zeroValue(o.pkg, f.XType())
+	}
+}
+
+// abandonCoroutines ends the suspended coroutines of o and of the structs
+// that o's fields hold, as they can no longer be resumed once o is reset.
+// Coroutines that are in progress, further up the call stack, are left alone.
+func (m *Machine) abandonCoroutines(o *Object) {
+	for key, co := range o.coros {
+		if key.depth < o.active[key.fn] {
+			continue
+		}
+		co.abandon()
+		delete(o.coros, key)
+	}
+	if o.decl == nil {
+		return
+	}
+	for _, f := range o.decl.Fields() {
+		f := f.AsField()
+		typ := f.XType()
+		for typ.Decorator() == t.IDArray {
+			typ = typ.Inner()
+		}
+		if typ.Decorator() == 0 {
+			m.abandonValue(o.fields[f.Name()])
+		}
+	}
+}
+
+// abandonValue abandons the coroutines of the structs held, not pointed to,
+// by a field's value v.
+func (m *Machine) abandonValue(v Value) {
+	switch v := v.(type) {
+	case *Object:
+		if v != nil {
+			m.abandonCoroutines(v)
+		}
+	case []Value:
+		for _, x := range v {
+			m.abandonValue(x)
+		}
+	}
+}
+
+// Func returns the named method of the object's struct type.
+func (m *Machine) Func(o *Object, method string) (*a.Func, error) {
+	qqid := t.QQID{0, o.decl.QID()[1], m.tm.ByName(method)}
+	if f := o.pkg.funcs[qqid]; f != nil {
+		return f, nil
+	}
+	return nil, fmt.Errorf("interp: unknown method %s.%s.%s",
+		o.pkg.name, o.decl.QID()[1].Str(m.tm), method)
+}
+
+// Call calls a method on an object. The args are matched, in order, to the
+// method's in-parameters. For a suspendible method, the returned Value is the
+// method's Status. Calling a suspended method again resumes it.
+func (m *Machine) Call(o *Object, method string, args ...Value) (ret Value, retErr error) {
+	f, err := m.Func(o, method)
+	if err != nil {
+		return nil, err
+	}
+	inFields := f.In().Fields()
+	if len(args) != len(inFields) {
+		return nil, fmt.Errorf("interp: %s takes %d arguments, got %d",
+			f.QQID().Str(m.tm), len(inFields), len(args))
+	}
+	argMap := map[t.ID]Value{}
+	for i, field := range inFields {
+		argMap[field.AsField().Name()] = copyArg(args[i])
+	}
+
+	retErr = catch(func() {
+		if f.Suspendible() {
+			ret, _ = m.callSuspendible(o.pkg, f, o, argMap)
+		} else {
+			ret = m.callFunc(o.pkg, f, o, argMap, nil)
+		}
+	})
+	return ret, retErr
+}
+
+// interpError is a panic value that unwinds the Go call stack when the
+// interpreter hits an unsupported or invalid construct.
+type interpError struct {
+	err error
+}
+
+func fail(format string, args ...interface{}) {
+	panic(interpError{fmt.Errorf("interp: "+format, args...)})
+}
+
+// catch runs f, converting any interpError panic into a returned error.
+func catch(f func()) (err error) {
+	defer func() {
+		if x := recover(); x != nil {
+			if e, ok := x.(interpError); ok {
+				err = e.err
+				return
+			}
+			panic(x)
+		}
+	}()
+	f()
+	return nil
+}
+
+func (m *Machine) zeroValue(p *pkg, typ *a.TypeExpr) Value {
+	switch typ.Decorator() {
+	case 0:
+		// No-op.
+	case t.IDArray:
+		n := typ.ArrayLength().ConstValue()
+		if n == nil || !n.IsInt64() {
+			fail("invalid array length for %q", typ.Str(m.tm))
+		}
+		if isU8(typ.Inner()) {
+			return make([]byte, n.Int64())
+		}
+		ret := make([]Value, n.Int64())
+		for i := range ret {
+			ret[i] = m.zeroValue(p, typ.Inner())
+		}
+		return ret
+	case t.IDSlice:
+		if isU8(typ.Inner()) {
+			return []byte(nil)
+		}
+		return []Value(nil)
+	case t.IDTable:
+		return Table{}
+	case t.IDNptr, t.IDPtr:
+		return nil
+	default:
+		fail("cannot make a zero value of type %q", typ.Str(m.tm))
+	}
+
+	qid := typ.QID()
+	if qid[0] == t.IDBase {
+		switch {
+		case qid[1].IsNumType():
+			return uint64(0)
+		case qid[1] == t.IDBool:
+			return false
+		case qid[1] == t.IDStatus:
+			return Status{}
+		case qid[1] == t.IDIOReader:
+			return &Reader{}
+		case qid[1] == t.IDIOWriter:
+			return &Writer{}
+		}
+		return struct{}{}
+	}
+
+	q, err := m.resolve(p, qid[0])
+	if err != nil {
+		panic(interpError{err})
+	}
+	s := q.structs[qid[1]]
+	if s == nil {
+		fail("unknown type %q", typ.Str(m.tm))
+	}
+	return m.newObject(q, s)
+}
+
+// copyValue returns a copy of v, for those values (arrays) that have value
+// semantics but are represented by Go reference types.
+func copyValue(v Value) Value {
+	switch v := v.(type) {
+	case []byte:
+		return append([]byte(nil), v...)
+	case []Value:
+		ret := make([]Value, len(v))
+		for i, x := range v {
+			ret[i] = copyValue(x)
+		}
+		return ret
+	}
+	return v
+}
+
+// copyArg returns the value to pass as a function argument. Like the
+// generated C code, io_reader and io_writer arguments are passed by value:
+// the callee's set_mark and set_limit calls do not affect the caller.
+func copyArg(v Value) Value {
+	switch v := v.(type) {
+	case *Reader:
+		r := *v
+		return &r
+	case *Writer:
+		w := *v
+		return &w
+	}
+	return v
+}
+
+func isU8(typ *a.TypeExpr) bool {
+	return typ.Decorator() == 0 && typ.QID() == t.QID{t.IDBase, t.IDU8}
+}
+
+// numBits returns the bit width of a sized numeric type, or 0 for other types
+// such as the ideal (arbitrary precision) type.
+func numBits(typ *a.TypeExpr) uint32 {
+	if typ == nil || typ.Decorator() != 0 || typ.QID()[0] != t.IDBase {
+		return 0
+	}
+	switch typ.QID()[1] {
+	case t.IDI8, t.IDU8:
+		return 8
+	case t.IDI16, t.IDU16:
+		return 16
+	case t.IDI32, t.IDU32:
+		return 32
+	case t.IDI64, t.IDU64:
+		return 64
+	}
+	return 0
+}
+
+func mask(x uint64, nBits uint32) uint64 {
+	if nBits == 0 || nBits >= 64 {
+		return x
+	}
+	return x & (1<<nBits - 1)
+}
+
+// fit truncates x to typ's bit width. For a signed integer type, it also
+// sign-extends the result.
+func fit(x uint64, typ *a.TypeExpr) uint64 {
+	nBits := numBits(typ)
+	if !typ.IsSignedInteger() {
+		return mask(x, nBits)
+	}
+	if nBits == 0 || nBits >= 64 {
+		return x
+	}
+	s := 64 - nBits
+	return uint64(int64(x<<s) >> s)
+}
@@ -0,0 +1,421 @@
+// Copyright 2018 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package interp
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/wuffs/lang/check"
+	"github.com/google/wuffs/lang/parse"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+const testSrc = `
+packageid "test"
+
+pub error (0x01) "bad zero"
+
+pub struct doubler?(
+	n base.u64,
+	counts array[4] base.u32,
+	delta base.i32,
+)
+
+pub func doubler.sum!(x slice base.u8)(ret base.u32) {
+	var s base.u32
+	iterate (p slice base.u8 =: in.x)(length:2, unroll:2) {
+		s ~mod+= (p[0] as base.u32) ~mod+ (p[1] as base.u32)
+	} else (length:1, unroll:1) {
+		s ~mod+= p[0] as base.u32
+	}
+	return s
+}
+
+pub func doubler.signed!(x base.u8)(ret base.i32) {
+	var d base.i32[-128..127] = (in.x as base.i32) - 128
+	var q base.i32[-50..50] = d / 3
+	var r base.i32[-2..2] = d % 3
+	var s base.i32 = (q * 10) + r + (d >> 4)
+	return s.min(x:200)
+}
+
+pub func doubler.wrap!(x base.u16)(ret base.u32) {
+	var h base.u16 = in.x ~mod* 0x9E37
+	h ~mod*= 3
+	var b base.u8 = ((in.x & 0xFF) as base.u8) ~mod<< 4
+	b ~mod-= 0x80
+	var s base.u8 = b ~sat+ 200
+	return ((h as base.u32) << 16) | ((b as base.u32) << 8) | (s as base.u32)
+}
+
+pub func doubler.read_delta?(src base.io_reader)() {
+	var x base.i16 = in.src.read_i16le?()
+	var y base.i8 = in.src.read_i8?()
+	this.delta = (x as base.i32) - (y as base.i32)
+}
+
+pri func doubler.divmod!(x base.u32, y base.u32[1..])(q base.u32, r base.u32) {
+	out.q = in.x / in.y
+	out.r = in.x % in.y
+}
+
+pub func doubler.split!(x base.u32)(ret base.u64) {
+	var q base.u32
+	var r base.u32
+	q, r = this.divmod!(x:in.x, y:10)
+	return ((q as base.u64) * 100) + (r as base.u64)
+}
+
+pri func doubler.read_pair?(src base.io_reader)(hi base.u8, lo base.u8) {
+	out.hi = in.src.read_u8?()
+	out.lo = in.src.read_u8?()
+}
+
+pub func doubler.read_n?(src base.io_reader)() {
+	var hi base.u8
+	var lo base.u8
+	hi, lo = this.read_pair?(src:in.src)
+	this.n = ((hi as base.u64) * 256) + (lo as base.u64)
+}
+
+pub func doubler.nest?(src base.io_reader)(), depth 3 {
+	var c base.u8 = in.src.read_u8?()
+	if c == 0 {
+		return
+	}
+	this.n ~mod+= 1
+	this.nest?(src:in.src)
+	this.n ~mod+= 0x100
+}
+
+pub func doubler.decode?(dst base.io_writer, src base.io_reader)() {
+	while true {
+		var z base.status = try this.decode_one?(dst:in.dst, src:in.src)
+		if z.is_ok() {
+			break
+		}
+		yield z
+	}
+}
+
+pri func doubler.decode_one?(dst base.io_writer, src base.io_reader)() {
+	var c base.u8
+	while true {
+		c = in.src.read_u8?()
+		if c == 0 {
+			return error "bad zero"
+		} else if c == 0x2E {
+			return
+		}
+		this.n ~mod+= 1
+		this.counts[c & 3] ~sat+= 1
+		in.dst.write_u8?(x:c)
+		in.dst.write_u8?(x:c)
+	}
+}
+`
+
+func load(tt *testing.T, src string) (*Machine, *Object) {
+	tm := &t.Map{}
+	tokens, _, err := t.Tokenize(tm, "test.wuffs", []byte(src))
+	if err != nil {
+		tt.Fatalf("Tokenize: %v", err)
+	}
+	file, err := parse.Parse(tm, "test.wuffs", tokens, nil)
+	if err != nil {
+		tt.Fatalf("Parse: %v", err)
+	}
+	files := []*a.File{file}
+	if _, err := check.Check(tm, files, nil, nil); err != nil {
+		tt.Fatalf("Check: %v", err)
+	}
+	m := NewMachine(tm)
+	if err := m.AddPackage("test", files); err != nil {
+		tt.Fatalf("AddPackage: %v", err)
+	}
+	o, err := m.NewObject("test", "doubler")
+	if err != nil {
+		tt.Fatalf("NewObject: %v", err)
+	}
+	return m, o
+}
+
+func TestPureCall(tt *testing.T) {
+	m, o := load(tt, testSrc)
+	got, err := m.Call(o, "sum", []byte{1, 2, 3, 4, 250})
+	if err != nil {
+		tt.Fatalf("Call: %v", err)
+	}
+	if want := uint64(260); got != want {
+		tt.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestSignedIntegers(tt *testing.T) {
+	m, o := load(tt, testSrc)
+	testCases := []struct {
+		x    uint8
+		want int64
+	}{
+		// d = -128, q = -42, r = -2, d>>4 = -8.
+		{0, -430},
+		// d = -1, q = 0, r = -1, d>>4 = -1.
+		{127, -2},
+		// d = 72, q = 24, r = 0, d>>4 = 4, min(244, 200).
+		{200, 200},
+	}
+	for _, tc := range testCases {
+		got, err := m.Call(o, "signed", uint64(tc.x))
+		if err != nil {
+			tt.Fatalf("x=%d: Call: %v", tc.x, err)
+		}
+		if got := int64(got.(uint64)); got != tc.want {
+			tt.Errorf("x=%d: got %d, want %d", tc.x, got, tc.want)
+		}
+	}
+
+	// 0xFFFE as an i16le is -2, and 0x85 as an i8 is -123.
+	src := &IOBuffer{Data: []byte{0xFE, 0xFF, 0x85}, WI: 3, Closed: true}
+	ret, err := m.Call(o, "read_delta", NewReader(src))
+	if err != nil {
+		tt.Fatalf("read_delta: Call: %v", err)
+	}
+	if !ret.(Status).IsOK() {
+		tt.Fatalf("read_delta: got %v", ret)
+	}
+	if got, want := int64(o.Field(m.tm.ByName("delta")).(uint64)), int64(121); got != want {
+		tt.Errorf("read_delta: got %d, want %d", got, want)
+	}
+}
+
+func TestTildeOperators(tt *testing.T) {
+	m, o := load(tt, testSrc)
+	got, err := m.Call(o, "wrap", uint64(0x1234))
+	if err != nil {
+		tt.Fatalf("Call: %v", err)
+	}
+	// h = (0x1234 * 0x9E37 * 3) & 0xFFFF, b = ((0x34 << 4) - 0x80) & 0xFF
+	// and s = min(b + 200, 0xFF).
+	if want := uint64(0x0384C0FF); got != want {
+		tt.Fatalf("got 0x%X, want 0x%X", got, want)
+	}
+}
+
+func TestMultipleOutFields(tt *testing.T) {
+	m, o := load(tt, testSrc)
+	got, err := m.Call(o, "split", uint64(1234))
+	if err != nil {
+		tt.Fatalf("split: Call: %v", err)
+	}
+	if want := uint64(12304); got != want {
+		tt.Errorf("split: got %v, want %v", got, want)
+	}
+
+	// Feed read_n one byte at a time, so that read_pair suspends after
+	// setting its first out field.
+	src := &IOBuffer{Data: []byte{0x12, 0x34}}
+	for i := 0; ; i++ {
+		if i == 3 {
+			tt.Fatalf("read_n: too many iterations")
+		}
+		src.WI++
+		ret, err := m.Call(o, "read_n", NewReader(src))
+		if err != nil {
+			tt.Fatalf("read_n: Call: %v", err)
+		}
+		if z := ret.(Status); z.IsOK() {
+			break
+		} else if !z.IsSuspension() {
+			tt.Fatalf("read_n: got %v", z)
+		}
+	}
+	if got, want := o.Field(m.tm.ByName("n")), uint64(0x1234); got != want {
+		tt.Errorf("read_n: got %v, want %v", got, want)
+	}
+}
+
+func TestRecursion(tt *testing.T) {
+	testCases := []struct {
+		in      []byte
+		wantN   uint64
+		wantErr bool
+	}{
+		{[]byte{0}, 0x000, false},
+		{[]byte{1, 0}, 0x101, false},
+		{[]byte{1, 1, 0}, 0x202, false},
+		{[]byte{1, 1, 1, 0}, 0x003, true},
+	}
+
+	for _, tc := range testCases {
+		// Feed nest one byte at a time, so that every level of recursion
+		// suspends and resumes.
+		m, o := load(tt, testSrc)
+		src := &IOBuffer{Data: tc.in}
+		for i := 0; ; i++ {
+			if i == len(tc.in) {
+				tt.Fatalf("in=%v: too many iterations", tc.in)
+			}
+			src.WI++
+			ret, err := m.Call(o, "nest", NewReader(src))
+			if err != nil {
+				tt.Fatalf("in=%v: Call: %v", tc.in, err)
+			}
+			z := ret.(Status)
+			if z.IsSuspension() {
+				continue
+			}
+			if gotErr := z.IsError(); gotErr != tc.wantErr {
+				tt.Fatalf("in=%v: got %v, want error %t", tc.in, z, tc.wantErr)
+			}
+			break
+		}
+		if got := o.Field(m.tm.ByName("n")); got != tc.wantN {
+			tt.Errorf("in=%v: got 0x%X, want 0x%X", tc.in, got, tc.wantN)
+		}
+	}
+}
+
+func TestSuspension(tt *testing.T) {
+	const in = "abcdefg."
+	const want = "aabbccddeeffgg"
+
+	for _, closed := range []bool{false, true} {
+		for dstLen := 1; dstLen <= 3; dstLen++ {
+			m, o := load(tt, testSrc)
+			src := &IOBuffer{Data: make([]byte, len(in))}
+			dst := &IOBuffer{Data: make([]byte, dstLen)}
+			got := []byte(nil)
+			for i := 0; ; i++ {
+				if i == 1000 {
+					tt.Fatalf("closed=%t, dstLen=%d: too many iterations", closed, dstLen)
+				}
+				// Feed the input one byte at a time, unless closed.
+				if closed {
+					src.WI = copy(src.Data, in)
+					src.Closed = true
+				} else if src.WI < len(in) {
+					src.Data[src.WI] = in[src.WI]
+					src.WI++
+				}
+				ret, err := m.Call(o, "decode", NewWriter(dst), NewReader(src))
+				if err != nil {
+					tt.Fatalf("Call: %v", err)
+				}
+				got = append(got, dst.Data[:dst.WI]...)
+				dst.WI = 0
+				z := ret.(Status)
+				if z.IsOK() {
+					break
+				}
+				if !z.IsSuspension() {
+					tt.Fatalf("closed=%t, dstLen=%d: got %v", closed, dstLen, z)
+				}
+			}
+			if string(got) != want {
+				tt.Fatalf("closed=%t, dstLen=%d: got %q, want %q", closed, dstLen, got, want)
+			}
+			if n := o.Field(m.tm.ByName("n")); n != uint64(7) {
+				tt.Fatalf("closed=%t, dstLen=%d: n: got %v, want 7", closed, dstLen, n)
+			}
+		}
+	}
+}
+
+func TestResetAbandonsCoroutines(tt *testing.T) {
+	// numGoroutine waits for any exiting goroutines to finish exiting.
+	numGoroutine := func(want int) int {
+		n := runtime.NumGoroutine()
+		for i := 0; i < 100 && n != want; i++ {
+			time.Sleep(10 * time.Millisecond)
+			n = runtime.NumGoroutine()
+		}
+		return n
+	}
+
+	m, o := load(tt, testSrc)
+	before := runtime.NumGoroutine()
+	for i := 0; i < 10; i++ {
+		// With no input, and the input not closed, decode and decode_one
+		// both suspend, parking two goroutines.
+		src := &IOBuffer{}
+		dst := &IOBuffer{Data: make([]byte, 16)}
+		ret, err := m.Call(o, "decode", NewWriter(dst), NewReader(src))
+		if err != nil {
+			tt.Fatalf("Call: %v", err)
+		}
+		if z := ret.(Status); !z.IsSuspension() {
+			tt.Fatalf("got %v, want a suspension", z)
+		}
+		if n := numGoroutine(before + 2); n != before+2 {
+			tt.Fatalf("suspended: got %d goroutines, want %d", n, before+2)
+		}
+		m.Reset(o)
+		if n := numGoroutine(before); n != before {
+			tt.Fatalf("reset: got %d goroutines, want %d", n, before)
+		}
+	}
+
+	// The reset object starts afresh.
+	src := &IOBuffer{Data: []byte("ab."), WI: 3, Closed: true}
+	dst := &IOBuffer{Data: make([]byte, 16)}
+	ret, err := m.Call(o, "decode", NewWriter(dst), NewReader(src))
+	if err != nil {
+		tt.Fatalf("Call: %v", err)
+	}
+	if z := ret.(Status); !z.IsOK() {
+		tt.Fatalf("got %v, want OK", z)
+	}
+	if got, want := string(dst.Data[:dst.WI]), "aabb"; got != want {
+		tt.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestErrors(tt *testing.T) {
+	testCases := []struct {
+		in     string
+		closed bool
+		want   string
+	}{
+		{"ab\x00", false, "error test: bad zero"},
+		{"ab", true, "error unexpected EOF"},
+		{"ab", false, "suspension short read"},
+	}
+
+	for _, tc := range testCases {
+		m, o := load(tt, testSrc)
+		src := &IOBuffer{Data: []byte(tc.in), WI: len(tc.in), Closed: tc.closed}
+		dst := &IOBuffer{Data: make([]byte, 100)}
+		ret, err := m.Call(o, "decode", NewWriter(dst), NewReader(src))
+		if err != nil {
+			tt.Fatalf("in=%q: Call: %v", tc.in, err)
+		}
+		if got := ret.(Status).String(); got != tc.want {
+			tt.Errorf("in=%q: got %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestUnknownMethod(tt *testing.T) {
+	m, o := load(tt, testSrc)
+	if _, err := m.Call(o, "no_such_method"); err == nil ||
+		!strings.Contains(err.Error(), "unknown method") {
+		tt.Fatalf("got %v, want an unknown method error", err)
+	}
+}
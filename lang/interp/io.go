@@ -0,0 +1,124 @@
+// Copyright 2018 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package interp
+
+import (
+	t "github.com/google/wuffs/lang/token"
+)
+
+// Status is an interpreted base.status value. The zero value means "ok".
+type Status struct {
+	Keyword t.ID
+	// Package is the name of the package that declared the status, or empty
+	// for a built-in status.
+	Package string
+	Message string
+}
+
+func (z Status) IsError() bool      { return z.Keyword == t.IDError }
+func (z Status) IsOK() bool         { return z == Status{} }
+func (z Status) IsSuspension() bool { return z.Keyword == t.IDSuspension }
+
+func (z Status) String() string {
+	if z.IsOK() {
+		return "ok"
+	}
+	prefix := "status "
+	switch z.Keyword {
+	case t.IDError:
+		prefix = "error "
+	case t.IDSuspension:
+		prefix = "suspension "
+	}
+	if z.Package != "" {
+		prefix += z.Package + ": "
+	}
+	return prefix + z.Message
+}
+
+var (
+	statusCannotReturnASuspension = Status{Keyword: t.IDError, Message: "cannot return a suspension"}
+	statusRecursionTooDeep        = Status{Keyword: t.IDError, Message: "recursion too deep"}
+	statusUnexpectedEOF           = Status{Keyword: t.IDError, Message: "unexpected EOF"}
+	statusShortRead               = Status{Keyword: t.IDSuspension, Message: "short read"}
+	statusShortWrite              = Status{Keyword: t.IDSuspension, Message: "short write"}
+)
+
+// IOBuffer is the equivalent of the C wuffs_base__io_buffer type. Bytes in
+// Data[RI:WI] have been written but not yet read.
+type IOBuffer struct {
+	Data   []byte
+	WI     int
+	RI     int
+	Closed bool
+}
+
+// Compact moves any written but unread bytes to the start of the buffer.
+func (b *IOBuffer) Compact() {
+	if b.RI == 0 {
+		return
+	}
+	n := copy(b.Data, b.Data[b.RI:b.WI])
+	b.WI = n
+	b.RI = 0
+}
+
+// Reader is an interpreted base.io_reader value. Reading advances its
+// buffer's RI.
+type Reader struct {
+	buf   *IOBuffer
+	mark  int
+	limit int // A negative limit means no limit.
+}
+
+// NewReader returns an io_reader for b, marked at its current read position.
+func NewReader(b *IOBuffer) *Reader {
+	return &Reader{buf: b, mark: b.RI, limit: -1}
+}
+
+func (r *Reader) available() int {
+	if r.buf == nil {
+		return 0
+	}
+	end := r.buf.WI
+	if r.limit >= 0 && end > r.limit {
+		end = r.limit
+	}
+	return end - r.buf.RI
+}
+
+// Writer is an interpreted base.io_writer value. Writing advances its
+// buffer's WI.
+type Writer struct {
+	buf   *IOBuffer
+	mark  int
+	limit int // A negative limit means no limit.
+}
+
+// NewWriter returns an io_writer for b, marked at its current write position.
+func NewWriter(b *IOBuffer) *Writer {
+	return &Writer{buf: b, mark: b.WI, limit: -1}
+}
+
+func (w *Writer) available() int {
+	if w.buf == nil || w.buf.Closed {
+		return 0
+	}
+	end := len(w.buf.Data)
+	if w.limit >= 0 && end > w.limit {
+		end = w.limit
+	}
+	return end - w.buf.WI
+}
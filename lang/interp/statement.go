@@ -0,0 +1,306 @@
+// Copyright 2018 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package interp
+
+import (
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// control is how a statement finished: by falling through to the next
+// statement, or by jumping.
+type control uint32
+
+const (
+	ctlNext = control(iota)
+	ctlBreak
+	ctlContinue
+	ctlReturn
+)
+
+func (f *frame) execBlock(block []*a.Node, depth uint32) control {
+	if depth > a.MaxBodyDepth {
+		fail("body recursion depth too large")
+	}
+	depth++
+
+	for _, o := range block {
+		if c := f.exec(o, depth); c != ctlNext {
+			return c
+		}
+	}
+	return ctlNext
+}
+
+func (f *frame) exec(n *a.Node, depth uint32) control {
+	switch n.Kind() {
+	case a.KAssert:
+		// Assertions only apply at compile-time.
+	case a.KAssign:
+		f.execAssign(n.AsAssign())
+	case a.KExpr:
+		f.eval(n.AsExpr(), 0)
+	case a.KIOBind:
+		return f.execIOBind(n.AsIOBind(), depth)
+	case a.KIf:
+		return f.execIf(n.AsIf(), depth)
+	case a.KIterate:
+		return f.execIterate(n.AsIterate(), depth)
+	case a.KJump:
+		o := n.AsJump()
+		f.jumpTarget = o.JumpTarget()
+		if o.Keyword() == t.IDBreak {
+			return ctlBreak
+		}
+		return ctlContinue
+	case a.KRet:
+		return f.execRet(n.AsRet())
+	case a.KVar:
+		f.execVar(n.AsVar())
+	case a.KWhile:
+		return f.execWhile(n.AsWhile(), depth)
+	default:
+		fail("unrecognized statement kind (%s)", n.Kind())
+	}
+	return ctlNext
+}
+
+func (f *frame) execAssign(n *a.Assign) {
+	if n.Destructuring() {
+		out, ok := f.eval(n.RHS(), 0).(*Object)
+		if !ok || out == nil {
+			fail("cannot destructure %q", n.RHS().Str(f.m.tm))
+		}
+		outFields := out.decl.Fields()
+		for i, o := range n.LHSList() {
+			f.store(o.AsExpr(), copyValue(out.fields[outFields[i].AsField().Name()]))
+		}
+		return
+	}
+
+	lhs := n.LHS()
+	if op := n.Operator(); op != t.IDEq {
+		x := f.eval(lhs, 0)
+		y := f.eval(n.RHS(), 0)
+		f.store(lhs, f.binaryOp(op.BinaryForm(), x, y, lhs.MType()))
+		return
+	}
+	v := f.eval(n.RHS(), 0)
+	if lhs.MType().IsArrayType() {
+		v = copyValue(v)
+	}
+	f.store(lhs, v)
+}
+
+// store assigns v to the location denoted by the assignable expression n.
+func (f *frame) store(n *a.Expr, v Value) {
+	switch n.Operator() {
+	case 0:
+		f.vars[n.Ident()] = v
+		return
+
+	case t.IDDot:
+		if lhs := n.LHS().AsExpr(); lhs.Ident() == t.IDIn {
+			f.args[n.Ident()] = v
+		} else if o, ok := f.eval(lhs, 0).(*Object); ok && o != nil {
+			o.fields[n.Ident()] = v
+		} else {
+			fail("cannot assign to %q", n.Str(f.m.tm))
+		}
+		return
+
+	case t.IDOpenBracket:
+		i := f.evalIndex(n.RHS().AsExpr())
+		switch x := f.eval(n.LHS().AsExpr(), 0).(type) {
+		case []byte:
+			x[i] = uint8(v.(uint64))
+			return
+		case []Value:
+			x[i] = v
+			return
+		}
+	}
+	fail("cannot assign to %q", n.Str(f.m.tm))
+}
+
+func (f *frame) execIOBind(n *a.IOBind, depth uint32) control {
+	// The io_bind statement restores its io_reader and io_writer arguments'
+	// state (but not their buffers' read and write indexes) afterwards.
+	restores := []func(){}
+	for _, o := range n.InFields() {
+		switch x := f.eval(o.AsExpr(), 0).(type) {
+		case *Reader:
+			saved := *x
+			restores = append(restores, func() { *x = saved })
+		case *Writer:
+			saved := *x
+			restores = append(restores, func() { *x = saved })
+		default:
+			fail("cannot io_bind %q", o.AsExpr().Str(f.m.tm))
+		}
+	}
+	defer func() {
+		for i := len(restores) - 1; i >= 0; i-- {
+			restores[i]()
+		}
+	}()
+	return f.execBlock(n.Body(), depth)
+}
+
+func (f *frame) execIf(n *a.If, depth uint32) control {
+	for ; n != nil; n = n.ElseIf() {
+		if f.eval(n.Condition(), 0).(bool) {
+			return f.execBlock(n.BodyIfTrue(), depth)
+		}
+		if bif := n.BodyIfFalse(); len(bif) > 0 {
+			return f.execBlock(bif, depth)
+		}
+	}
+	return ctlNext
+}
+
+func (f *frame) execIterate(n *a.Iterate, depth uint32) control {
+	vars := n.Variables()
+	if len(vars) == 0 {
+		return ctlNext
+	}
+
+	// The iterate variables advance in lock step.
+	slices := make([]Value, len(vars))
+	for i, o := range vars {
+		slices[i] = f.eval(o.AsVar().Value(), 0)
+	}
+
+	// Loop unrolling is an optimization hint that does not change the
+	// semantics, so the unroll argument is ignored.
+	loop := a.Loop(n)
+	for ; n != nil; n = n.ElseIterate() {
+		length := n.Length().SmallPowerOf2Value()
+		for minSliceLen(slices) >= length {
+			for i, o := range vars {
+				f.vars[o.AsVar().Name()] = subSlice(slices[i], 0, length)
+				slices[i] = subSlice(slices[i], length, sliceLen(slices[i]))
+			}
+			switch c := f.execBlock(n.Body(), depth); c {
+			case ctlBreak:
+				if f.jumpTarget.AsNode() == loop.AsNode() {
+					return ctlNext
+				}
+				return c
+			case ctlContinue:
+				if f.jumpTarget.AsNode() != loop.AsNode() {
+					return c
+				}
+			case ctlReturn:
+				return c
+			}
+		}
+	}
+	return ctlNext
+}
+
+func (f *frame) execRet(n *a.Ret) control {
+	v := Value(nil)
+	if retExpr := n.Value(); retExpr != nil {
+		v = f.eval(retExpr, 0)
+	} else if f.fn.Suspendible() {
+		v = Status{}
+	} else {
+		// A bare return returns the out fields.
+		v = f.outValue()
+	}
+
+	if !f.fn.Suspendible() {
+		f.retValue = v
+		return ctlReturn
+	}
+
+	z, ok := v.(Status)
+	if !ok {
+		fail("TODO: suspendible %s returning a non-status value", f.fn.QQID().Str(f.m.tm))
+	}
+	if n.Keyword() == t.IDYield {
+		f.suspend(z)
+		return ctlNext
+	}
+	if z.IsSuspension() {
+		z = statusCannotReturnASuspension
+	}
+	f.retValue = z
+	return ctlReturn
+}
+
+func (f *frame) execVar(n *a.Var) {
+	if n.Value() == nil {
+		f.vars[n.Name()] = f.m.zeroValue(f.pkg, n.XType())
+		return
+	}
+	v := f.eval(n.Value(), 0)
+	if n.XType().IsArrayType() {
+		v = copyValue(v)
+	}
+	f.vars[n.Name()] = v
+}
+
+func (f *frame) execWhile(n *a.While, depth uint32) control {
+	for f.eval(n.Condition(), 0).(bool) {
+		switch c := f.execBlock(n.Body(), depth); c {
+		case ctlBreak:
+			if f.jumpTarget.AsNode() == n.AsNode() {
+				return ctlNext
+			}
+			return c
+		case ctlContinue:
+			if f.jumpTarget.AsNode() != n.AsNode() {
+				return c
+			}
+		case ctlReturn:
+			return c
+		}
+	}
+	return ctlNext
+}
+
+func sliceLen(v Value) int {
+	switch v := v.(type) {
+	case []byte:
+		return len(v)
+	case []Value:
+		return len(v)
+	}
+	fail("%T is not a slice", v)
+	return 0
+}
+
+func minSliceLen(slices []Value) int {
+	ret := sliceLen(slices[0])
+	for _, s := range slices[1:] {
+		if n := sliceLen(s); ret > n {
+			ret = n
+		}
+	}
+	return ret
+}
+
+func subSlice(v Value, i int, j int) Value {
+	switch v := v.(type) {
+	case []byte:
+		return v[i:j]
+	case []Value:
+		return v[i:j]
+	}
+	fail("%T is not a slice", v)
+	return nil
+}
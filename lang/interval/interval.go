@@ -225,6 +225,47 @@ func (x IntRange) Empty() bool {
 	return x[0] != nil && x[1] != nil && x[0].Cmp(x[1]) > 0
 }
 
+// Unite returns z = x ∪ y, or more precisely, the smallest interval that
+// contains both x and y. Unlike the arithmetic operations, this is not an
+// element-wise operation: the union of [0, 1] and [5, 6] is [0, 6].
+func (x IntRange) Unite(y IntRange) (z IntRange) {
+	if x.Empty() {
+		return y
+	}
+	if y.Empty() {
+		return x
+	}
+	if x[0] != nil && y[0] != nil {
+		z[0] = x[0]
+		if y[0].Cmp(x[0]) < 0 {
+			z[0] = y[0]
+		}
+	}
+	if x[1] != nil && y[1] != nil {
+		z[1] = x[1]
+		if y[1].Cmp(x[1]) > 0 {
+			z[1] = y[1]
+		}
+	}
+	return z
+}
+
+// Intersect returns z = x ∩ y.
+func (x IntRange) Intersect(y IntRange) (z IntRange) {
+	if x.Empty() || y.Empty() {
+		return empty()
+	}
+	z[0] = x[0]
+	if z[0] == nil || (y[0] != nil && y[0].Cmp(z[0]) > 0) {
+		z[0] = y[0]
+	}
+	z[1] = x[1]
+	if z[1] == nil || (y[1] != nil && y[1].Cmp(z[1]) < 0) {
+		z[1] = y[1]
+	}
+	return z
+}
+
 // justZero returns whether x is the [0, 0] interval, containing exactly one
 // element: the integer zero.
 func (x IntRange) justZero() bool {
@@ -471,6 +512,280 @@ func (x IntRange) Quo(y IntRange) (z IntRange, ok bool) {
 	return ret.toIntRange(), true
 }
 
+// Rem returns z = x % y. Like the big.Int.Rem method (and unlike the
+// big.Int.Mod method), it truncates towards zero: any non-zero result has the
+// same sign as x.
+//
+// ok is false (and z will be IntRange{nil, nil}) if x is non-empty and y
+// contains zero, as it's invalid to divide by zero. Otherwise, ok is true.
+//
+// The bounds are exact, except that if y's absolute values span a very wide
+// range then finding them can be as hard as factoring. Rem gives up after
+// remMaxSteps steps of its search, falling back to looser (but still valid)
+// bounds, such as [0, |y|-1] when x is non-negative.
+func (x IntRange) Rem(y IntRange) (z IntRange, ok bool) {
+	if x.Empty() || y.Empty() {
+		return empty(), true
+	}
+	if y.ContainsZero() {
+		return IntRange{}, false
+	}
+
+	// (x % y) equals (x % |y|). Let [p, q] be the interval of |y|'s values. A
+	// nil q means that |y| can be arbitrarily large.
+	p, q := y[0], y[1]
+	if y[1] != nil && y[1].Sign() < 0 {
+		p = big.NewInt(0).Neg(y[1])
+		q = nil
+		if y[0] != nil {
+			q = big.NewInt(0).Neg(y[0])
+		}
+	}
+
+	ret := newBiggerIntPair()
+
+	// Split x into negative, zero and positive parts.
+	negX, posX, negXEmpty, zeroX, posXEmpty := x.split()
+
+	if zeroX {
+		ret[0] = biggerInt{i: big.NewInt(0)}
+		ret[1] = biggerInt{i: big.NewInt(0)}
+	}
+
+	if !negXEmpty {
+		// x is negative, so x % y is non-positive. It equals -((-x) % |y|).
+		a := IntRange{big.NewInt(0).Neg(negX[1]), nil}
+		if negX[0] != nil {
+			a[1] = big.NewInt(0).Neg(negX[0])
+		}
+		lo, hi := remNonNeg(a, p, q)
+		if hi == nil {
+			ret.lowerMin(biggerInt{extra: -1})
+		} else {
+			ret.lowerMin(biggerInt{i: hi.Neg(hi)})
+		}
+		ret.raiseMax(biggerInt{i: lo.Neg(lo)})
+	}
+
+	if !posXEmpty {
+		// x is positive, so x % y is non-negative.
+		lo, hi := remNonNeg(posX, p, q)
+		ret.lowerMin(biggerInt{i: lo})
+		if hi == nil {
+			ret.raiseMax(biggerInt{extra: +1})
+		} else {
+			ret.raiseMax(biggerInt{i: hi})
+		}
+	}
+
+	return ret.toIntRange(), true
+}
+
+// remMaxSteps bounds the number of quotient values that remMin and remMax
+// consider before giving up on an exact answer.
+const remMaxSteps = 1024
+
+// remNonNeg returns the minimum and maximum of (xx % yy), for all possible xx
+// in a and yy in [p, q]. a must be non-empty and non-negative, and p must be
+// positive. a[1] or q may be nil, meaning +∞. A nil hi means +∞.
+//
+// The returned values are newly allocated, so that the caller may modify
+// them.
+func remNonNeg(a IntRange, p *big.Int, q *big.Int) (lo *big.Int, hi *big.Int) {
+	if a[1] == nil {
+		// xx can be arbitrarily large, so it can take every remainder value.
+		lo = big.NewInt(0)
+		if q != nil {
+			hi = big.NewInt(0).Sub(q, one)
+		}
+		return lo, hi
+	}
+
+	if q == nil || q.Cmp(a[1]) > 0 {
+		// Some yy is greater than every xx, for which (xx % yy) equals xx.
+		hi = big.NewInt(0).Set(a[1])
+	} else {
+		hi = remMax(a[0], a[1], p, q)
+	}
+	return remMin(a[0], a[1], p, q), hi
+}
+
+// remMax returns the maximum of (xx % yy), for all possible xx in [a0, a1] and
+// yy in [p, q], where 0 <= a0 <= a1 and 0 < p <= q <= a1.
+//
+// It partitions [p, q] into runs of yy that share the same quotient k = (a1 /
+// yy), working from larger yy (smaller k) to smaller yy (larger k). Within a
+// run [l, u], the largest remainder is (u - 1) if some xx in [a0, a1] is just
+// below a multiple of u. Otherwise, every xx has quotient k and the largest
+// remainder is (a1 - k*l). Every remainder in later runs is less than l, which
+// lets the search stop early.
+func remMax(a0 *big.Int, a1 *big.Int, p *big.Int, q *big.Int) *big.Int {
+	best := big.NewInt(-1)
+	k := bigIntQuo(a1, q)
+	u := big.NewInt(0)
+	l := big.NewInt(0)
+	t := big.NewInt(0)
+
+	for steps := 0; ; steps++ {
+		// u = min(q, a1 / k).
+		u.Quo(a1, k)
+		if u.Cmp(q) > 0 {
+			u.Set(q)
+		}
+		// l = max(p, a1 / (k+1) + 1).
+		t.Add(k, one)
+		l.Quo(a1, t)
+		l.Add(l, one)
+		if l.Cmp(p) < 0 {
+			l.Set(p)
+		}
+
+		// Every remainder in this run or later runs is at most (u - 1).
+		u.Sub(u, one)
+		if u.Cmp(best) <= 0 {
+			return best
+		}
+		if steps == remMaxSteps {
+			return u
+		}
+		u.Add(u, one)
+
+		// If u > (a0 / k) then (k*u - 1) is in [a0, a1].
+		if u.Cmp(t.Quo(a0, k)) > 0 {
+			return u.Sub(u, one)
+		}
+
+		// t = a1 - k*l.
+		t.Mul(k, l)
+		t.Sub(a1, t)
+		if t.Cmp(best) > 0 {
+			best.Set(t)
+		}
+
+		if l.Cmp(p) <= 0 {
+			return best
+		}
+		k.Quo(a1, t.Sub(l, one))
+	}
+}
+
+// remMin returns the minimum of (xx % yy), for all possible xx in [a0, a1] and
+// yy in [p, q], where 0 <= a0 <= a1 and 0 < p. q may be nil, meaning +∞.
+//
+// Like remMax, it partitions [p, q] into runs of yy that share the same
+// quotient, but here the quotient is k = (a0 / yy). Within a run [l, u], the
+// remainder is zero if some xx in [a0, a1] is a multiple of l. Otherwise,
+// every xx has quotient k and the smallest remainder is (a0 - k*u).
+func remMin(a0 *big.Int, a1 *big.Int, p *big.Int, q *big.Int) *big.Int {
+	if a0.Sign() == 0 {
+		return big.NewInt(0)
+	}
+
+	best := (*big.Int)(nil)
+	k := big.NewInt(0)
+	u := big.NewInt(0)
+	l := big.NewInt(0)
+	t := big.NewInt(0)
+
+	if q == nil || q.Cmp(a0) > 0 {
+		// The run for k == 0 is every yy greater than a0.
+		l.Add(a0, one)
+		if l.Cmp(p) < 0 {
+			l.Set(p)
+		}
+		if l.Cmp(a1) <= 0 {
+			return big.NewInt(0)
+		}
+		// Every such yy is greater than a1, so (xx % yy) equals xx.
+		best = big.NewInt(0).Set(a0)
+		if l.Cmp(p) <= 0 {
+			return best
+		}
+		k.SetInt64(1)
+	} else {
+		k.Quo(a0, q)
+	}
+
+	for steps := 0; ; steps++ {
+		if steps == remMaxSteps {
+			return big.NewInt(0)
+		}
+
+		// u = min(q, a0 / k).
+		u.Quo(a0, k)
+		if q != nil && u.Cmp(q) > 0 {
+			u.Set(q)
+		}
+		// l = max(p, a0 / (k+1) + 1).
+		t.Add(k, one)
+		l.Quo(a0, t)
+		l.Add(l, one)
+		if l.Cmp(p) < 0 {
+			l.Set(p)
+		}
+
+		// If (k+1)*l <= a1 then that multiple of l is in [a0, a1].
+		if t.Mul(t, l).Cmp(a1) <= 0 {
+			return big.NewInt(0)
+		}
+
+		// t = a0 - k*u.
+		t.Mul(k, u)
+		t.Sub(a0, t)
+		if best == nil {
+			best = big.NewInt(0).Set(t)
+		} else if t.Cmp(best) < 0 {
+			best.Set(t)
+		}
+		if best.Sign() == 0 {
+			return best
+		}
+
+		if l.Cmp(p) <= 0 {
+			return best
+		}
+		k.Quo(a0, t.Sub(l, one))
+	}
+}
+
+// Min returns z = min(x, y). This is element-wise: z contains min(xx, yy) for
+// all possible xx in x and yy in y.
+func (x IntRange) Min(y IntRange) (z IntRange) {
+	if x.Empty() || y.Empty() {
+		return empty()
+	}
+	if x[0] != nil && y[0] != nil {
+		z[0] = x[0]
+		if y[0].Cmp(x[0]) < 0 {
+			z[0] = y[0]
+		}
+	}
+	z[1] = x[1]
+	if z[1] == nil || (y[1] != nil && y[1].Cmp(z[1]) < 0) {
+		z[1] = y[1]
+	}
+	return z
+}
+
+// Max returns z = max(x, y). This is element-wise: z contains max(xx, yy) for
+// all possible xx in x and yy in y.
+func (x IntRange) Max(y IntRange) (z IntRange) {
+	if x.Empty() || y.Empty() {
+		return empty()
+	}
+	z[0] = x[0]
+	if z[0] == nil || (y[0] != nil && y[0].Cmp(z[0]) > 0) {
+		z[0] = y[0]
+	}
+	if x[1] != nil && y[1] != nil {
+		z[1] = x[1]
+		if y[1].Cmp(x[1]) > 0 {
+			z[1] = y[1]
+		}
+	}
+	return z
+}
+
 // Rsh returns z = x >> y.
 //
 // ok is false (and z will be IntRange{nil, nil}) if x is non-empty and y
@@ -646,6 +961,139 @@ func (x IntRange) Or(y IntRange) (z IntRange, ok bool) {
 	return IntRange{zMin, zMax}, true
 }
 
+// Xor returns z = x ^ y.
+//
+// ok is false (and z will be IntRange{nil, nil}) if x or y contains at least
+// one negative value. Otherwise, ok is true.
+//
+// TODO: implement bit-wise operations (with tight bounds) on negative
+// integers. In that case, we could drop the "ok" return value.
+func (x IntRange) Xor(y IntRange) (z IntRange, ok bool) {
+	if x.Empty() || y.Empty() {
+		return empty(), true
+	}
+	if x.ContainsNegative() || y.ContainsNegative() {
+		return IntRange{}, false
+	}
+
+	if x[1] != nil && y[1] != nil {
+		return IntRange{xorMin(x, y), xorMax(x, y)}, true
+	}
+	if x[1] == nil && y[1] == nil {
+		// Both xx and yy can be the same arbitrarily large value.
+		return IntRange{big.NewInt(0), nil}, true
+	}
+
+	// Exactly one of the two intervals has an infinite upper bound. Without
+	// loss of generality, assume that that interval is y.
+	//
+	// (x ^ y) can be arbitrarily large, so z[1] is nil. For z[0], any yy
+	// greater than n = bitFillRight(max(xMax, yMin)) has a bit set that is
+	// not set in any xx, so that (xx ^ yy) > n. But (xx ^ yMin) <= n, so we
+	// can replace the infinite upper bound y[1] with n.
+	if x[1] == nil {
+		x, y = y, x
+	}
+	n := big.NewInt(0).Set(x[1])
+	if n.Cmp(y[0]) < 0 {
+		n.Set(y[0])
+	}
+	bitFillRight(n)
+	y[1] = n
+	return IntRange{xorMin(x, y), nil}, true
+}
+
+// xorMin and xorMax return exact solutions for the minimum and maximum
+// possible (xx ^ yy), for all possible xx in x and yy in y. x and y must be
+// finite and non-negative.
+//
+// The algorithms are from "Hacker's Delight" (second edition), section 4-3,
+// by Henry S. Warren, Jr. Working from the high bit down, xorMin sets a bit
+// in whichever of xMin or yMin lacks it (clearing the bits to its right), to
+// cancel out the other's bit, if that stays within range. Likewise, when a
+// bit is set in both xMax and yMax, xorMax clears that bit in one of them (and
+// sets all the bits to its right), if that stays within range.
+func xorMin(x IntRange, y IntRange) *big.Int {
+	a := big.NewInt(0).Set(x[0])
+	c := big.NewInt(0).Set(y[0])
+	t := big.NewInt(0)
+	n := x[1].BitLen()
+	if m := y[1].BitLen(); n < m {
+		n = m
+	}
+	for i := n - 1; i >= 0; i-- {
+		ai, ci := a.Bit(i), c.Bit(i)
+		if ai == 0 && ci == 1 {
+			xorMinStep(t, a, uint(i))
+			if t.Cmp(x[1]) <= 0 {
+				a.Set(t)
+			}
+		} else if ai == 1 && ci == 0 {
+			xorMinStep(t, c, uint(i))
+			if t.Cmp(y[1]) <= 0 {
+				c.Set(t)
+			}
+		}
+	}
+	return a.Xor(a, c)
+}
+
+// xorMinStep sets t to v with bit i set and all bits to its right cleared.
+func xorMinStep(t *big.Int, v *big.Int, i uint) {
+	t.Rsh(v, i)
+	t.SetBit(t, 0, 1)
+	t.Lsh(t, i)
+}
+
+func xorMax(x IntRange, y IntRange) *big.Int {
+	b := big.NewInt(0).Set(x[1])
+	d := big.NewInt(0).Set(y[1])
+	t := big.NewInt(0)
+	n := b.BitLen()
+	if m := d.BitLen(); n < m {
+		n = m
+	}
+	for i := n - 1; i >= 0; i-- {
+		if b.Bit(i) == 0 || d.Bit(i) == 0 {
+			continue
+		}
+		xorMaxStep(t, b, uint(i))
+		if t.Cmp(x[0]) >= 0 {
+			b.Set(t)
+			continue
+		}
+		xorMaxStep(t, d, uint(i))
+		if t.Cmp(y[0]) >= 0 {
+			d.Set(t)
+		}
+	}
+	return b.Xor(b, d)
+}
+
+// xorMaxStep sets t to v with bit i cleared and all bits to its right set.
+func xorMaxStep(t *big.Int, v *big.Int, i uint) {
+	t.SetInt64(1)
+	t.Lsh(t, i)
+	t.Sub(t, one)
+	t.Or(t, v)
+	t.SetBit(t, int(i), 0)
+}
+
+// Not returns z = ^x, the bit-wise complement of x. For two's complement
+// integers, ^xx equals (-xx - 1).
+func (x IntRange) Not() (z IntRange) {
+	if x.Empty() {
+		return empty()
+	}
+	if x[1] != nil {
+		z[0] = big.NewInt(0).Not(x[1])
+	}
+	if x[0] != nil {
+		z[1] = big.NewInt(0).Not(x[0])
+	}
+	return z
+}
+
 // The andMax and orMax algorithms are tricky.
 //
 // First, some notation. Let x and y be intervals, and in math notation, denote
@@ -418,14 +418,18 @@ func testOp1(s string) error {
 }
 
 var intOperators = map[string]func(IntRange, IntRange) (IntRange, bool){
-	"+":  func(x IntRange, y IntRange) (z IntRange, ok bool) { return x.Add(y), true },
-	"-":  func(x IntRange, y IntRange) (z IntRange, ok bool) { return x.Sub(y), true },
-	"*":  func(x IntRange, y IntRange) (z IntRange, ok bool) { return x.Mul(y), true },
-	"/":  IntRange.Quo,
-	"<<": IntRange.Lsh,
-	">>": IntRange.Rsh,
-	"&":  IntRange.And,
-	"|":  IntRange.Or,
+	"+":   func(x IntRange, y IntRange) (z IntRange, ok bool) { return x.Add(y), true },
+	"-":   func(x IntRange, y IntRange) (z IntRange, ok bool) { return x.Sub(y), true },
+	"*":   func(x IntRange, y IntRange) (z IntRange, ok bool) { return x.Mul(y), true },
+	"/":   IntRange.Quo,
+	"%":   IntRange.Rem,
+	"<<":  IntRange.Lsh,
+	">>":  IntRange.Rsh,
+	"&":   IntRange.And,
+	"|":   IntRange.Or,
+	"^":   IntRange.Xor,
+	"min": func(x IntRange, y IntRange) (z IntRange, ok bool) { return x.Min(y), true },
+	"max": func(x IntRange, y IntRange) (z IntRange, ok bool) { return x.Max(y), true },
 }
 
 var intOperatorsKeys []string
@@ -828,3 +832,186 @@ func TestOpOr(tt *testing.T) {
 		"[   5,    9]   |  [  12,   +∞)  ==  [  12,   +∞)",
 	)
 }
+
+func TestOpRem(tt *testing.T) {
+	testOp(tt,
+		"[   7,    7]   %  [   3,    3]  ==  [   1,    1]",
+		"[  -7,   -7]   %  [   3,    3]  ==  [  -1,   -1]",
+		"[   7,    7]   %  [  -3,   -3]  ==  [   1,    1]",
+		"[  -7,   -7]   %  [  -3,   -3]  ==  [  -1,   -1]",
+		"[   0,   10]   %  [   0,    3]  ==  invalid",
+		"[   0,   10]   %  [  -2,    3]  ==  invalid",
+		"[   3,    6]   %  [...empty..]  ==  [...empty..]",
+		"[...empty..]   %  [   0,    0]  ==  [...empty..]",
+		"[...empty..]   %  [...empty..]  ==  [...empty..]",
+
+		"[   0,   10]   %  [   4,    4]  ==  [   0,    3]",
+		"[   5,    6]   %  [   4,    4]  ==  [   1,    2]",
+		"[   5,    6]   %  [   7,    9]  ==  [   5,    6]",
+		"[  -9,    9]   %  [   4,    4]  ==  [  -3,    3]",
+		"[  -9,    9]   %  [  -4,   -4]  ==  [  -3,    3]",
+		"[  -2,    9]   %  [   4,    4]  ==  [  -2,    3]",
+
+		"[  10,   10]   %  [   3,    6]  ==  [   0,    4]",
+		"[  11,   11]   %  [   3,    6]  ==  [   1,    5]",
+		"[  13,   13]   %  [   2,    6]  ==  [   1,    3]",
+		"[  13,   13]   %  [  -6,   -2]  ==  [   1,    3]",
+		"[ -13,  -13]   %  [   2,    6]  ==  [  -3,   -1]",
+		"[  13,   14]   %  [   5,    6]  ==  [   1,    4]",
+		"[  12,   14]   %  [  10,   11]  ==  [   1,    4]",
+
+		"[   3,   +∞)   %  [   4,    4]  ==  [   0,    3]",
+		"(  -∞,   -3]   %  [   4,    4]  ==  [  -3,    0]",
+		"(  -∞,   +∞)   %  [   5,    5]  ==  [  -4,    4]",
+		"[   3,   +∞)   %  [   5,   +∞)  ==  [   0,   +∞)",
+		"(  -∞,   -3]   %  (  -∞,   -5]  ==  (  -∞,    0]",
+		"[   3,    6]   %  (  -∞,   -8]  ==  [   3,    6]",
+		"[   3,    6]   %  [   2,   +∞)  ==  [   0,    6]",
+		"[  -6,   -3]   %  [   5,   +∞)  ==  [  -6,    0]",
+		"[  -3,    6]   %  (  -∞,   +∞)  ==  invalid",
+	)
+}
+
+func TestOpXor(tt *testing.T) {
+	testOp(tt,
+		"[   3,    3]   ^  [  -5,   -5]  ==  invalid",
+		"[   3,    3]   ^  [   0,    0]  ==  [   3,    3]",
+		"[   0,    0]   ^  [  -7,    7]  ==  invalid",
+		"[   0,    2]   ^  [   0,    5]  ==  [   0,    7]",
+		"[   3,    6]   ^  [  10,   15]  ==  [   8,   15]",
+		"[   3,   +∞)   ^  [  -4,   -2]  ==  invalid",
+		"[   3,   +∞)   ^  [  10,   15]  ==  [   0,   +∞)",
+		"[   3,   +∞)   ^  (  -∞,   15]  ==  invalid",
+		"(  -∞,   +∞)   ^  (  -∞,   +∞)  ==  invalid",
+		"[   3,    6]   ^  [...empty..]  ==  [...empty..]",
+		"[...empty..]   ^  [  10,   15]  ==  [...empty..]",
+		"[...empty..]   ^  [...empty..]  ==  [...empty..]",
+		"(  -∞,   +∞)   ^  [...empty..]  ==  [...empty..]",
+
+		"[   0,    4]   ^  [   0,    3]  ==  [   0,    7]",
+		"[   1,    4]   ^  [   2,    3]  ==  [   0,    7]",
+		"[   4,    4]   ^  [   2,    3]  ==  [   6,    7]",
+
+		"[   0,   +∞)   ^  [   2,   +∞)  ==  [   0,   +∞)",
+		"[   7,   +∞)   ^  [   2,   +∞)  ==  [   0,   +∞)",
+
+		"[   1,    3]   ^  [   4,    9]  ==  [   4,   11]",
+		"[   3,    4]   ^  [   5,    6]  ==  [   1,    6]",
+		"[   4,    5]   ^  [   6,    7]  ==  [   2,    3]",
+		"[   7,    7]   ^  [  12,   14]  ==  [   9,   11]",
+
+		"[   5,    6]   ^  [   3,   +∞)  ==  [   0,   +∞)",
+		"[   5,    6]   ^  [   7,   +∞)  ==  [   1,   +∞)",
+		"[   5,    6]   ^  [   8,   +∞)  ==  [   8,   +∞)",
+		"[   5,    9]   ^  [  12,   +∞)  ==  [   4,   +∞)",
+	)
+}
+
+func TestOpMin(tt *testing.T) {
+	testOp(tt,
+		"[   3,    6]  min [  10,   15]  ==  [   3,    6]",
+		"[   3,   12]  min [   5,    8]  ==  [   3,    8]",
+		"[  -4,   -1]  min [  -3,    2]  ==  [  -4,   -1]",
+		"(  -∞,    4]  min [   1,   +∞)  ==  (  -∞,    4]",
+		"[   2,   +∞)  min [   1,   +∞)  ==  [   1,   +∞)",
+		"(  -∞,   +∞)  min [   1,    2]  ==  (  -∞,    2]",
+		"[   3,    6]  min [...empty..]  ==  [...empty..]",
+		"[...empty..]  min [...empty..]  ==  [...empty..]",
+	)
+}
+
+func TestOpMax(tt *testing.T) {
+	testOp(tt,
+		"[   3,    6]  max [  10,   15]  ==  [  10,   15]",
+		"[   3,   12]  max [   5,    8]  ==  [   5,   12]",
+		"[  -4,   -1]  max [  -3,    2]  ==  [  -3,    2]",
+		"(  -∞,    4]  max [   1,   +∞)  ==  [   1,   +∞)",
+		"(  -∞,    4]  max (  -∞,   -2]  ==  (  -∞,    4]",
+		"(  -∞,   +∞)  max [   1,    2]  ==  [   1,   +∞)",
+		"[   3,    6]  max [...empty..]  ==  [...empty..]",
+		"[...empty..]  max [...empty..]  ==  [...empty..]",
+	)
+}
+
+func TestOpNot(tt *testing.T) {
+	testCases := []struct {
+		x, want string
+	}{
+		{"[   0,    0]", "[  -1,   -1]"},
+		{"[   3,    6]", "[  -7,   -4]"},
+		{"[  -3,    2]", "[  -3,    2]"},
+		{"[  -8,   -5]", "[   4,    7]"},
+		{"[   3,   +∞)", "(  -∞,   -4]"},
+		{"(  -∞,   -3]", "[   2,   +∞)"},
+		{"(  -∞,   +∞)", "(  -∞,   +∞)"},
+		{"[...empty..]", "[...empty..]"},
+	}
+
+	for _, tc := range testCases {
+		x, _, err := parseInterval(tc.x)
+		if err != nil {
+			tt.Fatalf("%s: %v", tc.x, err)
+		}
+		want, _, err := parseInterval(tc.want)
+		if err != nil {
+			tt.Fatalf("%s: %v", tc.want, err)
+		}
+		got := x.Not()
+		if brute := bruteForceNot(x); !got.Eq(brute) {
+			tt.Errorf("^%v: got %v, brute force gave %v", x, got, brute)
+		}
+		if !got.Eq(want) {
+			tt.Errorf("^%v: got %v, want %v", x, got, want)
+		}
+	}
+}
+
+func TestUniteIntersect(tt *testing.T) {
+	testCases := []struct {
+		x, y, unite, intersect string
+	}{
+		{"[   0,    1]", "[   5,    6]", "[   0,    6]", "[...empty..]"},
+		{"[   0,    5]", "[   3,    8]", "[   0,    8]", "[   3,    5]"},
+		{"[   0,    9]", "[   3,    5]", "[   0,    9]", "[   3,    5]"},
+		{"[   3,    3]", "[   3,    3]", "[   3,    3]", "[   3,    3]"},
+		{"(  -∞,    2]", "[   0,    5]", "(  -∞,    5]", "[   0,    2]"},
+		{"[  -4,   +∞)", "[   0,    5]", "[  -4,   +∞)", "[   0,    5]"},
+		{"(  -∞,    2]", "[   1,   +∞)", "(  -∞,   +∞)", "[   1,    2]"},
+		{"(  -∞,   +∞)", "[   1,    2]", "(  -∞,   +∞)", "[   1,    2]"},
+		{"[...empty..]", "[   1,    2]", "[   1,    2]", "[...empty..]"},
+		{"[   1,    2]", "[...empty..]", "[   1,    2]", "[...empty..]"},
+		{"[...empty..]", "[...empty..]", "[...empty..]", "[...empty..]"},
+	}
+
+	for _, tc := range testCases {
+		x, _, err := parseInterval(tc.x)
+		if err != nil {
+			tt.Fatalf("%s: %v", tc.x, err)
+		}
+		y, _, err := parseInterval(tc.y)
+		if err != nil {
+			tt.Fatalf("%s: %v", tc.y, err)
+		}
+		unite, _, err := parseInterval(tc.unite)
+		if err != nil {
+			tt.Fatalf("%s: %v", tc.unite, err)
+		}
+		intersect, _, err := parseInterval(tc.intersect)
+		if err != nil {
+			tt.Fatalf("%s: %v", tc.intersect, err)
+		}
+
+		if got := x.Unite(y); !got.Eq(unite) {
+			tt.Errorf("%v ∪ %v: got %v, want %v", x, y, got, unite)
+		}
+		if got := y.Unite(x); !got.Eq(unite) {
+			tt.Errorf("%v ∪ %v: got %v, want %v", y, x, got, unite)
+		}
+		if got := x.Intersect(y); !got.Eq(intersect) {
+			tt.Errorf("%v ∩ %v: got %v, want %v", x, y, got, intersect)
+		}
+		if got := y.Intersect(x); !got.Eq(intersect) {
+			tt.Errorf("%v ∩ %v: got %v, want %v", y, x, got, intersect)
+		}
+	}
+}
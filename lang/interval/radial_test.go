@@ -38,8 +38,8 @@ package interval
 // If x and y are "small" radialInput values or one of the two "smallest large"
 // radialInput values, i.e. x and y are in the range [-16, +16], then (x op y)
 // will always be a "small" radialOutput value, for the common binary
-// operators: add, subtract, multiply, divide, left-shift, right-shift, and,
-// or.
+// operators: add, subtract, multiply, divide, remainder, left-shift,
+// right-shift, and, or, xor, min and max.
 //
 // Both of these radialInput and radialOutput types are encoded as an int32:
 //  - math.MinInt32 (which equals -1 << 31) encodes a NaN.
@@ -395,15 +395,136 @@ func (x radialInput) Or(y radialInput) radialOutPair {
 	}
 }
 
+func (x radialInput) Xor(y radialInput) radialOutPair {
+	if x == radialNaN || y == radialNaN {
+		return radialOutPair{radialNaN, radialNaN}
+	}
+	if x < 0 || y < 0 {
+		// TODO: handle negative numbers.
+		return radialOutPair{radialNaN, radialNaN}
+	}
+	ox := x.canonicalize()
+	oy := y.canonicalize()
+
+	// r is a power of 2, so that its binary representation contains one "1"
+	// digit, and that digit is not shared with any "small" value <= riRadius.
+	const r = riRadius + 1
+
+	if ox <= +riRadius {
+		if oy <= +riRadius {
+			return radialOutPair{ox ^ oy, ox ^ oy}
+		} else {
+			return radialOutPair{r, roLargePos}
+		}
+	} else {
+		if oy <= +riRadius {
+			return radialOutPair{r, roLargePos}
+		} else {
+			return radialOutPair{0, roLargePos}
+		}
+	}
+}
+
+func (x radialInput) Rem(y radialInput) radialOutPair {
+	if x == radialNaN || y == radialNaN || y == 0 {
+		return radialOutPair{radialNaN, radialNaN}
+	}
+	ox := x.canonicalize()
+	oy := y.canonicalize()
+
+	// The sign of y does not affect (x % y).
+	if oy < 0 {
+		oy = -oy
+	}
+
+	switch {
+	case ox < -riRadius:
+		if oy > +riRadius {
+			return radialOutPair{roLargeNeg, 0}
+		}
+		return radialOutPair{1 - oy, 0}
+	case ox > +riRadius:
+		if oy > +riRadius {
+			return radialOutPair{0, roLargePos}
+		}
+		return radialOutPair{0, oy - 1}
+	default:
+		if oy > +riRadius {
+			return radialOutPair{ox, ox}
+		}
+		return radialOutPair{ox % oy, ox % oy}
+	}
+}
+
+// box returns the smallest and largest values in x's box.
+func (x radialInput) box() radialOutPair {
+	o := x.canonicalize()
+	switch {
+	case o < -riRadius:
+		return radialOutPair{roLargeNeg, -riRadius - 1}
+	case o > +riRadius:
+		return radialOutPair{+riRadius + 1, roLargePos}
+	}
+	return radialOutPair{o, o}
+}
+
+func (x radialInput) Min(y radialInput) radialOutPair {
+	if x == radialNaN || y == radialNaN {
+		return radialOutPair{radialNaN, radialNaN}
+	}
+	bx, by := x.box(), y.box()
+	if bx[0] > by[0] {
+		bx[0] = by[0]
+	}
+	if bx[1] > by[1] {
+		bx[1] = by[1]
+	}
+	return bx
+}
+
+func (x radialInput) Max(y radialInput) radialOutPair {
+	if x == radialNaN || y == radialNaN {
+		return radialOutPair{radialNaN, radialNaN}
+	}
+	bx, by := x.box(), y.box()
+	if bx[0] < by[0] {
+		bx[0] = by[0]
+	}
+	if bx[1] < by[1] {
+		bx[1] = by[1]
+	}
+	return bx
+}
+
+func (x radialInput) Not() radialOutPair {
+	if x == radialNaN {
+		return radialOutPair{radialNaN, radialNaN}
+	}
+	ox := x.canonicalize()
+
+	switch {
+	case ox < -riRadius:
+		return radialOutPair{+riRadius, roLargePos}
+	case ox > +riRadius:
+		return radialOutPair{roLargeNeg, -riRadius - 2}
+	default:
+		return radialOutPair{^ox, ^ox}
+	}
+}
+
 var riOperators = map[string]func(radialInput, radialInput) radialOutPair{
-	"+":  radialInput.Add,
-	"-":  radialInput.Sub,
-	"*":  radialInput.Mul,
-	"/":  radialInput.Quo,
-	"<<": radialInput.Lsh,
-	">>": radialInput.Rsh,
-	"&":  radialInput.And,
-	"|":  radialInput.Or,
+	"+":   radialInput.Add,
+	"-":   radialInput.Sub,
+	"*":   radialInput.Mul,
+	"/":   radialInput.Quo,
+	"%":   radialInput.Rem,
+	"<<":  radialInput.Lsh,
+	">>":  radialInput.Rsh,
+	"&":   radialInput.And,
+	"|":   radialInput.Or,
+	"^":   radialInput.Xor,
+	"min": radialInput.Min,
+	"max": radialInput.Max,
 }
 
 func bruteForce(x IntRange, y IntRange, opKey string) (z IntRange, ok bool) {
@@ -438,3 +559,30 @@ func bruteForce(x IntRange, y IntRange, opKey string) (z IntRange, ok bool) {
 	}
 	return IntRange{result[0].bigInt(), result[1].bigInt()}, true
 }
+
+// bruteForceNot is like bruteForce, but for the unary Not operator.
+func bruteForceNot(x IntRange) IntRange {
+	iMin, iMax := enumerate(x)
+	result := radialOutPair{}
+	first := true
+
+	for i := iMin; i <= iMax; i++ {
+		k := i.Not()
+		if first {
+			result = k
+			first = false
+			continue
+		}
+		if result[0] > k[0] {
+			result[0] = k[0]
+		}
+		if result[1] < k[1] {
+			result[1] = k[1]
+		}
+	}
+
+	if first {
+		return empty()
+	}
+	return IntRange{result[0].bigInt(), result[1].bigInt()}
+}
@@ -0,0 +1,361 @@
+// Copyright 2018 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package linear decides whether a system of linear inequalities, over
+// integer-valued variables, has no solution. Coefficients and constants are
+// big integers, as per the standard math/big package.
+//
+// As a motivating example, if a compiler knows that a < b and that b <= c,
+// then it can prove that a < c by showing that the system of a < b, b <= c and
+// the negation of the goal, a >= c, is infeasible.
+//
+// The decision procedure is Fourier-Motzkin elimination, with each derived
+// constraint tightened to account for the variables being integers. It is
+// sound but not complete: if it reports that a system is infeasible, then
+// there are no integer solutions, but it can fail to report that some
+// infeasible systems are infeasible. It also gives up, reporting nothing, if
+// the number of constraints grows beyond MaxConstraints.
+//
+// This package depends only on the standard math/big package.
+package linear
+
+import (
+	"math/big"
+	"sort"
+	"strings"
+)
+
+var (
+	zero = big.NewInt(0)
+	one  = big.NewInt(1)
+)
+
+// MaxConstraints is the largest number of constraints that eliminating a
+// variable may produce. Fourier-Motzkin elimination can take exponential time
+// and space, so a System gives up instead of exceeding this limit.
+const MaxConstraints = 1024
+
+// Var is a variable. Its meaning, such as which sub-expression of a program it
+// stands for, is up to the caller.
+type Var uint32
+
+// Expr is a linear expression: a constant plus a sum of variables multiplied
+// by non-zero coefficients. The zero value is the constant zero.
+//
+// An Expr is immutable. Its methods return new values.
+type Expr struct {
+	k      *big.Int
+	coeffs map[Var]*big.Int
+}
+
+// Const returns the constant expression k.
+func Const(k *big.Int) Expr {
+	return Expr{k: k}
+}
+
+// Term returns the expression c*v.
+func Term(c *big.Int, v Var) Expr {
+	if c.Sign() == 0 {
+		return Expr{}
+	}
+	return Expr{coeffs: map[Var]*big.Int{v: c}}
+}
+
+// Constant returns e's constant part.
+func (e Expr) Constant() *big.Int {
+	if e.k == nil {
+		return zero
+	}
+	return e.k
+}
+
+// Coeff returns e's coefficient of v, which is zero if e does not mention v.
+func (e Expr) Coeff(v Var) *big.Int {
+	if c := e.coeffs[v]; c != nil {
+		return c
+	}
+	return zero
+}
+
+// IsConst returns whether e mentions no variables.
+func (e Expr) IsConst() bool {
+	return len(e.coeffs) == 0
+}
+
+// Add returns e + f.
+func (e Expr) Add(f Expr) Expr {
+	return e.combine(one, f, one)
+}
+
+// Sub returns e - f.
+func (e Expr) Sub(f Expr) Expr {
+	return e.combine(one, f, big.NewInt(-1))
+}
+
+// Mul returns c * e.
+func (e Expr) Mul(c *big.Int) Expr {
+	return Expr{}.combine(one, e, c)
+}
+
+// combine returns (x * e) + (y * f).
+func (e Expr) combine(x *big.Int, f Expr, y *big.Int) Expr {
+	ret := Expr{
+		k:      big.NewInt(0),
+		coeffs: map[Var]*big.Int{},
+	}
+	ret.k.Add(mul(x, e.Constant()), mul(y, f.Constant()))
+	for v, c := range e.coeffs {
+		ret.coeffs[v] = mul(x, c)
+	}
+	for v, c := range f.coeffs {
+		d := mul(y, c)
+		if old := ret.coeffs[v]; old != nil {
+			d.Add(d, old)
+		}
+		if d.Sign() == 0 {
+			delete(ret.coeffs, v)
+		} else {
+			ret.coeffs[v] = d
+		}
+	}
+	return ret
+}
+
+func (e Expr) String() string {
+	vars := e.sortedVars()
+	b := []byte(nil)
+	for _, v := range vars {
+		c := e.coeffs[v]
+		if len(b) == 0 {
+			if c.Sign() < 0 {
+				b = append(b, '-')
+			}
+		} else if c.Sign() < 0 {
+			b = append(b, " - "...)
+		} else {
+			b = append(b, " + "...)
+		}
+		if a := big.NewInt(0).Abs(c); a.Cmp(one) != 0 {
+			b = append(b, a.String()...)
+			b = append(b, '*')
+		}
+		b = append(b, 'v')
+		b = append(b, big.NewInt(int64(v)).String()...)
+	}
+	if k := e.Constant(); len(b) == 0 {
+		b = append(b, k.String()...)
+	} else if k.Sign() < 0 {
+		b = append(b, " - "...)
+		b = append(b, big.NewInt(0).Neg(k).String()...)
+	} else if k.Sign() > 0 {
+		b = append(b, " + "...)
+		b = append(b, k.String()...)
+	}
+	return string(b)
+}
+
+func (e Expr) sortedVars() []Var {
+	vars := make([]Var, 0, len(e.coeffs))
+	for v := range e.coeffs {
+		vars = append(vars, v)
+	}
+	sort.Slice(vars, func(i, j int) bool { return vars[i] < vars[j] })
+	return vars
+}
+
+// System is a conjunction of constraints. Its zero value is an empty (and
+// therefore feasible) system.
+type System struct {
+	// constraints are each of the form "e <= 0".
+	constraints []Expr
+}
+
+// String returns the constraints, one per line.
+func (s *System) String() string {
+	lines := make([]string, len(s.constraints))
+	for i, e := range s.constraints {
+		lines[i] = e.String() + " <= 0"
+	}
+	return strings.Join(lines, "\n")
+}
+
+// AddLessEq adds the constraint lhs <= rhs.
+func (s *System) AddLessEq(lhs Expr, rhs Expr) {
+	s.constraints = append(s.constraints, lhs.Sub(rhs))
+}
+
+// AddLessThan adds the constraint lhs < rhs. As the variables are integers,
+// this is equivalent to lhs + 1 <= rhs.
+func (s *System) AddLessThan(lhs Expr, rhs Expr) {
+	s.constraints = append(s.constraints, lhs.Sub(rhs).Add(Const(one)))
+}
+
+// AddEq adds the constraint lhs == rhs.
+func (s *System) AddEq(lhs Expr, rhs Expr) {
+	s.AddLessEq(lhs, rhs)
+	s.AddLessEq(rhs, lhs)
+}
+
+// Clone returns a copy of s. Adding constraints to the copy does not affect
+// s, and vice versa.
+func (s *System) Clone() *System {
+	return &System{
+		constraints: append([]Expr(nil), s.constraints...),
+	}
+}
+
+// Infeasible returns whether the system is proven to have no integer
+// solutions. A false result means either that there is a solution or that the
+// decision procedure could not prove otherwise.
+func (s *System) Infeasible() bool {
+	cs := newConstraintSet()
+	for _, e := range s.constraints {
+		if !cs.add(e) {
+			return true
+		}
+	}
+
+	for len(cs.list) > 0 {
+		v, ok := cs.pickVar()
+		if !ok {
+			return false
+		}
+		next := newConstraintSet()
+		pos, neg := []Expr(nil), []Expr(nil)
+		for _, e := range cs.list {
+			switch e.Coeff(v).Sign() {
+			case 0:
+				next.add(e)
+			case +1:
+				pos = append(pos, e)
+			case -1:
+				neg = append(neg, e)
+			}
+		}
+		if len(next.list)+len(pos)*len(neg) > MaxConstraints {
+			return false
+		}
+
+		// For each pair of constraints (p*v + P <= 0) and (-n*v + N <= 0),
+		// with positive p and n, eliminate v: (n*P + p*N <= 0).
+		for _, e := range pos {
+			p := e.Coeff(v)
+			for _, f := range neg {
+				n := big.NewInt(0).Neg(f.Coeff(v))
+				if !next.add(e.combine(n, f, p)) {
+					return true
+				}
+			}
+		}
+		cs = next
+	}
+	return false
+}
+
+// constraintSet is a set of tightened constraints, each of the form "e <= 0",
+// de-duplicated so that each combination of variable coefficients is listed
+// at most once.
+type constraintSet struct {
+	list    []Expr
+	indexes map[string]int
+}
+
+func newConstraintSet() *constraintSet {
+	return &constraintSet{indexes: map[string]int{}}
+}
+
+// add adds e, tightened, to the set. It returns false if e is trivially
+// infeasible: a positive constant.
+func (cs *constraintSet) add(e Expr) bool {
+	if e.IsConst() {
+		return e.Constant().Sign() <= 0
+	}
+	e = tighten(e)
+
+	key := Expr{coeffs: e.coeffs}.String()
+	if i, ok := cs.indexes[key]; ok {
+		// Of two constraints that differ only in their constant, keep the
+		// stronger one, with the larger constant.
+		if cs.list[i].Constant().Cmp(e.Constant()) < 0 {
+			cs.list[i] = e
+		}
+		return true
+	}
+	cs.indexes[key] = len(cs.list)
+	cs.list = append(cs.list, e)
+	return true
+}
+
+// pickVar returns the variable whose elimination produces the fewest new
+// constraints. It returns false if there are no variables.
+func (cs *constraintSet) pickVar() (Var, bool) {
+	nPos, nNeg := map[Var]int{}, map[Var]int{}
+	for _, e := range cs.list {
+		for v, c := range e.coeffs {
+			if c.Sign() > 0 {
+				nPos[v]++
+			} else {
+				nNeg[v]++
+			}
+		}
+	}
+
+	best, bestCost, found := Var(0), 0, false
+	consider := func(v Var) {
+		cost := nPos[v] * nNeg[v]
+		if !found || cost < bestCost || (cost == bestCost && v < best) {
+			best, bestCost, found = v, cost, true
+		}
+	}
+	for v := range nPos {
+		consider(v)
+	}
+	for v := range nNeg {
+		consider(v)
+	}
+	return best, found
+}
+
+// tighten divides the constraint (Σ c_i*v_i + k <= 0) through by g, the
+// greatest common divisor of the c_i. As the v_i are integers, the constant
+// can then be rounded up: (Σ (c_i/g)*v_i + ceil(k/g) <= 0).
+func tighten(e Expr) Expr {
+	g := (*big.Int)(nil)
+	for _, c := range e.coeffs {
+		if a := big.NewInt(0).Abs(c); g == nil {
+			g = a
+		} else {
+			g.GCD(nil, nil, g, a)
+		}
+	}
+	if g.Cmp(one) <= 0 {
+		return e
+	}
+
+	ret := Expr{
+		k:      big.NewInt(0),
+		coeffs: make(map[Var]*big.Int, len(e.coeffs)),
+	}
+	for v, c := range e.coeffs {
+		ret.coeffs[v] = big.NewInt(0).Quo(c, g)
+	}
+	// ceil(k/g) is -floor(-k/g), and Div rounds towards negative infinity
+	// when g is positive.
+	ret.k.Neg(e.Constant())
+	ret.k.Div(ret.k, g)
+	ret.k.Neg(ret.k)
+	return ret
+}
+
+func mul(i *big.Int, j *big.Int) *big.Int { return big.NewInt(0).Mul(i, j) }
@@ -0,0 +1,220 @@
+// Copyright 2018 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linear
+
+import (
+	"math/big"
+	"math/rand"
+	"testing"
+)
+
+func v(x Var) Expr           { return Term(big.NewInt(1), x) }
+func k(x int64) Expr         { return Const(big.NewInt(x)) }
+func cv(c int64, x Var) Expr { return Term(big.NewInt(c), x) }
+
+// TestMotivatingExample tests the "motivating example" given in the package
+// doc comment.
+func TestMotivatingExample(tt *testing.T) {
+	const a, b, c = Var(0), Var(1), Var(2)
+	s := &System{}
+	s.AddLessThan(v(a), v(b))
+	s.AddLessEq(v(b), v(c))
+	if s.Infeasible() {
+		tt.Fatalf("a < b, b <= c: got infeasible, want feasible")
+	}
+	s.AddLessEq(v(c), v(a))
+	if !s.Infeasible() {
+		tt.Fatalf("a < b, b <= c, a >= c: got feasible, want infeasible")
+	}
+}
+
+func TestExprString(tt *testing.T) {
+	testCases := []struct {
+		e    Expr
+		want string
+	}{
+		{Expr{}, "0"},
+		{k(-5), "-5"},
+		{v(3), "v3"},
+		{v(3).Mul(big.NewInt(-1)), "-v3"},
+		{v(1).Add(cv(2, 0)).Sub(k(7)), "2*v0 + v1 - 7"},
+		{v(1).Sub(v(1)).Add(k(4)), "4"},
+		{cv(-3, 2).Add(v(0)).Add(k(1)), "v0 - 3*v2 + 1"},
+	}
+	for _, tc := range testCases {
+		if got := tc.e.String(); got != tc.want {
+			tt.Errorf("got %q, want %q", got, tc.want)
+		}
+	}
+}
+
+func TestInfeasible(tt *testing.T) {
+	const x, y, z = Var(0), Var(1), Var(2)
+	testCases := []struct {
+		desc string
+		add  func(s *System)
+		want bool
+	}{{
+		"empty",
+		func(s *System) {},
+		false,
+	}, {
+		"1 <= 0",
+		func(s *System) { s.AddLessEq(k(1), k(0)) },
+		true,
+	}, {
+		"x < x",
+		func(s *System) { s.AddLessThan(v(x), v(x)) },
+		true,
+	}, {
+		"x < y; y < x + 1",
+		func(s *System) {
+			s.AddLessThan(v(x), v(y))
+			s.AddLessThan(v(y), v(x).Add(k(1)))
+		},
+		true,
+	}, {
+		"x < y; y < x + 2",
+		func(s *System) {
+			s.AddLessThan(v(x), v(y))
+			s.AddLessThan(v(y), v(x).Add(k(2)))
+		},
+		false,
+	}, {
+		// This has a rational solution, x = 1/2, but no integer one.
+		"2*x == 1",
+		func(s *System) { s.AddEq(cv(2, x), k(1)) },
+		true,
+	}, {
+		"x + y <= 10; x >= 6; y >= 6",
+		func(s *System) {
+			s.AddLessEq(v(x).Add(v(y)), k(10))
+			s.AddLessEq(k(6), v(x))
+			s.AddLessEq(k(6), v(y))
+		},
+		true,
+	}, {
+		"x + y <= 12; x >= 6; y >= 6",
+		func(s *System) {
+			s.AddLessEq(v(x).Add(v(y)), k(12))
+			s.AddLessEq(k(6), v(x))
+			s.AddLessEq(k(6), v(y))
+		},
+		false,
+	}, {
+		"x == y + z; 0 <= z; x < y",
+		func(s *System) {
+			s.AddEq(v(x), v(y).Add(v(z)))
+			s.AddLessEq(k(0), v(z))
+			s.AddLessThan(v(x), v(y))
+		},
+		true,
+	}}
+
+	for _, tc := range testCases {
+		s := &System{}
+		tc.add(s)
+		if got := s.Infeasible(); got != tc.want {
+			tt.Errorf("%s: got %t, want %t", tc.desc, got, tc.want)
+		}
+	}
+}
+
+func TestClone(tt *testing.T) {
+	s := &System{}
+	s.AddLessEq(k(0), v(0))
+	c := s.Clone()
+	c.AddLessThan(v(0), k(0))
+	if !c.Infeasible() {
+		tt.Fatalf("clone: got feasible, want infeasible")
+	}
+	if s.Infeasible() {
+		tt.Fatalf("original: got infeasible, want feasible")
+	}
+}
+
+// TestSoundness checks, for random systems over a small box of integer
+// points, that Infeasible never returns true when a brute force search finds
+// a solution.
+func TestSoundness(tt *testing.T) {
+	const (
+		nVars        = 3
+		boxMin       = -3
+		boxMax       = +3
+		nIterations  = 2000
+		nConstraints = 4
+	)
+	rng := rand.New(rand.NewSource(1))
+
+	type constraint struct {
+		coeffs [nVars]int64
+		k      int64
+	}
+	nInfeasible := 0
+	for i := 0; i < nIterations; i++ {
+		s := &System{}
+		for x := Var(0); x < nVars; x++ {
+			s.AddLessEq(k(boxMin), v(x))
+			s.AddLessEq(v(x), k(boxMax))
+		}
+		cs := make([]constraint, nConstraints)
+		for j := range cs {
+			e := Expr{}
+			for x := range cs[j].coeffs {
+				cs[j].coeffs[x] = rng.Int63n(7) - 3
+				e = e.Add(cv(cs[j].coeffs[x], Var(x)))
+			}
+			cs[j].k = rng.Int63n(13) - 6
+			s.AddLessEq(e.Add(k(cs[j].k)), k(0))
+		}
+
+		solved := false
+		point := [nVars]int64{}
+		var search func(x int)
+		search = func(x int) {
+			if solved {
+				return
+			}
+			if x == nVars {
+				for _, c := range cs {
+					sum := c.k
+					for y, coeff := range c.coeffs {
+						sum += coeff * point[y]
+					}
+					if sum > 0 {
+						return
+					}
+				}
+				solved = true
+				return
+			}
+			for point[x] = boxMin; point[x] <= boxMax; point[x]++ {
+				search(x + 1)
+			}
+		}
+		search(0)
+
+		got := s.Infeasible()
+		if got {
+			nInfeasible++
+		}
+		if got && solved {
+			tt.Fatalf("iteration #%d: got infeasible, but a solution exists:\n%v", i, s)
+		}
+	}
+	if nInfeasible == 0 {
+		tt.Fatalf("no infeasible systems were found; the test is not exercising the solver")
+	}
+}
@@ -18,6 +18,7 @@ package parse
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/google/wuffs/lang/base38"
 
@@ -28,6 +29,11 @@ import (
 type Options struct {
 	AllowBuiltIns              bool
 	AllowDoubleUnderscoreNames bool
+
+	// SortAsserts is whether to sort an assertion chain's "pre", "inv" and
+	// "post" asserts into that order, instead of rejecting a chain that isn't
+	// in that order. It is for tools like wuffsfmt that fix source code.
+	SortAsserts bool
 }
 
 func isDoubleUnderscore(s string) bool {
@@ -39,6 +45,7 @@ func Parse(tm *t.Map, filename string, src []t.Token, opts *Options) (*a.File, e
 		tm:       tm,
 		filename: filename,
 		src:      src,
+		all:      src,
 	}
 	if len(src) > 0 {
 		p.lastLine = src[len(src)-1].Line
@@ -54,6 +61,7 @@ func ParseExpr(tm *t.Map, filename string, src []t.Token, opts *Options) (*a.Exp
 		tm:       tm,
 		filename: filename,
 		src:      src,
+		all:      src,
 	}
 	if len(src) > 0 {
 		p.lastLine = src[len(src)-1].Line
@@ -68,15 +76,52 @@ type parser struct {
 	tm       *t.Map
 	filename string
 	src      []t.Token
+	all      []t.Token
 	opts     Options
 	lastLine uint32
 }
 
-func (p *parser) line() uint32 {
+// loc returns the next token's position, for error messages.
+func (p *parser) loc() string {
+	return p.locOf(p.peekToken())
+}
+
+// locOf returns x's position as "filename:line:col", or as "filename:line"
+// if x has no column, such as the zero-valued token past the end.
+func (p *parser) locOf(x t.Token) string {
+	if x.Col == 0 {
+		return fmt.Sprintf("%s:%d", p.filename, x.Line)
+	}
+	return fmt.Sprintf("%s:%d:%d", p.filename, x.Line, x.Col)
+}
+
+// peekToken returns the next token, or a zero-valued one (other than its Line)
+// if there are no more tokens.
+func (p *parser) peekToken() t.Token {
 	if len(p.src) != 0 {
-		return p.src[0].Line
+		return p.src[0]
 	}
-	return p.lastLine
+	return t.Token{Line: p.lastLine}
+}
+
+// setPosition sets n's position to span from the start token to the last
+// consumed token, ignoring any trailing semi-colons. It also sets n's filename
+// and line, if not already set.
+func (p *parser) setPosition(n *a.Node, start t.Token) {
+	end := start.End
+	for i := len(p.all) - len(p.src); i > 0; i-- {
+		if x := p.all[i-1]; x.ID != t.IDSemicolon {
+			if end < x.End {
+				end = x.End
+			}
+			break
+		}
+	}
+	raw := n.AsRaw()
+	if filename, _ := raw.FilenameLine(); filename == "" {
+		raw.SetFilenameLine(p.filename, start.Line)
+	}
+	raw.SetColPosEnd(start.Col, start.Pos, end)
 }
 
 func (p *parser) peek1() t.ID {
@@ -99,20 +144,30 @@ func (p *parser) parseFile() (*a.File, error) {
 }
 
 func (p *parser) parseTopLevelDecl() (*a.Node, error) {
+	start := p.peekToken()
+	n, err := p.parseTopLevelDecl1()
+	if n != nil {
+		p.setPosition(n, start)
+	}
+	return n, err
+}
+
+func (p *parser) parseTopLevelDecl1() (*a.Node, error) {
 	flags := a.Flags(0)
-	line := p.src[0].Line
+	first := p.src[0]
+	line := first.Line
 	switch k := p.peek1(); k {
 	case t.IDPackageID, t.IDUse:
 		p.src = p.src[1:]
 		path := p.peek1()
 		if !path.IsStrLiteral(p.tm) {
 			got := p.tm.ByID(path)
-			return nil, fmt.Errorf(`parse: expected string literal, got %q at %s:%d`, got, p.filename, p.line())
+			return nil, fmt.Errorf(`parse: expected string literal, got %q at %s`, got, p.loc())
 		}
 		p.src = p.src[1:]
 		if x := p.peek1(); x != t.IDSemicolon {
 			got := p.tm.ByID(x)
-			return nil, fmt.Errorf(`parse: expected (implicit) ";", got %q at %s:%d`, got, p.filename, p.line())
+			return nil, fmt.Errorf(`parse: expected (implicit) ";", got %q at %s`, got, p.loc())
 		}
 		p.src = p.src[1:]
 		if k == t.IDPackageID {
@@ -148,8 +203,8 @@ func (p *parser) parseTopLevelDecl() (*a.Node, error) {
 				return nil, err
 			}
 			if p.peek1() != t.IDEq {
-				return nil, fmt.Errorf(`parse: const %q has no value at %s:%d`,
-					p.tm.ByID(id), p.filename, p.line())
+				return nil, fmt.Errorf(`parse: const %q has no value at %s`,
+					p.tm.ByID(id), p.loc())
 			}
 			p.src = p.src[1:]
 			value, err := p.parsePossibleDollarExpr()
@@ -158,7 +213,7 @@ func (p *parser) parseTopLevelDecl() (*a.Node, error) {
 			}
 			if x := p.peek1(); x != t.IDSemicolon {
 				got := p.tm.ByID(x)
-				return nil, fmt.Errorf(`parse: expected (implicit) ";", got %q at %s:%d`, got, p.filename, p.line())
+				return nil, fmt.Errorf(`parse: expected (implicit) ";", got %q at %s`, got, p.loc())
 			}
 			p.src = p.src[1:]
 			return a.NewConst(flags, p.filename, line, id, typ, value).AsNode(), nil
@@ -173,17 +228,17 @@ func (p *parser) parseTopLevelDecl() (*a.Node, error) {
 			// (attached to receivers) and never free standing functions?
 			if !p.opts.AllowBuiltIns {
 				if id0 != 0 && id0.IsBuiltIn() {
-					return nil, fmt.Errorf(`parse: built-in %q used for func receiver at %s:%d`,
-						p.tm.ByID(id0), p.filename, p.line())
+					return nil, fmt.Errorf(`parse: built-in %q used for func receiver at %s`,
+						p.tm.ByID(id0), p.loc())
 				}
 				if id1.IsBuiltIn() {
-					return nil, fmt.Errorf(`parse: built-in %q used for func name at %s:%d`,
-						p.tm.ByID(id1), p.filename, p.line())
+					return nil, fmt.Errorf(`parse: built-in %q used for func name at %s`,
+						p.tm.ByID(id1), p.loc())
 				}
 			}
 			if !p.opts.AllowDoubleUnderscoreNames && isDoubleUnderscore(p.tm.ByID(id1)) {
-				return nil, fmt.Errorf(`parse: double-underscore %q used for func name at %s:%d`,
-					p.tm.ByID(id1), p.filename, p.line())
+				return nil, fmt.Errorf(`parse: double-underscore %q used for func name at %s`,
+					p.tm.ByID(id1), p.loc())
 			}
 
 			switch p.peek1() {
@@ -202,6 +257,14 @@ func (p *parser) parseTopLevelDecl() (*a.Node, error) {
 			if err != nil {
 				return nil, err
 			}
+			depth := (*a.Expr)(nil)
+			if p.peek1() == t.IDComma && len(p.src) > 1 && p.src[1].ID == t.IDDepth {
+				p.src = p.src[2:]
+				depth, err = p.parseExpr()
+				if err != nil {
+					return nil, err
+				}
+			}
 			asserts := []*a.Node(nil)
 			if p.peek1() == t.IDComma {
 				p.src = p.src[1:]
@@ -219,12 +282,54 @@ func (p *parser) parseTopLevelDecl() (*a.Node, error) {
 			}
 			if x := p.peek1(); x != t.IDSemicolon {
 				got := p.tm.ByID(x)
-				return nil, fmt.Errorf(`parse: expected (implicit) ";", got %q at %s:%d`, got, p.filename, p.line())
+				return nil, fmt.Errorf(`parse: expected (implicit) ";", got %q at %s`, got, p.loc())
 			}
 			p.src = p.src[1:]
 			in := a.NewStruct(0, p.filename, line, t.IDIn, inFields)
 			out := a.NewStruct(0, p.filename, line, t.IDOut, outFields)
-			return a.NewFunc(flags, p.filename, line, id0, id1, in, out, asserts, body).AsNode(), nil
+			return a.NewFunc(flags, p.filename, line, id0, id1, in, depth, out, asserts, body).AsNode(), nil
+
+		case t.IDLemma:
+			p.src = p.src[1:]
+			name, err := p.parseIdent()
+			if err != nil {
+				return nil, err
+			}
+			if !p.opts.AllowBuiltIns && name.IsBuiltIn() {
+				return nil, fmt.Errorf(`parse: built-in %q used for lemma name at %s`,
+					p.tm.ByID(name), p.loc())
+			}
+			if !p.opts.AllowDoubleUnderscoreNames && isDoubleUnderscore(p.tm.ByID(name)) {
+				return nil, fmt.Errorf(`parse: double-underscore %q used for lemma name at %s`,
+					p.tm.ByID(name), p.loc())
+			}
+
+			params, err := p.parseList(t.IDCloseParen, (*parser).parseFieldNode)
+			if err != nil {
+				return nil, err
+			}
+			if x := p.peek1(); x != t.IDComma {
+				got := p.tm.ByID(x)
+				return nil, fmt.Errorf(`parse: expected ",", got %q at %s`, got, p.loc())
+			}
+			p.src = p.src[1:]
+			asserts, err := p.parseList(t.IDOpenCurly, (*parser).parseAssertNode)
+			if err != nil {
+				return nil, err
+			}
+			if err := p.assertsSorted(asserts); err != nil {
+				return nil, err
+			}
+			body, err := p.parseBlock()
+			if err != nil {
+				return nil, err
+			}
+			if x := p.peek1(); x != t.IDSemicolon {
+				got := p.tm.ByID(x)
+				return nil, fmt.Errorf(`parse: expected (implicit) ";", got %q at %s`, got, p.loc())
+			}
+			p.src = p.src[1:]
+			return a.NewLemma(flags, p.filename, line, name, params, asserts, body).AsNode(), nil
 
 		case t.IDError, t.IDSuspension:
 			keyword := p.src[0].ID
@@ -232,7 +337,7 @@ func (p *parser) parseTopLevelDecl() (*a.Node, error) {
 
 			if x := p.peek1(); x != t.IDOpenParen {
 				got := p.tm.ByID(x)
-				return nil, fmt.Errorf(`parse: expected "(", got %q at %s:%d`, got, p.filename, p.line())
+				return nil, fmt.Errorf(`parse: expected "(", got %q at %s`, got, p.loc())
 			}
 			p.src = p.src[1:]
 			value, err := p.parseExpr()
@@ -241,19 +346,19 @@ func (p *parser) parseTopLevelDecl() (*a.Node, error) {
 			}
 			if x := p.peek1(); x != t.IDCloseParen {
 				got := p.tm.ByID(x)
-				return nil, fmt.Errorf(`parse: expected ")", got %q at %s:%d`, got, p.filename, p.line())
+				return nil, fmt.Errorf(`parse: expected ")", got %q at %s`, got, p.loc())
 			}
 			p.src = p.src[1:]
 
 			message := p.peek1()
 			if !message.IsStrLiteral(p.tm) {
 				got := p.tm.ByID(message)
-				return nil, fmt.Errorf(`parse: expected string literal, got %q at %s:%d`, got, p.filename, p.line())
+				return nil, fmt.Errorf(`parse: expected string literal, got %q at %s`, got, p.loc())
 			}
 			p.src = p.src[1:]
 			if x := p.peek1(); x != t.IDSemicolon {
 				got := p.tm.ByID(x)
-				return nil, fmt.Errorf(`parse: expected (implicit) ";", got %q at %s:%d`, got, p.filename, p.line())
+				return nil, fmt.Errorf(`parse: expected (implicit) ";", got %q at %s`, got, p.loc())
 			}
 			p.src = p.src[1:]
 			return a.NewStatus(flags, p.filename, line, keyword, value, message).AsNode(), nil
@@ -265,12 +370,12 @@ func (p *parser) parseTopLevelDecl() (*a.Node, error) {
 				return nil, err
 			}
 			if !p.opts.AllowBuiltIns && name.IsBuiltIn() {
-				return nil, fmt.Errorf(`parse: built-in %q used for struct name at %s:%d`,
-					p.tm.ByID(name), p.filename, p.line())
+				return nil, fmt.Errorf(`parse: built-in %q used for struct name at %s`,
+					p.tm.ByID(name), p.loc())
 			}
 			if !p.opts.AllowDoubleUnderscoreNames && isDoubleUnderscore(p.tm.ByID(name)) {
-				return nil, fmt.Errorf(`parse: double-underscore %q used for struct name at %s:%d`,
-					p.tm.ByID(name), p.filename, p.line())
+				return nil, fmt.Errorf(`parse: double-underscore %q used for struct name at %s`,
+					p.tm.ByID(name), p.loc())
 			}
 
 			if p.peek1() == t.IDQuestion {
@@ -283,13 +388,13 @@ func (p *parser) parseTopLevelDecl() (*a.Node, error) {
 			}
 			if x := p.peek1(); x != t.IDSemicolon {
 				got := p.tm.ByID(x)
-				return nil, fmt.Errorf(`parse: expected (implicit) ";", got %q at %s:%d`, got, p.filename, p.line())
+				return nil, fmt.Errorf(`parse: expected (implicit) ";", got %q at %s`, got, p.loc())
 			}
 			p.src = p.src[1:]
 			return a.NewStruct(flags, p.filename, line, name, fields).AsNode(), nil
 		}
 	}
-	return nil, fmt.Errorf(`parse: unrecognized top level declaration at %s:%d`, p.filename, line)
+	return nil, fmt.Errorf(`parse: unrecognized top level declaration at %s`, p.locOf(first))
 }
 
 // parseQualifiedIdent parses "foo.bar" or "bar".
@@ -313,12 +418,12 @@ func (p *parser) parseQualifiedIdent() (t.ID, t.ID, error) {
 
 func (p *parser) parseIdent() (t.ID, error) {
 	if len(p.src) == 0 {
-		return 0, fmt.Errorf(`parse: expected identifier at %s:%d`, p.filename, p.line())
+		return 0, fmt.Errorf(`parse: expected identifier at %s`, p.loc())
 	}
 	x := p.src[0]
 	if !x.ID.IsIdent(p.tm) {
 		got := p.tm.ByID(x.ID)
-		return 0, fmt.Errorf(`parse: expected identifier, got %q at %s:%d`, got, p.filename, p.line())
+		return 0, fmt.Errorf(`parse: expected identifier, got %q at %s`, got, p.loc())
 	}
 	p.src = p.src[1:]
 	return x.ID, nil
@@ -327,8 +432,8 @@ func (p *parser) parseIdent() (t.ID, error) {
 func (p *parser) parseList(stop t.ID, parseElem func(*parser) (*a.Node, error)) ([]*a.Node, error) {
 	if stop == t.IDCloseParen {
 		if x := p.peek1(); x != t.IDOpenParen {
-			return nil, fmt.Errorf(`parse: expected "(", got %q at %s:%d`,
-				p.tm.ByID(x), p.filename, p.line())
+			return nil, fmt.Errorf(`parse: expected "(", got %q at %s`,
+				p.tm.ByID(x), p.loc())
 		}
 		p.src = p.src[1:]
 	}
@@ -357,14 +462,15 @@ func (p *parser) parseList(stop t.ID, parseElem func(*parser) (*a.Node, error))
 		case t.IDComma:
 			p.src = p.src[1:]
 		default:
-			return nil, fmt.Errorf(`parse: expected %q, got %q at %s:%d`,
-				p.tm.ByID(stop), p.tm.ByID(x), p.filename, p.line())
+			return nil, fmt.Errorf(`parse: expected %q, got %q at %s`,
+				p.tm.ByID(stop), p.tm.ByID(x), p.loc())
 		}
 	}
-	return nil, fmt.Errorf(`parse: expected %q at %s:%d`, p.tm.ByID(stop), p.filename, p.line())
+	return nil, fmt.Errorf(`parse: expected %q at %s`, p.tm.ByID(stop), p.loc())
 }
 
 func (p *parser) parseFieldNode() (*a.Node, error) {
+	start := p.peekToken()
 	name, err := p.parseIdent()
 	if err != nil {
 		return nil, err
@@ -373,10 +479,21 @@ func (p *parser) parseFieldNode() (*a.Node, error) {
 	if err != nil {
 		return nil, err
 	}
-	return a.NewField(name, typ).AsNode(), nil
+	n := a.NewField(name, typ).AsNode()
+	p.setPosition(n, start)
+	return n, nil
 }
 
 func (p *parser) parseTypeExpr() (*a.TypeExpr, error) {
+	start := p.peekToken()
+	n, err := p.parseTypeExpr1()
+	if n != nil {
+		p.setPosition(n.AsNode(), start)
+	}
+	return n, err
+}
+
+func (p *parser) parseTypeExpr1() (*a.TypeExpr, error) {
 	if x := p.peek1(); x == t.IDNptr || x == t.IDPtr {
 		p.src = p.src[1:]
 		rhs, err := p.parseTypeExpr()
@@ -394,7 +511,7 @@ func (p *parser) parseTypeExpr() (*a.TypeExpr, error) {
 
 		if x := p.peek1(); x != t.IDOpenBracket {
 			got := p.tm.ByID(x)
-			return nil, fmt.Errorf(`parse: expected "[", got %q at %s:%d`, got, p.filename, p.line())
+			return nil, fmt.Errorf(`parse: expected "[", got %q at %s`, got, p.loc())
 		}
 		p.src = p.src[1:]
 
@@ -406,7 +523,7 @@ func (p *parser) parseTypeExpr() (*a.TypeExpr, error) {
 
 		if x := p.peek1(); x != t.IDCloseBracket {
 			got := p.tm.ByID(x)
-			return nil, fmt.Errorf(`parse: expected "]", got %q at %s:%d`, got, p.filename, p.line())
+			return nil, fmt.Errorf(`parse: expected "]", got %q at %s`, got, p.loc())
 		}
 		p.src = p.src[1:]
 
@@ -450,7 +567,7 @@ func (p *parser) parseTypeExpr() (*a.TypeExpr, error) {
 func (p *parser) parseBracket(sep t.ID) (op t.ID, ei *a.Expr, ej *a.Expr, err error) {
 	if x := p.peek1(); x != t.IDOpenBracket {
 		got := p.tm.ByID(x)
-		return 0, nil, nil, fmt.Errorf(`parse: expected "[", got %q at %s:%d`, got, p.filename, p.line())
+		return 0, nil, nil, fmt.Errorf(`parse: expected "[", got %q at %s`, got, p.loc())
 	}
 	p.src = p.src[1:]
 
@@ -475,8 +592,8 @@ func (p *parser) parseBracket(sep t.ID) (op t.ID, ei *a.Expr, ej *a.Expr, err er
 			extra = ` or "]"`
 		}
 		got := p.tm.ByID(x)
-		return 0, nil, nil, fmt.Errorf(`parse: expected %q%s, got %q at %s:%d`,
-			p.tm.ByID(sep), extra, got, p.filename, p.line())
+		return 0, nil, nil, fmt.Errorf(`parse: expected %q%s, got %q at %s`,
+			p.tm.ByID(sep), extra, got, p.loc())
 	}
 
 	if p.peek1() != t.IDCloseBracket {
@@ -488,7 +605,7 @@ func (p *parser) parseBracket(sep t.ID) (op t.ID, ei *a.Expr, ej *a.Expr, err er
 
 	if x := p.peek1(); x != t.IDCloseBracket {
 		got := p.tm.ByID(x)
-		return 0, nil, nil, fmt.Errorf(`parse: expected "]", got %q at %s:%d`, got, p.filename, p.line())
+		return 0, nil, nil, fmt.Errorf(`parse: expected "]", got %q at %s`, got, p.loc())
 	}
 	p.src = p.src[1:]
 
@@ -498,7 +615,7 @@ func (p *parser) parseBracket(sep t.ID) (op t.ID, ei *a.Expr, ej *a.Expr, err er
 func (p *parser) parseBlock() ([]*a.Node, error) {
 	if x := p.peek1(); x != t.IDOpenCurly {
 		got := p.tm.ByID(x)
-		return nil, fmt.Errorf(`parse: expected "{", got %q at %s:%d`, got, p.filename, p.line())
+		return nil, fmt.Errorf(`parse: expected "{", got %q at %s`, got, p.loc())
 	}
 	p.src = p.src[1:]
 
@@ -517,20 +634,35 @@ func (p *parser) parseBlock() ([]*a.Node, error) {
 
 		if x := p.peek1(); x != t.IDSemicolon {
 			got := p.tm.ByID(x)
-			return nil, fmt.Errorf(`parse: expected (implicit) ";", got %q at %s:%d`, got, p.filename, p.line())
+			return nil, fmt.Errorf(`parse: expected (implicit) ";", got %q at %s`, got, p.loc())
 		}
 		p.src = p.src[1:]
 	}
-	return nil, fmt.Errorf(`parse: expected "}" at %s:%d`, p.filename, p.line())
+	return nil, fmt.Errorf(`parse: expected "}" at %s`, p.loc())
 }
 
+// assertsSorted checks that the asserts are in "pre", "inv", "post" order. If
+// the SortAsserts option is set, it sorts them instead.
 func (p *parser) assertsSorted(asserts []*a.Node) error {
+	if p.opts.SortAsserts {
+		for _, o := range asserts {
+			if o.AsAssert().Keyword() == t.IDAssert {
+				return fmt.Errorf(`parse: assertion chain cannot contain "assert", `+
+					`only "pre", "inv" and "post" at %s`, p.loc())
+			}
+		}
+		sort.SliceStable(asserts, func(i, j int) bool {
+			return assertOrder(asserts[i]) < assertOrder(asserts[j])
+		})
+		return nil
+	}
+
 	seenInv, seenPost := false, false
 	for _, a := range asserts {
 		switch a.AsAssert().Keyword() {
 		case t.IDAssert:
 			return fmt.Errorf(`parse: assertion chain cannot contain "assert", `+
-				`only "pre", "inv" and "post" at %s:%d`, p.filename, p.line())
+				`only "pre", "inv" and "post" at %s`, p.loc())
 		case t.IDPre:
 			if seenPost || seenInv {
 				break
@@ -546,13 +678,24 @@ func (p *parser) assertsSorted(asserts []*a.Node) error {
 			seenPost = true
 			continue
 		}
-		return fmt.Errorf(`parse: assertion chain not in "pre", "inv", "post" order at %s:%d`,
-			p.filename, p.line())
+		return fmt.Errorf(`parse: assertion chain not in "pre", "inv", "post" order at %s`,
+			p.loc())
 	}
 	return nil
 }
 
+func assertOrder(n *a.Node) int {
+	switch n.AsAssert().Keyword() {
+	case t.IDPre:
+		return 0
+	case t.IDInv:
+		return 1
+	}
+	return 2
+}
+
 func (p *parser) parseAssertNode() (*a.Node, error) {
+	start := p.peekToken()
 	switch x := p.peek1(); x {
 	case t.IDAssert, t.IDPre, t.IDInv, t.IDPost:
 		p.src = p.src[1:]
@@ -563,10 +706,13 @@ func (p *parser) parseAssertNode() (*a.Node, error) {
 		reason, args := t.ID(0), []*a.Node(nil)
 		if p.peek1() == t.IDVia {
 			p.src = p.src[1:]
+			// The reason is either a built-in, like "a < b: a < c; c < b",
+			// or the name of a lemma.
 			reason = p.peek1()
-			if !reason.IsStrLiteral(p.tm) {
+			if !reason.IsStrLiteral(p.tm) && !reason.IsIdent(p.tm) {
 				got := p.tm.ByID(reason)
-				return nil, fmt.Errorf(`parse: expected string literal, got %q at %s:%d`, got, p.filename, p.line())
+				return nil, fmt.Errorf(`parse: expected string literal or identifier, got %q at %s`,
+					got, p.loc())
 			}
 			p.src = p.src[1:]
 			args, err = p.parseList(t.IDCloseParen, (*parser).parseArgNode)
@@ -574,22 +720,22 @@ func (p *parser) parseAssertNode() (*a.Node, error) {
 				return nil, err
 			}
 		}
-		return a.NewAssert(x, condition, reason, args).AsNode(), nil
+		n := a.NewAssert(x, condition, reason, args).AsNode()
+		p.setPosition(n, start)
+		return n, nil
 	}
-	return nil, fmt.Errorf(`parse: expected "assert", "pre" or "post" at %s:%d`, p.filename, p.line())
+	return nil, fmt.Errorf(`parse: expected "assert", "pre" or "post" at %s`, p.loc())
 }
 
 func (p *parser) parseStatement() (*a.Node, error) {
-	line := uint32(0)
-	if len(p.src) > 0 {
-		line = p.src[0].Line
-	}
+	start := p.peekToken()
 	n, err := p.parseStatement1()
 	if n != nil {
-		n.AsRaw().SetFilenameLine(p.filename, line)
+		n.AsRaw().SetFilenameLine(p.filename, start.Line)
+		p.setPosition(n, start)
 		if n.Kind() == a.KIterate {
 			for _, o := range n.AsIterate().Variables() {
-				o.AsRaw().SetFilenameLine(p.filename, line)
+				o.AsRaw().SetFilenameLine(p.filename, start.Line)
 			}
 		}
 	}
@@ -677,6 +823,28 @@ func (p *parser) parseStatement1() (*a.Node, error) {
 		return nil, err
 	}
 
+	if p.peek1() == t.IDComma {
+		lhsList := []*a.Node{lhs.AsNode()}
+		for p.peek1() == t.IDComma {
+			p.src = p.src[1:]
+			o, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			lhsList = append(lhsList, o.AsNode())
+		}
+		if x := p.peek1(); x != t.IDEq {
+			got := p.tm.ByID(x)
+			return nil, fmt.Errorf(`parse: expected "=", got %q at %s`, got, p.loc())
+		}
+		p.src = p.src[1:]
+		rhs, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		return a.NewDestructuringAssign(lhsList, rhs).AsNode(), nil
+	}
+
 	if op := p.peek1(); op.IsAssign() {
 		p.src = p.src[1:]
 		rhs, err := p.parseExpr()
@@ -707,7 +875,7 @@ func (p *parser) parseAsserts() ([]*a.Node, error) {
 func (p *parser) parseIf() (*a.If, error) {
 	if x := p.peek1(); x != t.IDIf {
 		got := p.tm.ByID(x)
-		return nil, fmt.Errorf(`parse: expected "if", got %q at %s:%d`, got, p.filename, p.line())
+		return nil, fmt.Errorf(`parse: expected "if", got %q at %s`, got, p.loc())
 	}
 	p.src = p.src[1:]
 	condition, err := p.parseExpr()
@@ -718,7 +886,7 @@ func (p *parser) parseIf() (*a.If, error) {
 	if err != nil {
 		return nil, err
 	}
-	elseIf, bodyIfFalse := (*a.If)(nil), ([]*a.Node)(nil)
+	elseIf, bodyIfFalse, hasElse := (*a.If)(nil), ([]*a.Node)(nil), false
 	if p.peek1() == t.IDElse {
 		p.src = p.src[1:]
 		if p.peek1() == t.IDIf {
@@ -731,15 +899,20 @@ func (p *parser) parseIf() (*a.If, error) {
 			if err != nil {
 				return nil, err
 			}
+			hasElse = true
 		}
 	}
-	return a.NewIf(condition, bodyIfTrue, bodyIfFalse, elseIf), nil
+	n := a.NewIf(condition, bodyIfTrue, bodyIfFalse, elseIf)
+	if hasElse {
+		n.SetHasElse()
+	}
+	return n, nil
 }
 
 func (p *parser) parseIterateNode() (*a.Node, error) {
 	if x := p.peek1(); x != t.IDIterate {
 		got := p.tm.ByID(x)
-		return nil, fmt.Errorf(`parse: expected "iterate", got %q at %s:%d`, got, p.filename, p.line())
+		return nil, fmt.Errorf(`parse: expected "iterate", got %q at %s`, got, p.loc())
 	}
 	p.src = p.src[1:]
 	label, err := p.parseLabel()
@@ -760,57 +933,57 @@ func (p *parser) parseIterateNode() (*a.Node, error) {
 func (p *parser) parseIterateBlock(label t.ID, vars []*a.Node) (*a.Iterate, error) {
 	if x := p.peek1(); x != t.IDOpenParen {
 		got := p.tm.ByID(x)
-		return nil, fmt.Errorf(`parse: expected "(", got %q at %s:%d`, got, p.filename, p.line())
+		return nil, fmt.Errorf(`parse: expected "(", got %q at %s`, got, p.loc())
 	}
 	p.src = p.src[1:]
 
 	if x := p.peek1(); x != t.IDLength {
 		got := p.tm.ByID(x)
-		return nil, fmt.Errorf(`parse: expected "length", got %q at %s:%d`, got, p.filename, p.line())
+		return nil, fmt.Errorf(`parse: expected "length", got %q at %s`, got, p.loc())
 	}
 	p.src = p.src[1:]
 
 	if x := p.peek1(); x != t.IDColon {
 		got := p.tm.ByID(x)
-		return nil, fmt.Errorf(`parse: expected ":", got %q at %s:%d`, got, p.filename, p.line())
+		return nil, fmt.Errorf(`parse: expected ":", got %q at %s`, got, p.loc())
 	}
 	p.src = p.src[1:]
 
 	length := p.peek1()
 	if length.SmallPowerOf2Value() == 0 {
-		return nil, fmt.Errorf(`parse: expected power-of-2 length count in [1..256], got %q at %s:%d`,
-			p.tm.ByID(length), p.filename, p.line())
+		return nil, fmt.Errorf(`parse: expected power-of-2 length count in [1..256], got %q at %s`,
+			p.tm.ByID(length), p.loc())
 	}
 	p.src = p.src[1:]
 
 	if x := p.peek1(); x != t.IDComma {
 		got := p.tm.ByID(x)
-		return nil, fmt.Errorf(`parse: expected ",", got %q at %s:%d`, got, p.filename, p.line())
+		return nil, fmt.Errorf(`parse: expected ",", got %q at %s`, got, p.loc())
 	}
 	p.src = p.src[1:]
 
 	if x := p.peek1(); x != t.IDUnroll {
 		got := p.tm.ByID(x)
-		return nil, fmt.Errorf(`parse: expected "unroll", got %q at %s:%d`, got, p.filename, p.line())
+		return nil, fmt.Errorf(`parse: expected "unroll", got %q at %s`, got, p.loc())
 	}
 	p.src = p.src[1:]
 
 	if x := p.peek1(); x != t.IDColon {
 		got := p.tm.ByID(x)
-		return nil, fmt.Errorf(`parse: expected ":", got %q at %s:%d`, got, p.filename, p.line())
+		return nil, fmt.Errorf(`parse: expected ":", got %q at %s`, got, p.loc())
 	}
 	p.src = p.src[1:]
 
 	unroll := p.peek1()
 	if unroll.SmallPowerOf2Value() == 0 {
-		return nil, fmt.Errorf(`parse: expected power-of-2 unroll count in [1..256], got %q at %s:%d`,
-			p.tm.ByID(unroll), p.filename, p.line())
+		return nil, fmt.Errorf(`parse: expected power-of-2 unroll count in [1..256], got %q at %s`,
+			p.tm.ByID(unroll), p.loc())
 	}
 	p.src = p.src[1:]
 
 	if x := p.peek1(); x != t.IDCloseParen {
 		got := p.tm.ByID(x)
-		return nil, fmt.Errorf(`parse: expected ")", got %q at %s:%d`, got, p.filename, p.line())
+		return nil, fmt.Errorf(`parse: expected ")", got %q at %s`, got, p.loc())
 	}
 	p.src = p.src[1:]
 
@@ -842,7 +1015,7 @@ func (p *parser) parseArgNode() (*a.Node, error) {
 	}
 	if x := p.peek1(); x != t.IDColon {
 		got := p.tm.ByID(x)
-		return nil, fmt.Errorf(`parse: expected ":", got %q at %s:%d`, got, p.filename, p.line())
+		return nil, fmt.Errorf(`parse: expected ":", got %q at %s`, got, p.loc())
 	}
 	p.src = p.src[1:]
 	value, err := p.parseExpr()
@@ -865,7 +1038,7 @@ func (p *parser) parseIOBindExprNode() (*a.Node, error) {
 			return e.AsNode(), nil
 		}
 	}
-	return nil, fmt.Errorf(`parse: expected "in.something", got %q at %s:%d`, e.Str(p.tm), p.filename, p.line())
+	return nil, fmt.Errorf(`parse: expected "in.something", got %q at %s`, e.Str(p.tm), p.loc())
 }
 
 func (p *parser) parseIterateVarNode() (*a.Node, error) {
@@ -888,7 +1061,7 @@ func (p *parser) parseVarNode(inIterate bool) (*a.Node, error) {
 		op = t.IDEqColon
 		if x := p.peek1(); x != t.IDEqColon {
 			got := p.tm.ByID(x)
-			return nil, fmt.Errorf(`parse: expected "=:", got %q at %s:%d`, got, p.filename, p.line())
+			return nil, fmt.Errorf(`parse: expected "=:", got %q at %s`, got, p.loc())
 		}
 		p.src = p.src[1:]
 		value, err = p.parseExpr()
@@ -927,30 +1100,36 @@ func (p *parser) parsePossibleDollarExpr() (*a.Expr, error) {
 	if x := p.peek1(); x != t.IDDollar {
 		return p.parseExpr()
 	}
+	start := p.peekToken()
 	p.src = p.src[1:]
 	args, err := p.parseList(t.IDCloseParen, (*parser).parsePossibleDollarExprNode)
 	if err != nil {
 		return nil, err
 	}
-	return a.NewExpr(0, t.IDDollar, 0, 0, nil, nil, nil, args), nil
+	n := a.NewExpr(0, t.IDDollar, 0, 0, nil, nil, nil, args)
+	p.setPosition(n.AsNode(), start)
+	return n, nil
 }
 
 func (p *parser) parseTryExpr() (*a.Expr, error) {
 	if x := p.peek1(); x != t.IDTry {
 		got := p.tm.ByID(x)
-		return nil, fmt.Errorf(`parse: expected "try", got %q at %s:%d`, got, p.filename, p.line())
+		return nil, fmt.Errorf(`parse: expected "try", got %q at %s`, got, p.loc())
 	}
+	start := p.peekToken()
 	p.src = p.src[1:]
 	call, err := p.parseExpr()
 	if err != nil {
 		return nil, err
 	}
 	if call.Operator() != t.IDOpenParen {
-		return nil, fmt.Errorf(`parse: expected function call after "try", got %q at %s:%d`,
-			call.Str(p.tm), p.filename, p.line())
+		return nil, fmt.Errorf(`parse: expected function call after "try", got %q at %s`,
+			call.Str(p.tm), p.loc())
 	}
-	return a.NewExpr(call.AsNode().AsRaw().Flags(), t.IDTry, 0, call.Ident(),
-		call.LHS(), call.MHS(), call.RHS(), call.Args()), nil
+	n := a.NewExpr(call.AsNode().AsRaw().Flags(), t.IDTry, 0, call.Ident(),
+		call.LHS(), call.MHS(), call.RHS(), call.Args())
+	p.setPosition(n.AsNode(), start)
+	return n, nil
 }
 
 func (p *parser) parseExprNode() (*a.Node, error) {
@@ -962,6 +1141,7 @@ func (p *parser) parseExprNode() (*a.Node, error) {
 }
 
 func (p *parser) parseExpr() (*a.Expr, error) {
+	start := p.peekToken()
 	lhs, err := p.parseOperand()
 	if err != nil {
 		return nil, err
@@ -988,7 +1168,9 @@ func (p *parser) parseExpr() (*a.Expr, error) {
 			if op == 0 {
 				return nil, fmt.Errorf(`parse: internal error: no binary form for token 0x%02X`, x)
 			}
-			return a.NewExpr(0, op, 0, 0, lhs.AsNode(), nil, rhs, nil), nil
+			n := a.NewExpr(0, op, 0, 0, lhs.AsNode(), nil, rhs, nil)
+			p.setPosition(n.AsNode(), start)
+			return n, nil
 		}
 
 		args := []*a.Node{lhs.AsNode(), rhs}
@@ -1004,12 +1186,15 @@ func (p *parser) parseExpr() (*a.Expr, error) {
 		if op == 0 {
 			return nil, fmt.Errorf(`parse: internal error: no associative form for token 0x%02X`, x)
 		}
-		return a.NewExpr(0, op, 0, 0, nil, nil, nil, args), nil
+		n := a.NewExpr(0, op, 0, 0, nil, nil, nil, args)
+		p.setPosition(n.AsNode(), start)
+		return n, nil
 	}
 	return lhs, nil
 }
 
 func (p *parser) parseOperand() (*a.Expr, error) {
+	start := p.peekToken()
 	switch x := p.peek1(); {
 	case x.IsUnaryOp():
 		p.src = p.src[1:]
@@ -1021,11 +1206,15 @@ func (p *parser) parseOperand() (*a.Expr, error) {
 		if op == 0 {
 			return nil, fmt.Errorf(`parse: internal error: no unary form for token 0x%02X`, x)
 		}
-		return a.NewExpr(0, op, 0, 0, nil, nil, rhs.AsNode(), nil), nil
+		n := a.NewExpr(0, op, 0, 0, nil, nil, rhs.AsNode(), nil)
+		p.setPosition(n.AsNode(), start)
+		return n, nil
 
 	case x.IsLiteral(p.tm):
 		p.src = p.src[1:]
-		return a.NewExpr(0, 0, 0, x, nil, nil, nil, nil), nil
+		n := a.NewExpr(0, 0, 0, x, nil, nil, nil, nil)
+		p.setPosition(n.AsNode(), start)
+		return n, nil
 
 	default:
 		switch x {
@@ -1037,7 +1226,7 @@ func (p *parser) parseOperand() (*a.Expr, error) {
 			}
 			if x := p.peek1(); x != t.IDCloseParen {
 				got := p.tm.ByID(x)
-				return nil, fmt.Errorf(`parse: expected ")", got %q at %s:%d`, got, p.filename, p.line())
+				return nil, fmt.Errorf(`parse: expected ")", got %q at %s`, got, p.loc())
 			}
 			p.src = p.src[1:]
 			return expr, nil
@@ -1050,10 +1239,12 @@ func (p *parser) parseOperand() (*a.Expr, error) {
 			statusPkg := t.ID(0)
 			if !message.IsStrLiteral(p.tm) {
 				got := p.tm.ByID(message)
-				return nil, fmt.Errorf(`parse: expected string literal, got %q at %s:%d`, got, p.filename, p.line())
+				return nil, fmt.Errorf(`parse: expected string literal, got %q at %s`, got, p.loc())
 			}
 			p.src = p.src[1:]
-			return a.NewExpr(0, keyword, statusPkg, message, nil, nil, nil, nil), nil
+			n := a.NewExpr(0, keyword, statusPkg, message, nil, nil, nil, nil)
+			p.setPosition(n.AsNode(), start)
+			return n, nil
 		}
 	}
 
@@ -1062,6 +1253,7 @@ func (p *parser) parseOperand() (*a.Expr, error) {
 		return nil, err
 	}
 	lhs := a.NewExpr(0, 0, 0, id, nil, nil, nil, nil)
+	p.setPosition(lhs.AsNode(), start)
 
 	for {
 		flags := a.Flags(0)
@@ -1083,6 +1275,7 @@ func (p *parser) parseOperand() (*a.Expr, error) {
 				return nil, err
 			}
 			lhs = a.NewExpr(flags, t.IDOpenParen, 0, 0, lhs.AsNode(), nil, nil, args)
+			p.setPosition(lhs.AsNode(), start)
 
 		case t.IDOpenBracket:
 			id0, mhs, rhs, err := p.parseBracket(t.IDColon)
@@ -1090,6 +1283,7 @@ func (p *parser) parseOperand() (*a.Expr, error) {
 				return nil, err
 			}
 			lhs = a.NewExpr(0, id0, 0, 0, lhs.AsNode(), mhs.AsNode(), rhs.AsNode(), nil)
+			p.setPosition(lhs.AsNode(), start)
 
 		case t.IDDot:
 			p.src = p.src[1:]
@@ -1098,6 +1292,7 @@ func (p *parser) parseOperand() (*a.Expr, error) {
 				return nil, err
 			}
 			lhs = a.NewExpr(0, t.IDDot, 0, selector, lhs.AsNode(), nil, nil, nil)
+			p.setPosition(lhs.AsNode(), start)
 		}
 	}
 }
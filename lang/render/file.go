@@ -0,0 +1,923 @@
+// Copyright 2017 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+type Options struct {
+	// Width, if positive, is the maximum line width, counting a tab as eight
+	// columns. Longer lines are broken after a comma or a binary operator,
+	// preferring the outermost level of nesting. Trailing comments don't
+	// count towards the width.
+	Width int
+
+	// AlignFields is whether to align the types of struct fields and func
+	// parameters that are written one per line.
+	AlignFields bool
+
+	// SortUses is whether to sort each run of consecutive `use` lines by
+	// path. A run is broken by a blank line, but not by a comment line.
+	SortUses bool
+}
+
+// RenderFile writes f, formatted, to w. The src tokens and the comments
+// (indexed by line number) are those that f was parsed from.
+//
+// The output is generated from f, not from src, so that redundant
+// parentheses are dropped and, with the right opts, long lines are reflowed
+// and fields aligned. Each token keeps the line of the source token that it
+// corresponds to, so that the source's line breaks, blank lines and comments
+// are otherwise preserved. A comment is attached to the node whose tokens
+// surround it: whole-line comments precede the next token and a trailing
+// comment follows the last token on its line.
+func RenderFile(w io.Writer, tm *t.Map, src []t.Token, comments []string, f *a.File, opts *Options) error {
+	p := &printer{
+		tm:       tm,
+		src:      src,
+		comments: comments,
+	}
+	if opts != nil {
+		p.opts = *opts
+	}
+	decls := f.TopLevelDecls()
+	for i := 0; i < len(decls); {
+		j := i + 1
+		if p.opts.SortUses && decls[i].Kind() == a.KUse {
+			for ; j < len(decls) && decls[j].Kind() == a.KUse &&
+				p.adjacentLines(p.nodeLine(decls[j-1]), p.nodeLine(decls[j])); j++ {
+			}
+		}
+		if j-i > 1 {
+			uses := append([]*a.Node(nil), decls[i:j]...)
+			sort.SliceStable(uses, func(x, y int) bool {
+				return uses[x].AsUse().Path().Str(tm) < uses[y].AsUse().Path().Str(tm)
+			})
+			p.inSlots(decls[i:j], uses, func(k int) {
+				p.topLevelDecl(uses[k])
+			})
+		} else {
+			p.topLevelDecl(decls[i])
+		}
+		i = j
+	}
+	if p.err != nil {
+		return p.err
+	}
+	if p.outComments != nil {
+		comments = p.outComments
+	}
+	return render(w, tm, p.out, comments, p.opts.Width)
+}
+
+// printer converts an AST to a token stream, annotated with layout hints.
+type printer struct {
+	tm       *t.Map
+	src      []t.Token
+	comments []string
+	opts     Options
+	err      error
+
+	// cursor is the index in src of the next source token to match against.
+	cursor int
+	// depth is the nesting depth of brackets within a declaration or
+	// statement, used to prioritize where to break long lines.
+	depth uint32
+	// brk and pad are the layout hints for the next token.
+	brk uint32
+	pad uint32
+	// lineDelta is added to the line of each source token, when emitting
+	// nodes in a different order than the source's.
+	lineDelta int64
+	// outComments are the comments indexed by output line, if reordering
+	// nodes has moved any comments. Otherwise, it is nil and the comments
+	// are indexed by source line.
+	outComments []string
+
+	out []token
+}
+
+func (p *printer) fail(format string, args ...interface{}) {
+	if p.err == nil {
+		p.err = fmt.Errorf("render: "+format, args...)
+	}
+}
+
+func (p *printer) lastLine() uint32 {
+	if n := len(p.out); n > 0 {
+		return p.out[n-1].Line
+	}
+	if len(p.src) > 0 {
+		return p.src[0].Line
+	}
+	return 1
+}
+
+// match finds the source token for the next token, id, and returns its line.
+// Parentheses, commas and semi-colons that have no counterpart in the output
+// (such as redundant parentheses and optional trailing commas) are skipped.
+func (p *printer) match(id t.ID) uint32 {
+	for i := p.cursor; i < len(p.src); i++ {
+		x := p.src[i]
+		if x.ID == id {
+			p.cursor = i + 1
+			return x.Line
+		}
+		switch x.ID {
+		case t.IDOpenParen, t.IDCloseParen, t.IDComma, t.IDSemicolon:
+			continue
+		}
+		break
+	}
+	return p.lastLine()
+}
+
+// peekLine returns the line of the next source token that is id, skipping
+// commas, or zero if there is no such token.
+func (p *printer) peekLine(id t.ID) uint32 {
+	for i := p.cursor; i < len(p.src); i++ {
+		if x := p.src[i]; x.ID == id {
+			return x.Line
+		} else if x.ID != t.IDComma {
+			break
+		}
+	}
+	return 0
+}
+
+// sync moves the cursor to the source token that n starts at, if n's position
+// is known.
+func (p *printer) sync(n *a.Node) {
+	raw := n.AsRaw()
+	if raw.Col() == 0 {
+		return
+	}
+	pos := raw.Pos()
+	i := sort.Search(len(p.src), func(i int) bool { return p.src[i].Pos >= pos })
+	if i < len(p.src) && p.src[i].Pos == pos && p.src[i].ID != t.IDSemicolon {
+		p.cursor = i
+	}
+}
+
+// nodeLine returns the line of the source token that n starts at, or zero if
+// n's position is unknown.
+func (p *printer) nodeLine(n *a.Node) uint32 {
+	if i := p.nodeIndex(n); i >= 0 {
+		return p.src[i].Line
+	}
+	return 0
+}
+
+// nodeIndex returns the index in src of the token that n starts at, or -1 if
+// n's position is unknown.
+func (p *printer) nodeIndex(n *a.Node) int {
+	raw := n.AsRaw()
+	if raw.Col() == 0 {
+		return -1
+	}
+	pos := raw.Pos()
+	i := sort.Search(len(p.src), func(i int) bool { return p.src[i].Pos >= pos })
+	if i < len(p.src) && p.src[i].Pos == pos {
+		return i
+	}
+	return -1
+}
+
+// hasTokens returns whether any source token is on the given line.
+func (p *printer) hasTokens(line uint32) bool {
+	i := sort.Search(len(p.src), func(i int) bool { return p.src[i].Line >= line })
+	return i < len(p.src) && p.src[i].Line == line
+}
+
+// comment returns the comment on the given source line, if any.
+func (p *printer) comment(line uint32) string {
+	if uint(line) < uint(len(p.comments)) {
+		return p.comments[line]
+	}
+	return ""
+}
+
+func (p *printer) emit(id t.ID) {
+	line := uint32(int64(p.match(id)) + p.lineDelta)
+	if last := p.lastLine(); line < last {
+		line = last
+	}
+	p.out = append(p.out, token{
+		Token: t.Token{ID: id, Line: line},
+		pad:   p.pad,
+		brk:   p.brk,
+	})
+	p.brk, p.pad = 0, 0
+}
+
+// emitSemicolon ends a declaration or statement. The semi-colon is always on
+// the same line as the previous token, as it is implicit in the source.
+func (p *printer) emitSemicolon() {
+	if p.cursor < len(p.src) && p.src[p.cursor].ID == t.IDSemicolon {
+		p.cursor++
+	}
+	p.out = append(p.out, token{Token: t.Token{ID: t.IDSemicolon, Line: p.lastLine()}})
+	p.brk, p.pad = 0, 0
+}
+
+// inSlots emits the nodes, which are a permutation of the source nodes, by
+// calling emitOne for each index into nodes.
+//
+// If each source node has lines of its own, the nodes are laid out one after
+// another over those lines, each with its comments: the whole-line comments
+// just above it and the comments on its lines. Otherwise, each emitted node
+// takes the line slot of the source node at the same index, so that
+// reordering nodes does not reorder lines, and comments stay on their lines.
+func (p *printer) inSlots(source []*a.Node, nodes []*a.Node, emitOne func(i int)) {
+	deltas := p.moveComments(source, nodes)
+	maxCursor := p.cursor
+	for i, n := range nodes {
+		if deltas != nil {
+			p.lineDelta = deltas[i]
+		} else {
+			p.lineDelta = int64(p.nodeLine(source[i])) - int64(p.nodeLine(n))
+		}
+		p.sync(n)
+		emitOne(i)
+		if maxCursor < p.cursor {
+			maxCursor = p.cursor
+		}
+	}
+	p.lineDelta = 0
+	p.cursor = maxCursor
+}
+
+// moveComments lays out the nodes, a permutation of the source nodes, over
+// the source nodes' lines, moving their comments with them. It returns the
+// line delta for each of the nodes, or nil if the source nodes don't each
+// have lines of their own.
+func (p *printer) moveComments(source []*a.Node, nodes []*a.Node) []int64 {
+	type span struct {
+		// lead is the first of any whole-line comments above the node, first
+		// and last are the node's first and last lines.
+		lead, first, last uint32
+	}
+	spans := make(map[*a.Node]span, len(source))
+	prevLast := uint32(0)
+	for i, n := range source {
+		j := p.nodeIndex(n)
+		if j < 0 {
+			return nil
+		}
+		sp := span{first: p.src[j].Line}
+		if i == 0 {
+			if j > 0 && p.src[j-1].Line == sp.first {
+				return nil
+			}
+			prevLast = 0
+			if j > 0 {
+				prevLast = p.src[j-1].Line
+			}
+		} else if sp.first <= prevLast {
+			return nil
+		}
+		sp.lead = sp.first
+		for sp.lead-1 > prevLast && p.comment(sp.lead-1) != "" && !p.hasTokens(sp.lead-1) {
+			sp.lead--
+		}
+		if i+1 < len(source) {
+			k := p.nodeIndex(source[i+1])
+			if k <= j {
+				return nil
+			}
+			sp.last = p.src[k-1].Line
+		} else {
+			sp.last = p.lastNodeLine(j)
+		}
+		spans[n] = sp
+		prevLast = sp.last
+	}
+
+	// The gaps are the blank lines between the source nodes' lines, which stay
+	// where they are.
+	gaps := make([]uint32, len(source))
+	for i := 1; i < len(source); i++ {
+		gaps[i] = spans[source[i]].lead - spans[source[i-1]].last - 1
+	}
+
+	if p.outComments == nil {
+		p.outComments = append([]string(nil), p.comments...)
+	}
+	for l := spans[source[0]].lead; l <= prevLast && uint(l) < uint(len(p.outComments)); l++ {
+		p.outComments[l] = ""
+	}
+	deltas := make([]int64, len(nodes))
+	line := spans[source[0]].lead
+	for i, n := range nodes {
+		line += gaps[i]
+		sp := spans[n]
+		deltas[i] = int64(line) - int64(sp.lead)
+		for l := sp.lead; l <= sp.last; l++ {
+			if c := p.comment(l); c != "" {
+				p.outComments[int64(l)+deltas[i]] = c
+			}
+		}
+		line += sp.last - sp.lead + 1
+	}
+	return deltas
+}
+
+// lastNodeLine returns the line of the last token of the node, a declaration
+// or an assertion, that starts at src[i]. That node ends before a ";" or "{"
+// that is not nested in brackets.
+func (p *printer) lastNodeLine(i int) uint32 {
+	depth := 0
+	last := p.src[i].Line
+	for ; i < len(p.src); i++ {
+		switch x := p.src[i]; {
+		case depth == 0 && (x.ID == t.IDSemicolon || x.ID == t.IDOpenCurly):
+			return last
+		case depth == 0 && x.ID == t.IDComma:
+			continue
+		case x.ID.IsOpen():
+			depth++
+		case x.ID.IsClose():
+			depth--
+		}
+		last = p.src[i].Line
+	}
+	return last
+}
+
+// allowBreak allows a long line to be broken before the next token.
+func (p *printer) allowBreak() {
+	p.brk = 1 + p.depth
+}
+
+// closeList ends a list of n elements with the close token. If the source has
+// the close token on a later line than the last element, a trailing comma is
+// required.
+func (p *printer) closeList(close t.ID, n int) {
+	if n > 0 {
+		if line := p.peekLine(close); line > p.lastLine() {
+			p.emit(t.IDComma)
+		}
+	}
+	p.emit(close)
+	p.depth--
+}
+
+func (p *printer) topLevelDecl(n *a.Node) {
+	p.sync(n)
+	p.depth = 0
+	switch n.Kind() {
+	case a.KConst:
+		o := n.AsConst()
+		p.emitPubPri(o.Public())
+		p.emit(t.IDConst)
+		p.emit(o.QID()[1])
+		p.typeExpr(o.XType())
+		p.emit(t.IDEq)
+		p.allowBreak()
+		p.expr(o.Value(), false)
+
+	case a.KFunc:
+		o := n.AsFunc()
+		p.emitPubPri(o.Public())
+		p.emit(t.IDFunc)
+		if r := o.Receiver(); r[1] != 0 {
+			p.emit(r[1])
+			p.emit(t.IDDot)
+		}
+		p.emit(o.FuncName())
+		p.emitEffect(o.Effect())
+		p.fields(o.In().Fields())
+		p.fields(o.Out().Fields())
+		if d := o.Depth(); d != nil {
+			p.emit(t.IDComma)
+			p.allowBreak()
+			p.emit(t.IDDepth)
+			p.expr(d, false)
+		}
+		p.asserts(o.Asserts())
+		p.block(o.Body())
+
+	case a.KLemma:
+		o := n.AsLemma()
+		p.emitPubPri(o.Public())
+		p.emit(t.IDLemma)
+		p.emit(o.QID()[1])
+		p.fields(o.Params())
+		p.emit(t.IDComma)
+		p.allowBreak()
+		p.assertList(o.Asserts())
+		p.block(o.Body())
+
+	case a.KPackageID:
+		p.emit(t.IDPackageID)
+		p.emit(n.AsPackageID().ID())
+
+	case a.KStatus:
+		o := n.AsStatus()
+		p.emitPubPri(o.Public())
+		p.emit(o.Keyword())
+		p.emit(t.IDOpenParen)
+		p.expr(o.Value(), false)
+		p.emit(t.IDCloseParen)
+		p.emit(o.QID()[1])
+
+	case a.KStruct:
+		o := n.AsStruct()
+		p.emitPubPri(o.Public())
+		p.emit(t.IDStruct)
+		p.emit(o.QID()[1])
+		if o.Suspendible() {
+			p.emit(t.IDQuestion)
+		}
+		p.fields(o.Fields())
+
+	case a.KUse:
+		p.emit(t.IDUse)
+		p.emit(n.AsUse().Path())
+
+	default:
+		p.fail("unexpected top level declaration kind %v", n.Kind())
+	}
+	p.emitSemicolon()
+}
+
+func (p *printer) emitPubPri(public bool) {
+	if public {
+		p.emit(t.IDPub)
+	} else {
+		p.emit(t.IDPri)
+	}
+}
+
+func (p *printer) emitEffect(e a.Effect) {
+	switch e {
+	case a.Effect(a.FlagsImpure):
+		p.emit(t.IDExclam)
+	case a.Effect(a.FlagsImpure | a.FlagsSuspendible):
+		p.emit(t.IDQuestion)
+	}
+}
+
+// fields emits a parenthesized list of "name type" fields.
+func (p *printer) fields(fields []*a.Node) {
+	p.emit(t.IDOpenParen)
+	p.depth++
+	pads := p.alignFields(fields)
+	for i, o := range fields {
+		if i > 0 {
+			p.emit(t.IDComma)
+			p.allowBreak()
+		}
+		p.sync(o)
+		f := o.AsField()
+		p.emit(f.Name())
+		if pads != nil {
+			p.pad = pads[i]
+		}
+		p.typeExpr(f.XType())
+	}
+	p.closeList(t.IDCloseParen, len(fields))
+}
+
+// alignFields returns the extra spaces to put between each field's name and
+// type, so that the types line up, or nil if there is nothing to align.
+//
+// A field is aligned with its neighbors if each is the only field on its
+// line. A run of aligned fields is broken by a blank line, but not by a
+// comment line.
+func (p *printer) alignFields(fields []*a.Node) []uint32 {
+	if !p.opts.AlignFields || len(fields) < 2 {
+		return nil
+	}
+	lines := make([]uint32, len(fields))
+	for i, o := range fields {
+		if lines[i] = p.nodeLine(o); lines[i] == 0 {
+			return nil
+		}
+	}
+	pads := make([]uint32, len(fields))
+	for i := 0; i < len(fields); {
+		j := i + 1
+		for ; j < len(fields) && p.adjacentLines(lines[j-1], lines[j]); j++ {
+		}
+		if j-i > 1 {
+			width := 0
+			for _, o := range fields[i:j] {
+				if w := len(p.tm.ByID(o.AsField().Name())); width < w {
+					width = w
+				}
+			}
+			for k, o := range fields[i:j] {
+				pads[i+k] = uint32(width - len(p.tm.ByID(o.AsField().Name())))
+			}
+		}
+		i = j
+	}
+	return pads
+}
+
+// adjacentLines returns whether line y follows line x with nothing but
+// comment lines in between.
+func (p *printer) adjacentLines(x uint32, y uint32) bool {
+	if y <= x {
+		return false
+	}
+	for l := x + 1; l < y; l++ {
+		if uint(l) >= uint(len(p.comments)) || p.comments[l] == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// asserts emits a function's or loop's assertion chain, if any, including
+// the leading comma.
+func (p *printer) asserts(asserts []*a.Node) {
+	if len(asserts) > 0 {
+		p.emit(t.IDComma)
+		p.allowBreak()
+		p.assertList(asserts)
+	}
+}
+
+// assertList emits an assertion chain. As for closeList, if the source has
+// the "{" that follows on a later line, a trailing comma is required.
+//
+// The parser may have sorted the chain into "pre", "inv", "post" order, which
+// can differ from the source order.
+func (p *printer) assertList(asserts []*a.Node) {
+	source := append([]*a.Node(nil), asserts...)
+	sort.SliceStable(source, func(i, j int) bool {
+		return source[i].AsRaw().Pos() < source[j].AsRaw().Pos()
+	})
+	p.inSlots(source, asserts, func(i int) {
+		p.assert(asserts[i].AsAssert())
+		if i < len(asserts)-1 {
+			p.emit(t.IDComma)
+			p.allowBreak()
+		}
+	})
+	if len(asserts) > 0 {
+		if line := p.peekLine(t.IDOpenCurly); line > p.lastLine() {
+			p.emit(t.IDComma)
+		}
+	}
+}
+
+func (p *printer) assert(n *a.Assert) {
+	p.emit(n.Keyword())
+	p.expr(n.Condition(), false)
+	if r := n.Reason(); r != 0 {
+		p.emit(t.IDVia)
+		p.emit(r)
+		p.args(n.Args())
+	}
+}
+
+// args emits a parenthesized list of "name:value" arguments.
+func (p *printer) args(args []*a.Node) {
+	p.emit(t.IDOpenParen)
+	p.depth++
+	for i, o := range args {
+		if i > 0 {
+			p.emit(t.IDComma)
+			p.allowBreak()
+		}
+		arg := o.AsArg()
+		p.emit(arg.Name())
+		p.emit(t.IDColon)
+		p.expr(arg.Value(), false)
+	}
+	p.closeList(t.IDCloseParen, len(args))
+}
+
+func (p *printer) block(body []*a.Node) {
+	p.emit(t.IDOpenCurly)
+	for _, o := range body {
+		p.statement(o)
+		p.emitSemicolon()
+	}
+	p.emit(t.IDCloseCurly)
+}
+
+func (p *printer) statement(n *a.Node) {
+	p.sync(n)
+	p.depth = 0
+	switch n.Kind() {
+	case a.KAssert:
+		p.assert(n.AsAssert())
+
+	case a.KAssign:
+		o := n.AsAssign()
+		if o.Destructuring() {
+			for i, x := range o.LHSList() {
+				if i > 0 {
+					p.emit(t.IDComma)
+				}
+				p.expr(x.AsExpr(), false)
+			}
+		} else {
+			p.expr(o.LHS(), false)
+		}
+		p.emit(o.Operator())
+		p.allowBreak()
+		p.expr(o.RHS(), false)
+
+	case a.KExpr:
+		p.expr(n.AsExpr(), false)
+
+	case a.KIOBind:
+		o := n.AsIOBind()
+		p.emit(t.IDIOBind)
+		p.emit(t.IDOpenParen)
+		p.depth++
+		for i, x := range o.InFields() {
+			if i > 0 {
+				p.emit(t.IDComma)
+				p.allowBreak()
+			}
+			p.expr(x.AsExpr(), false)
+		}
+		p.closeList(t.IDCloseParen, len(o.InFields()))
+		p.block(o.Body())
+
+	case a.KIf:
+		p.ifStatement(n.AsIf())
+
+	case a.KIterate:
+		o := n.AsIterate()
+		p.emit(t.IDIterate)
+		p.emitLabel(o.Label())
+		p.emit(t.IDOpenParen)
+		p.depth++
+		for i, x := range o.Variables() {
+			if i > 0 {
+				p.emit(t.IDComma)
+				p.allowBreak()
+			}
+			p.variable(x.AsVar())
+		}
+		p.closeList(t.IDCloseParen, len(o.Variables()))
+		p.iterateBlock(o)
+
+	case a.KJump:
+		o := n.AsJump()
+		p.emit(o.Keyword())
+		p.emitLabel(o.Label())
+
+	case a.KRet:
+		o := n.AsRet()
+		p.emit(o.Keyword())
+		if v := o.Value(); v != nil {
+			p.expr(v, false)
+		}
+
+	case a.KVar:
+		p.emit(t.IDVar)
+		p.variable(n.AsVar())
+
+	case a.KWhile:
+		o := n.AsWhile()
+		p.emit(t.IDWhile)
+		p.emitLabel(o.Label())
+		p.expr(o.Condition(), false)
+		p.asserts(o.Asserts())
+		p.block(o.Body())
+
+	default:
+		p.fail("unexpected statement kind %v", n.Kind())
+	}
+}
+
+func (p *printer) emitLabel(label t.ID) {
+	if label != 0 {
+		p.emit(t.IDColon)
+		p.emit(label)
+	}
+}
+
+func (p *printer) ifStatement(n *a.If) {
+	p.emit(t.IDIf)
+	p.expr(n.Condition(), false)
+	p.block(n.BodyIfTrue())
+	if elseIf := n.ElseIf(); elseIf != nil {
+		p.emit(t.IDElse)
+		p.ifStatement(elseIf)
+	} else if n.HasElse() {
+		p.emit(t.IDElse)
+		p.block(n.BodyIfFalse())
+	}
+}
+
+func (p *printer) iterateBlock(n *a.Iterate) {
+	p.emit(t.IDOpenParen)
+	p.emit(t.IDLength)
+	p.emit(t.IDColon)
+	p.emit(n.Length())
+	p.emit(t.IDComma)
+	p.emit(t.IDUnroll)
+	p.emit(t.IDColon)
+	p.emit(n.Unroll())
+	p.emit(t.IDCloseParen)
+	p.asserts(n.Asserts())
+	p.block(n.Body())
+	if elseIterate := n.ElseIterate(); elseIterate != nil {
+		p.emit(t.IDElse)
+		p.iterateBlock(elseIterate)
+	}
+}
+
+// variable emits "name type", "name type = value" or, for an iterate
+// variable, "name type =: value". The "var" keyword, if any, is emitted by
+// the caller.
+func (p *printer) variable(n *a.Var) {
+	p.emit(n.Name())
+	p.typeExpr(n.XType())
+	if v := n.Value(); v != nil {
+		if n.IterateVariable() {
+			p.emit(t.IDEqColon)
+		} else {
+			p.emit(t.IDEq)
+		}
+		p.allowBreak()
+		p.expr(v, false)
+	}
+}
+
+// expr emits n, parenthesized if parenthesize is set and n is a binary or
+// associative operation. Other parentheses in the source are redundant and
+// are dropped.
+//
+// As an exception, a "not" operand of a binary or associative operation is
+// also parenthesized, for readability: "(not a) and b" instead of the
+// equivalent "not a and b".
+func (p *printer) expr(n *a.Expr, parenthesize bool) {
+	p.expr1(n, parenthesize, false)
+}
+
+func (p *printer) expr1(n *a.Expr, parenthesize bool, operand bool) {
+	if n == nil {
+		return
+	}
+	op := n.Operator()
+	paren := parenthesize && (op.IsXBinaryOp() || op.IsXAssociativeOp() ||
+		(operand && op == t.IDXUnaryNot))
+	if paren {
+		p.emit(t.IDOpenParen)
+		p.depth++
+	}
+	p.sync(n.AsNode())
+
+	switch {
+	case op.IsXUnaryOp():
+		p.emit(op.AmbiguousForm())
+		p.expr(n.RHS().AsExpr(), true)
+
+	case op.IsXBinaryOp():
+		p.expr1(n.LHS().AsExpr(), true, true)
+		p.emit(op.AmbiguousForm())
+		p.allowBreak()
+		if op == t.IDXBinaryAs {
+			p.typeExpr(n.RHS().AsTypeExpr())
+		} else {
+			p.expr1(n.RHS().AsExpr(), true, true)
+		}
+
+	case op.IsXAssociativeOp():
+		for i, o := range n.Args() {
+			if i > 0 {
+				p.emit(op.AmbiguousForm())
+				p.allowBreak()
+			}
+			p.expr1(o.AsExpr(), true, true)
+		}
+
+	default:
+		switch op {
+		case 0:
+			p.emit(n.Ident())
+
+		case t.IDError, t.IDStatus, t.IDSuspension:
+			p.emit(op)
+			if pkg := n.StatusQID()[0]; pkg != 0 {
+				p.emit(pkg)
+				p.emit(t.IDDot)
+			}
+			p.emit(n.Ident())
+
+		case t.IDTry, t.IDOpenParen:
+			if op == t.IDTry {
+				p.emit(t.IDTry)
+			}
+			p.expr(n.LHS().AsExpr(), true)
+			if n.CallSuspendible() {
+				p.emit(t.IDQuestion)
+			} else if n.CallImpure() {
+				p.emit(t.IDExclam)
+			}
+			p.args(n.Args())
+
+		case t.IDOpenBracket:
+			p.expr(n.LHS().AsExpr(), true)
+			p.emit(t.IDOpenBracket)
+			p.depth++
+			p.expr(n.RHS().AsExpr(), false)
+			p.emit(t.IDCloseBracket)
+			p.depth--
+
+		case t.IDColon:
+			p.expr(n.LHS().AsExpr(), true)
+			p.emit(t.IDOpenBracket)
+			p.depth++
+			p.expr(n.MHS().AsExpr(), false)
+			p.emit(t.IDColon)
+			p.expr(n.RHS().AsExpr(), false)
+			p.emit(t.IDCloseBracket)
+			p.depth--
+
+		case t.IDDot:
+			p.expr(n.LHS().AsExpr(), true)
+			p.emit(t.IDDot)
+			p.emit(n.Ident())
+
+		case t.IDDollar:
+			p.emit(t.IDDollar)
+			p.emit(t.IDOpenParen)
+			p.depth++
+			for i, o := range n.Args() {
+				if i > 0 {
+					p.emit(t.IDComma)
+					p.allowBreak()
+				}
+				p.expr(o.AsExpr(), false)
+			}
+			p.closeList(t.IDCloseParen, len(n.Args()))
+
+		default:
+			p.fail("unexpected expression operator %q", p.tm.ByID(op))
+		}
+	}
+
+	if paren {
+		p.emit(t.IDCloseParen)
+		p.depth--
+	}
+}
+
+func (p *printer) typeExpr(n *a.TypeExpr) {
+	if n == nil {
+		return
+	}
+	p.sync(n.AsNode())
+	switch d := n.Decorator(); d {
+	case 0:
+		if pkg := n.QID()[0]; pkg != 0 {
+			p.emit(pkg)
+			p.emit(t.IDDot)
+		}
+		p.emit(n.QID()[1])
+		if n.Min() != nil || n.Max() != nil {
+			p.emit(t.IDOpenBracket)
+			p.depth++
+			p.expr(n.Min(), false)
+			p.emit(t.IDDotDot)
+			p.expr(n.Max(), false)
+			p.emit(t.IDCloseBracket)
+			p.depth--
+		}
+
+	case t.IDArray:
+		p.emit(t.IDArray)
+		p.emit(t.IDOpenBracket)
+		p.depth++
+		p.expr(n.ArrayLength(), false)
+		p.emit(t.IDCloseBracket)
+		p.depth--
+		p.typeExpr(n.Inner())
+
+	case t.IDNptr, t.IDPtr, t.IDSlice, t.IDTable:
+		p.emit(d)
+		p.typeExpr(n.Inner())
+
+	default:
+		p.fail("unexpected type decorator %q", p.tm.ByID(d))
+	}
+}
@@ -12,12 +12,13 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
+// Package render formats Wuffs source code.
+//
+// RenderFile walks an *ast.File. Render works on the flat token stream and is
+// kept for callers that have no AST, such as for source code that doesn't
+// parse.
 package render
 
-// TODO: render an *ast.Node instead of a []token.Token, as this will better
-// allow automated refactoring tools, not just automated formatting. For now,
-// rendering tokens is easier, especially with respect to tracking comments.
-
 import (
 	"errors"
 	"io"
@@ -27,7 +28,38 @@ import (
 
 var newLine = []byte{'\n'}
 
+// tabWidth is the number of columns that a tab counts for when measuring a
+// line's width.
+const tabWidth = 8
+
+// token is a t.Token plus layout hints.
+type token struct {
+	t.Token
+
+	// pad is the number of extra spaces before the token, used to align
+	// columns.
+	pad uint32
+
+	// brk, if non-zero, means that an over-long line may be broken before
+	// this token. Lower values are preferred, so that a line is broken at
+	// the outermost level of nesting first.
+	brk uint32
+}
+
+// Render writes the src tokens, and the comments (indexed by line number),
+// formatted, to w. The line breaks are those of src.
 func Render(w io.Writer, tm *t.Map, src []t.Token, comments []string) (err error) {
+	toks := make([]token, len(src))
+	for i, x := range src {
+		toks[i].Token = x
+	}
+	return render(w, tm, toks, comments, 0)
+}
+
+// render is like Render but with layout hints. If width is positive, lines
+// (not counting any trailing comment) longer than that are broken where the
+// brk hints allow.
+func render(w io.Writer, tm *t.Map, src []token, comments []string, width int) (err error) {
 	if len(src) == 0 {
 		return nil
 	}
@@ -38,6 +70,7 @@ func Render(w io.Writer, tm *t.Map, src []t.Token, comments []string) (err error
 	commentLine := uint32(0)
 	prevLine := src[0].Line - 1
 	prevLineHanging := false
+	starts, ends := []int(nil), []int(nil)
 
 	for len(src) > 0 {
 		// Find the tokens in this line.
@@ -102,9 +135,11 @@ func Render(w io.Writer, tm *t.Map, src []t.Token, comments []string) (err error
 		} else if hanging && lineTokens[0].ID != t.IDOpenCurly {
 			indentAdjustment++
 		}
-		buf = appendTabs(buf, indent+indentAdjustment)
+		tabs := indent + indentAdjustment
+		buf = appendTabs(buf, tabs)
 
 		// Render the lineTokens.
+		starts, ends = starts[:0], ends[:0]
 		prevID, prevIsTightRight := t.ID(0), false
 		for _, tok := range lineTokens {
 			if prevID != 0 && !prevIsTightRight && !tok.ID.IsTightLeft() {
@@ -114,8 +149,13 @@ func Render(w io.Writer, tm *t.Map, src []t.Token, comments []string) (err error
 					buf = append(buf, ' ')
 				}
 			}
+			for i := uint32(0); i < tok.pad; i++ {
+				buf = append(buf, ' ')
+			}
 
+			starts = append(starts, len(buf))
 			buf = append(buf, tm.ByID(tok.ID)...)
+			ends = append(ends, len(buf))
 
 			if tok.ID == t.IDOpenCurly {
 				if indent == maxIndent {
@@ -141,6 +181,12 @@ func Render(w io.Writer, tm *t.Map, src []t.Token, comments []string) (err error
 			prevID = tok.ID
 		}
 
+		if width > 0 {
+			if buf, err = breakLongLine(w, buf, lineTokens, starts, ends, tabs, width); err != nil {
+				return err
+			}
+		}
+
 		buf = appendComment(buf, comments, line, 0, false)
 		buf = append(buf, '\n')
 		if _, err = w.Write(buf); err != nil {
@@ -172,6 +218,61 @@ func Render(w io.Writer, tm *t.Map, src []t.Token, comments []string) (err error
 	return nil
 }
 
+// breakLongLine writes all but the last piece of an over-long line to w, and
+// returns that last piece. The line, with the given number of leading tabs,
+// is in buf. The byte offsets of the toks' text are in starts and ends.
+//
+// Each continuation line is indented one more tab than the line's first
+// piece, the same as for a line that continues a statement in the source.
+func breakLongLine(w io.Writer, buf []byte, toks []token, starts []int, ends []int, tabs int, width int) ([]byte, error) {
+	if tabs < 0 {
+		tabs = 0
+	}
+	lineStart, contTabs := tabs, tabs+1
+	for len(toks) > 1 && tabs*tabWidth+ends[len(ends)-1]-lineStart > width {
+		// Pick the break point: of those with the lowest brk value, the
+		// right-most that keeps this piece within width or, if none do, the
+		// left-most, to overflow by as little as possible.
+		minBrk := uint32(0)
+		for _, tok := range toks[1:] {
+			if tok.brk != 0 && (minBrk == 0 || minBrk > tok.brk) {
+				minBrk = tok.brk
+			}
+		}
+		if minBrk == 0 {
+			break
+		}
+		k := -1
+		for j := 1; j < len(toks); j++ {
+			if toks[j].brk != minBrk {
+				continue
+			}
+			if k < 0 || tabs*tabWidth+ends[j-1]-lineStart <= width {
+				k = j
+			} else {
+				break
+			}
+		}
+
+		if _, err := w.Write(append(buf[:ends[k-1]], '\n')); err != nil {
+			return nil, err
+		}
+		rest := buf[starts[k]:]
+		tabs = contTabs
+		newBuf := appendTabs(make([]byte, 0, len(rest)+tabs), tabs)
+		lineStart = len(newBuf)
+		shift := lineStart - starts[k]
+		newBuf = append(newBuf, rest...)
+		buf = newBuf
+		toks, starts, ends = toks[k:], starts[k:], ends[k:]
+		for j := range starts {
+			starts[j] += shift
+			ends[j] += shift
+		}
+	}
+	return buf, nil
+}
+
 func appendComment(buf []byte, comments []string, line uint32, indent int, otherwiseEmpty bool) []byte {
 	if uint(line) < uint(len(comments)) {
 		if com := comments[line]; com != "" {
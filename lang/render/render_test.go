@@ -0,0 +1,263 @@
+// Copyright 2017 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/wuffs/lang/parse"
+
+	t "github.com/google/wuffs/lang/token"
+)
+
+func renderFile(filename string, src []byte, opts *Options) (string, error) {
+	tm := &t.Map{}
+	tokens, comments, err := t.Tokenize(tm, filename, src)
+	if err != nil {
+		return "", err
+	}
+	f, err := parse.Parse(tm, filename, tokens, &parse.Options{
+		AllowDoubleUnderscoreNames: true,
+		SortAsserts:                opts != nil && opts.SortUses,
+	})
+	if err != nil {
+		return "", err
+	}
+	buf := &bytes.Buffer{}
+	if err := RenderFile(buf, tm, tokens, comments, f, opts); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func TestRenderFileStd(tt *testing.T) {
+	filenames, err := filepath.Glob("../../std/*/*.wuffs")
+	if err != nil {
+		tt.Fatalf("Glob: %v", err)
+	}
+	if len(filenames) == 0 {
+		tt.Fatalf("no std files found")
+	}
+	for _, filename := range filenames {
+		src, err := ioutil.ReadFile(filename)
+		if err != nil {
+			tt.Fatalf("ReadFile: %v", err)
+		}
+		got, err := renderFile(filename, src, nil)
+		if err != nil {
+			tt.Errorf("%s: %v", filename, err)
+			continue
+		}
+		if want := string(src); got != want {
+			gotLines, wantLines := strings.Split(got, "\n"), strings.Split(want, "\n")
+			for i := 0; ; i++ {
+				if i == len(gotLines) || i == len(wantLines) || gotLines[i] != wantLines[i] {
+					g, w := "EOF", "EOF"
+					if i < len(gotLines) {
+						g = gotLines[i]
+					}
+					if i < len(wantLines) {
+						w = wantLines[i]
+					}
+					tt.Errorf("%s:%d: round trip:\ngot  %q\nwant %q", filename, i+1, g, w)
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestRenderFile(tt *testing.T) {
+	testCases := []struct {
+		opts Options
+		src  string
+		want string
+	}{{
+		// Redundant parentheses are dropped, required ones are kept.
+		src: "pri func foo()() {\n" +
+			"\tvar x base.u32 = ((1))\n" +
+			"\tx = (x + 2) * (x)\n" +
+			"\tx = -(x)\n" +
+			"}\n",
+		want: "pri func foo()() {\n" +
+			"\tvar x base.u32 = 1\n" +
+			"\tx = (x + 2) * x\n" +
+			"\tx = -x\n" +
+			"}\n",
+	}, {
+		// Comments are kept, including those inside a multi-line statement.
+		src: "// Leading.\n" +
+			"pri func foo()() {  // Trailing.\n" +
+			"\tvar x base.u32 = 1 +  // One.\n" +
+			"\t\t2  // Two.\n" +
+			"\n" +
+			"\t// Last.\n" +
+			"}\n",
+		want: "// Leading.\n" +
+			"pri func foo()() {  // Trailing.\n" +
+			"\tvar x base.u32 = 1 +  // One.\n" +
+			"\t\t2  // Two.\n" +
+			"\n" +
+			"\t// Last.\n" +
+			"}\n",
+	}, {
+		// A multi-line list gets a trailing comma.
+		src: "pri const c array[3] base.u8 = $(\n" +
+			"\t1, 2,\n" +
+			"\t3)\n",
+		want: "pri const c array[3] base.u8 = $(\n" +
+			"\t1, 2,\n" +
+			"\t3)\n",
+	}, {
+		src:  "pri const c array[3] base.u8 = $(1, 2, 3,)\n",
+		want: "pri const c array[3] base.u8 = $(1, 2, 3)\n",
+	}, {
+		// Field alignment.
+		opts: Options{AlignFields: true},
+		src: "pri struct foo(\n" +
+			"\ta base.u32,\n" +
+			"\t// Comment.\n" +
+			"\tbcd base.u8,\n" +
+			"\n" +
+			"\tef base.u8,\n" +
+			"\tg base.u8,\n" +
+			")\n" +
+			"pri func foo.bar(x base.u32, yy base.u32)() {\n" +
+			"}\n",
+		want: "pri struct foo(\n" +
+			"\ta   base.u32,\n" +
+			"\t// Comment.\n" +
+			"\tbcd base.u8,\n" +
+			"\n" +
+			"\tef base.u8,\n" +
+			"\tg  base.u8,\n" +
+			")\n" +
+			"pri func foo.bar(x base.u32, yy base.u32)() {\n" +
+			"}\n",
+	}, {
+		// Empty else blocks, with or without a comment, are kept.
+		src: "pri func foo(x base.u32)() {\n" +
+			"\tif in.x > 0 {\n" +
+			"\t\treturn\n" +
+			"\t} else {\n" +
+			"\t\t// Nothing to do.\n" +
+			"\t}\n" +
+			"\tif in.x > 1 {\n" +
+			"\t} else {\n" +
+			"\t}\n" +
+			"}\n",
+		want: "pri func foo(x base.u32)() {\n" +
+			"\tif in.x > 0 {\n" +
+			"\t\treturn\n" +
+			"\t} else {\n" +
+			"\t\t// Nothing to do.\n" +
+			"\t}\n" +
+			"\tif in.x > 1 {\n" +
+			"\t} else {\n" +
+			"\t}\n" +
+			"}\n",
+	}, {
+		// Reflow.
+		opts: Options{Width: 44},
+		src: "pri func foo()() {\n" +
+			"\tvar x base.u32 = (this.alpha + this.beta) * (this.gamma + this.delta)\n" +
+			"\tthis.f!(a:this.alpha, b:this.beta, c:this.gamma)  // Call.\n" +
+			"}\n",
+		want: "pri func foo()() {\n" +
+			"\tvar x base.u32 =\n" +
+			"\t\t(this.alpha + this.beta) *\n" +
+			"\t\t(this.gamma + this.delta)\n" +
+			"\tthis.f!(a:this.alpha, b:this.beta,\n" +
+			"\t\tc:this.gamma)  // Call.\n" +
+			"}\n",
+	}, {
+		// Sorting use lines and assertion chains.
+		opts: Options{SortUses: true},
+		src: "use \"std/zlib\"\n" +
+			"use \"std/crc32\"\n" +
+			"\n" +
+			"use \"std/b\"\n" +
+			"use \"std/a\"\n" +
+			"\n" +
+			"pri func foo()() {\n" +
+			"\twhile true,\n" +
+			"\t\tpost true,\n" +
+			"\t\tpre true,\n" +
+			"\t{\n" +
+			"\t}\n" +
+			"\twhile true, inv true, pre true {\n" +
+			"\t}\n" +
+			"}\n",
+		want: "use \"std/crc32\"\n" +
+			"use \"std/zlib\"\n" +
+			"\n" +
+			"use \"std/a\"\n" +
+			"use \"std/b\"\n" +
+			"\n" +
+			"pri func foo()() {\n" +
+			"\twhile true,\n" +
+			"\t\tpre true,\n" +
+			"\t\tpost true,\n" +
+			"\t{\n" +
+			"\t}\n" +
+			"\twhile true, pre true, inv true {\n" +
+			"\t}\n" +
+			"}\n",
+	}, {
+		// Comments move with the use lines and assertions that they annotate.
+		opts: Options{SortUses: true},
+		src: "use \"std/zlib\"  // Z.\n" +
+			"// About crc32.\n" +
+			"use \"std/crc32\"  // C.\n" +
+			"\n" +
+			"pri func foo()() {\n" +
+			"\twhile true,\n" +
+			"\t\t// Afterwards.\n" +
+			"\t\tpost true,  // Post.\n" +
+			"\t\tpre true,  // Pre.\n" +
+			"\t{\n" +
+			"\t}\n" +
+			"}\n",
+		want: "// About crc32.\n" +
+			"use \"std/crc32\"  // C.\n" +
+			"use \"std/zlib\"  // Z.\n" +
+			"\n" +
+			"pri func foo()() {\n" +
+			"\twhile true,\n" +
+			"\t\tpre true,  // Pre.\n" +
+			"\t\t// Afterwards.\n" +
+			"\t\tpost true,  // Post.\n" +
+			"\t{\n" +
+			"\t}\n" +
+			"}\n",
+	}}
+
+	for i, tc := range testCases {
+		src := "packageid \"test\"\n\n" + tc.src
+		want := "packageid \"test\"\n\n" + tc.want
+		got, err := renderFile("test.wuffs", []byte(src), &tc.opts)
+		if err != nil {
+			tt.Errorf("test case #%d: %v", i, err)
+			continue
+		}
+		if got != want {
+			tt.Errorf("test case #%d:\ngot:\n%s\nwant:\n%s", i, got, want)
+		}
+	}
+}
@@ -172,10 +172,18 @@ func (x QQID) Str(m *Map) string {
 	return m.ByID(x[2])
 }
 
-// Token combines an ID and the line number it was seen.
+// Token combines an ID and the position it was seen.
 type Token struct {
 	ID   ID
 	Line uint32
+	// Col is the 1-based column of the token's first byte. Columns count
+	// bytes, not runes, and a tab is one column.
+	Col uint32
+	// Pos and End are the byte offsets, in the source, of the token's first
+	// byte and one past its last byte. For an implicit semi-colon, they are
+	// both the offset of the '\n'.
+	Pos uint32
+	End uint32
 }
 
 // nBuiltInIDs is the number of built-in IDs. The packing is:
@@ -236,8 +244,9 @@ const (
 	IDTildeModShiftLEq = ID(0x1A)
 	IDTildeModPlusEq   = ID(0x1B)
 	IDTildeModMinusEq  = ID(0x1C)
-	IDTildeSatPlusEq   = ID(0x1D)
-	IDTildeSatMinusEq  = ID(0x1E)
+	IDTildeModStarEq   = ID(0x1D)
+	IDTildeSatPlusEq   = ID(0x1E)
+	IDTildeSatMinusEq  = ID(0x1F)
 
 	IDEq      = ID(0x2E)
 	IDEqColon = ID(0x2F)
@@ -264,8 +273,9 @@ const (
 	IDTildeModShiftL = ID(0x3A)
 	IDTildeModPlus   = ID(0x3B)
 	IDTildeModMinus  = ID(0x3C)
-	IDTildeSatPlus   = ID(0x3D)
-	IDTildeSatMinus  = ID(0x3E)
+	IDTildeModStar   = ID(0x3D)
+	IDTildeSatPlus   = ID(0x3E)
+	IDTildeSatMinus  = ID(0x3F)
 
 	IDNotEq       = ID(0x40)
 	IDLessThan    = ID(0x41)
@@ -305,25 +315,26 @@ const (
 	IDXBinaryTildeModShiftL = ID(0x62)
 	IDXBinaryTildeModPlus   = ID(0x63)
 	IDXBinaryTildeModMinus  = ID(0x64)
-	IDXBinaryTildeSatPlus   = ID(0x65)
-	IDXBinaryTildeSatMinus  = ID(0x66)
-	IDXBinaryNotEq          = ID(0x67)
-	IDXBinaryLessThan       = ID(0x68)
-	IDXBinaryLessEq         = ID(0x69)
-	IDXBinaryEqEq           = ID(0x6A)
-	IDXBinaryGreaterEq      = ID(0x6B)
-	IDXBinaryGreaterThan    = ID(0x6C)
-	IDXBinaryAnd            = ID(0x6D)
-	IDXBinaryOr             = ID(0x6E)
-	IDXBinaryAs             = ID(0x6F)
-
-	IDXAssociativePlus = ID(0x70)
-	IDXAssociativeStar = ID(0x71)
-	IDXAssociativeAmp  = ID(0x72)
-	IDXAssociativePipe = ID(0x73)
-	IDXAssociativeHat  = ID(0x74)
-	IDXAssociativeAnd  = ID(0x75)
-	IDXAssociativeOr   = ID(0x76)
+	IDXBinaryTildeModStar   = ID(0x65)
+	IDXBinaryTildeSatPlus   = ID(0x66)
+	IDXBinaryTildeSatMinus  = ID(0x67)
+	IDXBinaryNotEq          = ID(0x68)
+	IDXBinaryLessThan       = ID(0x69)
+	IDXBinaryLessEq         = ID(0x6A)
+	IDXBinaryEqEq           = ID(0x6B)
+	IDXBinaryGreaterEq      = ID(0x6C)
+	IDXBinaryGreaterThan    = ID(0x6D)
+	IDXBinaryAnd            = ID(0x6E)
+	IDXBinaryOr             = ID(0x6F)
+	IDXBinaryAs             = ID(0x70)
+
+	IDXAssociativePlus = ID(0x71)
+	IDXAssociativeStar = ID(0x72)
+	IDXAssociativeAmp  = ID(0x73)
+	IDXAssociativePipe = ID(0x74)
+	IDXAssociativeHat  = ID(0x75)
+	IDXAssociativeAnd  = ID(0x76)
+	IDXAssociativeOr   = ID(0x77)
 )
 
 const (
@@ -356,6 +367,8 @@ const (
 	IDIterate    = ID(0x96)
 	IDYield      = ID(0x97)
 	IDIOBind     = ID(0x98)
+	IDDepth      = ID(0x99)
+	IDLemma      = ID(0x9A)
 )
 
 const (
@@ -529,6 +542,14 @@ const (
 	IDCopyNFromReader      = ID(0x193)
 	IDCopyNFromSlice       = ID(0x194)
 
+	IDReadI8    = ID(0x1A1)
+	IDReadI16BE = ID(0x1A2)
+	IDReadI16LE = ID(0x1A3)
+	IDReadI32BE = ID(0x1A4)
+	IDReadI32LE = ID(0x1A5)
+	IDReadI64BE = ID(0x1A6)
+	IDReadI64LE = ID(0x1A7)
+
 	// -------- 0x200 block.
 
 	IDReset  = ID(0x200)
@@ -586,6 +607,7 @@ var builtInsByID = [nBuiltInIDs]string{
 	IDTildeModShiftLEq: "~mod<<=",
 	IDTildeModPlusEq:   "~mod+=",
 	IDTildeModMinusEq:  "~mod-=",
+	IDTildeModStarEq:   "~mod*=",
 	IDTildeSatPlusEq:   "~sat+=",
 	IDTildeSatMinusEq:  "~sat-=",
 
@@ -605,6 +627,7 @@ var builtInsByID = [nBuiltInIDs]string{
 	IDTildeModShiftL: "~mod<<",
 	IDTildeModPlus:   "~mod+",
 	IDTildeModMinus:  "~mod-",
+	IDTildeModStar:   "~mod*",
 	IDTildeSatPlus:   "~sat+",
 	IDTildeSatMinus:  "~sat-",
 
@@ -647,6 +670,8 @@ var builtInsByID = [nBuiltInIDs]string{
 	IDIterate:    "iterate",
 	IDYield:      "yield",
 	IDIOBind:     "io_bind",
+	IDDepth:      "depth",
+	IDLemma:      "lemma",
 
 	IDArray: "array",
 	IDNptr:  "nptr",
@@ -816,6 +841,14 @@ var builtInsByID = [nBuiltInIDs]string{
 	IDCopyNFromReader:      "copy_n_from_reader",
 	IDCopyNFromSlice:       "copy_n_from_slice",
 
+	IDReadI8:    "read_i8",
+	IDReadI16BE: "read_i16be",
+	IDReadI16LE: "read_i16le",
+	IDReadI32BE: "read_i32be",
+	IDReadI32LE: "read_i32le",
+	IDReadI64BE: "read_i64be",
+	IDReadI64LE: "read_i64le",
+
 	// -------- 0x200 block.
 
 	IDReset:  "reset",
@@ -942,6 +975,8 @@ var lexers = [256][]suffixLexer{
 		{"mod+", IDTildeModPlus},
 		{"mod-=", IDTildeModMinusEq},
 		{"mod-", IDTildeModMinus},
+		{"mod*=", IDTildeModStarEq},
+		{"mod*", IDTildeModStar},
 		{"sat+=", IDTildeSatPlusEq},
 		{"sat+", IDTildeSatPlus},
 		{"sat-=", IDTildeSatMinusEq},
@@ -969,6 +1004,7 @@ var ambiguousForms = [nBuiltInSymbolicIDs]ID{
 	IDXBinaryTildeModShiftL: IDTildeModShiftL,
 	IDXBinaryTildeModPlus:   IDTildeModPlus,
 	IDXBinaryTildeModMinus:  IDTildeModMinus,
+	IDXBinaryTildeModStar:   IDTildeModStar,
 	IDXBinaryTildeSatPlus:   IDTildeSatPlus,
 	IDXBinaryTildeSatMinus:  IDTildeSatMinus,
 	IDXBinaryNotEq:          IDNotEq,
@@ -1038,6 +1074,7 @@ var binaryForms = [nBuiltInSymbolicIDs]ID{
 	IDTildeModShiftLEq: IDXBinaryTildeModShiftL,
 	IDTildeModPlusEq:   IDXBinaryTildeModPlus,
 	IDTildeModMinusEq:  IDXBinaryTildeModMinus,
+	IDTildeModStarEq:   IDXBinaryTildeModStar,
 	IDTildeSatPlusEq:   IDXBinaryTildeSatPlus,
 	IDTildeSatMinusEq:  IDXBinaryTildeSatMinus,
 
@@ -1054,6 +1091,7 @@ var binaryForms = [nBuiltInSymbolicIDs]ID{
 	IDTildeModShiftL: IDXBinaryTildeModShiftL,
 	IDTildeModPlus:   IDXBinaryTildeModPlus,
 	IDTildeModMinus:  IDXBinaryTildeModMinus,
+	IDTildeModStar:   IDXBinaryTildeModStar,
 	IDTildeSatPlus:   IDXBinaryTildeSatPlus,
 	IDTildeSatMinus:  IDXBinaryTildeSatMinus,
 
@@ -1074,7 +1112,7 @@ var associativeForms = [nBuiltInSymbolicIDs]ID{
 	IDAmp:  IDXAssociativeAmp,
 	IDPipe: IDXAssociativePipe,
 	IDHat:  IDXAssociativeHat,
-	// TODO: IDTildeModPlus, IDTildeSatPlus?
+	// TODO: IDTildeModPlus, IDTildeModStar, IDTildeSatPlus?
 	IDAnd: IDXAssociativeAnd,
 	IDOr:  IDXAssociativeOr,
 }
@@ -23,6 +23,7 @@ const (
 	maxID        = 1048575
 	maxLine      = 1048575
 	maxTokenSize = 1023
+	maxSrcSize   = 0xFFFFFFFF
 )
 
 func Unescape(s string) (unescaped string, ok bool) {
@@ -114,7 +115,20 @@ func hasPrefix(a []byte, s string) bool {
 }
 
 func Tokenize(m *Map, filename string, src []byte) (tokens []Token, comments []string, retErr error) {
-	line := uint32(1)
+	if uint64(len(src)) > maxSrcSize {
+		return nil, nil, fmt.Errorf("token: source too large in %q", filename)
+	}
+	line, lineStart := uint32(1), 0
+	// tok returns the Token for the src[i:j] bytes.
+	tok := func(id ID, i int, j int) Token {
+		return Token{
+			ID:   id,
+			Line: line,
+			Col:  uint32(i-lineStart) + 1,
+			Pos:  uint32(i),
+			End:  uint32(j),
+		}
+	}
 loop:
 	for i := 0; i < len(src); {
 		c := src[i]
@@ -122,12 +136,13 @@ loop:
 		if c <= ' ' {
 			if c == '\n' {
 				if len(tokens) > 0 && tokens[len(tokens)-1].ID.IsImplicitSemicolon(m) {
-					tokens = append(tokens, Token{IDSemicolon, line})
+					tokens = append(tokens, tok(IDSemicolon, i, i))
 				}
 				if line == maxLine {
 					return nil, nil, fmt.Errorf("token: too many lines in %q", filename)
 				}
 				line++
+				lineStart = i + 1
 			}
 			i++
 			continue
@@ -145,24 +160,24 @@ loop:
 					break
 				}
 				if c == '\\' {
-					return nil, nil, fmt.Errorf("token: backslash in string at %s:%d", filename, line)
+					return nil, nil, fmt.Errorf("token: backslash in string at %s:%d:%d", filename, line, i-lineStart+1)
 				}
 				if c == '\n' {
-					return nil, nil, fmt.Errorf("token: expected final '\"' in string at %s:%d", filename, line)
+					return nil, nil, fmt.Errorf("token: expected final '\"' in string at %s:%d:%d", filename, line, i-lineStart+1)
 				}
 				if c < ' ' {
-					return nil, nil, fmt.Errorf("token: control character in string at %s:%d", filename, line)
+					return nil, nil, fmt.Errorf("token: control character in string at %s:%d:%d", filename, line, i-lineStart+1)
 				}
 				// The -1 is because we still haven't seen the final '"'.
 				if j-i == maxTokenSize-1 {
-					return nil, nil, fmt.Errorf("token: string too long at %s:%d", filename, line)
+					return nil, nil, fmt.Errorf("token: string too long at %s:%d:%d", filename, line, i-lineStart+1)
 				}
 			}
 			id, err := m.Insert(string(src[i:j]))
 			if err != nil {
 				return nil, nil, err
 			}
-			tokens = append(tokens, Token{id, line})
+			tokens = append(tokens, tok(id, i, j))
 			i = j
 			continue
 		}
@@ -171,14 +186,14 @@ loop:
 			j := i + 1
 			for ; j < len(src) && alphaNumeric(src[j]); j++ {
 				if j-i == maxTokenSize {
-					return nil, nil, fmt.Errorf("token: identifier too long at %s:%d", filename, line)
+					return nil, nil, fmt.Errorf("token: identifier too long at %s:%d:%d", filename, line, i-lineStart+1)
 				}
 			}
 			id, err := m.Insert(string(src[i:j]))
 			if err != nil {
 				return nil, nil, err
 			}
-			tokens = append(tokens, Token{id, line})
+			tokens = append(tokens, tok(id, i, j))
 			i = j
 			continue
 		}
@@ -192,19 +207,19 @@ loop:
 				if next := src[j]; next == 'x' || next == 'X' {
 					j, isDigit = j+1, hexaNumeric
 				} else if numeric(next) {
-					return nil, nil, fmt.Errorf("token: legacy octal syntax at %s:%d", filename, line)
+					return nil, nil, fmt.Errorf("token: legacy octal syntax at %s:%d:%d", filename, line, i-lineStart+1)
 				}
 			}
 			for ; j < len(src) && isDigit(src[j]); j++ {
 				if j-i == maxTokenSize {
-					return nil, nil, fmt.Errorf("token: constant too long at %s:%d", filename, line)
+					return nil, nil, fmt.Errorf("token: constant too long at %s:%d:%d", filename, line, i-lineStart+1)
 				}
 			}
 			id, err := m.Insert(string(src[i:j]))
 			if err != nil {
 				return nil, nil, err
 			}
-			tokens = append(tokens, Token{id, line})
+			tokens = append(tokens, tok(id, i, j))
 			i = j
 			continue
 		}
@@ -222,14 +237,15 @@ loop:
 		}
 
 		if id := squiggles[c]; id != 0 {
+			tokens = append(tokens, tok(id, i, i+1))
 			i++
-			tokens = append(tokens, Token{id, line})
 			continue
 		}
 		for _, x := range lexers[c] {
 			if hasPrefix(src[i+1:], x.suffix) {
-				i += len(x.suffix) + 1
-				tokens = append(tokens, Token{x.id, line})
+				j := i + len(x.suffix) + 1
+				tokens = append(tokens, tok(x.id, i, j))
+				i = j
 				continue loop
 			}
 		}
@@ -240,7 +256,7 @@ loop:
 		} else {
 			msg = fmt.Sprintf("non-ASCII byte '\\x%02X'", c)
 		}
-		return nil, nil, fmt.Errorf("token: unrecognized %s at %s:%d", msg, filename, line)
+		return nil, nil, fmt.Errorf("token: unrecognized %s at %s:%d:%d", msg, filename, line, i-lineStart+1)
 	}
 	return tokens, comments, nil
 }
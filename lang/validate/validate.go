@@ -0,0 +1,27 @@
+// Copyright 2018 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// validate holds functions that validate names, such as package paths, that
+// are used by both the Wuffs tools and the language packages.
+package validate
+
+import (
+	"path"
+)
+
+// IsValidUsePath returns whether s is a valid package path, such as
+// "std/deflate", as used by `use` declarations: clean, non-empty and relative.
+func IsValidUsePath(s string) bool {
+	return s == path.Clean(s) && s != "" && s[0] != '.' && s[0] != '/'
+}